@@ -0,0 +1,337 @@
+package profiler
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Signals understood by the agent, these are the single byte commands
+// sent by the gops CLI (github.com/google/gops/signal).
+const (
+	gopsStackTrace   byte = 0x1
+	gopsGC           byte = 0x2
+	gopsMemStats     byte = 0x3
+	gopsVersion      byte = 0x4
+	gopsHeapProfile  byte = 0x5
+	gopsCPUProfile   byte = 0x6
+	gopsStats        byte = 0x7
+	gopsTraceProfile byte = 0x8
+	gopsBinaryDump   byte = 0x9
+	gopsSetGCPercent byte = 0x10
+)
+
+const (
+	// gopsCPUDuration and gopsTraceDuration match the durations used
+	// by the gops agent.
+	gopsCPUDuration   = 30 * time.Second
+	gopsTraceDuration = 5 * time.Second
+	// agentHandshakeTimeout bounds the TLS handshake of a connection.
+	agentHandshakeTimeout = 10 * time.Second
+	// agentReadTimeout bounds the wait for the signal of a connection.
+	agentReadTimeout = 10 * time.Second
+)
+
+// Agent speaks (a subset of) the gops protocol so that the existing
+// `gops pprof-cpu <pid>`, `gops pprof-heap <pid>`, `gops trace <pid>`,
+// `gops stack <pid>` etc workflows work against processes instrumented
+// with this package.  Timed captures reuse the profiler strategies and
+// output management, a copy of each artifact is kept on disk.
+type Agent struct {
+	listener net.Listener
+	portFile string
+	options  []ProfileOption
+	reporter *Profiler
+	ctx      context.Context
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+}
+
+// StartAgent starts listening on addr (for example "127.0.0.1:0") and
+// advertises the port in the gops config directory so that the gops CLI
+// can discover the process.  options are applied to every capture.
+// Close should be invoked to stop the agent and remove the port file.
+func StartAgent(addr string, options ...ProfileOption) (*Agent, error) {
+	dir, err := gopsConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create gops config folder: %w", err)
+	}
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	reporter := New(options...)
+	if reporter.agentTLS != nil {
+		listener = tls.NewListener(listener, reporter.agentTLS)
+	}
+	portFile := filepath.Join(dir, strconv.Itoa(os.Getpid()))
+	if err := os.WriteFile(portFile, []byte(strconv.Itoa(port)), 0644); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to write gops port file: %w", err), listener.Close())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	a := &Agent{listener: listener, portFile: portFile, options: options, reporter: reporter, ctx: ctx, cancel: cancel}
+	a.wg.Add(1)
+	goInternal(a.serve)
+	return a, nil
+}
+
+// Addr returns the address the agent is listening on.
+func (a *Agent) Addr() net.Addr {
+	return a.listener.Addr()
+}
+
+// Close stops the agent, interrupting any capture in progress and
+// removing the advertised port file.
+func (a *Agent) Close() error {
+	a.cancel()
+	err := a.listener.Close()
+	a.wg.Wait()
+	return errors.Join(err, os.Remove(a.portFile))
+}
+
+// serve accepts connections until the listener is closed.  Each
+// connection is handled concurrently, so that a slow or idle client does
+// not stall the others.  Concurrent captures are refused by the session
+// of the capture in progress.
+func (a *Agent) serve() {
+	defer a.wg.Done()
+	for {
+		conn, err := a.listener.Accept()
+		if err != nil {
+			return
+		}
+		a.wg.Add(1)
+		goInternal(func() {
+			defer a.wg.Done()
+			_ = a.handle(conn)
+		})
+	}
+}
+
+// gopsActions names the action of each signal in an AuditEntry.
+var gopsActions = map[byte]string{
+	gopsStackTrace:   "stack",
+	gopsGC:           "gc",
+	gopsMemStats:     "memstats",
+	gopsVersion:      "version",
+	gopsHeapProfile:  MemoryHeapMode.String(),
+	gopsCPUProfile:   CPUMode.String(),
+	gopsStats:        "stats",
+	gopsTraceProfile: TraceMode.String(),
+	gopsBinaryDump:   "binary",
+	gopsSetGCPercent: "setgc",
+}
+
+// handle reads a single signal from conn and writes the response, auditing
+// the request.
+func (a *Agent) handle(conn net.Conn) (err error) {
+	defer func() { err = errors.Join(err, conn.Close()) }()
+	// Close interrupts a client which never sends its signal.
+	stop := context.AfterFunc(a.ctx, func() { _ = conn.Close() })
+	defer stop()
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		// A client which does not speak TLS, such as the gops CLI, would
+		// otherwise stall the handshake and the agent with it.
+		_ = conn.SetDeadline(time.Now().Add(agentHandshakeTimeout))
+		if err := tlsConn.HandshakeContext(a.ctx); err != nil {
+			return err
+		}
+		_ = conn.SetDeadline(time.Time{})
+	}
+	// The deadline also bounds the parameters read by respond.
+	_ = conn.SetReadDeadline(time.Now().Add(agentReadTimeout))
+	signal := make([]byte, 1)
+	if _, err := io.ReadFull(conn, signal); err != nil {
+		return err
+	}
+	entry := AuditEntry{Time: time.Now(), Source: AuditSourceAgent, Requester: conn.RemoteAddr().String(), Action: gopsActions[signal[0]]}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		// Under mTLS the client certificate identifies the requester.
+		if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+			entry.Requester = certs[0].Subject.CommonName + "@" + entry.Requester
+		}
+	}
+	if entry.Action == "" {
+		entry.Action = fmt.Sprintf("unknown(%#x)", signal[0])
+	}
+	a.reporter.auditReceived(a.ctx, entry)
+	err = a.respond(conn, signal[0], &entry)
+	a.reporter.audit(a.ctx, entry, err)
+	return err
+}
+
+// respond writes the response to signal, recording the parameters and
+// artifacts of the request in entry.
+func (a *Agent) respond(conn net.Conn, signal byte, entry *AuditEntry) error {
+	switch signal {
+	case gopsStackTrace:
+		return pprof.Lookup("goroutine").WriteTo(conn, 2)
+	case gopsGC:
+		runtime.GC()
+		_, err := io.WriteString(conn, "ok")
+		return err
+	case gopsMemStats:
+		return writeGopsMemStats(conn)
+	case gopsVersion:
+		_, err := fmt.Fprintf(conn, "%v\n", runtime.Version())
+		return err
+	case gopsHeapProfile:
+		return pprof.Lookup(heapProfileName).WriteTo(conn, 0)
+	case gopsCPUProfile:
+		return a.capture(conn, CPUMode, gopsCPUDuration, entry)
+	case gopsStats:
+		_, err := fmt.Fprintf(conn, "goroutines: %v\nOS threads: %v\nGOMAXPROCS: %v\nnum CPU: %v\n",
+			runtime.NumGoroutine(), pprof.Lookup("threadcreate").Count(), runtime.GOMAXPROCS(0), runtime.NumCPU())
+		return err
+	case gopsTraceProfile:
+		return a.capture(conn, TraceMode, gopsTraceDuration, entry)
+	case gopsBinaryDump:
+		return writeExecutable(conn)
+	case gopsSetGCPercent:
+		var percent int64
+		if err := binary.Read(conn, binary.BigEndian, &percent); err != nil {
+			return err
+		}
+		entry.Params = map[string]string{"percent": strconv.FormatInt(percent, 10)}
+		_, err := fmt.Fprintf(conn, "New GC percent set to %v. Previous value was %v.\n", percent, debug.SetGCPercent(int(percent)))
+		return err
+	default:
+		return fmt.Errorf("unknown gops signal %#x", signal)
+	}
+}
+
+// capture performs a timed capture using the profiler strategies and
+// streams the resulting artifact to w.
+func (a *Agent) capture(w io.Writer, mode Mode, d time.Duration, entry *AuditEntry) error {
+	entry.Params = map[string]string{"duration": d.String()}
+	p, err := Capture(a.ctx, d, append(append([]ProfileOption{}, a.options...), WithMode(mode))...)
+	if err != nil {
+		return err
+	}
+	entry.Artifacts = p.ArtifactPaths()
+	for _, path := range entry.Artifacts {
+		if err := copyFile(w, p.fs, path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// agentSignals are the signals requesting a capture of each mode from an
+// Agent.
+var agentSignals = map[Mode]byte{
+	MemoryHeapMode: gopsHeapProfile,
+	CPUMode:        gopsCPUProfile,
+	TraceMode:      gopsTraceProfile,
+}
+
+// AgentCapture requests a capture of mode from the Agent listening on
+// addr, writing the artifact to w.  Heap profiles are written immediately,
+// cpu and trace captures run for the 30s and 5s used by the gops CLI.
+func AgentCapture(ctx context.Context, addr string, mode Mode, w io.Writer) error {
+	return AgentCaptureTLS(ctx, addr, mode, w, nil)
+}
+
+// AgentCaptureTLS is AgentCapture of an Agent serving TLS (see
+// WithAgentTLS), connecting with config, see ClientTLSConfig.  A nil
+// config connects without TLS.
+func AgentCaptureTLS(ctx context.Context, addr string, mode Mode, w io.Writer, config *tls.Config) error {
+	signal, ok := agentSignals[mode]
+	if !ok {
+		return fmt.Errorf("the agent cannot capture %s profiles", mode)
+	}
+	var conn net.Conn
+	var err error
+	if config != nil {
+		dialer := tls.Dialer{Config: config}
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+	if _, err := conn.Write([]byte{signal}); err != nil {
+		return errors.Join(err, conn.Close())
+	}
+	n, err := io.Copy(w, conn)
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err == nil && n == 0 {
+		// The agent closes the connection without a response if the
+		// capture failed.
+		err = fmt.Errorf("the agent at %s returned no %s artifact", addr, mode)
+	}
+	return errors.Join(err, conn.Close())
+}
+
+// writeGopsMemStats writes runtime.MemStats in the gops text format.
+func writeGopsMemStats(w io.Writer) error {
+	var s runtime.MemStats
+	runtime.ReadMemStats(&s)
+	_, err := fmt.Fprintf(w, "alloc: %v bytes\ntotal-alloc: %v bytes\nsys: %v bytes\nlookups: %v\nmallocs: %v\nfrees: %v\n"+
+		"heap-alloc: %v bytes\nheap-sys: %v bytes\nheap-idle: %v bytes\nheap-in-use: %v bytes\nheap-released: %v bytes\nheap-objects: %v\n"+
+		"stack-in-use: %v bytes\nstack-sys: %v bytes\nnext-gc: when heap-alloc >= %v bytes\nlast-gc: %v\ngc-pause-total: %v\n"+
+		"num-gc: %v\nenable-gc: %v\ndebug-gc: %v\n",
+		s.Alloc, s.TotalAlloc, s.Sys, s.Lookups, s.Mallocs, s.Frees,
+		s.HeapAlloc, s.HeapSys, s.HeapIdle, s.HeapInuse, s.HeapReleased, s.HeapObjects,
+		s.StackInuse, s.StackSys, s.NextGC, time.Unix(0, int64(s.LastGC)), time.Duration(s.PauseTotalNs),
+		s.NumGC, s.EnableGC, s.DebugGC)
+	return err
+}
+
+// writeExecutable copies the running binary to w.
+func writeExecutable(w io.Writer) error {
+	path, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	return copyFile(w, OSFS{}, path)
+}
+
+// copyFile copies the contents of the file at path of fsys to w.
+func copyFile(w io.Writer, fsys FS, path string) (err error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, f.Close()) }()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// gopsConfigDir returns the folder the gops CLI searches for port files,
+// mirroring the lookup order of the gops agent.
+func gopsConfigDir() (string, error) {
+	if dir := os.Getenv("GOPS_CONFIG_DIR"); dir != "" {
+		return dir, nil
+	}
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "gops"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine gops config folder: %w", err)
+	}
+	return filepath.Join(home, ".config", "gops"), nil
+}
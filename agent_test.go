@@ -0,0 +1,93 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentSpeaksGopsProtocol(t *testing.T) {
+	config := t.TempDir()
+	t.Setenv("GOPS_CONFIG_DIR", config)
+	agent, err := StartAgent("127.0.0.1:0", WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	port, err := os.ReadFile(filepath.Join(config, strconv.Itoa(os.Getpid())))
+	assert.NoError(t, err)
+	addr := net.JoinHostPort("127.0.0.1", string(port))
+
+	send := func(signal byte) string {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		if _, err := conn.Write([]byte{signal}); err != nil {
+			t.Fatal(err)
+		}
+		out, err := io.ReadAll(conn)
+		assert.NoError(t, err)
+		return string(out)
+	}
+	assert.Equal(t, runtime.Version()+"\n", send(gopsVersion))
+	assert.Contains(t, send(gopsStats), "goroutines:")
+	assert.Contains(t, send(gopsStackTrace), "goroutine")
+	assert.NotEmpty(t, send(gopsHeapProfile))
+
+	assert.NoError(t, agent.Close())
+	assert.NoFileExists(t, filepath.Join(config, strconv.Itoa(os.Getpid())))
+}
+
+func TestAgentCapture(t *testing.T) {
+	t.Setenv("GOPS_CONFIG_DIR", t.TempDir())
+	agent, err := StartAgent("127.0.0.1:0", WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	require.NoError(t, err)
+	defer agent.Close()
+
+	var b bytes.Buffer
+	require.NoError(t, AgentCapture(context.Background(), agent.Addr().String(), MemoryHeapMode, &b))
+	prof, err := profile.Parse(&b)
+	require.NoError(t, err)
+	assert.NotEmpty(t, prof.SampleType)
+
+	assert.ErrorContains(t, AgentCapture(context.Background(), agent.Addr().String(), BlockMode, &b), "cannot capture block profiles")
+
+	// A capture is interrupted by its context.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, AgentCapture(ctx, agent.Addr().String(), CPUMode, io.Discard), context.DeadlineExceeded)
+}
+
+func TestAgentServesAlongsideIdleConnections(t *testing.T) {
+	t.Setenv("GOPS_CONFIG_DIR", t.TempDir())
+	agent, err := StartAgent("127.0.0.1:0", WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	require.NoError(t, err)
+	defer agent.Close()
+
+	idle, err := net.Dial("tcp", agent.Addr().String())
+	require.NoError(t, err)
+	defer idle.Close()
+
+	conn, err := net.Dial("tcp", agent.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	require.NoError(t, conn.SetDeadline(time.Now().Add(5*time.Second)))
+	_, err = conn.Write([]byte{gopsVersion})
+	require.NoError(t, err)
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Equal(t, runtime.Version()+"\n", string(out))
+}
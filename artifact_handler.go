@@ -0,0 +1,184 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Content types served by ArtifactHandler.
+const (
+	protobufContentType = "application/vnd.google.protobuf"
+	gzipContentType     = "application/gzip"
+	binaryContentType   = "application/octet-stream"
+)
+
+// maxDecompressedSize bounds the memory used to decompress an artifact for
+// a client which does not accept gzip.
+const maxDecompressedSize = 256 << 20
+
+// errDecompressedTooLarge is returned by gunzip when the decompressed
+// artifact exceeds its limit.
+var errDecompressedTooLarge = errors.New("decompressed artifact is too large")
+
+// ListedArtifact describes an artifact listed by ArtifactHandler.
+type ListedArtifact struct {
+	// Name is the slash separated path of the artifact within the folder.
+	Name string `json:"name"`
+	// Size is the size of the artifact in bytes.
+	Size int64 `json:"size"`
+	// Modified is when the artifact was last written.
+	Modified time.Time `json:"modified"`
+}
+
+// ArtifactHandler returns an http.Handler serving the artifacts beneath
+// dir, typically the output of continuous profiling, so that they can be
+// retrieved from remote hosts.  A request for the root lists every
+// artifact as json, any other path downloads that artifact.  Downloads
+// support range requests, so that large traces can be resumed, and
+// conditional requests.  pprof profiles are gzip compressed protobuf, the
+// stored gzip is served unless the client only accepts
+// application/vnd.google.protobuf, in which case it is decompressed, or
+// refused with 406 Not Acceptable if it decompresses beyond 256MiB.  Such
+// clients are refused any artifact which is not a .pprof profile.
+//
+//	http.Handle("/artifacts/", http.StripPrefix("/artifacts", profiler.ArtifactHandler("/var/log/profiles")))
+func ArtifactHandler(dir string) http.Handler {
+	fsys := os.DirFS(dir)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			w.Header().Set("Allow", "GET, HEAD")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name := strings.Trim(path.Clean("/"+r.URL.Path), "/")
+		if name == "" {
+			listArtifacts(w, fsys)
+			return
+		}
+		serveArtifact(w, r, fsys, name)
+	})
+}
+
+// listArtifacts writes every artifact in fsys as json.
+func listArtifacts(w http.ResponseWriter, fsys fs.FS) {
+	artifacts := []ListedArtifact{}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		artifacts = append(artifacts, ListedArtifact{Name: name, Size: info.Size(), Modified: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(artifacts)
+}
+
+// serveArtifact serves the named artifact, negotiating its content type.
+func serveArtifact(w http.ResponseWriter, r *http.Request, fsys fs.FS, name string) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		http.Error(w, "artifact is not seekable", http.StatusInternalServerError)
+		return
+	}
+	var magic [2]byte
+	n, _ := io.ReadFull(content, magic[:])
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	gzipped := n == 2 && magic == [2]byte{0x1f, 0x8b}
+	contentType := binaryContentType
+	if gzipped {
+		contentType = gzipContentType
+	}
+	if acceptsOnly(r, protobufContentType) {
+		// Other artifacts, such as compressed traces, are not protobuf
+		// however they are stored.
+		if path.Ext(name) != ".pprof" {
+			http.Error(w, path.Base(name)+" is not a pprof profile", http.StatusNotAcceptable)
+			return
+		}
+		if gzipped {
+			decompressed, err := gunzip(content, maxDecompressedSize)
+			if errors.Is(err, errDecompressedTooLarge) {
+				http.Error(w, err.Error()+", accept "+gzipContentType, http.StatusNotAcceptable)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			content = decompressed
+		}
+		contentType = protobufContentType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(name)}))
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+// acceptsOnly reports whether the Accept header of r names contentType
+// and does not accept gzip.
+func acceptsOnly(r *http.Request, contentType string) bool {
+	accepted := false
+	for _, value := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(value))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case contentType:
+			accepted = true
+		case gzipContentType, "*/*", "application/*":
+			return false
+		}
+	}
+	return accepted
+}
+
+// gunzip decompresses r into memory, failing with errDecompressedTooLarge
+// rather than reading more than limit bytes.
+func gunzip(r io.Reader, limit int64) (io.ReadSeeker, error) {
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(io.LimitReader(zr, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w, it exceeds %d bytes", errDecompressedTooLarge, limit)
+	}
+	return bytes.NewReader(data), nil
+}
@@ -0,0 +1,116 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func artifactServer(t *testing.T) (*httptest.Server, []byte) {
+	t.Helper()
+	dir := t.TempDir()
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write([]byte("protobuf"))
+	assert.NoError(t, zw.Close())
+	assert.NoError(t, os.MkdirAll(filepath.Join(dir, "cycle"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "cycle", CPUFileName), compressed.Bytes(), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, TraceFileName), []byte("0123456789"), 0o644))
+	server := httptest.NewServer(ArtifactHandler(dir))
+	t.Cleanup(server.Close)
+	return server, compressed.Bytes()
+}
+
+func get(t *testing.T, url string, header map[string]string) (*http.Response, []byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	assert.NoError(t, err)
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	return resp, body
+}
+
+func TestArtifactHandlerLists(t *testing.T) {
+	server, compressed := artifactServer(t)
+	resp, body := get(t, server.URL+"/", nil)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	var artifacts []ListedArtifact
+	assert.NoError(t, json.Unmarshal(body, &artifacts))
+	assert.Len(t, artifacts, 2)
+	assert.Equal(t, "cycle/cpu.pprof", artifacts[0].Name)
+	assert.Equal(t, int64(len(compressed)), artifacts[0].Size)
+	assert.Equal(t, TraceFileName, artifacts[1].Name)
+}
+
+func TestArtifactHandlerRange(t *testing.T) {
+	server, _ := artifactServer(t)
+	resp, body := get(t, server.URL+"/trace.out", map[string]string{"Range": "bytes=2-5"})
+	assert.Equal(t, http.StatusPartialContent, resp.StatusCode)
+	assert.Equal(t, "2345", string(body))
+	assert.Equal(t, binaryContentType, resp.Header.Get("Content-Type"))
+}
+
+func TestArtifactHandlerNegotiatesContentType(t *testing.T) {
+	server, compressed := artifactServer(t)
+	resp, body := get(t, server.URL+"/cycle/cpu.pprof", nil)
+	assert.Equal(t, gzipContentType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, compressed, body)
+
+	resp, body = get(t, server.URL+"/cycle/cpu.pprof", map[string]string{"Accept": protobufContentType})
+	assert.Equal(t, protobufContentType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, "protobuf", string(body))
+}
+
+func TestArtifactHandlerRefusesOtherArtifactsAsProtobuf(t *testing.T) {
+	dir := t.TempDir()
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write([]byte("trace"))
+	assert.NoError(t, zw.Close())
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, TraceFileName+".gz"), compressed.Bytes(), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, TraceFileName), []byte("trace"), 0o644))
+	server := httptest.NewServer(ArtifactHandler(dir))
+	defer server.Close()
+	for _, name := range []string{"/trace.out.gz", "/trace.out"} {
+		resp, _ := get(t, server.URL+name, map[string]string{"Accept": protobufContentType})
+		assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode, name)
+	}
+	resp, body := get(t, server.URL+"/trace.out.gz", nil)
+	assert.Equal(t, gzipContentType, resp.Header.Get("Content-Type"))
+	assert.Equal(t, compressed.Bytes(), body)
+}
+
+func TestGunzipLimit(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write([]byte("protobuf"))
+	assert.NoError(t, zw.Close())
+	decompressed, err := gunzip(bytes.NewReader(compressed.Bytes()), 8)
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(decompressed)
+	assert.Equal(t, "protobuf", string(data))
+	_, err = gunzip(bytes.NewReader(compressed.Bytes()), 7)
+	assert.ErrorIs(t, err, errDecompressedTooLarge)
+}
+
+func TestArtifactHandlerNotFound(t *testing.T) {
+	server, _ := artifactServer(t)
+	resp, _ := get(t, server.URL+"/../../etc/passwd", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	resp, _ = get(t, server.URL+"/cycle", nil)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
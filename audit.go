@@ -0,0 +1,203 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Sources of an AuditEntry.
+const (
+	// AuditSourceAgent is a request received by an Agent.
+	AuditSourceAgent = "agent"
+	// AuditSourceCommand is a Command, see RunCommand and ServeCommands.
+	AuditSourceCommand = "command"
+	// AuditSourceRequest is a request traced by a RequestTracer.
+	AuditSourceRequest = "request"
+)
+
+// auditWebhookTimeout bounds the delivery of an entry to a webhook.
+const auditWebhookTimeout = 10 * time.Second
+
+// auditWebhookBacklog bounds the entries awaiting delivery to a webhook,
+// further entries are dropped, and reported, rather than stalling the
+// requests they record.
+const auditWebhookBacklog = 256
+
+// AuditEntry records a request made of the process from outside it, such
+// as a capture requested of its Agent or by a Command, for environments
+// which must account for every use of the control plane.  Every request
+// is recorded as it is received, before it is served, and again with its
+// result once served, so that a request which never completes is still
+// accounted for.
+type AuditEntry struct {
+	// Time is when the request was received.
+	Time time.Time `json:"time"`
+	// Source is the control plane which received the request, such as
+	// AuditSourceAgent.
+	Source string `json:"source"`
+	// Requester identifies who made the request, the remote address of an
+	// agent connection or the requested_by of a command, if known.
+	Requester string `json:"requester,omitempty"`
+	// Action is what was requested, a mode name for captures.
+	Action string `json:"action"`
+	// Params are the parameters of the request, such as its duration.
+	Params map[string]string `json:"params,omitempty"`
+	// Artifacts are the paths of the artifacts written.
+	Artifacts []string `json:"artifacts,omitempty"`
+	// Error is the message of the error of the request, empty if it
+	// succeeded.
+	Error string `json:"error,omitempty"`
+	// Elapsed is how long the request took to serve.
+	Elapsed time.Duration `json:"elapsed_ns"`
+	// Completed is false for the entry recorded as the request is
+	// received, which has no result, and true for the entry recording its
+	// result.
+	Completed bool `json:"completed"`
+}
+
+// AuditHandler records an AuditEntry, a returned error is reported as a
+// warning and passed to the error handler.
+type AuditHandler func(ctx context.Context, entry AuditEntry) error
+
+// WithAuditHandler invokes handler with the AuditEntry of every request
+// served by an Agent, Command or RequestTracer the option is provided to.  This option
+// may be provided multiple times, every handler is invoked in turn.
+func WithAuditHandler(handler AuditHandler) ProfileOption {
+	return func(p *Profiler) {
+		p.auditHandlers = append(p.auditHandlers, handler)
+	}
+}
+
+// WithAuditLog appends each AuditEntry to w as a single line of JSON.  w
+// is typically a file opened with os.O_APPEND, each entry is written with
+// a single call to Write.
+func WithAuditLog(w io.Writer) ProfileOption {
+	var mu sync.Mutex
+	return WithAuditHandler(func(_ context.Context, entry AuditEntry) error {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		_, err = w.Write(append(data, '\n'))
+		return err
+	})
+}
+
+// WithAuditLogger logs each AuditEntry as JSON with the standard logger,
+// even when output is otherwise quiet.
+func WithAuditLogger() ProfileOption {
+	return WithAuditHandler(func(_ context.Context, entry AuditEntry) error {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		log.Printf("audit %s", data)
+		return nil
+	})
+}
+
+// auditDelivery is an entry awaiting delivery to a webhook, along with
+// the profiler which reports a failure to deliver it.
+type auditDelivery struct {
+	ctx      context.Context
+	reporter *Profiler
+	entry    AuditEntry
+}
+
+// WithAuditWebhook POSTs each AuditEntry as JSON to url, a response
+// other than 2xx is an error.  Entries are delivered in order by a
+// goroutine of their own, so that a slow webhook does not delay the
+// requests being audited, failures are reported once delivery fails.
+// Entries beyond a backlog of 256 are dropped and reported.
+func WithAuditWebhook(url string) ProfileOption {
+	var once sync.Once
+	queue := make(chan auditDelivery, auditWebhookBacklog)
+	deliver := func() {
+		for delivery := range queue {
+			if err := postAuditEntry(delivery.ctx, url, delivery.entry); err != nil {
+				delivery.reporter.auditFailed(delivery.entry, err)
+			}
+		}
+	}
+	return func(p *Profiler) {
+		p.auditHandlers = append(p.auditHandlers, func(ctx context.Context, entry AuditEntry) error {
+			once.Do(func() { goInternal(deliver) })
+			// The entry is delivered even if the request which caused it
+			// was interrupted.
+			select {
+			case queue <- auditDelivery{ctx: context.WithoutCancel(ctx), reporter: p, entry: entry}:
+				return nil
+			default:
+				return fmt.Errorf("audit webhook %s has a backlog of %d entries, the entry was dropped", url, auditWebhookBacklog)
+			}
+		})
+	}
+}
+
+// postAuditEntry POSTs entry as JSON to url.
+func postAuditEntry(ctx context.Context, url string, entry AuditEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, auditWebhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("audit webhook %s returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+// auditReceived passes entry, a request which has been received but not
+// yet served, to every audit handler.
+func (p *Profiler) auditReceived(ctx context.Context, entry AuditEntry) {
+	p.auditEntry(ctx, entry)
+}
+
+// audit completes entry with the time elapsed and err, passing it to
+// every audit handler.
+func (p *Profiler) audit(ctx context.Context, entry AuditEntry, err error) {
+	entry.Elapsed = time.Since(entry.Time)
+	entry.Completed = true
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	p.auditEntry(ctx, entry)
+}
+
+// auditEntry passes entry to every audit handler.
+func (p *Profiler) auditEntry(ctx context.Context, entry AuditEntry) {
+	for _, handler := range p.auditHandlers {
+		if err := handler(ctx, entry); err != nil {
+			p.auditFailed(entry, err)
+		}
+	}
+}
+
+// auditFailed reports the failure to audit entry.
+func (p *Profiler) auditFailed(entry AuditEntry, err error) {
+	p.report("[warning] failed to audit %s %s: %s", entry.Source, entry.Action, err)
+	if p.errorHandler != nil {
+		p.errorHandler(err)
+	}
+}
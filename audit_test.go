@@ -0,0 +1,190 @@
+package profiler
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// auditLines decodes the entries of an audit log.
+func auditLines(t *testing.T, r io.Reader) []AuditEntry {
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		var entry AuditEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+	return entries
+}
+
+func TestAuditCommands(t *testing.T) {
+	sub := &stubSubscriber{messages: [][]byte{
+		[]byte(`{"mode": "heap", "duration": "10ms", "reply_to": "results", "selector": {"service": "checkout"}, "requested_by": "alice"}`),
+		[]byte(`{"mode": "unknown"}`),
+		[]byte(`not json`),
+		[]byte(`{"mode": "heap", "selector": {"service": "billing"}}`),
+	}}
+	var log bytes.Buffer
+	tags := map[string]string{"service": "checkout"}
+	err := ServeCommands(context.Background(), sub, nil, WithInstanceTags(tags), WithAuditLog(&log), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	require.NoError(t, err)
+
+	entries := auditLines(t, &log)
+	require.Len(t, entries, 5, "commands targeting other instances are not audited")
+	received, served := entries[0], entries[1]
+	assert.False(t, received.Completed, "the command is recorded before it is served")
+	assert.Equal(t, "alice", received.Requester)
+	assert.Equal(t, "heap", received.Action)
+	assert.Empty(t, received.Artifacts)
+	assert.Zero(t, received.Elapsed)
+	assert.True(t, served.Completed)
+	assert.Equal(t, received.Time, served.Time)
+	assert.Equal(t, AuditSourceCommand, served.Source)
+	assert.Equal(t, "alice", served.Requester)
+	assert.Equal(t, "heap", served.Action)
+	assert.Equal(t, map[string]string{"duration": "10ms", "reply_to": "results", "selector": "service=checkout"}, served.Params)
+	require.Len(t, served.Artifacts, 1)
+	assert.Empty(t, served.Error)
+	assert.Positive(t, served.Elapsed)
+
+	assert.False(t, entries[2].Completed)
+	assert.True(t, entries[3].Completed)
+	assert.Contains(t, entries[3].Error, "unknown profiler mode")
+	assert.Equal(t, "invalid", entries[4].Action)
+	assert.True(t, entries[4].Completed, "a command which cannot be decoded is never served")
+	assert.Contains(t, entries[4].Error, "invalid command")
+}
+
+func TestAuditAgent(t *testing.T) {
+	t.Setenv("GOPS_CONFIG_DIR", t.TempDir())
+	var mu sync.Mutex
+	var entries []AuditEntry
+	handler := func(_ context.Context, entry AuditEntry) error {
+		mu.Lock()
+		defer mu.Unlock()
+		entries = append(entries, entry)
+		return nil
+	}
+	agent, err := StartAgent("127.0.0.1:0", WithAuditHandler(handler), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	require.NoError(t, err)
+	defer agent.Close()
+
+	require.NoError(t, AgentCapture(context.Background(), agent.Addr().String(), MemoryHeapMode, io.Discard))
+	// The entry of the result is recorded after the response is written.
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(entries) == 2
+	}, 5*time.Second, 5*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.False(t, entries[0].Completed)
+	assert.True(t, entries[1].Completed)
+	for _, entry := range entries {
+		assert.Equal(t, AuditSourceAgent, entry.Source)
+		assert.Equal(t, "heap", entry.Action)
+		assert.Contains(t, entry.Requester, "127.0.0.1:")
+	}
+}
+
+func TestAuditWebhook(t *testing.T) {
+	var mu sync.Mutex
+	var received []AuditEntry
+	var errs []error
+	status := http.StatusNoContent
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, auditLines(t, r.Body)...)
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	options := []ProfileOption{
+		WithAuditWebhook(server.URL),
+		WithErrorHandler(func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			errs = append(errs, err)
+		}),
+		WithProfileFileLocation(t.TempDir()),
+		WithQuietOutput(),
+	}
+	count := func() (int, int) {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(received), len(errs)
+	}
+
+	// The command is not delayed by the webhook, which is blocked until
+	// it has returned.
+	RunCommand(context.Background(), Command{Mode: "unknown", RequestedBy: "bob"}, options...)
+	close(release)
+	require.Eventually(t, func() bool { n, _ := count(); return n == 2 }, 5*time.Second, 5*time.Millisecond)
+	mu.Lock()
+	assert.False(t, received[0].Completed)
+	assert.True(t, received[1].Completed)
+	assert.Equal(t, "bob", received[1].Requester)
+	assert.Empty(t, errs)
+	status = http.StatusInternalServerError
+	mu.Unlock()
+
+	RunCommand(context.Background(), Command{Mode: "unknown"}, options...)
+	require.Eventually(t, func() bool { _, n := count(); return n == 2 }, 5*time.Second, 5*time.Millisecond)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.ErrorContains(t, errs[0], "500")
+}
+
+func TestAuditRequestTracer(t *testing.T) {
+	var log bytes.Buffer
+	tracer := NewRequestTracer("", WithAuditLog(&log), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	handler := tracer.Middleware(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	tracer.Arm("abc")
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(RequestIDHeader, "abc")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	entries := auditLines(t, &log)
+	require.Len(t, entries, 2, "only traced requests are audited")
+	assert.False(t, entries[0].Completed)
+	assert.True(t, entries[1].Completed)
+	for _, entry := range entries {
+		assert.Equal(t, AuditSourceRequest, entry.Source)
+		assert.Equal(t, "trace", entry.Action)
+		assert.Equal(t, "192.0.2.1:1234", entry.Requester)
+		assert.Equal(t, map[string]string{"request_id": "abc"}, entry.Params)
+	}
+	require.Len(t, entries[1].Artifacts, 1)
+	assert.Equal(t, TraceFileName, filepath.Base(entries[1].Artifacts[0]))
+	assert.Empty(t, entries[1].Error)
+}
+
+func TestAuditHandlerErrorsAreReported(t *testing.T) {
+	var errs []error
+	failing := func(context.Context, AuditEntry) error { return errors.New("disk full") }
+	RunCommand(context.Background(), Command{Mode: "unknown"}, WithAuditHandler(failing), WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}), WithQuietOutput())
+	require.Len(t, errs, 2, "the received and served entries are both reported")
+	assert.EqualError(t, errs[0], "disk full")
+}
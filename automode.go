@@ -0,0 +1,167 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"runtime/metrics"
+	"slices"
+	"time"
+)
+
+// autoModeObservation is how long WithAutoMode observes the runtime
+// before selecting a profiler.
+var autoModeObservation = 10 * time.Second
+
+// The runtime/metrics observed by WithAutoMode.
+const (
+	userCPUMetric    = "/cpu/classes/user:cpu-seconds"
+	heapObjectMetric = "/memory/classes/heap/objects:bytes"
+	goroutineMetric  = "/sched/goroutines:goroutines"
+	mutexWaitMetric  = "/sync/mutex/wait/total:seconds"
+	heapAllocsMetric = "/gc/heap/allocs:bytes"
+)
+
+func init() {
+	// AutoMode delegates to the other strategies, it cannot be part of
+	// the StrategyMap literal without an initialization cycle.
+	StrategyMap[AutoMode] = autoStrategyFn
+}
+
+// observation is a reading of the runtime signals used to select a mode.
+type observation struct {
+	at         time.Time
+	userCPU    float64
+	heap       uint64
+	goroutines uint64
+	mutexWait  float64
+	allocs     uint64
+}
+
+// observe reads the runtime signals, unsupported metrics read as zero.
+func observe() observation {
+	samples := []metrics.Sample{{Name: userCPUMetric}, {Name: heapObjectMetric}, {Name: goroutineMetric}, {Name: mutexWaitMetric}, {Name: heapAllocsMetric}}
+	metrics.Read(samples)
+	o := observation{at: time.Now()}
+	if samples[0].Value.Kind() == metrics.KindFloat64 {
+		o.userCPU = samples[0].Value.Float64()
+	}
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		o.heap = samples[1].Value.Uint64()
+	}
+	if samples[2].Value.Kind() == metrics.KindUint64 {
+		o.goroutines = samples[2].Value.Uint64()
+	}
+	if samples[3].Value.Kind() == metrics.KindFloat64 {
+		o.mutexWait = samples[3].Value.Float64()
+	}
+	if samples[4].Value.Kind() == metrics.KindUint64 {
+		o.allocs = samples[4].Value.Uint64()
+	}
+	return o
+}
+
+// selection is a mode chosen by auto mode and the reason it was chosen.
+type selection struct {
+	mode   Mode
+	reason string
+}
+
+// selectModes picks every profiler relevant to the symptoms observed
+// between before and after, explaining its reasoning.  At most one of
+// the cpu and clock profilers is picked, as both sample the stacks of the
+// process for the duration of the session, and it is always last.
+func selectModes(before observation, after observation, procs int) []selection {
+	elapsed := after.at.Sub(before.at).Seconds()
+	if elapsed <= 0 {
+		return []selection{{CPUMode, "nothing was observed, defaulting to cpu"}}
+	}
+	var selected []selection
+	if grown := after.goroutines - before.goroutines; after.goroutines > before.goroutines && grown >= 100 && float64(grown) >= float64(before.goroutines)/2 {
+		selected = append(selected, selection{GoroutineMode, fmt.Sprintf("goroutines grew from %d to %d, a goroutine profile shows where they are created and blocked", before.goroutines, after.goroutines)})
+	}
+	if after.heap > before.heap && float64(after.heap-before.heap) >= float64(before.heap)/4 {
+		selected = append(selected, selection{MemoryMode, fmt.Sprintf("the heap grew from %d to %d bytes, a memory profile shows what is retained and allocated", before.heap, after.heap)})
+	}
+	busy := (after.userCPU - before.userCPU) / (elapsed * float64(procs))
+	if busy >= 0.5 {
+		return append(selected, selection{CPUMode, fmt.Sprintf("the process was CPU bound (%.0f%% of GOMAXPROCS busy), a cpu profile shows where the time is spent", busy*100)})
+	}
+	if wait := (after.mutexWait - before.mutexWait) / elapsed; wait >= 0.1 {
+		return append(selected, selection{ClockMode, fmt.Sprintf("goroutines waited %.2fs per second on mutexes, a clock profile shows time spent off CPU", wait)})
+	}
+	if len(selected) == 0 {
+		selected = append(selected, selection{ClockMode, fmt.Sprintf("the process was mostly idle or blocked (%.0f%% of GOMAXPROCS busy), a clock profile shows time spent waiting", busy*100)})
+	}
+	return selected
+}
+
+// autoStrategyFn observes the runtime for autoModeObservation, without
+// blocking the caller, before delegating to the strategies of every mode
+// selected from the symptoms observed.  Nothing is captured if the
+// session is stopped before the observation completes.
+func autoStrategyFn(p *Profiler) (FinalizerFunc, error) {
+	before := observe()
+	return deferStrategy(p, autoModeObservation, "observation", func() (FinalizerFunc, error) {
+		selected := selectModes(before, observe(), runtime.GOMAXPROCS(0))
+		modes := make([]Mode, 0, len(selected))
+		for _, s := range selected {
+			p.report("auto mode selected the %s profiler: %s", s.mode, s.reason)
+			modes = append(modes, s.mode)
+		}
+		p.mu.Lock()
+		p.autoModes = modes
+		p.mu.Unlock()
+		// The session reports the last mode, the cpu or clock profile
+		// when one was selected.
+		p.setMode(modes[len(modes)-1])
+		return startEach(p, modes)
+	}), nil
+}
+
+// startEach starts the strategy of every mode in turn, the profile file
+// bound by each strategy is set aside so that the next does not discard
+// it, and restored before its finalizer runs.  The strategies are
+// finalized in reverse, those already started are finalized if a later
+// strategy fails to start.
+func startEach(p *Profiler, modes []Mode) (FinalizerFunc, error) {
+	type started struct {
+		finalizer FinalizerFunc
+		file      io.WriteCloser
+		path      string
+	}
+	var strategies []started
+	finalize := func() error {
+		var err error
+		for i := len(strategies) - 1; i >= 0; i-- {
+			s := strategies[i]
+			p.mu.Lock()
+			p.profileFile, p.profilePath = s.file, s.path
+			p.mu.Unlock()
+			err = errors.Join(err, s.finalizer())
+		}
+		return err
+	}
+	for _, mode := range modes {
+		p.mu.Lock()
+		p.profileFile, p.profilePath = nil, ""
+		p.mu.Unlock()
+		finalizer, err := StrategyMap[mode](p)
+		if err != nil {
+			return nil, errors.Join(err, finalize())
+		}
+		p.mu.Lock()
+		strategies = append(strategies, started{finalizer: finalizer, file: p.profileFile, path: p.profilePath})
+		p.mu.Unlock()
+	}
+	return finalize, nil
+}
+
+// selectedMode reports whether mode is that of the session, or one of
+// the modes selected by auto mode.
+func (p *Profiler) selectedMode(mode Mode) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.profileMode == mode || slices.Contains(p.autoModes, mode)
+}
@@ -0,0 +1,82 @@
+package profiler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectModes(t *testing.T) {
+	now := time.Now()
+	base := observation{at: now, heap: 1000, goroutines: 10}
+	later := func(o observation) observation {
+		o.at = now.Add(time.Second)
+		return o
+	}
+	tests := map[string]struct {
+		after observation
+		want  []Mode
+	}{
+		"goroutine growth":   {after: later(observation{heap: 1000, goroutines: 500}), want: []Mode{GoroutineMode}},
+		"heap growth":        {after: later(observation{heap: 2000, goroutines: 10}), want: []Mode{MemoryMode}},
+		"cpu bound":          {after: later(observation{heap: 1000, goroutines: 10, userCPU: 3.5}), want: []Mode{CPUMode}},
+		"mutex contention":   {after: later(observation{heap: 1000, goroutines: 10, mutexWait: 0.5}), want: []Mode{ClockMode}},
+		"idle":               {after: later(observation{heap: 1000, goroutines: 10}), want: []Mode{ClockMode}},
+		"leaking under load": {after: later(observation{heap: 2000, goroutines: 500, userCPU: 3.5}), want: []Mode{GoroutineMode, MemoryMode, CPUMode}},
+		"growing heap":       {after: later(observation{heap: 2000, goroutines: 10, mutexWait: 0.5}), want: []Mode{MemoryMode, ClockMode}},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var modes []Mode
+			for _, s := range selectModes(base, tc.after, 4) {
+				modes = append(modes, s.mode)
+				assert.NotEmpty(t, s.reason)
+			}
+			assert.Equal(t, tc.want, modes)
+		})
+	}
+}
+
+func TestAutoModeCapturesSelectedMode(t *testing.T) {
+	previous := autoModeObservation
+	autoModeObservation = 20 * time.Millisecond
+	defer func() { autoModeObservation = previous }()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for i := 0; i < 200; i++ {
+		go func() { <-ctx.Done() }()
+	}
+	p, err := Capture(context.Background(), 100*time.Millisecond, WithAutoMode(), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.NotEqual(t, AutoMode, p.Mode())
+	assert.NotEmpty(t, p.ArtifactPaths())
+}
+
+func TestAutoModeRunsEverySelectedMode(t *testing.T) {
+	p := New(WithAutoMode(), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	finalizer, err := startEach(p, []Mode{GoroutineMode, MemoryMode, CPUMode})
+	require.NoError(t, err)
+	require.NoError(t, finalizer())
+	var names []string
+	for _, path := range p.ArtifactPaths() {
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.NotZero(t, info.Size())
+		names = append(names, filepath.Base(path))
+	}
+	assert.ElementsMatch(t, []string{GoroutineMode.fileName(), HeapFileName, AllocsFileName, CPUMode.fileName()}, names)
+}
+
+func TestAutoModeStoppedDuringObservation(t *testing.T) {
+	p, err := start(WithAutoMode(), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.NoError(t, p.stop(false))
+	assert.Empty(t, p.ArtifactPaths())
+	assert.Equal(t, AutoMode, p.Mode())
+}
@@ -0,0 +1,96 @@
+package profiler
+
+import (
+	"context"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// maxBandwidthBurst bounds the bytes written at once by a throttled upload,
+// so that uploads are smooth rather than bursting a second at a time.
+const maxBandwidthBurst = 32 << 10
+
+// bandwidthLimiter is a token bucket shared by every upload of a session,
+// so that concurrent uploads to several sinks divide the bandwidth rather
+// than each using it in full.
+type bandwidthLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// newBandwidthLimiter returns a limiter allowing bytesPerSec, nil if
+// bytesPerSec is not positive.
+func newBandwidthLimiter(bytesPerSec int64) *bandwidthLimiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	burst := int(min(bytesPerSec, maxBandwidthBurst))
+	return &bandwidthLimiter{rate: float64(bytesPerSec), burst: burst, tokens: float64(burst)}
+}
+
+// wait blocks until n bytes, at most the burst, may be written or ctx is
+// done.  Waiting writers are served in the order they arrived.
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if !l.last.IsZero() {
+		l.tokens = math.Min(float64(l.burst), l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	}
+	l.last = now
+	// The bytes are reserved now, leaving the bucket in debt until they
+	// have been paid for.
+	l.tokens -= float64(n)
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// throttledWriter limits the rate of writes to w.
+type throttledWriter struct {
+	ctx     context.Context
+	w       io.Writer
+	limiter *bandwidthLimiter
+}
+
+// Write writes p to w a burst at a time, waiting for the bandwidth of
+// each.
+func (t throttledWriter) Write(p []byte) (int, error) {
+	var n int
+	for len(p) > 0 {
+		chunk := p[:min(len(p), t.limiter.burst)]
+		if err := t.limiter.wait(t.ctx, len(chunk)); err != nil {
+			return n, err
+		}
+		written, err := t.w.Write(chunk)
+		n += written
+		if err != nil {
+			return n, err
+		}
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// throttle returns w limited to the upload bandwidth of the session, see
+// WithUploadBandwidth.
+func (p *Profiler) throttle(ctx context.Context, w io.Writer) io.Writer {
+	if p.uploadLimiter == nil {
+		return w
+	}
+	return throttledWriter{ctx: ctx, w: w, limiter: p.uploadLimiter}
+}
@@ -0,0 +1,67 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestThrottledWriterLimitsBandwidth(t *testing.T) {
+	limiter := newBandwidthLimiter(1 << 20)
+	var buf bytes.Buffer
+	w := throttledWriter{ctx: context.Background(), w: &buf, limiter: limiter}
+	data := bytes.Repeat([]byte("x"), maxBandwidthBurst+256<<10)
+	start := time.Now()
+	n, err := w.Write(data)
+	elapsed := time.Since(start)
+	require.NoError(t, err)
+	assert.Equal(t, len(data), n)
+	assert.Equal(t, data, buf.Bytes())
+	// The first burst is free, the remaining 256KiB take a quarter second.
+	assert.GreaterOrEqual(t, elapsed, 200*time.Millisecond)
+	assert.Less(t, elapsed, 2*time.Second)
+}
+
+func TestThrottledWriterHonoursContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	w := throttledWriter{ctx: ctx, w: &bytes.Buffer{}, limiter: newBandwidthLimiter(1024)}
+	n, err := w.Write(make([]byte, 10<<10))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1024, n, "only the first burst is written")
+}
+
+func TestUploadBandwidthUnlimited(t *testing.T) {
+	assert.Nil(t, newBandwidthLimiter(0))
+	p := New(WithUploadBandwidth(-1))
+	var buf bytes.Buffer
+	assert.Same(t, &buf, p.throttle(context.Background(), &buf))
+}
+
+func TestUploadBandwidthUploadsArtifacts(t *testing.T) {
+	sink := memorySink{}
+	p, err := Capture(context.Background(), time.Millisecond, WithHeapProfiler(), WithUpload(sink), WithUploadBandwidth(1<<20),
+		WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	require.NoError(t, err)
+	want, err := os.ReadFile(p.ArtifactPaths()[0])
+	require.NoError(t, err)
+	require.Contains(t, sink, MemoryFileName)
+	assert.Equal(t, want, sink[MemoryFileName].Bytes())
+}
+
+func TestUploadTimeoutBoundsThrottledUploads(t *testing.T) {
+	start := time.Now()
+	p, err := Capture(context.Background(), time.Millisecond, WithHeapProfiler(), WithUpload(memorySink{}), WithUploadBandwidth(1),
+		WithUploadTimeout(50*time.Millisecond), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	require.NoError(t, err)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	errs := p.Report().Errors
+	require.Len(t, errs, 1)
+	assert.ErrorIs(t, errs[0], context.DeadlineExceeded)
+	assert.FileExists(t, p.ArtifactPaths()[0], "the local artifact is retained")
+}
@@ -0,0 +1,199 @@
+// Package bench measures the cost of profiling, the throughput a workload
+// loses while each mode is capturing, so that changes to the strategies of
+// the profiler cannot silently make instrumentation more expensive.
+// Benchmark reports the cost per operation through the testing package
+// and AssertMaxOverhead fails a test once the overhead of a mode exceeds
+// a threshold, for use as a gate in CI.
+package bench
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/symonk/profiler"
+)
+
+// DefaultDuration is how long AssertMaxOverhead runs a workload for, both
+// with and without profiling.
+var DefaultDuration = 500 * time.Millisecond
+
+// Workload is a single operation of a synthetic workload, run repeatedly
+// to measure its throughput.
+type Workload func()
+
+// sink keeps the results of workloads reachable so that the work is not
+// optimised away.
+var sink struct {
+	mu    sync.Mutex
+	value any
+}
+
+// keep stores v in the sink.
+func keep(v any) {
+	sink.mu.Lock()
+	sink.value = v
+	sink.mu.Unlock()
+}
+
+// Compute is a CPU bound Workload, hashing a 4KB buffer.
+func Compute() {
+	b := make([]byte, 4*1024)
+	for i := 0; i < 16; i++ {
+		sum := sha256.Sum256(b)
+		copy(b, sum[:])
+	}
+	keep(b)
+}
+
+// Allocate is an allocation heavy Workload, allocating many small, short
+// lived objects.
+func Allocate() {
+	objects := make([][]byte, 64)
+	for i := range objects {
+		objects[i] = make([]byte, 128)
+	}
+	keep(objects)
+}
+
+// Overhead is the throughput of a workload with and without a mode
+// capturing.
+type Overhead struct {
+	// Mode is the mode captured.
+	Mode profiler.Mode
+	// Baseline is the operations per second of the workload without
+	// profiling.
+	Baseline float64
+	// Profiled is the operations per second of the workload while Mode
+	// was capturing.
+	Profiled float64
+}
+
+// Fraction returns the fraction (0 to 1) of the throughput lost to
+// profiling, zero when profiling was no slower.
+func (o Overhead) Fraction() float64 {
+	if o.Baseline <= 0 || o.Profiled >= o.Baseline {
+		return 0
+	}
+	return 1 - o.Profiled/o.Baseline
+}
+
+// String describes the overhead, such as "cpu: 2.1% overhead (10000 -> 9790 ops/s)".
+func (o Overhead) String() string {
+	return fmt.Sprintf("%s: %.1f%% overhead (%.0f -> %.0f ops/s)", o.Mode, o.Fraction()*100, o.Baseline, o.Profiled)
+}
+
+// Measure runs work for d without profiling, then for d while mode is
+// captured into a temporary folder, and returns the throughput of both.
+// The baseline is measured either side of the capture and averaged, to
+// smooth out the machine warming up or slowing down.  options are applied
+// to the capture after those of Measure.
+func Measure(ctx context.Context, mode profiler.Mode, work Workload, d time.Duration, options ...profiler.ProfileOption) (Overhead, error) {
+	dir, err := os.MkdirTemp("", "profiler-bench")
+	if err != nil {
+		return Overhead{}, fmt.Errorf("unable to create a temporary folder: %w", err)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	before := throughput(ctx, work, d)
+	options = append([]profiler.ProfileOption{profiler.WithMode(mode), profiler.WithProfileFileLocation(dir), profiler.WithQuietOutput()}, options...)
+	var captureErr error
+	profiled := measureDuring(work, func() {
+		_, captureErr = profiler.Capture(ctx, d, options...)
+	})
+	if captureErr != nil {
+		return Overhead{}, captureErr
+	}
+	after := throughput(ctx, work, d)
+	return Overhead{Mode: mode, Baseline: (before + after) / 2, Profiled: profiled}, ctx.Err()
+}
+
+// throughput returns the operations per second of work over d.
+func throughput(ctx context.Context, work Workload, d time.Duration) float64 {
+	ctx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	return measureDuring(work, func() { <-ctx.Done() })
+}
+
+// measureDuring runs work repeatedly for as long as during runs, returning
+// the operations per second achieved.
+func measureDuring(work Workload, during func()) float64 {
+	var (
+		stop = make(chan struct{})
+		done = make(chan int64)
+	)
+	go func() {
+		var ops int64
+		for {
+			select {
+			case <-stop:
+				done <- ops
+				return
+			default:
+				work()
+				ops++
+			}
+		}
+	}()
+	start := time.Now()
+	during()
+	close(stop)
+	ops := <-done
+	return float64(ops) / time.Since(start).Seconds()
+}
+
+// AssertMaxOverhead measures the overhead of capturing mode while work
+// runs, for DefaultDuration, and fails the test if more than maxOverhead
+// (0 to 1) of the throughput of work was lost.  Timing is noisy on shared
+// machines, maxOverhead should leave generous headroom over the overhead
+// typically measured.
+//
+//	bench.AssertMaxOverhead(t, profiler.CPUMode, bench.Compute, 0.1)
+func AssertMaxOverhead(t testing.TB, mode profiler.Mode, work Workload, maxOverhead float64, options ...profiler.ProfileOption) bool {
+	t.Helper()
+	overhead, err := Measure(context.Background(), mode, work, DefaultDuration, options...)
+	if err != nil {
+		t.Errorf("failed to measure the overhead of %s: %v", mode, err)
+		return false
+	}
+	if overhead.Fraction() <= maxOverhead {
+		return true
+	}
+	t.Errorf("%s, exceeding the maximum of %.1f%%", overhead, maxOverhead*100)
+	return false
+}
+
+// Benchmark runs work b.N times while mode is capturing, reporting the
+// cost per operation including the overhead of profiling.  Compare it
+// with a benchmark running work without profiling, such as with benchstat.
+//
+//	func BenchmarkComputeCPU(b *testing.B) {
+//	    bench.Benchmark(b, profiler.CPUMode, bench.Compute)
+//	}
+func Benchmark(b *testing.B, mode profiler.Mode, work Workload, options ...profiler.ProfileOption) {
+	b.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	options = append([]profiler.ProfileOption{profiler.WithMode(mode), profiler.WithProfileFileLocation(b.TempDir()), profiler.WithQuietOutput()}, options...)
+	captured := make(chan error, 1)
+	go func() {
+		// The capture runs until the benchmark cancels it.
+		_, err := profiler.Capture(ctx, time.Hour, options...)
+		captured <- err
+	}()
+	// Give the capture a moment to start before timing the work.
+	time.Sleep(10 * time.Millisecond)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		work()
+	}
+	b.StopTimer()
+	cancel()
+	if err := <-captured; err != nil && !errors.Is(err, context.Canceled) {
+		b.Fatalf("failed to capture %s: %v", mode, err)
+	}
+}
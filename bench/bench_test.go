@@ -0,0 +1,113 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/symonk/profiler"
+)
+
+// recordingT records failures rather than failing the test.
+type recordingT struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func TestOverheadFraction(t *testing.T) {
+	assert.InDelta(t, 0.25, Overhead{Baseline: 100, Profiled: 75}.Fraction(), 0.0001)
+	assert.Zero(t, Overhead{Baseline: 100, Profiled: 110}.Fraction())
+	assert.Zero(t, Overhead{}.Fraction())
+	assert.Equal(t, "cpu: 25.0% overhead (100 -> 75 ops/s)", Overhead{Mode: profiler.CPUMode, Baseline: 100, Profiled: 75}.String())
+}
+
+func TestMeasure(t *testing.T) {
+	overhead, err := Measure(context.Background(), profiler.CPUMode, Compute, 50*time.Millisecond)
+	require.NoError(t, err)
+	assert.Equal(t, profiler.CPUMode, overhead.Mode)
+	assert.Positive(t, overhead.Baseline)
+	assert.Positive(t, overhead.Profiled)
+}
+
+func TestMeasureCaptureError(t *testing.T) {
+	_, err := Measure(context.Background(), profiler.Mode(99), Compute, 10*time.Millisecond)
+	assert.Error(t, err)
+}
+
+func TestAssertMaxOverhead(t *testing.T) {
+	previous := DefaultDuration
+	DefaultDuration = 50 * time.Millisecond
+	defer func() { DefaultDuration = previous }()
+
+	r := &recordingT{TB: t}
+	// Profiling never costs all of the throughput.
+	assert.True(t, AssertMaxOverhead(r, profiler.GoroutineMode, Compute, 1))
+	assert.Empty(t, r.failures)
+
+	// A workload made slower only while profiling exceeds any threshold.
+	var capturing atomic.Bool
+	slow := func() {
+		if capturing.Load() {
+			time.Sleep(time.Millisecond)
+		}
+		Compute()
+	}
+	assert.False(t, AssertMaxOverhead(r, profiler.CPUMode, slow, 0.01,
+		profiler.WithBeforeCapture(func(profiler.Mode) { capturing.Store(true) }),
+		profiler.WithAfterCapture(func(profiler.Mode, profiler.ArtifactInfo, error) { capturing.Store(false) }),
+	))
+	require.Len(t, r.failures, 1)
+	assert.Contains(t, r.failures[0], "exceeding the maximum of 1.0%")
+}
+
+// The benchmarks below report the cost per operation of each workload
+// unprofiled and under each mode, compare them with benchstat:
+//
+//	go test ./bench -run '^$' -bench . -count 10 | tee new.txt
+//	benchstat old.txt new.txt
+
+func BenchmarkComputeBaseline(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Compute()
+	}
+}
+
+func BenchmarkComputeCPU(b *testing.B) {
+	Benchmark(b, profiler.CPUMode, Compute)
+}
+
+func BenchmarkComputeTrace(b *testing.B) {
+	Benchmark(b, profiler.TraceMode, Compute)
+}
+
+func BenchmarkComputeClock(b *testing.B) {
+	Benchmark(b, profiler.ClockMode, Compute)
+}
+
+func BenchmarkAllocateBaseline(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		Allocate()
+	}
+}
+
+func BenchmarkAllocateHeap(b *testing.B) {
+	Benchmark(b, profiler.MemoryHeapMode, Allocate)
+}
+
+func BenchmarkAllocateAlloc(b *testing.B) {
+	Benchmark(b, profiler.MemoryAllocMode, Allocate)
+}
+
+func BenchmarkAllocateTrace(b *testing.B) {
+	Benchmark(b, profiler.TraceMode, Allocate)
+}
@@ -0,0 +1,136 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// ErrBufferOverflow is returned when closing an artifact written to a
+// BufferedSink with the BufferDrop policy which had to drop data.
+var ErrBufferOverflow = errors.New("buffered sink overflowed")
+
+// BufferPolicy controls what a BufferedSink does when its buffer is full.
+type BufferPolicy int
+
+const (
+	// BufferBlock blocks writes until the destination catches up.
+	BufferBlock BufferPolicy = iota
+	// BufferDrop drops writes which do not fit in the buffer, the
+	// artifact is incomplete and closing it returns ErrBufferOverflow.
+	BufferDrop
+)
+
+// BufferedSink wraps sink with a bounded buffer of size bytes per
+// artifact, which is written to sink in the background.  Streaming
+// profilers write from within StopCPUProfile and trace.Stop, a slow
+// destination (a network, stdout) wrapped with BufferDrop can not stall
+// them and extend process shutdown indefinitely.  Closing an artifact
+// waits for the buffered data to be written.
+func BufferedSink(sink Sink, size int, policy BufferPolicy) Sink {
+	return &bufferedSink{sink: sink, size: size, policy: policy}
+}
+
+// bufferedSink is the Sink returned by BufferedSink.
+type bufferedSink struct {
+	sink   Sink
+	size   int
+	policy BufferPolicy
+}
+
+// Create opens the artifact on the underlying sink, starting the
+// goroutine which drains the buffer into it.
+func (s *bufferedSink) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	w, err := s.sink.Create(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	b := &bufferedWriter{w: w, size: s.size, policy: s.policy, done: make(chan struct{})}
+	b.cond = sync.NewCond(&b.mu)
+	goInternal(b.drain)
+	return b, nil
+}
+
+// bufferedWriter queues writes for the drain goroutine.
+type bufferedWriter struct {
+	w       io.WriteCloser
+	size    int
+	policy  BufferPolicy
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queue   [][]byte
+	queued  int
+	closed  bool
+	err     error
+	dropped int64
+	done    chan struct{}
+}
+
+// Write queues a copy of p, blocking or dropping it if the buffer is
+// full according to the policy.  A single write larger than the buffer
+// is queued once the buffer is empty.
+func (b *bufferedWriter) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for b.err == nil && b.queued > 0 && b.queued+len(p) > b.size {
+		if b.policy == BufferDrop {
+			b.dropped += int64(len(p))
+			return len(p), nil
+		}
+		b.cond.Wait()
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	b.queue = append(b.queue, append([]byte(nil), p...))
+	b.queued += len(p)
+	b.cond.Broadcast()
+	return len(p), nil
+}
+
+// drain writes the queued data to the destination until closed.  Once
+// the destination fails the remaining data is discarded.
+func (b *bufferedWriter) drain() {
+	defer close(b.done)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for {
+		for len(b.queue) == 0 && !b.closed {
+			b.cond.Wait()
+		}
+		if len(b.queue) == 0 {
+			return
+		}
+		chunk := b.queue[0]
+		b.queue = b.queue[1:]
+		failed := b.err != nil
+		b.mu.Unlock()
+		var err error
+		if !failed {
+			_, err = b.w.Write(chunk)
+		}
+		b.mu.Lock()
+		if err != nil && b.err == nil {
+			b.err = err
+		}
+		b.queued -= len(chunk)
+		b.cond.Broadcast()
+	}
+}
+
+// Close waits for the buffered data to be written before closing the
+// destination.
+func (b *bufferedWriter) Close() error {
+	b.mu.Lock()
+	b.closed = true
+	b.cond.Broadcast()
+	b.mu.Unlock()
+	<-b.done
+	err := errors.Join(b.err, b.w.Close())
+	if b.dropped > 0 {
+		err = errors.Join(err, fmt.Errorf("%w: %d bytes were dropped", ErrBufferOverflow, b.dropped))
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// gatedWriter blocks every write until the gate is opened.
+type gatedWriter struct {
+	gate chan struct{}
+	buf  bytes.Buffer
+}
+
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	<-g.gate
+	return g.buf.Write(p)
+}
+
+func (g *gatedWriter) Close() error { return nil }
+
+type gatedSink struct{ w *gatedWriter }
+
+func (s gatedSink) Create(context.Context, string) (io.WriteCloser, error) { return s.w, nil }
+
+func TestBufferedSinkDropsWhenFull(t *testing.T) {
+	gated := &gatedWriter{gate: make(chan struct{})}
+	w, err := BufferedSink(gatedSink{gated}, 4, BufferDrop).Create(context.Background(), "cpu.pprof")
+	assert.NoError(t, err)
+	for _, chunk := range []string{"ab", "cd", "ef"} {
+		n, err := w.Write([]byte(chunk))
+		assert.NoError(t, err)
+		assert.Equal(t, 2, n)
+	}
+	close(gated.gate)
+	assert.ErrorIs(t, w.Close(), ErrBufferOverflow)
+	assert.Equal(t, "abcd", gated.buf.String())
+}
+
+func TestBufferedSinkBlocksWhenFull(t *testing.T) {
+	gated := &gatedWriter{gate: make(chan struct{})}
+	w, err := BufferedSink(gatedSink{gated}, 4, BufferBlock).Create(context.Background(), "cpu.pprof")
+	assert.NoError(t, err)
+	written := make(chan struct{})
+	go func() {
+		for _, chunk := range []string{"ab", "cd", "ef"} {
+			_, _ = w.Write([]byte(chunk))
+		}
+		close(written)
+	}()
+	select {
+	case <-written:
+		t.Fatal("writes did not block on a full buffer")
+	default:
+	}
+	close(gated.gate)
+	<-written
+	assert.NoError(t, w.Close())
+	assert.Equal(t, "abcdef", gated.buf.String())
+}
+
+func TestBufferedSinkSurfacesDestinationErrors(t *testing.T) {
+	w, err := BufferedSink(failingWriterSink{}, 4, BufferBlock).Create(context.Background(), "cpu.pprof")
+	assert.NoError(t, err)
+	_, _ = w.Write([]byte("ab"))
+	assert.ErrorContains(t, w.Close(), "disk full")
+}
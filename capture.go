@@ -0,0 +1,45 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrDisabled is returned when a capture is skipped because the function
+// provided by WithEnabledFunc reported profiling as disabled.
+var ErrDisabled = errors.New("profiling is disabled")
+
+// Capture runs a profiling session for the duration d, or until ctx is
+// done, and returns the stopped *Profiler so that the artifacts written
+// can be inspected.  Unlike Start, Capture never installs signal handling
+// and returns errors rather than causing an exit, which makes it suitable
+// for captures triggered on demand in long running programs.
+// Only a single profiling instance may be active at a time, Capture returns
+// ErrAlreadyStarted if another is still running, ErrNotSampled if the
+// process was not selected by WithProbability and ErrDisabled if
+// profiling has been disabled by the function provided to WithEnabledFunc.
+func Capture(ctx context.Context, d time.Duration, options ...ProfileOption) (*Profiler, error) {
+	if d <= 0 {
+		return nil, errors.New("capture duration must be positive")
+	}
+	if p := New(options...); p.dryRunOnly {
+		return p.inert(), p.dryRun()
+	} else if !p.sampled() {
+		return nil, ErrNotSampled
+	} else if p.enabled != nil && !p.enabled() {
+		return nil, ErrDisabled
+	}
+	p, err := startContext(ctx, append(append([]ProfileOption{}, options...), WithoutSignalHandling())...)
+	if err != nil {
+		return nil, err
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return p, p.stop(false)
+	case <-ctx.Done():
+		return p, errors.Join(p.stop(true), ctx.Err())
+	}
+}
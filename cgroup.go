@@ -0,0 +1,174 @@
+package profiler
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cgroupRoot is where the cgroup filesystem is mounted.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// throttlingWarnRatio is the fraction of CFS periods throttled above
+// which the session report warns that the profile may be misleading.
+const throttlingWarnRatio = 0.1
+
+// CPUThrottling summarises the CFS (completely fair scheduler) quota of
+// the container and the throttling which occurred during the session.
+// A CPU profile taken while heavily throttled reflects time spent
+// waiting for quota rather than the work the program was doing.
+type CPUThrottling struct {
+	// Quota is the number of CPUs the cgroup may use per period, zero
+	// if the cgroup is unlimited.
+	Quota float64
+	// Periods is the number of enforcement periods which elapsed.
+	Periods uint64
+	// ThrottledPeriods is the number of periods in which the cgroup
+	// exhausted its quota and was throttled.
+	ThrottledPeriods uint64
+	// ThrottledTime is the total time the cgroup was throttled for.
+	ThrottledTime time.Duration
+}
+
+// Ratio returns the fraction of periods which were throttled.
+func (t CPUThrottling) Ratio() float64 {
+	if t.Periods == 0 {
+		return 0
+	}
+	return float64(t.ThrottledPeriods) / float64(t.Periods)
+}
+
+// sub returns the throttling which occurred between start and t.
+func (t CPUThrottling) sub(start CPUThrottling) CPUThrottling {
+	return CPUThrottling{
+		Quota:            t.Quota,
+		Periods:          t.Periods - start.Periods,
+		ThrottledPeriods: t.ThrottledPeriods - start.ThrottledPeriods,
+		ThrottledTime:    t.ThrottledTime - start.ThrottledTime,
+	}
+}
+
+// readCPUThrottling reads the CFS statistics of the cgroup the process
+// is running in, supporting both cgroup v2 and v1.  false is returned
+// when not running in a cgroup with the cpu controller enabled.
+func readCPUThrottling() (CPUThrottling, bool) {
+	if stat, err := readKeyValues(filepath.Join(cgroupRoot, "cpu.stat")); err == nil {
+		if _, ok := stat["nr_periods"]; ok {
+			return CPUThrottling{
+				Quota:            readCPUMax(filepath.Join(cgroupRoot, "cpu.max")),
+				Periods:          stat["nr_periods"],
+				ThrottledPeriods: stat["nr_throttled"],
+				ThrottledTime:    time.Duration(stat["throttled_usec"]) * time.Microsecond,
+			}, true
+		}
+	}
+	v1 := filepath.Join(cgroupRoot, "cpu")
+	stat, err := readKeyValues(filepath.Join(v1, "cpu.stat"))
+	if err != nil {
+		return CPUThrottling{}, false
+	}
+	var quota float64
+	q, qErr := readInt(filepath.Join(v1, "cpu.cfs_quota_us"))
+	period, pErr := readInt(filepath.Join(v1, "cpu.cfs_period_us"))
+	if qErr == nil && pErr == nil && q > 0 && period > 0 {
+		quota = float64(q) / float64(period)
+	}
+	return CPUThrottling{
+		Quota:            quota,
+		Periods:          stat["nr_periods"],
+		ThrottledPeriods: stat["nr_throttled"],
+		ThrottledTime:    time.Duration(stat["throttled_time"]),
+	}, true
+}
+
+// readCPUMax parses the cgroup v2 `<quota> <period>` format, where the
+// quota is `max` when unlimited.
+func readCPUMax(path string) float64 {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0
+	}
+	fields := strings.Fields(string(b))
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0
+	}
+	quota, qErr := strconv.ParseFloat(fields[0], 64)
+	period, pErr := strconv.ParseFloat(fields[1], 64)
+	if qErr != nil || pErr != nil || period == 0 {
+		return 0
+	}
+	return quota / period
+}
+
+// unlimitedMemory is the smallest cgroup v1 memory limit treated as no
+// limit, v1 reports an unset limit as the largest page aligned int64.
+const unlimitedMemory = 1 << 62
+
+// ContainerMemoryLimit returns the memory limit in bytes of the cgroup the
+// process is running in, supporting both cgroup v2 and v1, so that memory
+// thresholds can be expressed relative to the size of the pod.  false is
+// returned when the memory is unlimited or not running in a cgroup.
+func ContainerMemoryLimit() (uint64, bool) {
+	if b, err := os.ReadFile(filepath.Join(cgroupRoot, "memory.max")); err == nil {
+		limit, err := strconv.ParseUint(strings.TrimSpace(string(b)), 10, 64)
+		// An unlimited cgroup reports max.
+		return limit, err == nil && limit > 0
+	}
+	limit, err := readInt(filepath.Join(cgroupRoot, "memory", "memory.limit_in_bytes"))
+	if err != nil || limit <= 0 || limit >= unlimitedMemory {
+		return 0, false
+	}
+	return uint64(limit), true
+}
+
+// readKeyValues parses a flat keyed file of `<key> <value>` lines.
+func readKeyValues(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	values := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if v, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			values[fields[0]] = v
+		}
+	}
+	return values, scanner.Err()
+}
+
+// readInt reads a file containing a single integer.
+func readInt(path string) (int64, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+}
+
+// recordThrottling records the CFS throttling which occurred during the
+// session and warns when it was significant.
+func (p *Profiler) recordThrottling() {
+	if p.throttlingStart == nil {
+		return
+	}
+	end, ok := readCPUThrottling()
+	if !ok {
+		return
+	}
+	throttling := end.sub(*p.throttlingStart)
+	p.mu.Lock()
+	p.throttling = &throttling
+	p.mu.Unlock()
+	if throttling.Ratio() > throttlingWarnRatio {
+		p.report("[warning] the process was CPU throttled in %d of %d periods (%s) with a quota of %.2f CPUs, profiles may reflect time waiting for quota rather than work", throttling.ThrottledPeriods, throttling.Periods, throttling.ThrottledTime, throttling.Quota)
+	}
+}
@@ -0,0 +1,90 @@
+package profiler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fakeCgroup(t *testing.T, files map[string]string) {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	previous := cgroupRoot
+	cgroupRoot = root
+	t.Cleanup(func() { cgroupRoot = previous })
+}
+
+func TestReadCPUThrottlingV2(t *testing.T) {
+	fakeCgroup(t, map[string]string{
+		"cpu.stat": "usage_usec 100\nnr_periods 10\nnr_throttled 4\nthrottled_usec 2000\n",
+		"cpu.max":  "150000 100000\n",
+	})
+	throttling, ok := readCPUThrottling()
+	assert.True(t, ok)
+	assert.Equal(t, CPUThrottling{Quota: 1.5, Periods: 10, ThrottledPeriods: 4, ThrottledTime: 2 * time.Millisecond}, throttling)
+	assert.Equal(t, 0.4, throttling.Ratio())
+}
+
+func TestReadCPUThrottlingV1(t *testing.T) {
+	fakeCgroup(t, map[string]string{
+		"cpu/cpu.stat":          "nr_periods 20\nnr_throttled 1\nthrottled_time 5000\n",
+		"cpu/cpu.cfs_quota_us":  "-1\n",
+		"cpu/cpu.cfs_period_us": "100000\n",
+	})
+	throttling, ok := readCPUThrottling()
+	assert.True(t, ok)
+	assert.Equal(t, CPUThrottling{Periods: 20, ThrottledPeriods: 1, ThrottledTime: 5 * time.Microsecond}, throttling)
+}
+
+func TestReadCPUThrottlingNoCgroup(t *testing.T) {
+	fakeCgroup(t, nil)
+	_, ok := readCPUThrottling()
+	assert.False(t, ok)
+}
+
+func TestReportIncludesThrottling(t *testing.T) {
+	fakeCgroup(t, map[string]string{"cpu.stat": "nr_periods 10\nnr_throttled 2\nthrottled_usec 0\n"})
+	p, err := start(WithCPUProfiler(), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput())
+	assert.NoError(t, err)
+	if err := os.WriteFile(filepath.Join(cgroupRoot, "cpu.stat"), []byte("nr_periods 30\nnr_throttled 12\nthrottled_usec 1000\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, p.stop(false))
+	assert.Equal(t, &CPUThrottling{Periods: 20, ThrottledPeriods: 10, ThrottledTime: time.Millisecond}, p.Report().Throttling)
+}
+
+func TestContainerMemoryLimit(t *testing.T) {
+	fakeCgroup(t, map[string]string{"memory.max": "536870912\n"})
+	limit, ok := ContainerMemoryLimit()
+	assert.True(t, ok)
+	assert.EqualValues(t, 512<<20, limit)
+
+	fakeCgroup(t, map[string]string{"memory.max": "max\n"})
+	_, ok = ContainerMemoryLimit()
+	assert.False(t, ok, "v2 unlimited")
+
+	fakeCgroup(t, map[string]string{"memory/memory.limit_in_bytes": "1073741824\n"})
+	limit, ok = ContainerMemoryLimit()
+	assert.True(t, ok)
+	assert.EqualValues(t, 1<<30, limit)
+
+	fakeCgroup(t, map[string]string{"memory/memory.limit_in_bytes": "9223372036854771712\n"})
+	_, ok = ContainerMemoryLimit()
+	assert.False(t, ok, "v1 unlimited")
+
+	fakeCgroup(t, nil)
+	_, ok = ContainerMemoryLimit()
+	assert.False(t, ok)
+}
@@ -0,0 +1,36 @@
+// Package chi adapts the HTTP integration of the profiler to chi.  It is
+// a separate module so that the profiler itself does not depend on
+// github.com/go-chi/chi.
+package chi
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/symonk/profiler"
+)
+
+// Middleware returns chi middleware tracing the requests armed on
+// tracer, see profiler.RequestTracer.
+//
+//	r.Use(profilerchi.Middleware(tracer))
+func Middleware(tracer *profiler.RequestTracer) func(http.Handler) http.Handler {
+	return tracer.Middleware
+}
+
+// MountArtifacts serves the artifacts beneath dir at pattern, which may
+// contain URL parameters, see profiler.ArtifactHandler.
+//
+//	profilerchi.MountArtifacts(r, "/artifacts", "/var/log/profiles")
+func MountArtifacts(r chi.Router, pattern string, dir string) {
+	handler := profiler.ArtifactHandler(dir)
+	r.Mount(pattern, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		clone := new(http.Request)
+		*clone = *req
+		u := *req.URL
+		// The path beneath the mount, the pattern already matched.
+		u.Path, u.RawPath = chi.RouteContext(req.Context()).RoutePath, ""
+		clone.URL = &u
+		handler.ServeHTTP(w, clone)
+	}))
+}
@@ -0,0 +1,19 @@
+module github.com/symonk/profiler/chi
+
+go 1.22
+
+replace github.com/symonk/profiler => ../
+
+require (
+	github.com/go-chi/chi/v5 v5.1.0
+	github.com/stretchr/testify v1.9.0
+	github.com/symonk/profiler v0.0.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/felixge/fgprof v0.9.5 // indirect
+	github.com/google/pprof v0.0.0-20241023014458-598669927662 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,160 @@
+// Command profiler wraps programs which import the profiler package.
+//
+// Usage:
+//
+//	profiler run [-dir profiles] [-keep 10] -- ./mybinary args...
+//
+// The child process is run with PROFILER_OUTPUT_DIR set to a folder named
+// after the command and the time it started, so that its artifacts are
+// collected in one place.  Signals received are forwarded to the child
+// and only the newest -keep folders of the command are retained.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/symonk/profiler"
+)
+
+// runTimeFormat names the folder each run is collected into.
+const runTimeFormat = "20060102T150405"
+
+// forwarded are the signals forwarded to the child process.
+var forwarded = []os.Signal{os.Interrupt, syscall.SIGTERM, syscall.SIGHUP}
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run dispatches args to the sub command, returning the exit code.
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "run" {
+		fmt.Fprintln(stderr, "usage: profiler run [-dir profiles] [-keep 10] -- command [args...]")
+		return 2
+	}
+	flags := flag.NewFlagSet("run", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	dir := flags.String("dir", "profiles", "the folder runs are collected into")
+	keep := flags.Int("keep", 10, "the number of runs of the command to retain, all if zero")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	command := flags.Args()
+	if len(command) == 0 {
+		fmt.Fprintln(stderr, "profiler run requires a command to run")
+		return 2
+	}
+	name := filepath.Base(command[0])
+	runDir := filepath.Join(*dir, fmt.Sprintf("%s-%s", name, time.Now().Format(runTimeFormat)))
+	if err := os.MkdirAll(runDir, 0755); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	code, err := runChild(ctx, command, runDir, stdin, stdout, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+	}
+	if collect(runDir, stderr) && *keep > 0 {
+		if err := retain(*dir, name, *keep); err != nil {
+			fmt.Fprintf(stderr, "failed to apply retention: %s\n", err)
+		}
+	}
+	return code
+}
+
+// runChild runs command with its artifacts directed to runDir, forwarding
+// signals, and returns its exit code.
+func runChild(ctx context.Context, command []string, runDir string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (int, error) {
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+	cmd.Env = append(os.Environ(), profiler.OutputDirEnv+"="+runDir)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwarded...)
+	defer signal.Stop(signals)
+	if err := cmd.Start(); err != nil {
+		return 1, err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				_ = cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+	err := cmd.Wait()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	if err != nil {
+		return 1, err
+	}
+	return 0, nil
+}
+
+// collect reports the artifacts written to runDir, removing it if there
+// are none, and returns whether any were written.
+func collect(runDir string, stderr io.Writer) bool {
+	var artifacts []string
+	_ = filepath.WalkDir(runDir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			artifacts = append(artifacts, path)
+		}
+		return nil
+	})
+	if len(artifacts) == 0 {
+		_ = os.RemoveAll(runDir)
+		fmt.Fprintf(stderr, "no artifacts were written, does the command import github.com/symonk/profiler?\n")
+		return false
+	}
+	fmt.Fprintf(stderr, "collected %d artifacts into %s:\n", len(artifacts), runDir)
+	for _, path := range artifacts {
+		fmt.Fprintf(stderr, "  %s\n", path)
+	}
+	return true
+}
+
+// retain removes all but the newest keep runs of the command name in dir.
+func retain(dir string, name string, keep int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var runs []string
+	for _, entry := range entries {
+		stamp, ok := strings.CutPrefix(entry.Name(), name+"-")
+		if !ok || !entry.IsDir() {
+			continue
+		}
+		if _, err := time.Parse(runTimeFormat, stamp); err == nil {
+			runs = append(runs, entry.Name())
+		}
+	}
+	if len(runs) <= keep {
+		return nil
+	}
+	// The timestamps sort chronologically.
+	sort.Strings(runs)
+	var errs []error
+	for _, run := range runs[:len(runs)-keep] {
+		errs = append(errs, os.RemoveAll(filepath.Join(dir, run)))
+	}
+	return errors.Join(errs...)
+}
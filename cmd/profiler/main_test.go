@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/symonk/profiler"
+)
+
+// helperEnv makes the test binary act as the wrapped child process.
+const helperEnv = "PROFILER_RUN_HELPER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(helperEnv) != "" {
+		_ = os.WriteFile(filepath.Join(os.Getenv(profiler.OutputDirEnv), "cpu.pprof"), []byte("profile"), 0644)
+		os.Exit(3)
+	}
+	os.Exit(m.Run())
+}
+
+func TestRunCollectsArtifactsOfTheChild(t *testing.T) {
+	t.Setenv(helperEnv, "1")
+	dir := t.TempDir()
+	name := filepath.Base(os.Args[0])
+	stale := filepath.Join(dir, name+"-20200101T000000")
+	unrelated := filepath.Join(dir, "other-20200101T000000")
+	for _, d := range []string{stale, unrelated} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"run", "-dir", dir, "-keep", "1", "--", os.Args[0]}, nil, &stdout, &stderr)
+	assert.Equal(t, 3, code, "the exit code of the child is returned")
+	assert.Contains(t, stderr.String(), "collected 1 artifacts")
+	matches, _ := filepath.Glob(filepath.Join(dir, name+"-*", "cpu.pprof"))
+	assert.Len(t, matches, 1)
+	assert.NoDirExists(t, stale)
+	assert.DirExists(t, unrelated)
+}
+
+func TestRunRemovesEmptyRuns(t *testing.T) {
+	dir := t.TempDir()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"run", "-dir", dir, "--", "go", "version"}, nil, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.True(t, strings.HasPrefix(stdout.String(), "go version"))
+	assert.Contains(t, stderr.String(), "no artifacts were written")
+	entries, _ := os.ReadDir(dir)
+	assert.Empty(t, entries)
+}
+
+func TestRunUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run(context.Background(), nil, nil, &stdout, &stderr))
+	assert.Equal(t, 2, run(context.Background(), []string{"run"}, nil, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "requires a command")
+}
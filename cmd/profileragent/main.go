@@ -0,0 +1,167 @@
+// Command profileragent profiles another process as a sidecar, pulling
+// its profiles on a schedule from its agent (see profiler.StartAgent) or
+// its net/http/pprof endpoints, retaining and uploading them.
+//
+// Usage:
+//
+//	profileragent -source http://localhost:6060/debug/pprof [-modes cpu,heap] [-interval 1m] [-duration 10s] [-dir profiles] [-keep 10] [-upload url] [-bandwidth bytes] [-tags k=v,...]
+//	profileragent -source localhost:6061 -modes heap [-cert client.pem -key client-key.pem -ca ca.pem]
+//
+// Every flag may instead be set by an environment variable named after it,
+// such as PROFILER_AGENT_SOURCE or PROFILER_AGENT_KEEP, so that the agent
+// is configured by the env of its container.  Explicit flags take
+// precedence.  The agent runs until it receives SIGINT or SIGTERM.
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/symonk/profiler"
+)
+
+// envPrefix prefixes the environment variable of each flag.
+const envPrefix = "PROFILER_AGENT_"
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Getenv, os.Stderr))
+}
+
+// run runs the sidecar configured by args and getenv until ctx is done,
+// returning the exit code.
+func run(ctx context.Context, args []string, getenv func(string) string, stderr io.Writer) int {
+	flags := flag.NewFlagSet("profileragent", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	source := flags.String("source", "", "the agent host:port or net/http/pprof url to pull profiles from")
+	modes := flags.String("modes", "cpu,heap,goroutine", "comma separated modes to pull each cycle")
+	interval := flags.Duration("interval", time.Minute, "the time between pull cycles, at least a second")
+	duration := flags.Duration("duration", 10*time.Second, "how long cpu and trace are captured for")
+	dir := flags.String("dir", "profiles", "the folder to write cycles to")
+	keep := flags.Int("keep", 10, "the number of cycle folders to retain, all if zero")
+	upload := flags.String("upload", "", "the url to upload artifacts beneath with HTTP PUT requests")
+	bandwidth := flags.Int64("bandwidth", 0, "the bytes per second uploads are limited to, unlimited if zero")
+	tags := flags.String("tags", "", "comma separated key=value tags of uploads")
+	quiet := flags.Bool("quiet", false, "do not log each pull")
+	cert := flags.String("cert", "", "the PEM client certificate presented to the source and upload server (mTLS)")
+	key := flags.String("key", "", "the PEM key of -cert")
+	ca := flags.String("ca", "", "the PEM certificates verifying the source and upload server, the system roots if empty")
+	var envErr error
+	flags.VisitAll(func(f *flag.Flag) {
+		name := envPrefix + strings.ToUpper(f.Name)
+		if value := getenv(name); value != "" && envErr == nil {
+			if err := f.Value.Set(value); err != nil {
+				envErr = fmt.Errorf("invalid %s: %w", name, err)
+			}
+		}
+	})
+	if envErr != nil {
+		fmt.Fprintln(stderr, envErr)
+		return 2
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if *source == "" {
+		fmt.Fprintln(stderr, "profileragent requires -source or "+envPrefix+"SOURCE")
+		return 2
+	}
+	parsed, err := parseModes(*modes)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	parsedTags, err := parseTags(*tags)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	var tlsConfig *tls.Config
+	if *cert != "" || *key != "" || *ca != "" {
+		if tlsConfig, err = profiler.ClientTLSConfig(*cert, *key, *ca); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 2
+		}
+	}
+	config := profiler.SidecarConfig{
+		Source:    newSource(*source, tlsConfig),
+		Modes:     parsed,
+		Interval:  *interval,
+		Duration:  *duration,
+		OutputDir: *dir,
+		Keep:      *keep,
+	}
+	options := []profiler.ProfileOption{profiler.WithTags(parsedTags), profiler.WithUploadBandwidth(*bandwidth)}
+	if *quiet {
+		options = append(options, profiler.WithQuietOutput())
+	}
+	if *upload != "" {
+		var sinkOptions []profiler.HTTPSinkOption
+		if tlsConfig != nil {
+			sinkOptions = append(sinkOptions, profiler.WithHTTPTLS(tlsConfig))
+		}
+		options = append(options, profiler.WithHTTPUpload(*upload, sinkOptions...))
+	}
+	if err := profiler.RunSidecar(ctx, config, options...); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// newSource returns the source at address, net/http/pprof if it is a url
+// and an agent otherwise, connecting with tlsConfig if not nil.
+func newSource(address string, tlsConfig *tls.Config) profiler.Source {
+	if strings.HasPrefix(address, "http://") || strings.HasPrefix(address, "https://") {
+		source := profiler.DebugSource{URL: address}
+		if tlsConfig != nil {
+			transport := http.DefaultTransport.(*http.Transport).Clone()
+			transport.TLSClientConfig = tlsConfig
+			source.Client = &http.Client{Transport: transport}
+		}
+		return source
+	}
+	return profiler.AgentSource{Addr: address, TLSConfig: tlsConfig}
+}
+
+// parseModes parses a comma separated list of mode names.
+func parseModes(list string) ([]profiler.Mode, error) {
+	var modes []profiler.Mode
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		mode, err := profiler.ParseMode(name)
+		if err != nil {
+			return nil, err
+		}
+		modes = append(modes, mode)
+	}
+	return modes, nil
+}
+
+// parseTags parses a comma separated list of key=value tags.
+func parseTags(list string) (map[string]string, error) {
+	tags := make(map[string]string)
+	for _, pair := range strings.Split(list, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid tag %q, expected key=value", pair)
+		}
+		tags[key] = value
+	}
+	return tags, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"net/http/pprof"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/symonk/profiler"
+)
+
+func TestRunPullsFromEnvConfiguredSource(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	dir := t.TempDir()
+	env := map[string]string{
+		"PROFILER_AGENT_SOURCE":   server.URL + "/debug/pprof",
+		"PROFILER_AGENT_MODES":    "heap,goroutine",
+		"PROFILER_AGENT_INTERVAL": "1s",
+		"PROFILER_AGENT_QUIET":    "true",
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	var stderr bytes.Buffer
+	code := run(ctx, []string{"-dir", dir}, func(key string) string { return env[key] }, &stderr)
+	require.Equal(t, 0, code, stderr.String())
+
+	cycles, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, cycles, 1)
+	for _, name := range []string{profiler.MemoryFileName, profiler.GoroutineFileName} {
+		assert.FileExists(t, filepath.Join(dir, cycles[0].Name(), name))
+	}
+}
+
+func TestRunInvalidArguments(t *testing.T) {
+	for name, tc := range map[string]struct {
+		args []string
+		env  map[string]string
+		want string
+	}{
+		"no source":    {want: "requires -source"},
+		"bad mode":     {args: []string{"-source", "localhost:1", "-modes", "nope"}, want: "nope"},
+		"bad tag":      {args: []string{"-source", "localhost:1", "-tags", "team"}, want: "invalid tag"},
+		"bad env":      {env: map[string]string{"PROFILER_AGENT_KEEP": "many"}, want: "invalid PROFILER_AGENT_KEEP"},
+		"bad interval": {args: []string{"-source", "localhost:1", "-interval", "1ms"}, want: "at least a second"},
+		"bad ca":       {args: []string{"-source", "localhost:1", "-ca", "missing.pem"}, want: "failed to read tls ca"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var stderr bytes.Buffer
+			code := run(context.Background(), tc.args, func(key string) string { return tc.env[key] }, &stderr)
+			assert.NotEqual(t, 0, code)
+			assert.Contains(t, stderr.String(), tc.want)
+		})
+	}
+}
+
+func TestNewSource(t *testing.T) {
+	assert.Equal(t, profiler.DebugSource{URL: "http://app:6060/debug/pprof"}, newSource("http://app:6060/debug/pprof", nil))
+	assert.Equal(t, profiler.AgentSource{Addr: "localhost:6061"}, newSource("localhost:6061", nil))
+
+	config := &tls.Config{ServerName: "app"}
+	source := newSource("https://app:6060/debug/pprof", config).(profiler.DebugSource)
+	require.NotNil(t, source.Client)
+	assert.Same(t, config, source.Client.Transport.(*http.Transport).TLSClientConfig)
+	assert.Equal(t, profiler.AgentSource{Addr: "localhost:6061", TLSConfig: config}, newSource("localhost:6061", config))
+}
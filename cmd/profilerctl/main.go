@@ -0,0 +1,567 @@
+// Command profilerctl is a command line companion to the profiler package.
+//
+// Usage:
+//
+//	profilerctl selftest [-modes cpu,heap] [-dir folder]
+//	profilerctl convert -to speedscope|folded|html [-o output] input.pprof
+//	profilerctl top [-limit 20] [-sort flat|cum] [-type cpu] input.pprof
+//	profilerctl modes
+//	profilerctl goroutines [-limit 20] goroutine.pprof
+//	profilerctl metadata metadata.json
+//	profilerctl leaks [-limit 10] [-min 1] [-format table|csv] snapshots|heap.pprof...
+//	profilerctl soak [-for 4h] [-interval 1m] [-duration 10s] [-modes cpu,heap] [-keep 10] [-dir folder]
+//	profilerctl k8s capture -selector app=checkout -port 6060 [-mode heap] [-namespace ns] [-dir folder]
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/symonk/profiler"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// commands are the sub commands of profilerctl.
+var commands = map[string]func(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) int{
+	"selftest":   selfTest,
+	"convert":    convert,
+	"top":        top,
+	"modes":      modes,
+	"leaks":      leaks,
+	"goroutines": goroutines,
+	"metadata":   metadata,
+	"soak":       soak,
+	"k8s":        k8s,
+}
+
+// run dispatches args to the sub command, returning the exit code.
+func run(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return 2
+	}
+	command, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+	return command(ctx, args[1:], stdout, stderr)
+}
+
+// usage writes the available sub commands.
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: profilerctl <command> [flags]")
+	fmt.Fprintln(w, "commands:")
+	fmt.Fprintln(w, "  selftest    verify profiling works in this environment")
+	fmt.Fprintln(w, "  convert     convert a profile to speedscope, folded stacks or html")
+	fmt.Fprintln(w, "  top         print the top functions of a profile")
+	fmt.Fprintln(w, "  modes       list the profiling modes and their capabilities")
+	fmt.Fprintln(w, "  leaks       print the allocation sites growing across heap snapshots")
+	fmt.Fprintln(w, "  goroutines  print what the goroutines of a goroutine profile are blocked on")
+	fmt.Fprintln(w, "  metadata    print the session and events of a metadata.json")
+	fmt.Fprintln(w, "  soak        run continuous profiling against a synthetic workload and verify it")
+	fmt.Fprintln(w, "  k8s         capture profiles from the agents of kubernetes pods")
+}
+
+// parseModes parses a comma separated list of mode names.
+func parseModes(list string) ([]profiler.Mode, error) {
+	var modes []profiler.Mode
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		mode, err := profiler.ParseMode(name)
+		if err != nil {
+			return nil, err
+		}
+		modes = append(modes, mode)
+	}
+	return modes, nil
+}
+
+// selfTest runs profiler.SelfTest, reporting the outcome of each mode.
+func selfTest(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("selftest", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	modeList := flags.String("modes", "", "comma separated modes to test, all modes if empty")
+	dir := flags.String("dir", ".", "the output directory profiles would be written to")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	modes, err := parseModes(*modeList)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	results, err := profiler.SelfTest(ctx, modes, profiler.WithProfileFileLocation(*dir), profiler.WithQuietOutput())
+	for _, result := range results {
+		if result.Err != nil {
+			fmt.Fprintf(stdout, "FAIL %-14s %s\n", result.Mode, result.Err)
+			continue
+		}
+		fmt.Fprintf(stdout, "ok   %s\n", result.Mode)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "self test failed:\n%s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// converters write a profile in each format supported by convert, along
+// with the extension of the file written.
+var converters = map[string]struct {
+	extension string
+	write     func(w io.Writer, name string, prof *profile.Profile) error
+}{
+	"speedscope": {".speedscope.json", profiler.WriteSpeedscope},
+	"folded":     {".folded", func(w io.Writer, _ string, prof *profile.Profile) error { return profiler.WriteFolded(w, prof) }},
+	"html":       {".html", profiler.WriteHTMLReport},
+}
+
+// convert writes a profile in another format, next to the input unless
+// an output is given, "-" writing to stdout.
+func convert(_ context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("convert", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	to := flags.String("to", "", "the format to convert to: speedscope, folded or html")
+	output := flags.String("o", "", "the file to write, derived from the input if empty, - for stdout")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	converter, ok := converters[*to]
+	if !ok || flags.NArg() != 1 {
+		fmt.Fprintln(stderr, "usage: profilerctl convert -to speedscope|folded|html [-o output] input.pprof")
+		return 2
+	}
+	input := flags.Arg(0)
+	prof, err := profiler.ReadProfile(input)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	name := filepath.Base(input)
+	if *output == "-" {
+		if err := converter.write(stdout, name, prof); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		return 0
+	}
+	if *output == "" {
+		*output = strings.TrimSuffix(input, filepath.Ext(input)) + converter.extension
+	}
+	f, err := os.Create(*output)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := errors.Join(converter.write(f, name, prof), f.Close()); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	fmt.Fprintf(stdout, "wrote %s\n", *output)
+	return 0
+}
+
+// top prints the top functions of a profile.  Flags may also follow the
+// input, as in `profilerctl top cpu.pprof -limit 20`.
+func top(_ context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("top", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	limit := flags.Int("limit", 10, "the number of functions to print")
+	sortBy := flags.String("sort", "flat", "the value functions are ordered by: flat or cum")
+	sampleType := flags.String("type", "", "the sample type, such as cpu or alloc_space, the default of the profile if empty")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	var inputs []string
+	for flags.NArg() > 0 {
+		inputs = append(inputs, flags.Arg(0))
+		if err := flags.Parse(flags.Args()[1:]); err != nil {
+			return 2
+		}
+	}
+	if len(inputs) != 1 || *limit < 0 || (*sortBy != "flat" && *sortBy != "cum") {
+		fmt.Fprintln(stderr, "usage: profilerctl top [-limit 20] [-sort flat|cum] [-type cpu] input.pprof")
+		return 2
+	}
+	prof, err := profiler.ReadProfile(inputs[0])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := profiler.WriteTop(stdout, prof, *sampleType, *limit, *sortBy == "cum"); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// modes lists every profiling mode along with its capabilities.
+func modes(_ context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) != 0 {
+		fmt.Fprintln(stderr, "usage: profilerctl modes")
+		return 2
+	}
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "name\tfile\texclusive\tneeds rate\tcapture at stop")
+	for _, spec := range profiler.ModeSpecs() {
+		file := spec.FileName
+		if file == "" {
+			file = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%t\t%t\t%t\n", spec.Name, file, spec.Exclusive, spec.NeedsRate, spec.CaptureAtStop)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// leaks prints the allocation sites suspected of leaking across a series of
+// heap profiles, either the snapshots in a folder or the profiles given,
+// oldest first.
+func leaks(_ context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("leaks", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	limit := flags.Int("limit", 10, "the number of sites to print")
+	minGrowth := flags.Int64("min", 1, "the objects a site must gain to be suspected")
+	format := flags.String("format", "table", "the output format: table or csv")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() == 0 || *limit < 0 || (*format != "table" && *format != "csv") {
+		fmt.Fprintln(stderr, "usage: profilerctl leaks [-limit 10] [-min 1] [-format table|csv] snapshots|heap.pprof...")
+		return 2
+	}
+	var series []*profile.Profile
+	if info, err := os.Stat(flags.Arg(0)); err == nil && info.IsDir() && flags.NArg() == 1 {
+		if series, err = profiler.ReadSnapshotSeries(flags.Arg(0)); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	} else {
+		for _, path := range flags.Args() {
+			prof, err := profiler.ReadProfile(path)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+			series = append(series, prof)
+		}
+	}
+	suspects, err := profiler.SuspectLeaks(series, *minGrowth, *limit)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	write := profiler.WriteLeakSuspects
+	if *format == "csv" {
+		write = profiler.WriteLeakSuspectsCSV
+	}
+	if err := write(stdout, suspects); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// goroutines prints the goroutines of a goroutine profile bucketed by what
+// they are blocked on, largest first.
+func goroutines(_ context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("goroutines", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	limit := flags.Int("limit", 20, "the number of buckets to print")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() != 1 || *limit < 0 {
+		fmt.Fprintln(stderr, "usage: profilerctl goroutines [-limit 20] goroutine.pprof")
+		return 2
+	}
+	prof, err := profiler.ReadProfile(flags.Arg(0))
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	buckets, err := profiler.ClassifyGoroutines(prof)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	if err := profiler.WriteGoroutineBuckets(stdout, buckets, *limit); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// metadata prints the session metadata written by profiler.WithMetadataFile.
+func metadata(_ context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) != 1 {
+		fmt.Fprintln(stderr, "usage: profilerctl metadata metadata.json")
+		return 2
+	}
+	data, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	m, err := profiler.ParseMetadata(data)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	w := tabwriter.NewWriter(stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "mode\t%s\n", m.Mode)
+	if m.Host != "" {
+		fmt.Fprintf(w, "process\t%s (pid %d)\n", m.Host, m.PID)
+	}
+	fmt.Fprintf(w, "runtime\t%s %s/%s\n", m.GoVersion, m.GOOS, m.GOARCH)
+	fmt.Fprintf(w, "duration\t%s\n", time.Duration(m.DurationNanos))
+	fmt.Fprintf(w, "interrupted\t%t\n", m.Interrupted)
+	for _, artifact := range m.Artifacts {
+		fmt.Fprintf(w, "artifact\t%s (%d bytes)\n", artifact.Path, artifact.Size)
+	}
+	for _, err := range m.Errors {
+		fmt.Fprintf(w, "error\t%s\n", err)
+	}
+	for _, event := range m.Events {
+		line := event.Type
+		if event.Error != "" {
+			line += ": " + event.Error
+		}
+		fmt.Fprintf(w, "event\t%s %s\n", event.Time.Format(time.RFC3339Nano), line)
+	}
+	if err := w.Flush(); err != nil {
+		fmt.Fprintln(stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// soak runs profiler.Soak, printing its report.
+func soak(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("soak", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	length := flags.Duration("for", 4*time.Hour, "how long to soak for")
+	interval := flags.Duration("interval", time.Minute, "the time between capture cycles, at least a second")
+	duration := flags.Duration("duration", 10*time.Second, "how long each mode is captured for")
+	modes := flags.String("modes", "cpu,heap,goroutine", "comma separated modes to capture each cycle")
+	keep := flags.Int("keep", 10, "the number of cycle folders to retain, all if zero")
+	dir := flags.String("dir", "", "the folder to write cycles to, a temporary folder if empty")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	parsed, err := parseModes(*modes)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return 2
+	}
+	names := make([]string, len(parsed))
+	for i, mode := range parsed {
+		names[i] = mode.String()
+	}
+	output := *dir
+	if output == "" {
+		temp, err := os.MkdirTemp("", "profiler-soak")
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		defer func() { _ = os.RemoveAll(temp) }()
+		output = temp
+	}
+	config := profiler.SoakConfig{
+		Continuous: profiler.ContinuousConfig{
+			Interval:  *interval,
+			Duration:  *duration,
+			Modes:     names,
+			OutputDir: output,
+			Keep:      *keep,
+		},
+		Length: *length,
+	}
+	report, err := profiler.Soak(ctx, config, profiler.WithQuietOutput())
+	if writeErr := profiler.WriteSoakReport(stdout, report); writeErr != nil {
+		fmt.Fprintln(stderr, writeErr)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "soak failed:\n%s\n", err)
+		return 1
+	}
+	return 0
+}
+
+// k8sUsage describes the k8s command.
+const k8sUsage = "usage: profilerctl k8s capture -selector app=checkout -port 6060 [-mode heap] [-namespace ns] [-dir folder]"
+
+// k8s captures a profile from the agent (see profiler.StartAgent) of every
+// running pod matching a label selector, through kubectl port-forward, and
+// writes each to a folder named after its pod.
+func k8s(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "capture" {
+		fmt.Fprintln(stderr, k8sUsage)
+		return 2
+	}
+	flags := flag.NewFlagSet("k8s capture", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	selector := flags.String("selector", "", "the label selector of the pods to capture")
+	port := flags.Int("port", 0, "the port the agent of each pod listens on")
+	modeName := flags.String("mode", "heap", "the mode to capture: heap, cpu or trace")
+	namespace := flags.String("namespace", "", "the namespace of the pods, that of the kubectl context if empty")
+	dir := flags.String("dir", ".", "the folder to write a folder per pod to")
+	kubectl := flags.String("kubectl", "kubectl", "the kubectl binary")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	mode, err := profiler.ParseMode(*modeName)
+	// The modes captured by the agent.
+	supported := mode == profiler.MemoryHeapMode || mode == profiler.CPUMode || mode == profiler.TraceMode
+	if err != nil || !supported || *selector == "" || *port <= 0 {
+		fmt.Fprintln(stderr, k8sUsage)
+		return 2
+	}
+	kube := kubeClient{binary: *kubectl, namespace: *namespace}
+	pods, err := kube.pods(ctx, *selector)
+	if err != nil {
+		fmt.Fprintf(stderr, "unable to list pods: %s\n", err)
+		return 1
+	}
+	if len(pods) == 0 {
+		fmt.Fprintf(stderr, "no running pods match %s\n", *selector)
+		return 1
+	}
+	spec, _ := mode.Spec()
+	errs := make([]error, len(pods))
+	var wg sync.WaitGroup
+	for i, pod := range pods {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = kube.capture(ctx, pod, *port, mode, filepath.Join(*dir, pod, spec.FileName))
+		}()
+	}
+	wg.Wait()
+	code := 0
+	for i, pod := range pods {
+		if errs[i] != nil {
+			fmt.Fprintf(stdout, "FAIL %s %s\n", pod, errs[i])
+			code = 1
+			continue
+		}
+		fmt.Fprintf(stdout, "ok   %s %s\n", pod, filepath.Join(*dir, pod, spec.FileName))
+	}
+	return code
+}
+
+// kubeClient runs kubectl against a namespace.
+type kubeClient struct {
+	binary    string
+	namespace string
+}
+
+// command returns kubectl invoked with args in the namespace.
+func (k kubeClient) command(ctx context.Context, args ...string) *exec.Cmd {
+	if k.namespace != "" {
+		args = append([]string{"--namespace", k.namespace}, args...)
+	}
+	return exec.CommandContext(ctx, k.binary, args...)
+}
+
+// pods returns the names of the running pods matching selector.
+func (k kubeClient) pods(ctx context.Context, selector string) ([]string, error) {
+	var stderr bytes.Buffer
+	cmd := k.command(ctx, "get", "pods", "--selector", selector, "--field-selector", "status.phase=Running",
+		"--output", `jsonpath={range .items[*]}{.metadata.name}{"\n"}{end}`)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.Fields(string(out)), nil
+}
+
+// capture port-forwards to the agent of pod and writes a capture of mode
+// to path.
+func (k kubeClient) capture(ctx context.Context, pod string, port int, mode profiler.Mode, path string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// Port 0 forwards from a random local port, which kubectl reports.
+	cmd := k.command(ctx, "port-forward", "pod/"+pod, fmt.Sprintf(":%d", port))
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	addr, err := forwardedAddr(out)
+	// Drain the output so kubectl is never blocked writing it.  Wait
+	// closes the pipe, so it is only called once the drain has finished.
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		_, _ = io.Copy(io.Discard, out)
+	}()
+	defer func() {
+		cancel()
+		<-drained
+		_ = cmd.Wait()
+	}()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	// A failed capture leaves no partial artifact behind.
+	err = errors.Join(profiler.AgentCapture(ctx, addr, mode, f), f.Close())
+	if err != nil {
+		_ = os.Remove(path)
+	}
+	return err
+}
+
+// forwardedAddr reads the local address from the output of kubectl
+// port-forward, "Forwarding from 127.0.0.1:54321 -> 6060".
+func forwardedAddr(r io.Reader) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		forwarding, ok := strings.CutPrefix(scanner.Text(), "Forwarding from ")
+		if addr, _, found := strings.Cut(forwarding, " -> "); ok && found {
+			return addr, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.New("kubectl port-forward exited without forwarding")
+}
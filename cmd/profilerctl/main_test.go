@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/symonk/profiler"
+)
+
+func TestSelfTestCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"selftest", "-modes", "heap,goroutine", "-dir", t.TempDir()}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Equal(t, "ok   heap\nok   goroutine\n", stdout.String())
+}
+
+func TestUnknownCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run(context.Background(), []string{"nope"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "unknown command")
+	assert.Equal(t, 2, run(context.Background(), []string{"selftest", "-modes", "nope"}, &stdout, &stderr))
+}
+
+// goroutineProfile captures a goroutine profile, returning its path.
+func goroutineProfile(t *testing.T) string {
+	p, err := profiler.Capture(context.Background(), time.Millisecond, profiler.WithMode(profiler.GoroutineMode), profiler.WithProfileFileLocation(t.TempDir()), profiler.WithQuietOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.ArtifactPaths()[0]
+}
+
+func TestConvertCommand(t *testing.T) {
+	input := goroutineProfile(t)
+	for format, extension := range map[string]string{"speedscope": ".speedscope.json", "folded": ".folded", "html": ".html"} {
+		var stdout, stderr bytes.Buffer
+		code := run(context.Background(), []string{"convert", "--to", format, input}, &stdout, &stderr)
+		assert.Equal(t, 0, code, stderr.String())
+		output := filepath.Join(filepath.Dir(input), "goroutine"+extension)
+		assert.Equal(t, "wrote "+output+"\n", stdout.String())
+		info, err := os.Stat(output)
+		assert.NoError(t, err)
+		assert.Greater(t, info.Size(), int64(0))
+	}
+}
+
+func TestConvertCommandToStdout(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"convert", "-to", "folded", "-o", "-", goroutineProfile(t)}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "TestConvertCommandToStdout")
+}
+
+func TestConvertCommandUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run(context.Background(), []string{"convert", "-to", "svg", "cpu.pprof"}, &stdout, &stderr))
+	assert.Equal(t, 2, run(context.Background(), []string{"convert", "-to", "folded"}, &stdout, &stderr))
+	assert.Equal(t, 1, run(context.Background(), []string{"convert", "-to", "folded", filepath.Join(t.TempDir(), "missing.pprof")}, &stdout, &stderr))
+}
+
+func TestTopCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"top", goroutineProfile(t), "-limit", "3", "--sort", "cum"}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Contains(t, lines[0], "flat%")
+	// runtime.goexit is at the root of every goroutine.
+	assert.Contains(t, stdout.String(), "100.00%")
+}
+
+func TestTopCommandUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run(context.Background(), []string{"top"}, &stdout, &stderr))
+	assert.Equal(t, 2, run(context.Background(), []string{"top", "-sort", "name", "cpu.pprof"}, &stdout, &stderr))
+	assert.Equal(t, 2, run(context.Background(), []string{"top", "-limit", "-1", "cpu.pprof"}, &stdout, &stderr))
+	assert.Equal(t, 1, run(context.Background(), []string{"top", "-type", "alloc_space", goroutineProfile(t)}, &stdout, &stderr))
+}
+
+func TestModesCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run(context.Background(), []string{"modes"}, &stdout, &stderr))
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Len(t, lines, len(profiler.ModeSpecs())+1)
+	assert.Regexp(t, `^cpu\s+cpu.pprof\s+true\s+false\s+false$`, lines[1])
+	assert.Equal(t, 2, run(context.Background(), []string{"modes", "-v"}, &stdout, &stderr))
+}
+
+func TestLeaksCommand(t *testing.T) {
+	dir := t.TempDir()
+	for range 2 {
+		if _, err := profiler.Snapshot(dir); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run(context.Background(), []string{"leaks", "-format", "csv", dir}, &stdout, &stderr), stderr.String())
+	assert.True(t, strings.HasPrefix(stdout.String(), "site,growth,inuse_space,inuse_objects\n"))
+
+	stdout.Reset()
+	heaps, _ := filepath.Glob(filepath.Join(dir, "*", profiler.HeapFileName))
+	assert.Equal(t, 0, run(context.Background(), append([]string{"leaks"}, heaps...), &stdout, &stderr), stderr.String())
+	assert.Contains(t, stdout.String(), "growth")
+}
+
+func TestLeaksCommandUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run(context.Background(), []string{"leaks"}, &stdout, &stderr))
+	assert.Equal(t, 2, run(context.Background(), []string{"leaks", "-limit", "-1", t.TempDir()}, &stdout, &stderr))
+	assert.Equal(t, 1, run(context.Background(), []string{"leaks", t.TempDir()}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "at least two heap profiles")
+}
+
+func TestGoroutinesCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run(context.Background(), []string{"goroutines", "-limit", "5", goroutineProfile(t)}, &stdout, &stderr), stderr.String())
+	assert.Regexp(t, `^goroutines\s+share\s+state\s+frame\n`, stdout.String())
+	assert.Equal(t, 2, run(context.Background(), []string{"goroutines"}, &stdout, &stderr))
+	assert.Equal(t, 2, run(context.Background(), []string{"goroutines", "-limit", "-1", goroutineProfile(t)}, &stdout, &stderr))
+}
+
+func TestMetadataCommand(t *testing.T) {
+	dir := t.TempDir()
+	_, err := profiler.Capture(context.Background(), time.Millisecond, profiler.WithMode(profiler.GoroutineMode), profiler.WithMetadataFile(),
+		profiler.WithProfileFileLocation(dir), profiler.WithQuietOutput())
+	if !assert.NoError(t, err) {
+		return
+	}
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run(context.Background(), []string{"metadata", filepath.Join(dir, profiler.MetadataFileName)}, &stdout, &stderr), stderr.String())
+	assert.Regexp(t, `(?m)^mode\s+goroutine$`, stdout.String())
+	assert.Contains(t, stdout.String(), profiler.GoroutineFileName)
+	assert.Regexp(t, `(?m)^event\s+\S+ started$`, stdout.String())
+	assert.Equal(t, 2, run(context.Background(), []string{"metadata"}, &stdout, &stderr))
+	assert.Equal(t, 1, run(context.Background(), []string{"metadata", filepath.Join(dir, "missing.json")}, &stdout, &stderr))
+}
+
+func TestSoakCommand(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"soak", "-for", "2500ms", "-interval", "1s", "-duration", "20ms", "-modes", "heap, goroutine", "-keep", "2"}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	assert.Contains(t, stdout.String(), "elapsed")
+	assert.True(t, strings.HasSuffix(stdout.String(), "PASS\n"), stdout.String())
+
+	stderr.Reset()
+	assert.Equal(t, 1, run(context.Background(), []string{"soak", "-interval", "10ms"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "at least a second")
+}
+
+// fakeKubectl is a stand in for kubectl which lists two pods and forwards
+// every port to the agent at $AGENT_ADDR.
+const fakeKubectl = `#!/bin/sh
+if [ "$1" = "--namespace" ]; then shift 2; fi
+case "$1" in
+	get) printf 'checkout-a\ncheckout-b\n' ;;
+	port-forward)
+		echo "Forwarding from $AGENT_ADDR -> 6060"
+		exec sleep 60 ;;
+esac
+`
+
+func TestK8sCaptureCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake kubectl is a shell script")
+	}
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "kubectl"), []byte(fakeKubectl), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("GOPS_CONFIG_DIR", t.TempDir())
+	agent, err := profiler.StartAgent("127.0.0.1:0", profiler.WithQuietOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+	t.Setenv("AGENT_ADDR", agent.Addr().String())
+
+	dir := t.TempDir()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"k8s", "capture", "-selector", "app=checkout", "-port", "6060", "-namespace", "shop", "-dir", dir}, &stdout, &stderr)
+	assert.Equal(t, 0, code, stderr.String())
+	for _, pod := range []string{"checkout-a", "checkout-b"} {
+		path := filepath.Join(dir, pod, profiler.MemoryFileName)
+		assert.Contains(t, stdout.String(), "ok   "+pod+" "+path)
+		_, err := profiler.ReadProfile(path)
+		assert.NoError(t, err)
+	}
+}
+
+func TestK8sCaptureCommandFailure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the fake kubectl is a shell script")
+	}
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "kubectl"), []byte(fakeKubectl), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	// Nothing listens on the forwarded address.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AGENT_ADDR", listener.Addr().String())
+	listener.Close()
+
+	dir := t.TempDir()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), []string{"k8s", "capture", "-selector", "app=checkout", "-port", "6060", "-dir", dir}, &stdout, &stderr)
+	assert.Equal(t, 1, code)
+	for _, pod := range []string{"checkout-a", "checkout-b"} {
+		assert.Contains(t, stdout.String(), "FAIL "+pod)
+		assert.NoFileExists(t, filepath.Join(dir, pod, profiler.MemoryFileName), "failed captures leave no artifact")
+	}
+}
+
+func TestK8sCommandUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 2, run(context.Background(), []string{"k8s"}, &stdout, &stderr))
+	assert.Equal(t, 2, run(context.Background(), []string{"k8s", "capture", "-port", "6060"}, &stdout, &stderr))
+	assert.Equal(t, 2, run(context.Background(), []string{"k8s", "capture", "-selector", "app=x", "-port", "6060", "-mode", "block"}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "usage: profilerctl k8s capture")
+}
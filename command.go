@@ -0,0 +1,182 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultCommandDuration is used when a Command does not specify
+// how long to capture for, mirroring net/http/pprof.
+const defaultCommandDuration = 30 * time.Second
+
+// Command is a structured request to perform a capture, typically
+// received from a message queue so that profiling can be triggered
+// on demand across a fleet without per host access.
+//
+//	{"mode": "cpu", "duration": "30s", "reply_to": "profiles.results", "selector": {"service": "checkout"}, "requested_by": "alice"}
+type Command struct {
+	// Mode is the name of the profiler mode, see ParseMode.
+	Mode string `json:"mode"`
+	// Duration is parsed by time.ParseDuration, defaulting to 30s.
+	Duration string `json:"duration,omitempty"`
+	// ReplyTo is the subject/topic the CommandResult is published to,
+	// when empty no result is published.
+	ReplyTo string `json:"reply_to,omitempty"`
+	// Selector restricts a broadcast command to instances whose tags,
+	// provided by WithInstanceTags, contain every key and value.
+	Selector map[string]string `json:"selector,omitempty"`
+	// RequestedBy identifies who issued the command, it is recorded as
+	// the requester of its AuditEntry.
+	RequestedBy string `json:"requested_by,omitempty"`
+}
+
+// Matches reports whether an instance with the given tags is targeted
+// by the command.  A command without a selector targets every instance.
+func (c Command) Matches(tags map[string]string) bool {
+	for key, value := range c.Selector {
+		if tag, ok := tags[key]; !ok || tag != value {
+			return false
+		}
+	}
+	return true
+}
+
+// CommandResult is published to the reply subject of a Command once
+// the capture has completed.
+type CommandResult struct {
+	Host      string            `json:"host"`
+	Tags      map[string]string `json:"tags,omitempty"`
+	Command   Command           `json:"command"`
+	Artifacts []Artifact        `json:"artifacts,omitempty"`
+	Error     string            `json:"error,omitempty"`
+}
+
+// Artifact is a named profile file and its contents.
+type Artifact struct {
+	Name string `json:"name"`
+	Data []byte `json:"data"`
+}
+
+// Subscriber adapts a message queue client (NATS, Kafka etc) to deliver
+// the payload of each message received on the command subject/topic.
+// Subscribe should block until ctx is done or the subscription fails.
+type Subscriber interface {
+	Subscribe(ctx context.Context, handle func(ctx context.Context, data []byte)) error
+}
+
+// Publisher adapts a message queue client to publish command results.
+type Publisher interface {
+	Publish(ctx context.Context, subject string, data []byte) error
+}
+
+// ServeCommands subscribes to sub and performs a capture for each Command
+// targeting this instance, publishing the CommandResult (including the artifact contents)
+// to the reply subject of the command via pub.  options are applied to
+// every capture, the mode and duration are taken from the command.
+// Captures are performed one at a time in the order they are received.
+func ServeCommands(ctx context.Context, sub Subscriber, pub Publisher, options ...ProfileOption) error {
+	reporter := New(options...)
+	return sub.Subscribe(ctx, func(ctx context.Context, data []byte) {
+		var cmd Command
+		var result CommandResult
+		if err := json.Unmarshal(data, &cmd); err != nil {
+			result = CommandResult{Host: hostname(), Tags: reporter.instanceTags, Error: fmt.Sprintf("invalid command: %s", err)}
+			reporter.audit(ctx, AuditEntry{Time: time.Now(), Source: AuditSourceCommand, Action: "invalid"}, errors.New(result.Error))
+		} else if !cmd.Matches(reporter.instanceTags) {
+			return
+		} else {
+			result = RunCommand(ctx, cmd, options...)
+		}
+		if result.Error != "" {
+			reporter.report("[warning] command %q failed: %s", cmd.Mode, result.Error)
+		}
+		if cmd.ReplyTo == "" || pub == nil {
+			return
+		}
+		payload, err := json.Marshal(result)
+		if err != nil {
+			reporter.report("[warning] unable to encode command result: %s", err)
+			return
+		}
+		if err := pub.Publish(ctx, cmd.ReplyTo, payload); err != nil {
+			reporter.report("[warning] unable to publish command result to %s: %s", cmd.ReplyTo, err)
+		}
+	})
+}
+
+// RunCommand performs the capture described by cmd and returns the result.
+// It is exported for transports which do not fit the Subscriber model,
+// the selector of the command is not consulted, see Command.Matches.  The
+// command is audited, see WithAuditHandler.
+func RunCommand(ctx context.Context, cmd Command, options ...ProfileOption) CommandResult {
+	reporter := New(options...)
+	entry := AuditEntry{Time: time.Now(), Source: AuditSourceCommand, Requester: cmd.RequestedBy, Action: cmd.Mode, Params: commandParams(cmd)}
+	reporter.auditReceived(ctx, entry)
+	result := runCommand(ctx, cmd, reporter, options, &entry)
+	var err error
+	if result.Error != "" {
+		err = errors.New(result.Error)
+	}
+	reporter.audit(ctx, entry, err)
+	return result
+}
+
+// commandParams returns the parameters of cmd recorded when it is audited.
+func commandParams(cmd Command) map[string]string {
+	params := make(map[string]string)
+	if cmd.Duration != "" {
+		params["duration"] = cmd.Duration
+	}
+	if cmd.ReplyTo != "" {
+		params["reply_to"] = cmd.ReplyTo
+	}
+	if len(cmd.Selector) > 0 {
+		params["selector"] = strings.Join(sortedTags(cmd.Selector), ",")
+	}
+	return params
+}
+
+// runCommand performs cmd, recording its artifacts in entry.
+func runCommand(ctx context.Context, cmd Command, reporter *Profiler, options []ProfileOption, entry *AuditEntry) CommandResult {
+	result := CommandResult{Host: hostname(), Tags: reporter.instanceTags, Command: cmd}
+	mode, err := ParseMode(cmd.Mode)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	duration := defaultCommandDuration
+	if cmd.Duration != "" {
+		if duration, err = time.ParseDuration(cmd.Duration); err != nil {
+			result.Error = fmt.Sprintf("invalid duration: %s", err)
+			return result
+		}
+	}
+	p, err := Capture(ctx, duration, append(append([]ProfileOption{}, options...), WithMode(mode))...)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	entry.Artifacts = p.ArtifactPaths()
+	for _, path := range entry.Artifacts {
+		data, err := readFile(p.fs, path)
+		if err != nil {
+			result.Error = err.Error()
+			return result
+		}
+		result.Artifacts = append(result.Artifacts, Artifact{Name: filepath.Base(path), Data: data})
+	}
+	return result
+}
+
+// hostname returns the host name reported by the kernel, or an empty
+// string if it cannot be determined.
+func hostname() string {
+	name, _ := os.Hostname()
+	return name
+}
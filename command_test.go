@@ -0,0 +1,83 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type stubSubscriber struct {
+	messages [][]byte
+}
+
+func (s *stubSubscriber) Subscribe(ctx context.Context, handle func(ctx context.Context, data []byte)) error {
+	for _, message := range s.messages {
+		handle(ctx, message)
+	}
+	return nil
+}
+
+type stubPublisher struct {
+	subjects []string
+	results  []CommandResult
+}
+
+func (s *stubPublisher) Publish(_ context.Context, subject string, data []byte) error {
+	var result CommandResult
+	if err := json.Unmarshal(data, &result); err != nil {
+		return err
+	}
+	s.subjects = append(s.subjects, subject)
+	s.results = append(s.results, result)
+	return nil
+}
+
+func TestServeCommandsPublishesArtifacts(t *testing.T) {
+	sub := &stubSubscriber{messages: [][]byte{
+		[]byte(`{"mode": "heap", "duration": "10ms", "reply_to": "results"}`),
+		[]byte(`{"mode": "unknown", "reply_to": "results"}`),
+		[]byte(`{"mode": "cpu", "duration": "10ms"}`),
+	}}
+	pub := &stubPublisher{}
+	err := ServeCommands(context.Background(), sub, pub, WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"results", "results"}, pub.subjects)
+
+	assert.Empty(t, pub.results[0].Error)
+	assert.Len(t, pub.results[0].Artifacts, 1)
+	assert.Equal(t, MemoryFileName, pub.results[0].Artifacts[0].Name)
+	assert.NotEmpty(t, pub.results[0].Artifacts[0].Data)
+
+	assert.Contains(t, pub.results[1].Error, "unknown profiler mode")
+}
+
+func TestServeCommandsHonoursSelector(t *testing.T) {
+	sub := &stubSubscriber{messages: [][]byte{
+		[]byte(`{"mode": "heap", "duration": "10ms", "reply_to": "results", "selector": {"service": "checkout"}}`),
+		[]byte(`{"mode": "heap", "duration": "10ms", "reply_to": "results", "selector": {"service": "billing"}}`),
+	}}
+	pub := &stubPublisher{}
+	tags := map[string]string{"service": "checkout", "region": "eu"}
+	err := ServeCommands(context.Background(), sub, pub, WithInstanceTags(tags), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.Len(t, pub.results, 1)
+	assert.Equal(t, tags, pub.results[0].Tags)
+	assert.Equal(t, "checkout", pub.results[0].Command.Selector["service"])
+}
+
+func TestCapturesDoNotAppendToSharedOptions(t *testing.T) {
+	// Spare capacity would otherwise be shared by concurrent captures.
+	options := make([]ProfileOption, 0, 8)
+	options = append(options, WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	spare := options[:cap(options)]
+	result := runCommand(context.Background(), Command{Mode: "goroutine", Duration: "1ms"}, New(options...), options, &AuditEntry{})
+	assert.Empty(t, result.Error)
+	_, err := Capture(context.Background(), time.Millisecond, options...)
+	assert.NoError(t, err)
+	for _, option := range spare[len(options):] {
+		assert.Nil(t, option)
+	}
+}
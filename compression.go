@@ -0,0 +1,80 @@
+package profiler
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"path/filepath"
+)
+
+// Compression describes a streaming compression format.  Formats other
+// than gzip (for example zstd, see the github.com/symonk/profiler/zstd
+// module) can be provided without this package depending on them.
+type Compression struct {
+	// Extension is appended to the name of compressed artifacts,
+	// for example ".gz".
+	Extension string
+	// NewWriter wraps w, compressing everything written to it.  Closing
+	// the returned writer must flush any buffered data but not close w.
+	NewWriter func(w io.Writer) (io.WriteCloser, error)
+}
+
+// Gzip compresses artifacts with compress/gzip.
+var Gzip = Compression{
+	Extension: ".gz",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+}
+
+// compressible reports whether an artifact benefits from compression.
+// pprof files are already gzipped protocol buffers, traces and text
+// dumps compress extremely well.
+func compressible(name string) bool {
+	return filepath.Ext(name) != ".pprof"
+}
+
+// compressedWriter flushes the compressor before closing the
+// underlying writer.
+type compressedWriter struct {
+	io.WriteCloser
+	underlying io.Closer
+}
+
+// compress wraps w with the compression format c.
+func compress(w io.WriteCloser, c Compression) (io.WriteCloser, error) {
+	cw, err := c.NewWriter(w)
+	if err != nil {
+		return nil, errors.Join(err, w.Close())
+	}
+	return &compressedWriter{WriteCloser: cw, underlying: w}, nil
+}
+
+// Close flushes the compressor and closes the underlying writer.
+func (c *compressedWriter) Close() error {
+	return errors.Join(c.WriteCloser.Close(), c.underlying.Close())
+}
+
+// compressedSink compresses every artifact written to the wrapped sink.
+type compressedSink struct {
+	sink        Sink
+	compression Compression
+}
+
+// CompressedSink wraps sink so that every artifact written to it is
+// compressed with c and named with the extension of c appended.  This
+// composes with any sink, including uploads.
+func CompressedSink(sink Sink, c Compression) Sink {
+	return &compressedSink{sink: sink, compression: c}
+}
+
+// Create opens the artifact on the underlying sink and wraps it with
+// the compressor.
+func (c *compressedSink) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	w, err := c.sink.Create(ctx, name+c.compression.Extension)
+	if err != nil {
+		return nil, err
+	}
+	return compress(w, c.compression)
+}
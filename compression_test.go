@@ -0,0 +1,67 @@
+package profiler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithCompressionCompressesArtifacts(t *testing.T) {
+	storage := t.TempDir()
+	p := New(WithCompression(Gzip), WithProfileFileLocation(storage), WithQuietOutput())
+	w, err := p.createArtifact(TraceFileName)
+	assert.NoError(t, err)
+	_, err = io.WriteString(w, "trace")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, []string{filepath.Join(storage, TraceFileName+Gzip.Extension)}, p.ArtifactPaths())
+
+	f, err := os.Open(p.ArtifactPaths()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	assert.NoError(t, err)
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "trace", string(data))
+
+	// pprof files are already compressed.
+	w, err = p.createArtifact(CPUFileName)
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+	assert.Equal(t, filepath.Join(storage, CPUFileName), p.ArtifactPaths()[1])
+}
+
+type memorySink map[string]*bytes.Buffer
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func (m memorySink) Create(_ context.Context, name string) (io.WriteCloser, error) {
+	m[name] = &bytes.Buffer{}
+	return nopCloser{m[name]}, nil
+}
+
+func TestCompressedSink(t *testing.T) {
+	sink := memorySink{}
+	w, err := CompressedSink(sink, Gzip).Create(context.Background(), "trace.out")
+	assert.NoError(t, err)
+	_, err = io.WriteString(w, "profile")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	r, err := gzip.NewReader(sink["trace.out.gz"])
+	assert.NoError(t, err)
+	data, err := io.ReadAll(r)
+	assert.NoError(t, err)
+	assert.Equal(t, "profile", string(data))
+}
@@ -0,0 +1,74 @@
+package profiler
+
+import (
+	"errors"
+)
+
+// Config declares a profiling session as plain data, so that it can be
+// loaded alongside the rest of an application's configuration and wired
+// by dependency injection frameworks, see the optional
+// github.com/symonk/profiler/fx and github.com/symonk/profiler/wire
+// modules.  The zero Config profiles the CPU into the working directory.
+type Config struct {
+	// Mode is the name of the mode captured, see ParseMode, cpu if empty.
+	Mode string `json:"mode" yaml:"mode"`
+	// OutputDir is the folder artifacts are written to, see
+	// WithProfileFileLocation.
+	OutputDir string `json:"output_dir" yaml:"output_dir"`
+	// Disabled starts nothing, to turn profiling off by configuration.
+	Disabled bool `json:"disabled" yaml:"disabled"`
+	// Probability is the fraction of processes profiled, see
+	// WithProbability, every process is profiled if zero.
+	Probability float64 `json:"probability" yaml:"probability"`
+	// Quiet suppresses the output of the session, see WithQuietOutput.
+	Quiet bool `json:"quiet" yaml:"quiet"`
+	// Tags are attached to the session, see WithTags.
+	Tags map[string]string `json:"tags" yaml:"tags"`
+	// UploadURL, if set, is where artifacts are uploaded, see
+	// WithHTTPUpload.
+	UploadURL string `json:"upload_url" yaml:"upload_url"`
+	// UploadBandwidth limits uploads to the bytes per second, see
+	// WithUploadBandwidth, uploads are unlimited if zero.
+	UploadBandwidth int64 `json:"upload_bandwidth" yaml:"upload_bandwidth"`
+}
+
+// Options returns the options configuring the session declared by c, an
+// error if c is invalid.
+func (c Config) Options() ([]ProfileOption, error) {
+	var options []ProfileOption
+	if c.Mode != "" {
+		mode, err := ParseMode(c.Mode)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, WithMode(mode))
+	}
+	if c.OutputDir != "" {
+		options = append(options, WithProfileFileLocation(c.OutputDir))
+	}
+	if c.Disabled {
+		options = append(options, WithEnabledFunc(func() bool { return false }))
+	}
+	if c.Probability < 0 || c.Probability > 1 {
+		return nil, errors.New("probability must be between 0 and 1")
+	}
+	if c.Probability > 0 {
+		options = append(options, WithProbability(c.Probability))
+	}
+	if c.Quiet {
+		options = append(options, WithQuietOutput())
+	}
+	if len(c.Tags) > 0 {
+		options = append(options, WithTags(c.Tags))
+	}
+	if c.UploadURL != "" {
+		options = append(options, WithHTTPUpload(c.UploadURL))
+	}
+	if c.UploadBandwidth < 0 {
+		return nil, errors.New("upload bandwidth must not be negative")
+	}
+	if c.UploadBandwidth > 0 {
+		options = append(options, WithUploadBandwidth(c.UploadBandwidth))
+	}
+	return options, nil
+}
@@ -0,0 +1,47 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigOptions(t *testing.T) {
+	var config Config
+	require.NoError(t, json.Unmarshal([]byte(`{"mode": "heap", "output_dir": "out", "quiet": true, "tags": {"service": "api"}, "upload_bandwidth": 1048576}`), &config))
+	options, err := config.Options()
+	require.NoError(t, err)
+	p := New(options...)
+	assert.Equal(t, MemoryHeapMode, p.Mode())
+	assert.Equal(t, "out", p.profileFolder)
+	assert.True(t, p.quiet)
+	assert.Equal(t, map[string]string{"service": "api"}, p.tags)
+	require.NotNil(t, p.uploadLimiter)
+	assert.Equal(t, float64(1<<20), p.uploadLimiter.rate)
+}
+
+func TestConfigZero(t *testing.T) {
+	options, err := Config{}.Options()
+	require.NoError(t, err)
+	assert.Empty(t, options)
+}
+
+func TestConfigInvalid(t *testing.T) {
+	_, err := Config{Mode: "bogus"}.Options()
+	assert.ErrorContains(t, err, `unknown profiler mode "bogus"`)
+	_, err = Config{Probability: 2}.Options()
+	assert.ErrorContains(t, err, "probability must be between 0 and 1")
+	_, err = Config{UploadBandwidth: -1}.Options()
+	assert.ErrorContains(t, err, "upload bandwidth must not be negative")
+}
+
+func TestConfigDisabled(t *testing.T) {
+	options, err := Config{Mode: "heap", Disabled: true, Quiet: true}.Options()
+	require.NoError(t, err)
+	_, err = Capture(context.Background(), time.Millisecond, options...)
+	assert.ErrorIs(t, err, ErrDisabled)
+}
@@ -0,0 +1,397 @@
+package profiler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// ContinuousConfig configures continuous profiling, where each of the
+// modes is captured for Duration every Interval.
+type ContinuousConfig struct {
+	// Interval is the time between the start of each capture cycle.
+	Interval time.Duration
+	// Duration is how long each mode is captured for.
+	Duration time.Duration
+	// Modes are the names of the modes captured each cycle, see ParseMode.
+	Modes []string
+	// OutputDir is the folder each cycle writes a timestamped folder to.
+	OutputDir string
+	// Keep is the number of the newest cycle folders retained, older
+	// folders are removed as each cycle completes, all are retained if
+	// zero.
+	Keep int
+	// UploadURLs are where the artifacts of each cycle are uploaded, see
+	// WithHTTPUpload, in addition to the sinks of the options.
+	UploadURLs []string
+	// OverheadBudget governs the cycles, see WithOverheadBudget, which it
+	// takes the place of unless zero.
+	OverheadBudget OverheadBudget
+}
+
+// validate checks the configuration can be scheduled.
+func (c ContinuousConfig) validate() error {
+	if len(c.Modes) == 0 {
+		return errors.New("continuous profiling requires at least one mode")
+	}
+	if c.Duration <= 0 {
+		return errors.New("continuous duration must be positive")
+	}
+	if c.Keep < 0 {
+		return errors.New("continuous keep must not be negative")
+	}
+	if c.Interval < c.Duration*time.Duration(len(c.Modes)) {
+		return fmt.Errorf("continuous interval %s is shorter than capturing every mode", c.Interval)
+	}
+	for _, mode := range c.Modes {
+		if _, err := ParseMode(mode); err != nil {
+			return err
+		}
+	}
+	for _, url := range c.UploadURLs {
+		if url == "" {
+			return errors.New("continuous upload urls must not be empty")
+		}
+	}
+	if c.OverheadBudget.CPU < 0 || c.OverheadBudget.Alloc < 0 {
+		return errors.New("continuous overhead budget must not be negative")
+	}
+	return nil
+}
+
+// ConfigLoader loads the configuration for continuous profiling, it is
+// invoked on start and again on every reload.
+type ConfigLoader func() (ContinuousConfig, error)
+
+// StaticConfig returns a loader which always returns config.
+func StaticConfig(config ContinuousConfig) ConfigLoader {
+	return func() (ContinuousConfig, error) {
+		return config, nil
+	}
+}
+
+// ConfigFile returns a loader which reads the configuration from the
+// json file at path, re-reading it on every reload:
+//
+//	{"interval": "5m", "duration": "30s", "modes": ["cpu", "heap"], "output_dir": "/var/log/profiles", "keep": 288,
+//	 "upload_urls": ["https://profiles.example.com"], "overhead_budget": {"cpu": 0.01, "alloc": 0.05}}
+func ConfigFile(path string) ConfigLoader {
+	return func() (ContinuousConfig, error) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return ContinuousConfig{}, err
+		}
+		var raw struct {
+			Interval       string   `json:"interval"`
+			Duration       string   `json:"duration"`
+			Modes          []string `json:"modes"`
+			OutputDir      string   `json:"output_dir"`
+			Keep           int      `json:"keep"`
+			UploadURLs     []string `json:"upload_urls"`
+			OverheadBudget struct {
+				CPU   float64 `json:"cpu"`
+				Alloc float64 `json:"alloc"`
+			} `json:"overhead_budget"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return ContinuousConfig{}, fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		config := ContinuousConfig{
+			Modes:          raw.Modes,
+			OutputDir:      raw.OutputDir,
+			Keep:           raw.Keep,
+			UploadURLs:     raw.UploadURLs,
+			OverheadBudget: OverheadBudget(raw.OverheadBudget),
+		}
+		if config.Interval, err = time.ParseDuration(raw.Interval); err != nil {
+			return ContinuousConfig{}, fmt.Errorf("invalid interval: %w", err)
+		}
+		if config.Duration, err = time.ParseDuration(raw.Duration); err != nil {
+			return ContinuousConfig{}, fmt.Errorf("invalid duration: %w", err)
+		}
+		return config, nil
+	}
+}
+
+// cycleTimeFormat names the folder each capture cycle is written to.
+const cycleTimeFormat = "20060102T150405"
+
+// Continuous captures profiles on a schedule for the lifetime of a long
+// running process.  Its configuration can be reloaded without restarting
+// the process with Reload or by sending the process SIGHUP.
+type Continuous struct {
+	loader   ConfigLoader
+	options  []ProfileOption
+	reporter *Profiler
+	mu       sync.Mutex
+	config   ContinuousConfig
+	reloaded chan struct{}
+	cancel   context.CancelFunc
+	wg       sync.WaitGroup
+	governor *governor
+}
+
+// StartContinuous loads the configuration and begins capturing until ctx
+// is done or Close is invoked.  options are applied to every capture, the
+// mode and output location are taken from the configuration.  SIGHUP
+// triggers a reload unless WithoutSignalHandling is provided.
+func StartContinuous(ctx context.Context, loader ConfigLoader, options ...ProfileOption) (*Continuous, error) {
+	config, err := loader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load continuous config: %w", err)
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c := &Continuous{
+		loader:   loader,
+		options:  options,
+		reporter: New(options...),
+		config:   config,
+		reloaded: make(chan struct{}, 1),
+		cancel:   cancel,
+	}
+	c.governorOf(config)
+	if c.reporter.signalHandling {
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGHUP)
+		c.wg.Add(1)
+		goInternal(func() {
+			defer c.wg.Done()
+			defer signal.Stop(ch)
+			for {
+				select {
+				case <-ch:
+					c.reporter.report("sighup received, reloading configuration")
+					if err := c.Reload(); err != nil {
+						c.reporter.report("[warning] %s", err)
+					}
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}
+	c.wg.Add(1)
+	goInternal(func() { c.run(ctx) })
+	return c, nil
+}
+
+// Config returns the configuration currently in effect.
+func (c *Continuous) Config() ContinuousConfig {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config
+}
+
+// Reload re-reads the configuration, logging what changed.  The new
+// configuration is applied to the schedule immediately and to captures,
+// uploads and the overhead budget from the next cycle, an invalid configuration is rejected and the
+// current configuration remains in effect.
+func (c *Continuous) Reload() error {
+	config, err := c.loader()
+	if err != nil {
+		return fmt.Errorf("failed to reload continuous config: %w", err)
+	}
+	if err := config.validate(); err != nil {
+		return fmt.Errorf("rejected continuous config: %w", err)
+	}
+	c.mu.Lock()
+	changes := diffConfig(c.config, config)
+	c.config = config
+	c.mu.Unlock()
+	if len(changes) == 0 {
+		c.reporter.report("configuration reloaded, nothing changed")
+		return nil
+	}
+	c.reporter.report("configuration reloaded: %s", strings.Join(changes, ", "))
+	select {
+	case c.reloaded <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Close stops capturing, interrupting any capture in progress.
+func (c *Continuous) Close() error {
+	c.cancel()
+	c.wg.Wait()
+	return nil
+}
+
+// run performs a capture cycle every interval until ctx is done.
+func (c *Continuous) run(ctx context.Context) {
+	defer c.wg.Done()
+	for {
+		began := time.Now()
+		c.governedCycle(ctx, c.Config())
+		if !c.wait(ctx, began) {
+			return
+		}
+	}
+}
+
+// wait blocks until the cycle after the one which began at began is
+// due, rescheduling on reload, returning false once ctx is done.
+func (c *Continuous) wait(ctx context.Context, began time.Time) bool {
+	for {
+		timer := time.NewTimer(time.Until(began.Add(c.Config().Interval)))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return false
+		case <-c.reloaded:
+			timer.Stop()
+		case <-timer.C:
+			return true
+		}
+	}
+}
+
+// governorOf returns the governor of the overhead budget of config, or of
+// WithOverheadBudget if it has none, nil if neither has a budget.  The
+// governor is retained across reloads which change the budget, one
+// created by a reload measures its baseline from then.
+func (c *Continuous) governorOf(config ContinuousConfig) *governor {
+	budget := config.OverheadBudget
+	if budget == (OverheadBudget{}) {
+		budget = c.reporter.overheadBudget
+	}
+	if budget == (OverheadBudget{}) {
+		c.governor = nil
+		return nil
+	}
+	if c.governor == nil {
+		c.governor = &governor{procs: runtime.GOMAXPROCS(0), idle: observe()}
+	}
+	c.governor.budget = budget
+	return c.governor
+}
+
+// governedCycle performs a capture cycle, measuring its overhead, unless
+// the overhead governor is backing off.
+func (c *Continuous) governedCycle(ctx context.Context, config ContinuousConfig) {
+	g := c.governorOf(config)
+	if g == nil {
+		c.cycle(ctx, config)
+		return
+	}
+	if !g.admit() {
+		return
+	}
+	start := observe()
+	c.cycle(ctx, config)
+	if change := g.record(start, observe(), config.Interval); change != "" {
+		c.reporter.report("%s", change)
+	}
+}
+
+// cycle captures every configured mode in turn into a timestamped folder,
+// writing an overview of the folder once a multi-mode cycle completes.
+func (c *Continuous) cycle(ctx context.Context, config ContinuousConfig) {
+	now := time.Now()
+	root := config.OutputDir
+	if c.reporter.datePartitioning {
+		// The cycle folder is partitioned once, rather than every
+		// capture partitioning beneath it.
+		root = datePartition(root, now)
+	}
+	folder := filepath.Join(root, now.Format(cycleTimeFormat))
+	var profilers []*Profiler
+	for _, name := range config.Modes {
+		mode, _ := ParseMode(name)
+		options := append([]ProfileOption{}, c.options...)
+		options = append(options, WithMode(mode), WithProfileFileLocation(folder), withoutDatePartitioning())
+		for _, url := range config.UploadURLs {
+			options = append(options, WithHTTPUpload(url))
+		}
+		p, err := Capture(ctx, config.Duration, options...)
+		profilers = append(profilers, p)
+		if errors.Is(err, ErrDisabled) {
+			c.reporter.report("profiling is disabled, skipping cycle")
+			return
+		}
+		if errors.Is(err, ErrNotSampled) {
+			return
+		}
+		if err != nil && ctx.Err() == nil {
+			c.reporter.report("[warning] continuous %s capture failed: %s", name, err)
+			if c.reporter.errorHandler != nil {
+				c.reporter.errorHandler(err)
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+	if err := writeOverviews(profilers); err != nil {
+		c.reporter.report("[warning] continuous overview failed: %s", err)
+	}
+	if config.Keep > 0 {
+		if err := retainCycles(c.reporter.fs, root, config.Keep); err != nil {
+			c.reporter.report("[warning] continuous retention failed: %s", err)
+		}
+	}
+}
+
+// retainCycles removes all but the newest keep cycle folders in root of
+// fsys, other entries of root are left alone.
+func retainCycles(fsys FS, root string, keep int) error {
+	cycles, err := cycleFolders(fsys, root)
+	if err != nil || len(cycles) <= keep {
+		return err
+	}
+	var errs []error
+	for _, name := range cycles[:len(cycles)-keep] {
+		errs = append(errs, removeAll(fsys, filepath.Join(root, name)))
+	}
+	return errors.Join(errs...)
+}
+
+// cycleFolders returns the names of the cycle folders in root of fsys,
+// oldest first.
+func cycleFolders(fsys FS, root string) ([]string, error) {
+	entries, err := fsys.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+	var cycles []string
+	for _, entry := range entries {
+		if _, err := time.Parse(cycleTimeFormat, entry.Name()); entry.IsDir() && err == nil {
+			cycles = append(cycles, entry.Name())
+		}
+	}
+	// The names sort chronologically and ReadDir sorts by name.
+	return cycles, nil
+}
+
+// withoutDatePartitioning disables date partitioning for captures whose
+// folder has already been partitioned.
+func withoutDatePartitioning() ProfileOption {
+	return func(p *Profiler) {
+		p.datePartitioning = false
+	}
+}
+
+// diffConfig describes each field that differs between before and after.
+func diffConfig(before ContinuousConfig, after ContinuousConfig) []string {
+	var changes []string
+	b, a := reflect.ValueOf(before), reflect.ValueOf(after)
+	for i := 0; i < b.NumField(); i++ {
+		if !reflect.DeepEqual(b.Field(i).Interface(), a.Field(i).Interface()) {
+			changes = append(changes, fmt.Sprintf("%s %v -> %v", b.Type().Field(i).Name, b.Field(i).Interface(), a.Field(i).Interface()))
+		}
+	}
+	return changes
+}
@@ -0,0 +1,212 @@
+package profiler
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContinuousReloadsOnSighup(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals cannot be sent on windows")
+	}
+	storage := t.TempDir()
+	config := filepath.Join(t.TempDir(), "config.json")
+	write := func(contents string) {
+		if err := os.WriteFile(config, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`{"interval": "1h", "duration": "10ms", "modes": ["heap"], "output_dir": "` + storage + `"}`)
+
+	c, err := StartContinuous(context.Background(), ConfigFile(config), WithQuietOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	write(`{"interval": "50ms", "duration": "10ms", "modes": ["heap", "goroutine"], "output_dir": "` + storage + `"}`)
+	process, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := process.Signal(syscall.SIGHUP); err != nil {
+		t.Fatal(err)
+	}
+	assert.Eventually(t, func() bool {
+		return c.Config().Interval == 50*time.Millisecond
+	}, time.Second, time.Millisecond)
+	// The reloaded interval is applied to the schedule, capturing both modes.
+	assert.Eventually(t, func() bool {
+		matches, _ := filepath.Glob(filepath.Join(storage, "*", GoroutineFileName))
+		return len(matches) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestContinuousRejectsInvalidReload(t *testing.T) {
+	valid := ContinuousConfig{Interval: time.Hour, Duration: time.Millisecond, Modes: []string{"heap"}, OutputDir: t.TempDir()}
+	configs := []ContinuousConfig{valid, {Interval: time.Hour, Duration: time.Millisecond, Modes: []string{"unknown"}}}
+	loader := func() (ContinuousConfig, error) {
+		config := configs[0]
+		configs = configs[1:]
+		return config, nil
+	}
+	c, err := StartContinuous(context.Background(), loader, WithQuietOutput(), WithoutSignalHandling())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	assert.ErrorContains(t, c.Reload(), "unknown profiler mode")
+	assert.Equal(t, valid, c.Config())
+}
+
+func TestContinuousReloadsUploadsAndBudget(t *testing.T) {
+	var uploads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		uploads.Add(1)
+	}))
+	defer server.Close()
+	config := filepath.Join(t.TempDir(), "config.json")
+	write := func(contents string) {
+		if err := os.WriteFile(config, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	storage := strconv.Quote(t.TempDir())
+	write(`{"interval": "20ms", "duration": "1ms", "modes": ["heap"], "output_dir": ` + storage + `}`)
+	c, err := StartContinuous(context.Background(), ConfigFile(config), WithQuietOutput(), WithoutSignalHandling())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	write(`{"interval": "20ms", "duration": "1ms", "modes": ["heap"], "output_dir": ` + storage + `,
+		"upload_urls": ["` + server.URL + `"], "overhead_budget": {"cpu": 0.5, "alloc": 0.25}}`)
+	assert.NoError(t, c.Reload())
+	assert.Equal(t, []string{server.URL}, c.Config().UploadURLs)
+	assert.Equal(t, OverheadBudget{CPU: 0.5, Alloc: 0.25}, c.Config().OverheadBudget)
+	assert.Eventually(t, func() bool { return uploads.Load() > 0 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestContinuousGovernorFollowsTheBudget(t *testing.T) {
+	c := &Continuous{reporter: New(WithOverheadBudget(OverheadBudget{CPU: 0.01}), WithQuietOutput())}
+	g := c.governorOf(ContinuousConfig{})
+	if assert.NotNil(t, g) {
+		assert.Equal(t, OverheadBudget{CPU: 0.01}, g.budget)
+	}
+	// The budget of the config takes the place of the option, retaining
+	// the governor and its backoff.
+	g.backoff = 2
+	assert.Same(t, g, c.governorOf(ContinuousConfig{OverheadBudget: OverheadBudget{Alloc: 0.1}}))
+	assert.Equal(t, OverheadBudget{Alloc: 0.1}, g.budget)
+	assert.Equal(t, 2, g.backoff)
+
+	c = &Continuous{reporter: New(WithQuietOutput())}
+	assert.NotNil(t, c.governorOf(ContinuousConfig{OverheadBudget: OverheadBudget{CPU: 0.01}}))
+	assert.Nil(t, c.governorOf(ContinuousConfig{}))
+	assert.Nil(t, c.governor)
+}
+
+func TestContinuousConfigValidatesUploadsAndBudget(t *testing.T) {
+	valid := ContinuousConfig{Interval: time.Hour, Duration: time.Millisecond, Modes: []string{"heap"}}
+	config := valid
+	config.UploadURLs = []string{""}
+	assert.ErrorContains(t, config.validate(), "upload urls must not be empty")
+	config = valid
+	config.OverheadBudget = OverheadBudget{CPU: -1}
+	assert.ErrorContains(t, config.validate(), "overhead budget must not be negative")
+}
+
+func TestDiffConfig(t *testing.T) {
+	before := ContinuousConfig{Interval: time.Minute, Duration: time.Second, Modes: []string{"cpu"}}
+	after := before
+	after.Interval = time.Hour
+	assert.Equal(t, []string{"Interval 1m0s -> 1h0m0s"}, diffConfig(before, after))
+}
+
+func TestContinuousHonoursEnabledFunc(t *testing.T) {
+	storage := t.TempDir()
+	var enabled atomic.Bool
+	config := ContinuousConfig{Interval: 20 * time.Millisecond, Duration: time.Millisecond, Modes: []string{"heap"}, OutputDir: storage}
+	c, err := StartContinuous(context.Background(), StaticConfig(config), WithEnabledFunc(enabled.Load), WithQuietOutput(), WithoutSignalHandling())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	time.Sleep(50 * time.Millisecond)
+	matches, _ := filepath.Glob(filepath.Join(storage, "*", MemoryFileName))
+	assert.Empty(t, matches)
+
+	enabled.Store(true)
+	assert.Eventually(t, func() bool {
+		matches, _ := filepath.Glob(filepath.Join(storage, "*", MemoryFileName))
+		return len(matches) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestContinuousPartitionsCyclesByDate(t *testing.T) {
+	storage := t.TempDir()
+	config := ContinuousConfig{Interval: time.Hour, Duration: time.Millisecond, Modes: []string{"heap"}, OutputDir: storage}
+	c, err := StartContinuous(context.Background(), StaticConfig(config), WithDatePartitioning(), WithQuietOutput(), WithoutSignalHandling())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	assert.Eventually(t, func() bool {
+		matches, _ := filepath.Glob(filepath.Join(storage, "*", "*", "*", "*", MemoryFileName))
+		return len(matches) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	matches, _ := filepath.Glob(filepath.Join(storage, "*", "*", "*", "*", "*", MemoryFileName))
+	assert.Empty(t, matches)
+}
+
+func TestRetainCycles(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"20240101T000000", "20240101T000100", "20240101T000200", "unrelated"} {
+		if err := os.Mkdir(filepath.Join(root, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.NoError(t, retainCycles(OSFS{}, root, 2))
+	entries, _ := os.ReadDir(root)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	assert.Equal(t, []string{"20240101T000100", "20240101T000200", "unrelated"}, names)
+	assert.NoError(t, retainCycles(OSFS{}, root, 5))
+	cycles, _ := cycleFolders(OSFS{}, root)
+	assert.Len(t, cycles, 2)
+}
+
+// wrappedFS is the OSFS as an FS of another type, exercising the paths
+// taken for filesystems other than that of the operating system.
+type wrappedFS struct{ OSFS }
+
+func TestRetainCyclesOfOtherFS(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{"20240101T000000", "20240101T000100"} {
+		if err := os.MkdirAll(filepath.Join(root, name, "nested"), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, name, "nested", CPUFileName), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.NoError(t, retainCycles(wrappedFS{}, root, 1))
+	cycles, err := cycleFolders(wrappedFS{}, root)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"20240101T000100"}, cycles)
+}
@@ -0,0 +1,81 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// hostLockPoll is how often a capture waiting on another process of the
+// host retries the lock.
+var hostLockPoll = 100 * time.Millisecond
+
+// hostLockTimeout bounds the wait for the host lock, so that a process
+// which hangs while holding it does not stall every other capture of the
+// host indefinitely.
+var hostLockTimeout = 5 * time.Minute
+
+// errHostLockUnsupported is returned on platforms without file locks.
+var errHostLockUnsupported = errors.New("host coordination is not supported on this platform")
+
+// hostCoordination returns middleware which holds an exclusive lock on the
+// file at path for the duration of every capture, so that processes on the
+// same host sharing the path capture one after another rather than all at
+// once.  The lock is released by the operating system if a process dies.
+func hostCoordination(path string) StrategyMiddleware {
+	return func(next StrategyFunc) StrategyFunc {
+		return func(p *Profiler) (FinalizerFunc, error) {
+			ctx := p.startCtx
+			if ctx == nil {
+				ctx = context.Background()
+			}
+			unlock, err := acquireHostLock(ctx, path, func() {
+				p.report("another process on the host is capturing, waiting on %s before starting %s", path, p.Mode())
+			})
+			if err != nil {
+				return nil, err
+			}
+			finalizer, err := next(p)
+			if err != nil {
+				return nil, errors.Join(err, unlock())
+			}
+			return func() error {
+				return errors.Join(finalizer(), unlock())
+			}, nil
+		}
+	}
+}
+
+// acquireHostLock takes the exclusive lock on the file at path, polling
+// until it is free, ctx is done or hostLockTimeout elapses, invoking
+// waiting once if it is held by another process.  The returned function
+// releases the lock.
+func acquireHostLock(ctx context.Context, path string, waiting func()) (func() error, error) {
+	ctx, cancel := context.WithTimeout(ctx, hostLockTimeout)
+	defer cancel()
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open host lock: %w", err)
+	}
+	reported := false
+	for {
+		locked, err := lockFile(f)
+		if err != nil {
+			return nil, errors.Join(fmt.Errorf("failed to lock %s: %w", path, err), f.Close())
+		}
+		if locked {
+			return func() error { return errors.Join(unlockFile(f), f.Close()) }, nil
+		}
+		if !reported {
+			waiting()
+			reported = true
+		}
+		select {
+		case <-ctx.Done():
+			return nil, errors.Join(fmt.Errorf("waiting on host lock %s: %w", path, ctx.Err()), f.Close())
+		case <-time.After(hostLockPoll):
+		}
+	}
+}
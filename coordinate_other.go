@@ -0,0 +1,15 @@
+//go:build !unix
+
+package profiler
+
+import "os"
+
+// lockFile is not supported on this platform.
+func lockFile(*os.File) (bool, error) {
+	return false, errHostLockUnsupported
+}
+
+// unlockFile is not supported on this platform.
+func unlockFile(*os.File) error {
+	return errHostLockUnsupported
+}
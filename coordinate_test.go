@@ -0,0 +1,74 @@
+package profiler
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireHostLockWaitsForTheHolder(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("host coordination is only supported on unix")
+	}
+	path := filepath.Join(t.TempDir(), "profiler.lock")
+	unlock, err := acquireHostLock(context.Background(), path, func() { t.Error("the lock is free") })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	waited := 0
+	_, err = acquireHostLock(ctx, path, func() { waited++ })
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, waited)
+
+	assert.NoError(t, unlock())
+	unlock, err = acquireHostLock(context.Background(), path, func() { t.Error("the lock was released") })
+	assert.NoError(t, err)
+	assert.NoError(t, unlock())
+}
+
+func TestHostCoordinationStaggersCaptures(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("host coordination is only supported on unix")
+	}
+	path := filepath.Join(t.TempDir(), "profiler.lock")
+	// Another process on the host is capturing.
+	release, err := acquireHostLock(context.Background(), path, func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(100*time.Millisecond, func() { _ = release() })
+
+	began := time.Now()
+	p, err := Capture(context.Background(), 10*time.Millisecond, WithMode(GoroutineMode), WithProfileFileLocation(t.TempDir()), WithHostCoordination(path), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(began), 100*time.Millisecond)
+	assert.Len(t, p.ArtifactPaths(), 1)
+
+	// The lock is released once the capture completes.
+	unlock, err := acquireHostLock(context.Background(), path, func() { t.Error("the capture still holds the lock") })
+	assert.NoError(t, err)
+	assert.NoError(t, unlock())
+}
+
+func TestAcquireHostLockTimesOut(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("host coordination is only supported on unix")
+	}
+	defer func(timeout time.Duration) { hostLockTimeout = timeout }(hostLockTimeout)
+	hostLockTimeout = 50 * time.Millisecond
+	path := filepath.Join(t.TempDir(), "profiler.lock")
+	unlock, err := acquireHostLock(context.Background(), path, func() {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+	_, err = acquireHostLock(context.Background(), path, func() {})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
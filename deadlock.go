@@ -0,0 +1,361 @@
+package profiler
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// goroutineHeader matches the first line of each goroutine of a debug=2
+// goroutine dump, such as `goroutine 18 [chan receive, 2 minutes]:`.
+var goroutineHeader = regexp.MustCompile(`^goroutine (\d+)(?: [^\[]*)? \[(.*)\]:$`)
+
+// waitFunctions identify what a goroutine is blocked on by the standard
+// library function it is blocked in, matched without the package path so
+// that internal/sync and sync are alike.
+var waitFunctions = map[string]string{
+	"sync.(*Mutex).Lock":     "mutex",
+	"sync.(*Mutex).lockSlow": "mutex",
+	"sync.(*RWMutex).Lock":   "mutex",
+	"sync.(*RWMutex).RLock":  "mutex",
+	"runtime.chanrecv1":      "chan receive",
+	"runtime.chanrecv2":      "chan receive",
+	"runtime.chansend1":      "chan send",
+	"sync.(*WaitGroup).Wait": "wait group",
+	"sync.(*Cond).Wait":      "cond wait",
+}
+
+// addressWindow is how far past an address an object waited on may lie
+// and still be referenced by it, such as a mutex embedded in a struct
+// whose pointer is passed as an argument.
+const addressWindow = 64
+
+// minimumAddress is the smallest argument considered a pointer, smaller
+// values are most likely integers.
+const minimumAddress = 0x10000
+
+// dumpedGoroutine is a goroutine of a debug=2 goroutine dump.
+type dumpedGoroutine struct {
+	id       int
+	minutes  int
+	frames   []dumpedFrame
+	waitKind string
+	waitAddr uint64
+	// blocking is the number of leaf frames which wait, their arguments
+	// are not references held by the goroutine.
+	blocking int
+}
+
+// dumpedFrame is a frame of a goroutine of a debug=2 goroutine dump.
+type dumpedFrame struct {
+	function  string
+	addresses []uint64
+}
+
+// SuspectedDeadlock is a group of goroutines each blocked on an object
+// referenced by another goroutine of the group, a cycle in which no
+// goroutine can progress.
+type SuspectedDeadlock struct {
+	// Goroutines are the ids of the goroutines of the group, ascending.
+	Goroutines []int
+	// Waits describe what each goroutine of the group waits on, in the
+	// order of Goroutines.
+	Waits []string
+}
+
+// String describes the group, such as "goroutines 18, 19".
+func (d SuspectedDeadlock) String() string {
+	ids := make([]string, len(d.Goroutines))
+	for i, id := range d.Goroutines {
+		ids[i] = strconv.Itoa(id)
+	}
+	return fmt.Sprintf("goroutines %s: %s", strings.Join(ids, ", "), strings.Join(d.Waits, "; "))
+}
+
+// SuspectDeadlocks parses the debug=2 goroutine dump in r and returns the
+// groups of goroutines which appear to be waiting on each other.  A dump
+// does not record which goroutine holds a mutex or will send on a channel,
+// so a goroutine is assumed to hold the objects passed as arguments to the
+// functions on its stack.  Tracebacks omit runtime frames, so waits on a
+// channel are only attributed when the dump includes them, such as with
+// GOTRACEBACK=system.  This is best effort, both false positives and
+// deadlocks which are missed are possible.
+func SuspectDeadlocks(r io.Reader) ([]SuspectedDeadlock, error) {
+	goroutines, err := parseGoroutineDump(r)
+	if err != nil {
+		return nil, err
+	}
+	// edges[i] are the goroutines holding the object goroutine i waits on.
+	edges := make([][]int, len(goroutines))
+	for i, waiter := range goroutines {
+		if waiter.waitAddr == 0 {
+			continue
+		}
+		for j, holder := range goroutines {
+			// A goroutine waiting on the same object cannot be the one to
+			// release it.
+			if i == j || holder.waitAddr == waiter.waitAddr || !holder.references(waiter.waitAddr) {
+				continue
+			}
+			edges[i] = append(edges[i], j)
+		}
+	}
+	var deadlocks []SuspectedDeadlock
+	for _, component := range stronglyConnected(edges) {
+		if len(component) < 2 {
+			continue
+		}
+		sort.Slice(component, func(i, j int) bool { return goroutines[component[i]].id < goroutines[component[j]].id })
+		var d SuspectedDeadlock
+		for _, i := range component {
+			g := goroutines[i]
+			d.Goroutines = append(d.Goroutines, g.id)
+			d.Waits = append(d.Waits, g.describe())
+		}
+		deadlocks = append(deadlocks, d)
+	}
+	sort.Slice(deadlocks, func(i, j int) bool { return deadlocks[i].Goroutines[0] < deadlocks[j].Goroutines[0] })
+	return deadlocks, nil
+}
+
+// references reports whether any frame of the goroutine, beneath those
+// which wait, was passed a pointer to or just before address.
+func (g dumpedGoroutine) references(address uint64) bool {
+	for _, frame := range g.frames[g.blocking:] {
+		for _, a := range frame.addresses {
+			if near(a, address) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// describe describes what the goroutine waits on and where.
+func (g dumpedGoroutine) describe() string {
+	names := make([]string, len(g.frames))
+	for i, frame := range g.frames {
+		names[i] = frame.function
+	}
+	description := fmt.Sprintf("goroutine %d waits on %s %#x in %s", g.id, g.waitKind, g.waitAddr, blockingFrame(names))
+	if g.minutes > 0 {
+		description += fmt.Sprintf(" for %d minutes", g.minutes)
+	}
+	return description
+}
+
+// near reports whether address lies within addressWindow past base.
+func near(base uint64, address uint64) bool {
+	return address >= base && address-base < addressWindow
+}
+
+// parseGoroutineDump parses the goroutines of a debug=2 goroutine dump.
+func parseGoroutineDump(r io.Reader) ([]dumpedGoroutine, error) {
+	var goroutines []dumpedGoroutine
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	var current *dumpedGoroutine
+	for scanner.Scan() {
+		line := scanner.Text()
+		if match := goroutineHeader.FindStringSubmatch(line); match != nil {
+			goroutines = append(goroutines, dumpedGoroutine{})
+			current = &goroutines[len(goroutines)-1]
+			current.id, _ = strconv.Atoi(match[1])
+			current.minutes = waitedMinutes(match[2])
+			continue
+		}
+		// Source lines are indented and the creator is not on the stack.
+		if current == nil || line == "" || strings.HasPrefix(line, "\t") || strings.HasPrefix(line, "created by ") {
+			continue
+		}
+		current.frames = append(current.frames, parseDumpedFrame(line))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	for i := range goroutines {
+		goroutines[i].classifyWait()
+	}
+	return goroutines, nil
+}
+
+// waitedMinutes returns the minutes waited from the status of a goroutine
+// header, such as "chan receive, 2 minutes", zero if under a minute.
+func waitedMinutes(status string) int {
+	for _, part := range strings.Split(status, ", ") {
+		if n, ok := strings.CutSuffix(part, " minutes"); ok {
+			minutes, _ := strconv.Atoi(n)
+			return minutes
+		}
+	}
+	return 0
+}
+
+// parseDumpedFrame parses a frame such as `main.a(0xc0000a8008, 0x1?)`,
+// keeping the arguments which look like pointers.
+func parseDumpedFrame(line string) dumpedFrame {
+	open := strings.LastIndex(line, "(")
+	if open < 0 || !strings.HasSuffix(line, ")") {
+		return dumpedFrame{function: line}
+	}
+	frame := dumpedFrame{function: line[:open]}
+	for _, arg := range strings.Split(line[open+1:len(line)-1], ", ") {
+		arg = strings.Trim(arg, "{}?")
+		if !strings.HasPrefix(arg, "0x") {
+			continue
+		}
+		if a, err := strconv.ParseUint(arg[2:], 16, 64); err == nil && a >= minimumAddress {
+			frame.addresses = append(frame.addresses, a)
+		}
+	}
+	return frame
+}
+
+// classifyWait determines the object the goroutine is blocked on from the
+// innermost wait function amongst the standard library frames at its leaf.
+// The arguments of outer frames may be stale, such as those of
+// sync.(*Mutex).Lock in a binary built with -race, which does not inline
+// it.
+func (g *dumpedGoroutine) classifyWait() {
+	for i, frame := range g.frames {
+		if !standardLibrary(frame.function) {
+			break
+		}
+		g.blocking = i + 1
+		name := frame.function
+		if slash := strings.LastIndex(name, "/"); slash >= 0 {
+			name = name[slash+1:]
+		}
+		kind, ok := waitFunctions[name]
+		if !ok || len(frame.addresses) == 0 || g.waitAddr != 0 {
+			continue
+		}
+		g.waitKind, g.waitAddr = kind, frame.addresses[0]
+	}
+}
+
+// stronglyConnected returns the strongly connected components of the graph
+// of edges, using Tarjan's algorithm.
+func stronglyConnected(edges [][]int) [][]int {
+	index := make([]int, len(edges))
+	low := make([]int, len(edges))
+	onStack := make([]bool, len(edges))
+	for i := range index {
+		index[i] = -1
+	}
+	var stack []int
+	var components [][]int
+	next := 0
+	var connect func(v int)
+	connect = func(v int) {
+		index[v], low[v] = next, next
+		next++
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range edges[v] {
+			if index[w] < 0 {
+				connect(w)
+				low[v] = min(low[v], low[w])
+			} else if onStack[w] {
+				low[v] = min(low[v], index[w])
+			}
+		}
+		if low[v] != index[v] {
+			return
+		}
+		var component []int
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			component = append(component, w)
+			if w == v {
+				break
+			}
+		}
+		components = append(components, component)
+	}
+	for v := range edges {
+		if index[v] < 0 {
+			connect(v)
+		}
+	}
+	return components
+}
+
+// writeGoroutineDump writes a debug=2 goroutine dump alongside the goroutine
+// profile and records the deadlocks suspected from it.
+func (p *Profiler) writeGoroutineDump() error {
+	var dump bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&dump, 2); err != nil {
+		return err
+	}
+	w, err := p.createArtifact(GoroutineDumpFileName)
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(dump.Bytes()); err != nil {
+		return errors.Join(err, w.Close())
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	deadlocks, err := SuspectDeadlocks(&dump)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	p.deadlocks = deadlocks
+	p.mu.Unlock()
+	return nil
+}
+
+// reportDeadlocks warns of each deadlock suspected, see WithDeadlockDetection.
+func (p *Profiler) reportDeadlocks() {
+	for _, d := range p.Report().Deadlocks {
+		p.report("[warning] suspected deadlock of %s", d)
+	}
+}
+
+// NoProgressCondition is met when counter, such as the number of requests
+// served or jobs completed, has not changed since it was last polled.  The
+// condition is met once per stall, counter must change before it is met
+// again.
+func NoProgressCondition(counter func() int64) Condition {
+	var last int64
+	polled, stalled := false, false
+	return func() (bool, string) {
+		value := counter()
+		if !polled || value != last {
+			polled, stalled, last = true, false, value
+			return false, ""
+		}
+		if stalled {
+			return false, ""
+		}
+		stalled = true
+		return true, fmt.Sprintf("no progress, the counter remains at %d", value)
+	}
+}
+
+// DeadlockTrigger returns a Trigger capturing a goroutine profile and
+// checking it for deadlocks each time counter stops progressing, see
+// NoProgressCondition and WithDeadlockDetection.  The Interval of the
+// trigger must be longer than counter is expected to be idle for.
+//
+//	go profiler.DeadlockTrigger(served.Load, profiler.WithProfileFileLocation("/var/log/profiles")).Watch(ctx)
+func DeadlockTrigger(counter func() int64, options ...ProfileOption) Trigger {
+	return Trigger{
+		Condition: NoProgressCondition(counter),
+		Interval:  time.Minute,
+		Options:   append([]ProfileOption{WithMode(GoroutineMode), WithDeadlockDetection()}, options...),
+	}
+}
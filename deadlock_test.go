@@ -0,0 +1,148 @@
+package profiler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mutexDeadlockDump is a debug=2 goroutine dump of two goroutines locking
+// two mutexes in opposite orders, alongside two workers receiving from the
+// same channel and a goroutine waiting on them.  The stale argument of
+// sync.(*Mutex).Lock of goroutine 19 is as dumped by a -race binary.
+const mutexDeadlockDump = `goroutine 1 [semacquire]:
+sync.runtime_Semacquire(0xc000012108?)
+	/usr/local/go/src/runtime/sema.go:71 +0x25
+sync.(*WaitGroup).Wait(0xc000012100)
+	/usr/local/go/src/sync/waitgroup.go:118 +0x48
+main.main()
+	/app/main.go:30 +0x1d5
+
+goroutine 18 [sync.Mutex.Lock, 2 minutes]:
+internal/sync.runtime_SemacquireMutex(0xc000012094?, 0x0?, 0x1?)
+	/usr/local/go/src/runtime/sema.go:95 +0x25
+internal/sync.(*Mutex).lockSlow(0xc000012090)
+	/usr/local/go/src/internal/sync/mutex.go:149 +0x15d
+internal/sync.(*Mutex).Lock(...)
+	/usr/local/go/src/internal/sync/mutex.go:70
+sync.(*Mutex).Lock(...)
+	/usr/local/go/src/sync/mutex.go:46
+main.transfer(0xc000012080, 0xc000012090, 0xc000012100)
+	/app/main.go:12 +0x85
+created by main.main in goroutine 1
+	/app/main.go:25 +0x125
+
+goroutine 19 [sync.Mutex.Lock, 2 minutes]:
+internal/sync.runtime_SemacquireMutex(0xc000012084?, 0x0?, 0x1?)
+	/usr/local/go/src/runtime/sema.go:95 +0x25
+internal/sync.(*Mutex).lockSlow(0xc000012080)
+	/usr/local/go/src/internal/sync/mutex.go:149 +0x15d
+sync.(*Mutex).Lock(0xc000012100?)
+	/usr/local/go/src/sync/mutex.go:46 +0x15
+main.transfer(0xc000012090, 0xc000012080, 0xc000012100)
+	/app/main.go:12 +0x85
+created by main.main in goroutine 1
+	/app/main.go:26 +0x125
+
+goroutine 20 [chan receive]:
+main.worker(0xc00007e000)
+	/app/main.go:40 +0x2d
+created by main.main in goroutine 1
+	/app/main.go:27 +0x145
+
+goroutine 21 [chan receive]:
+runtime.chanrecv1(0xc00007e000, 0x0)
+	/usr/local/go/src/runtime/chan.go:489 +0x12
+main.worker(0xc00007e000)
+	/app/main.go:40 +0x2d
+created by main.main in goroutine 1
+	/app/main.go:27 +0x145
+
+goroutine 22 [chan receive]:
+runtime.chanrecv1(0xc00007e000, 0x0)
+	/usr/local/go/src/runtime/chan.go:489 +0x12
+main.worker(0xc00007e000)
+	/app/main.go:40 +0x2d
+created by main.main in goroutine 1
+	/app/main.go:27 +0x145
+`
+
+func TestSuspectDeadlocks(t *testing.T) {
+	deadlocks, err := SuspectDeadlocks(strings.NewReader(mutexDeadlockDump))
+	assert.NoError(t, err)
+	assert.Equal(t, []SuspectedDeadlock{{
+		Goroutines: []int{18, 19},
+		Waits: []string{
+			"goroutine 18 waits on mutex 0xc000012090 in main.transfer for 2 minutes",
+			"goroutine 19 waits on mutex 0xc000012080 in main.transfer for 2 minutes",
+		},
+	}}, deadlocks)
+	assert.True(t, strings.HasPrefix(deadlocks[0].String(), "goroutines 18, 19: goroutine 18 waits on mutex"))
+}
+
+func TestParseDumpedFrame(t *testing.T) {
+	assert.Equal(t, dumpedFrame{function: "sync.(*Mutex).Lock"}, parseDumpedFrame("sync.(*Mutex).Lock(...)"))
+	assert.Equal(t, dumpedFrame{function: "main.f", addresses: []uint64{0xc000012094}}, parseDumpedFrame("main.f(0xc000012094?, 0x0, {0x1, 0x2})"))
+	assert.Equal(t, 0, waitedMinutes("chan receive"))
+	assert.Equal(t, 12, waitedMinutes("select, 12 minutes, locked to thread"))
+}
+
+// lockBoth locks first and then second, two of which with the mutexes
+// swapped deadlock.  The first mutex is only unlocked when unlockFirst is
+// true, as the test releases the deadlock by unlocking it on their behalf.
+//
+//go:noinline
+func lockBoth(first *sync.Mutex, second *sync.Mutex, locked *sync.WaitGroup, unlockFirst bool) {
+	first.Lock()
+	locked.Done()
+	locked.Wait()
+	second.Lock()
+	second.Unlock()
+	if unlockFirst {
+		first.Unlock()
+	}
+}
+
+func TestDeadlockDetection(t *testing.T) {
+	var a, b sync.Mutex
+	var locked, done sync.WaitGroup
+	locked.Add(2)
+	done.Add(2)
+	go func() { defer done.Done(); lockBoth(&a, &b, &locked, true) }()
+	go func() { defer done.Done(); lockBoth(&b, &a, &locked, false) }()
+	locked.Wait()
+	// Allow both to block on their second mutex.
+	time.Sleep(10 * time.Millisecond)
+	p, err := Capture(context.Background(), time.Millisecond, WithMode(GoroutineMode), WithDeadlockDetection(), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	b.Unlock()
+	done.Wait()
+	assert.NoError(t, err)
+	assert.Len(t, p.Report().Artifacts, 2)
+	deadlocks := p.Report().Deadlocks
+	if assert.Len(t, deadlocks, 1) {
+		assert.Len(t, deadlocks[0].Goroutines, 2)
+		assert.Contains(t, deadlocks[0].Waits[0], "waits on mutex")
+		assert.Contains(t, deadlocks[0].Waits[0], "lockBoth")
+	}
+}
+
+func TestNoProgressCondition(t *testing.T) {
+	var counter int64
+	condition := NoProgressCondition(func() int64 { return counter })
+	met, _ := condition()
+	assert.False(t, met)
+	met, reason := condition()
+	assert.True(t, met)
+	assert.Equal(t, "no progress, the counter remains at 0", reason)
+	met, _ = condition()
+	assert.False(t, met, "met once per stall")
+	counter++
+	met, _ = condition()
+	assert.False(t, met)
+	met, _ = condition()
+	assert.True(t, met)
+}
@@ -0,0 +1,154 @@
+package profiler
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/google/pprof/profile"
+)
+
+// deduplicator remembers the normalized samples of the most recent
+// artifact of each name, it is shared by every capture configured with
+// the same WithDeduplication option.
+type deduplicator struct {
+	similarity float64
+	mu         sync.Mutex
+	previous   map[string]normalizedProfile
+}
+
+// normalizedProfile is a profile reduced to the sum of its sample values
+// keyed by call stack, independent of addresses, mappings and ordering.
+type normalizedProfile struct {
+	hash    [sha256.Size]byte
+	samples map[string][]int64
+}
+
+// duplicate reports whether the artifact at path is identical (or
+// within a non zero similarity threshold) to the previous artifact of
+// the same name, remembering it as the previous artifact if it is not.
+// Artifacts which cannot be parsed as profiles are never duplicates.
+func (d *deduplicator) duplicate(fsys FS, path string) bool {
+	current, err := normalizeProfile(fsys, path)
+	if err != nil {
+		return false
+	}
+	name := filepath.Base(path)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	previous, ok := d.previous[name]
+	if ok && (previous.hash == current.hash || d.similarity > 0 && similarity(previous, current) >= d.similarity) {
+		return true
+	}
+	d.previous[name] = current
+	return false
+}
+
+// normalizeProfile parses the profile at path of fsys and normalizes its
+// samples.
+func normalizeProfile(fsys FS, path string) (normalizedProfile, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return normalizedProfile{}, err
+	}
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	if err != nil {
+		return normalizedProfile{}, err
+	}
+	samples := make(map[string][]int64, len(prof.Sample))
+	for _, sample := range prof.Sample {
+		var frames []string
+		for _, location := range sample.Location {
+			for _, line := range location.Line {
+				if line.Function != nil {
+					frames = append(frames, line.Function.Name)
+				}
+			}
+		}
+		key := strings.Join(frames, ";")
+		values, ok := samples[key]
+		if !ok {
+			values = make([]int64, len(sample.Value))
+			samples[key] = values
+		}
+		for i, value := range sample.Value {
+			if i < len(values) {
+				values[i] += value
+			}
+		}
+	}
+	keys := make([]string, 0, len(samples))
+	for key := range samples {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s=%v\n", key, samples[key])
+	}
+	normalized := normalizedProfile{samples: samples}
+	copy(normalized.hash[:], h.Sum(nil))
+	return normalized, nil
+}
+
+// similarity returns a value between 0 (nothing in common) and 1
+// (identical) comparing the sample values of a and b by call stack.
+func similarity(a normalizedProfile, b normalizedProfile) float64 {
+	var diff, total float64
+	accumulate := func(x []int64, y []int64) {
+		for i := 0; i < len(x) || i < len(y); i++ {
+			var xv, yv float64
+			if i < len(x) {
+				xv = math.Abs(float64(x[i]))
+			}
+			if i < len(y) {
+				yv = math.Abs(float64(y[i]))
+			}
+			diff += math.Abs(xv - yv)
+			total += xv + yv
+		}
+	}
+	for key, values := range a.samples {
+		accumulate(values, b.samples[key])
+	}
+	for key, values := range b.samples {
+		if _, ok := a.samples[key]; !ok {
+			accumulate(nil, values)
+		}
+	}
+	if total == 0 {
+		return 1
+	}
+	return 1 - diff/total
+}
+
+// deduplicate removes artifacts which duplicate the previous artifact
+// of the same name, so that they are neither persisted nor uploaded.
+func (p *Profiler) deduplicate() {
+	if p.deduplicator == nil {
+		return
+	}
+	var kept, duplicates []string
+	for _, path := range p.ArtifactPaths() {
+		if !p.deduplicator.duplicate(p.fs, path) {
+			kept = append(kept, path)
+			continue
+		}
+		if err := p.fs.Remove(path); err != nil {
+			p.recordError(fmt.Errorf("failed to remove duplicate artifact: %w", err))
+			kept = append(kept, path)
+			continue
+		}
+		p.report("%s is a duplicate of the previous capture, it was discarded", path)
+		duplicates = append(duplicates, path)
+	}
+	p.mu.Lock()
+	p.artifacts = kept
+	p.duplicates = append(p.duplicates, duplicates...)
+	p.mu.Unlock()
+}
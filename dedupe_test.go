@@ -0,0 +1,79 @@
+package profiler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimilarity(t *testing.T) {
+	a := normalizedProfile{samples: map[string][]int64{"main;work": {10}, "main;idle": {10}}}
+	b := normalizedProfile{samples: map[string][]int64{"main;work": {10}, "main;idle": {30}}}
+	assert.Equal(t, 1.0, similarity(a, a))
+	assert.InDelta(t, 2.0/3, similarity(a, b), 0.0001)
+	assert.Equal(t, 0.0, similarity(a, normalizedProfile{samples: map[string][]int64{"other": {20}}}))
+}
+
+// writeSampledProfile writes a profile of a single sample of each stack
+// with the given values to the file named name beneath dir.
+func writeSampledProfile(t *testing.T, dir string, name string, values map[string]int64) string {
+	t.Helper()
+	prof := &profile.Profile{SampleType: []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}}}
+	for stack, value := range values {
+		id := uint64(len(prof.Function) + 1)
+		fn := &profile.Function{ID: id, Name: stack}
+		location := &profile.Location{ID: id, Line: []profile.Line{{Function: fn}}}
+		prof.Function = append(prof.Function, fn)
+		prof.Location = append(prof.Location, location)
+		prof.Sample = append(prof.Sample, &profile.Sample{Location: []*profile.Location{location}, Value: []int64{value}})
+	}
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, prof.Write(f))
+	return path
+}
+
+func TestDeduplicationThresholds(t *testing.T) {
+	previous := map[string]int64{"work": 100, "idle": 100}
+	near := map[string]int64{"work": 100, "idle": 110}
+	for _, test := range []struct {
+		similarity float64
+		current    map[string]int64
+		duplicate  bool
+	}{
+		{similarity: 0, current: previous, duplicate: true},
+		{similarity: 0, current: near, duplicate: false},
+		{similarity: 0.95, current: near, duplicate: true},
+		{similarity: 0.99, current: near, duplicate: false},
+		{similarity: 1, current: previous, duplicate: true},
+	} {
+		d := &deduplicator{similarity: test.similarity, previous: make(map[string]normalizedProfile)}
+		assert.False(t, d.duplicate(OSFS{}, writeSampledProfile(t, t.TempDir(), "heap.pprof", previous)), "the first artifact is kept")
+		assert.Equal(t, test.duplicate, d.duplicate(OSFS{}, writeSampledProfile(t, t.TempDir(), "heap.pprof", test.current)), "similarity %v", test.similarity)
+	}
+}
+
+func TestDeduplicationDiscardsSimilarArtifacts(t *testing.T) {
+	// Consecutive heap profiles of the test process share the bulk of
+	// their samples.
+	dedupe := WithDeduplication(0.01)
+	capture := func() *Profiler {
+		p, err := Capture(context.Background(), time.Millisecond, WithHeapProfiler(), dedupe, WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+		assert.NoError(t, err)
+		return p
+	}
+	first := capture()
+	assert.Len(t, first.ArtifactPaths(), 1)
+	second := capture()
+	assert.Empty(t, second.ArtifactPaths())
+	assert.Len(t, second.Report().Duplicates, 1)
+	assert.NoFileExists(t, second.Report().Duplicates[0])
+}
@@ -0,0 +1,127 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// dryRunTimeout bounds the connectivity checks of a dry run.
+const dryRunTimeout = 10 * time.Second
+
+// SinkChecker is implemented by sinks which can verify they are reachable
+// without writing an artifact, it is used by WithDryRun.
+type SinkChecker interface {
+	Check(ctx context.Context) error
+}
+
+// Check verifies the server accepting uploads is reachable, any response
+// other than a server error is considered reachable.
+func (s *HTTPSink) Check(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, s.url+"/", nil)
+	if err != nil {
+		return err
+	}
+	for key, values := range s.header {
+		req.Header[key] = values
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("%s responded with %s", s.url, resp.Status)
+	}
+	return nil
+}
+
+// Check verifies the host is reachable and the folder can be entered.
+func (s *SFTPSink) Check(ctx context.Context) error {
+	batch := fmt.Sprintf("-mkdir %s\ncd %s\n", sftpQuote(s.folder), sftpQuote(s.folder))
+	cmd := exec.CommandContext(ctx, "sftp", s.args()...)
+	cmd.Stdin = strings.NewReader(batch)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("sftp check of %s failed: %w: %s", s.host, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Check delegates to the underlying sink, if it is a SinkChecker.
+func (c *compressedSink) Check(ctx context.Context) error {
+	if checker, ok := c.sink.(SinkChecker); ok {
+		return checker.Check(ctx)
+	}
+	return nil
+}
+
+// dryRun validates the configuration of the profiler without profiling,
+// reporting what would be captured and where.  Every problem found is
+// returned.
+func (p *Profiler) dryRun() error {
+	var errs []error
+	if _, ok := StrategyMap[p.profileMode]; !ok {
+		errs = append(errs, fmt.Errorf("profiler mode %d not implemented", p.profileMode))
+	}
+	if err := platformSupports(p.profileMode); err != nil {
+		errs = append(errs, err)
+	}
+	folder, err := resolveFolder(p.fs, p.outputFolder(), p.fallbackFolder)
+	if err == nil {
+		err = checkWritable(p.fs, folder)
+	}
+	if err != nil {
+		errs = append(errs, fmt.Errorf("output directory %s is not writable: %w", p.profileFolder, err))
+	} else {
+		p.report("dry run: the %s profile would be written to %s", p.profileMode, folder)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), dryRunTimeout)
+	defer cancel()
+	for i, sink := range p.uploads {
+		checker, ok := sink.(SinkChecker)
+		if !ok {
+			p.report("dry run: upload %d (%T) cannot be checked", i, sink)
+			continue
+		}
+		if err := checker.Check(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("upload %d is unreachable: %w", i, err))
+			continue
+		}
+		p.report("dry run: artifacts would be uploaded to upload %d (%T)", i, sink)
+	}
+	for _, err := range errs {
+		p.report("[warning] dry run: %s", err)
+	}
+	return errors.Join(errs...)
+}
+
+// platformSupports reports if mode cannot be captured on this platform.
+func platformSupports(mode Mode) error {
+	switch mode {
+	case CPUMode, ClockMode:
+		if runtime.GOOS == "js" || runtime.GOOS == "wasip1" {
+			return fmt.Errorf("the %s profiler is not supported on %s", mode, runtime.GOOS)
+		}
+	case SchedLatencyMode:
+		if _, err := readSchedLatencies(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkWritable verifies a file can be created in folder of fsys.
+func checkWritable(fsys FS, folder string) error {
+	f, err := fsys.Create(filepath.Join(folder, fmt.Sprintf(".profiler-dry-run-%d", os.Getpid())))
+	if err != nil {
+		return err
+	}
+	return errors.Join(f.Close(), fsys.Remove(f.Name()))
+}
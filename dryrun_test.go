@@ -0,0 +1,49 @@
+package profiler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDryRunDoesNotProfile(t *testing.T) {
+	dir := t.TempDir()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}))
+	defer server.Close()
+	p, err := Capture(context.Background(), time.Second, WithDryRun(), WithCPUProfiler(), WithProfileFileLocation(dir), WithHTTPUpload(server.URL), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.Empty(t, p.ArtifactPaths())
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestDryRunReportsProblems(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(file, nil, 0o644))
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+	_, err := Capture(context.Background(), time.Second, WithDryRun(), WithProfileFileLocation(filepath.Join(file, "profiles")), WithFallbackDir(file), WithHTTPUpload(server.URL), WithQuietOutput())
+	assert.ErrorContains(t, err, "is not writable")
+	assert.ErrorContains(t, err, "upload 0 is unreachable")
+}
+
+func TestStartDryRunHandsProblemsToErrorHandler(t *testing.T) {
+	var errs []error
+	file := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(file, nil, 0o644))
+	p := Start(WithDryRun(), WithProfileFileLocation(file), WithFallbackDir(file), WithErrorHandler(func(err error) { errs = append(errs, err) }), WithQuietOutput())
+	p.Stop()
+	assert.Len(t, errs, 1)
+}
@@ -0,0 +1,54 @@
+// Package echo adapts the HTTP integration of the profiler to echo.  It is
+// a separate module so that the profiler itself does not depend on
+// github.com/labstack/echo.
+package echo
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/symonk/profiler"
+)
+
+// Router is the routing of an *echo.Echo or *echo.Group.
+type Router interface {
+	GET(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+	HEAD(path string, h echo.HandlerFunc, m ...echo.MiddlewareFunc) *echo.Route
+}
+
+// Middleware returns echo middleware tracing the requests armed on
+// tracer, see profiler.RequestTracer.
+//
+//	e.Use(profilerecho.Middleware(tracer))
+func Middleware(tracer *profiler.RequestTracer) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			var err error
+			tracer.Do(c.Request().Context(), c.Request().Header.Get(tracer.Header()), func(ctx context.Context) {
+				c.SetRequest(c.Request().WithContext(ctx))
+				err = next(c)
+			})
+			return err
+		}
+	}
+}
+
+// RegisterArtifacts serves the artifacts beneath dir at path, see
+// profiler.ArtifactHandler.
+//
+//	profilerecho.RegisterArtifacts(e, "/artifacts", "/var/log/profiles")
+func RegisterArtifacts(r Router, path string, dir string) {
+	handler := profiler.ArtifactHandler(dir)
+	serve := func(c echo.Context) error {
+		req := new(http.Request)
+		*req = *c.Request()
+		u := *req.URL
+		u.Path, u.RawPath = "/"+c.Param("*"), ""
+		req.URL = &u
+		handler.ServeHTTP(c.Response(), req)
+		return nil
+	}
+	r.GET(path+"/*", serve)
+	r.HEAD(path+"/*", serve)
+}
@@ -0,0 +1,56 @@
+package echo
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/symonk/profiler"
+)
+
+func TestMiddleware(t *testing.T) {
+	dir := t.TempDir()
+	tracer := profiler.NewRequestTracer("", profiler.WithProfileFileLocation(dir), profiler.WithQuietOutput())
+	tracer.Arm("abc")
+	r := echo.New()
+	r.Use(Middleware(tracer))
+	r.GET("/", func(c echo.Context) error { return c.NoContent(http.StatusNoContent) })
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(profiler.RequestIDHeader, "abc")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	info, err := os.Stat(filepath.Join(dir, "request-abc", profiler.TraceFileName))
+	require.NoError(t, err)
+	assert.Positive(t, info.Size())
+}
+
+func TestRegisterArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "trace.out"), []byte("trace"), 0644))
+	r := echo.New()
+	RegisterArtifacts(r, "/artifacts", dir)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/artifacts/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var listed []profiler.ListedArtifact
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &listed))
+	require.Len(t, listed, 1)
+	assert.Equal(t, "trace.out", listed[0].Name)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/artifacts/trace.out", nil))
+	assert.Equal(t, "trace", w.Body.String())
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodHead, "/artifacts/trace.out", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
@@ -0,0 +1,129 @@
+package profiler
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"runtime"
+	"runtime/metrics"
+	"strings"
+)
+
+// Environment describes the execution environment of a profiling session
+// so that reviewers of a profile understand the resources it ran with.
+type Environment struct {
+	// Host and PID identify the process profiled.
+	Host string
+	PID  int
+	// GoVersion is the version of the Go runtime.
+	GoVersion string
+	// GOOS and GOARCH are the operating system and architecture.
+	GOOS   string
+	GOARCH string
+	// GOMAXPROCS is the number of Ps available to the scheduler.
+	GOMAXPROCS int
+	// NumCPU is the number of logical CPUs usable by the process.
+	NumCPU int
+	// CPUQuota is the CFS quota of the container in CPUs, zero if the
+	// process is not running under a CPU quota.
+	CPUQuota float64
+	// GOGC is the effective garbage collection target percentage, set by
+	// GOGC or debug.SetGCPercent, -1 if collection is off.
+	GOGC int
+	// GOMemLimit is the effective soft memory limit in bytes, set by
+	// GOMEMLIMIT or debug.SetMemoryLimit, math.MaxInt64 if there is none.
+	GOMemLimit int64
+	// GODEBUG is the GODEBUG environment variable.
+	GODEBUG string
+}
+
+// The runtime/metrics describing the garbage collector settings.
+const (
+	gogcMetric       = "/gc/gogc:percent"
+	gomemlimitMetric = "/gc/gomemlimit:bytes"
+)
+
+// GODEBUGSetting returns the value of the GODEBUG setting key, such as
+// gctrace, the last value wins if it is repeated.
+func (e Environment) GODEBUGSetting(key string) (string, bool) {
+	var value string
+	var found bool
+	for _, setting := range strings.Split(e.GODEBUG, ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(setting), "="); ok && k == key {
+			value, found = v, true
+		}
+	}
+	return value, found
+}
+
+// Warnings describes the settings of the environment which distort the
+// profiles of mode, so that reviewers interpret them correctly.
+func (e Environment) Warnings(mode Mode) []string {
+	var warnings []string
+	memory := mode == MemoryHeapMode || mode == MemoryAllocMode || mode == MemoryMode
+	sampling := mode == CPUMode || mode == ClockMode || mode == TraceMode || mode == SchedLatencyMode
+	if memory && e.GOGC < 0 {
+		warnings = append(warnings, "garbage collection is off (GOGC=off), it only occurs when forced so the heap profile may describe a stale heap")
+	}
+	if rate, ok := e.GODEBUGSetting("memprofilerate"); memory && ok {
+		warnings = append(warnings, fmt.Sprintf("GODEBUG=memprofilerate=%s overrides the sampling rate of memory profiles", rate))
+	}
+	if trace, ok := e.GODEBUGSetting("gctrace"); sampling && ok && trace != "0" {
+		warnings = append(warnings, "GODEBUG=gctrace writes to stderr on every garbage collection, its cost is included in the profile")
+	}
+	if off, ok := e.GODEBUGSetting("asyncpreemptoff"); sampling && ok && off != "0" {
+		warnings = append(warnings, "GODEBUG=asyncpreemptoff disables asynchronous preemption, tight loops delay scheduling and distort latency")
+	}
+	return warnings
+}
+
+// QuotaExceeded returns true if GOMAXPROCS exceeds the CPU quota of the
+// container, resulting in goroutines being throttled rather than run.
+// automaxprocs and Go 1.25+ set GOMAXPROCS from the quota.
+func (e Environment) QuotaExceeded() bool {
+	return e.CPUQuota > 0 && float64(e.GOMAXPROCS) > math.Ceil(e.CPUQuota)
+}
+
+// captureEnvironment captures the current execution environment.
+func captureEnvironment() Environment {
+	env := Environment{
+		Host:       hostname(),
+		PID:        os.Getpid(),
+		GoVersion:  runtime.Version(),
+		GOOS:       runtime.GOOS,
+		GOARCH:     runtime.GOARCH,
+		GOMAXPROCS: runtime.GOMAXPROCS(0),
+		NumCPU:     runtime.NumCPU(),
+	}
+	if throttling, ok := readCPUThrottling(); ok {
+		env.CPUQuota = throttling.Quota
+	}
+	env.GOGC, env.GOMemLimit = 100, math.MaxInt64
+	samples := []metrics.Sample{{Name: gogcMetric}, {Name: gomemlimitMetric}}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() == metrics.KindUint64 {
+		// GOGC=off is reported as the maximum value.
+		env.GOGC = int(int64(samples[0].Value.Uint64()))
+	}
+	if samples[1].Value.Kind() == metrics.KindUint64 {
+		env.GOMemLimit = int64(samples[1].Value.Uint64())
+	}
+	env.GODEBUG = os.Getenv("GODEBUG")
+	return env
+}
+
+// recordEnvironment captures the environment at the start of the session,
+// warning when GOMAXPROCS is misconfigured for the container or settings
+// will distort the profile.
+func (p *Profiler) recordEnvironment() {
+	env := captureEnvironment()
+	p.mu.Lock()
+	p.environment = env
+	p.mu.Unlock()
+	if env.QuotaExceeded() {
+		p.report("[warning] GOMAXPROCS is %d but the container CPU quota is %.2f CPUs, consider setting GOMAXPROCS to match the quota", env.GOMAXPROCS, env.CPUQuota)
+	}
+	for _, warning := range env.Warnings(p.Mode()) {
+		p.report("[warning] %s", warning)
+	}
+}
@@ -0,0 +1,60 @@
+package profiler
+
+import (
+	"math"
+	"runtime"
+	"runtime/debug"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuotaExceeded(t *testing.T) {
+	assert.False(t, Environment{GOMAXPROCS: 8}.QuotaExceeded())
+	assert.False(t, Environment{GOMAXPROCS: 2, CPUQuota: 1.5}.QuotaExceeded())
+	assert.True(t, Environment{GOMAXPROCS: 8, CPUQuota: 2}.QuotaExceeded())
+}
+
+func TestReportIncludesEnvironment(t *testing.T) {
+	fakeCgroup(t, map[string]string{
+		"cpu.stat": "nr_periods 0\nnr_throttled 0\nthrottled_usec 0\n",
+		"cpu.max":  "50000 100000\n",
+	})
+	p, err := start(WithCPUProfiler(), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.NoError(t, p.stop(false))
+	env := p.Report().Environment
+	assert.Equal(t, runtime.GOMAXPROCS(0), env.GOMAXPROCS)
+	assert.Equal(t, runtime.NumCPU(), env.NumCPU)
+	assert.Equal(t, 0.5, env.CPUQuota)
+	assert.Equal(t, runtime.Version(), env.GoVersion)
+}
+
+func TestCaptureEnvironmentRecordsGCSettings(t *testing.T) {
+	t.Setenv("GODEBUG", "gctrace=0")
+	previous := debug.SetGCPercent(-1)
+	defer debug.SetGCPercent(previous)
+	env := captureEnvironment()
+	assert.Equal(t, -1, env.GOGC)
+	assert.Equal(t, int64(math.MaxInt64), env.GOMemLimit)
+	assert.Equal(t, "gctrace=0", env.GODEBUG)
+}
+
+func TestGODEBUGSetting(t *testing.T) {
+	env := Environment{GODEBUG: "gctrace=1, madvdontneed=1,gctrace=2"}
+	value, ok := env.GODEBUGSetting("gctrace")
+	assert.True(t, ok)
+	assert.Equal(t, "2", value)
+	_, ok = env.GODEBUGSetting("memprofilerate")
+	assert.False(t, ok)
+}
+
+func TestEnvironmentWarnings(t *testing.T) {
+	assert.Empty(t, Environment{GOGC: 100}.Warnings(MemoryHeapMode))
+	assert.Len(t, Environment{GOGC: -1}.Warnings(MemoryMode), 1)
+	assert.Empty(t, Environment{GOGC: -1}.Warnings(CPUMode))
+	risky := Environment{GOGC: 100, GODEBUG: "gctrace=1,asyncpreemptoff=1,memprofilerate=1"}
+	assert.Len(t, risky.Warnings(CPUMode), 2)
+	assert.Equal(t, []string{"GODEBUG=memprofilerate=1 overrides the sampling rate of memory profiles"}, risky.Warnings(MemoryAllocMode))
+	assert.Empty(t, Environment{GODEBUG: "gctrace=0"}.Warnings(TraceMode))
+}
@@ -0,0 +1,102 @@
+package profiler
+
+import (
+	"fmt"
+	"time"
+)
+
+// eventBufferSize is the number of events buffered for a consumer
+// of Events, events are dropped rather than blocking profiling.
+const eventBufferSize = 64
+
+// EventType identifies a lifecycle transition of a profiling session.
+type EventType int
+
+const (
+	// EventStarted is emitted when the session begins.
+	EventStarted EventType = iota
+	// EventCaptureBegan is emitted immediately before the strategy starts.
+	EventCaptureBegan
+	// EventCaptureFinished is emitted once the strategy has been finalized
+	// (or failed to start), Err is the error of the strategy.
+	EventCaptureFinished
+	// EventUploadFailed is emitted for each artifact which failed to upload.
+	EventUploadFailed
+	// EventInterrupted is emitted when the session is stopped by a signal,
+	// shutdown context or size limit rather than Stop.
+	EventInterrupted
+	// EventStopped is emitted once teardown has completed, it is always
+	// the final event.
+	EventStopped
+	// EventProgress is emitted periodically while a long running teardown
+	// task, such as an upload, is in progress.  Progress describes it.
+	EventProgress
+)
+
+// String returns the name of the event type.
+func (e EventType) String() string {
+	switch e {
+	case EventStarted:
+		return "started"
+	case EventCaptureBegan:
+		return "capture_began"
+	case EventCaptureFinished:
+		return "capture_finished"
+	case EventUploadFailed:
+		return "upload_failed"
+	case EventInterrupted:
+		return "interrupted"
+	case EventStopped:
+		return "stopped"
+	case EventProgress:
+		return "progress"
+	default:
+		return fmt.Sprintf("EventType(%d)", int(e))
+	}
+}
+
+// Event is a lifecycle transition of a profiling session.
+type Event struct {
+	Type EventType
+	Time time.Time
+	Mode Mode
+	// Artifacts are the artifacts the event relates to, if any.
+	Artifacts []string
+	// Err is the error the event relates to, if any.
+	Err error
+	// Tags are the session tags, see WithTags.
+	Tags map[string]string
+	// Progress is the progress of the task of an EventProgress.
+	Progress *Progress
+}
+
+// Events returns a channel of the lifecycle events of the session, so
+// that supervising code, UIs and tests can react to transitions without
+// parsing log output.  The channel is closed after EventStopped.  Events
+// are buffered, if the consumer falls behind further events are dropped
+// rather than blocking profiling.
+func (p *Profiler) Events() <-chan Event {
+	return p.events
+}
+
+// emit delivers an event without blocking.
+func (p *Profiler) emit(typ EventType, artifacts []string, err error) {
+	event := Event{Type: typ, Time: time.Now(), Mode: p.Mode(), Artifacts: artifacts, Err: err, Tags: copyTags(p.tags)}
+	if p.writeMetadata {
+		p.mu.Lock()
+		p.eventLog = append(p.eventLog, event.Metadata())
+		p.mu.Unlock()
+	}
+	select {
+	case p.events <- event:
+	default:
+	}
+}
+
+// emitProgress delivers an EventProgress without blocking.
+func (p *Profiler) emitProgress(progress Progress) {
+	select {
+	case p.events <- Event{Type: EventProgress, Time: time.Now(), Mode: p.Mode(), Tags: copyTags(p.tags), Progress: &progress}:
+	default:
+	}
+}
@@ -0,0 +1,38 @@
+package profiler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventsLifecycle(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Start(
+		WithHeapProfiler(),
+		WithProfileFileLocation(t.TempDir()),
+		WithUpload(failingSink{}),
+		WithErrorHandler(func(error) {}),
+		WithShutdownContext(ctx),
+		WithQuietOutput(),
+	)
+	cancel()
+	var types []EventType
+	for event := range p.Events() {
+		assert.Equal(t, MemoryHeapMode, event.Mode)
+		types = append(types, event.Type)
+		if event.Type == EventUploadFailed {
+			assert.Equal(t, p.ArtifactPaths(), event.Artifacts)
+			assert.Error(t, event.Err)
+		}
+	}
+	assert.Equal(t, []EventType{
+		EventStarted,
+		EventCaptureBegan,
+		EventInterrupted,
+		EventCaptureFinished,
+		EventUploadFailed,
+		EventStopped,
+	}, types)
+}
@@ -0,0 +1,78 @@
+package profiler
+
+import (
+	"errors"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// OnExit registers an atexit style hook which writes a lightweight final
+// snapshot, a full goroutine dump and runtime.MemStats, into an
+// `exit-<timestamp>` folder inside of dir regardless of whether any
+// profiling session ran.  This leaves postmortem crumbs for processes
+// which stop unexpectedly but cleanly.  Go has no atexit, so the returned
+// function must be deferred in main, the snapshot is also written when
+// SIGINT or SIGTERM is received, after which the signal is raised again
+// so the process terminates as it otherwise would have.  os.Exit does not
+// run deferred functions, invoke the returned function prior to it.
+//
+//	defer profiler.OnExit("/var/log/crumbs")()
+func OnExit(dir string) func() {
+	var once sync.Once
+	write := func() {
+		once.Do(func() {
+			if folder, err := exitSnapshot(dir); err != nil {
+				log.Printf("[warning] failed to write the exit snapshot to %s: %s", folder, err)
+			}
+		})
+	}
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case sig := <-ch:
+			write()
+			signal.Stop(ch)
+			raise(sig)
+		case <-done:
+		}
+	}()
+	var stop sync.Once
+	return func() {
+		stop.Do(func() {
+			signal.Stop(ch)
+			close(done)
+			write()
+		})
+	}
+}
+
+// exitSnapshot writes the exit snapshot into a timestamped folder in dir.
+func exitSnapshot(dir string) (string, error) {
+	folder, err := resolveFolder(OSFS{}, filepath.Join(dir, "exit-"+time.Now().Format(snapshotTimeFormat)), "")
+	if err != nil {
+		return dir, err
+	}
+	return folder, errors.Join(
+		writeSnapshotFile(folder, GoroutineDumpFileName, lookupWriter("goroutine", 2)),
+		writeSnapshotFile(folder, MemStatsFileName, writeMemStats),
+	)
+}
+
+// raise delivers sig to the current process again, exiting if it
+// cannot be delivered.
+func raise(sig os.Signal) {
+	process, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = process.Signal(sig)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
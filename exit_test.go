@@ -0,0 +1,93 @@
+package profiler
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func exitSnapshotFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	matches, err := filepath.Glob(filepath.Join(dir, "exit-*", "*"))
+	assert.NoError(t, err)
+	for i, match := range matches {
+		matches[i] = filepath.Base(match)
+	}
+	return matches
+}
+
+func TestOnExitWritesSnapshotOnce(t *testing.T) {
+	dir := t.TempDir()
+	exit := OnExit(dir)
+	exit()
+	exit()
+	assert.ElementsMatch(t, []string{GoroutineDumpFileName, MemStatsFileName}, exitSnapshotFiles(t, dir))
+}
+
+func TestOnExitWritesSnapshotOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals cannot be sent on windows")
+	}
+	// Receiving the signal here prevents the raised signal terminating
+	// the test binary.
+	ch := make(chan os.Signal, 2)
+	signal.Notify(ch, syscall.SIGTERM)
+	defer signal.Stop(ch)
+
+	dir := t.TempDir()
+	defer OnExit(dir)()
+	process, err := os.FindProcess(os.Getpid())
+	assert.NoError(t, err)
+	assert.NoError(t, process.Signal(syscall.SIGTERM))
+	assert.Eventually(t, func() bool {
+		return len(exitSnapshotFiles(t, dir)) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// exitOnSignalHelperEnv runs TestExitOnSignalHelperProcess, its value is
+// the folder the profile is written to.
+const exitOnSignalHelperEnv = "PROFILER_TEST_EXIT_ON_SIGNAL"
+
+// TestExitOnSignalHelperProcess is not a test, it is the subprocess of
+// TestWithExitOnSignal, which signals itself and reports if it survived.
+func TestExitOnSignalHelperProcess(t *testing.T) {
+	dir := os.Getenv(exitOnSignalHelperEnv)
+	if dir == "" {
+		t.Skip("only run as a subprocess of TestWithExitOnSignal")
+	}
+	exit := os.Getenv(exitOnSignalHelperEnv+"_EXIT") == "true"
+	p := Start(WithHeapProfiler(), WithProfileFileLocation(dir), WithExitOnSignal(exit), WithQuietOutput())
+	process, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, process.Signal(syscall.SIGTERM))
+	require.NoError(t, p.Wait())
+	fmt.Println("survived the signal")
+}
+
+func TestWithExitOnSignal(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("signals cannot be sent on windows")
+	}
+	for _, exit := range []bool{true, false} {
+		t.Run(strconv.FormatBool(exit), func(t *testing.T) {
+			dir := t.TempDir()
+			cmd := exec.Command(os.Args[0], "-test.run=^TestExitOnSignalHelperProcess$", "-test.v")
+			cmd.Env = append(os.Environ(), exitOnSignalHelperEnv+"="+dir, exitOnSignalHelperEnv+"_EXIT="+strconv.FormatBool(exit))
+			out, err := cmd.CombinedOutput()
+			require.NoError(t, err, string(out))
+			assert.Equal(t, !exit, strings.Contains(string(out), "survived the signal"), string(out))
+			assert.FileExists(t, filepath.Join(dir, MemoryFileName))
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package profiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// speedscopeSchema is the schema of the speedscope file format.
+const speedscopeSchema = "https://www.speedscope.app/file-format-schema.json"
+
+// speedscopeUnits are the units speedscope understands.
+var speedscopeUnits = map[string]bool{"nanoseconds": true, "microseconds": true, "milliseconds": true, "seconds": true, "bytes": true}
+
+// foldedStacks sums the default sample type of prof by stack, each stack
+// listing its function names from the root.
+func foldedStacks(prof *profile.Profile) (map[string]int64, error) {
+	index := defaultSampleIndex(prof)
+	if index < 0 {
+		return nil, errors.New("profile has no sample types")
+	}
+	stacks := make(map[string]int64)
+	for _, sample := range prof.Sample {
+		if sample.Value[index] == 0 {
+			continue
+		}
+		names := sampleFunctions(sample)
+		for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+			names[i], names[j] = names[j], names[i]
+		}
+		stacks[strings.Join(names, ";")] += sample.Value[index]
+	}
+	return stacks, nil
+}
+
+// WriteFolded writes the default sample type of prof in the folded stack
+// format, a line of semicolon separated function names from the root and
+// the value of the stack, as consumed by flamegraph.pl and many others.
+func WriteFolded(w io.Writer, prof *profile.Profile) error {
+	stacks, err := foldedStacks(prof)
+	if err != nil {
+		return err
+	}
+	lines := make([]string, 0, len(stacks))
+	for stack, value := range stacks {
+		lines = append(lines, fmt.Sprintf("%s %d\n", stack, value))
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		if _, err := io.WriteString(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteSpeedscope writes the default sample type of prof as a sampled
+// profile in the speedscope (https://www.speedscope.app) json format.
+func WriteSpeedscope(w io.Writer, name string, prof *profile.Profile) error {
+	index := defaultSampleIndex(prof)
+	if index < 0 {
+		return errors.New("profile has no sample types")
+	}
+	type frame struct {
+		Name string `json:"name"`
+	}
+	type sampled struct {
+		Type       string  `json:"type"`
+		Name       string  `json:"name"`
+		Unit       string  `json:"unit"`
+		StartValue int64   `json:"startValue"`
+		EndValue   int64   `json:"endValue"`
+		Samples    [][]int `json:"samples"`
+		Weights    []int64 `json:"weights"`
+	}
+	sampleType := prof.SampleType[index]
+	unit := "none"
+	if speedscopeUnits[sampleType.Unit] {
+		unit = sampleType.Unit
+	}
+	var frames []frame
+	frameIndex := make(map[string]int)
+	profiled := sampled{Type: "sampled", Name: fmt.Sprintf("%s (%s)", name, sampleType.Type), Unit: unit, Samples: [][]int{}, Weights: []int64{}}
+	for _, sample := range prof.Sample {
+		value := sample.Value[index]
+		if value == 0 {
+			continue
+		}
+		names := sampleFunctions(sample)
+		stack := make([]int, 0, len(names))
+		for i := len(names) - 1; i >= 0; i-- {
+			if _, ok := frameIndex[names[i]]; !ok {
+				frameIndex[names[i]] = len(frames)
+				frames = append(frames, frame{Name: names[i]})
+			}
+			stack = append(stack, frameIndex[names[i]])
+		}
+		profiled.Samples = append(profiled.Samples, stack)
+		profiled.Weights = append(profiled.Weights, value)
+		profiled.EndValue += value
+	}
+	if frames == nil {
+		frames = []frame{}
+	}
+	file := struct {
+		Schema string `json:"$schema"`
+		Shared struct {
+			Frames []frame `json:"frames"`
+		} `json:"shared"`
+		Profiles           []sampled `json:"profiles"`
+		Name               string    `json:"name"`
+		ActiveProfileIndex int       `json:"activeProfileIndex"`
+		Exporter           string    `json:"exporter"`
+	}{Schema: speedscopeSchema, Profiles: []sampled{profiled}, Name: name, Exporter: "github.com/symonk/profiler"}
+	file.Shared.Frames = frames
+	return json.NewEncoder(w).Encode(file)
+}
@@ -0,0 +1,64 @@
+package profiler
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+// exportProfile is a small cpu profile with two stacks.
+func exportProfile() *profile.Profile {
+	fn := func(id uint64, name string) *profile.Location {
+		return &profile.Location{ID: id, Line: []profile.Line{{Function: &profile.Function{ID: id, Name: name}}}}
+	}
+	main, work, idle := fn(1, "main.main"), fn(2, "main.work"), fn(3, "main.idle")
+	return &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{work, main}, Value: []int64{3, 300}},
+			{Location: []*profile.Location{idle, main}, Value: []int64{1, 100}},
+			{Location: []*profile.Location{work, main}, Value: []int64{1, 100}},
+		},
+	}
+}
+
+func TestWriteFolded(t *testing.T) {
+	var b strings.Builder
+	assert.NoError(t, WriteFolded(&b, exportProfile()))
+	assert.Equal(t, "main.main;main.idle 100\nmain.main;main.work 400\n", b.String())
+}
+
+func TestWriteSpeedscope(t *testing.T) {
+	var b strings.Builder
+	assert.NoError(t, WriteSpeedscope(&b, "cpu.pprof", exportProfile()))
+	var file struct {
+		Schema string `json:"$schema"`
+		Shared struct {
+			Frames []struct{ Name string } `json:"frames"`
+		} `json:"shared"`
+		Profiles []struct {
+			Type     string  `json:"type"`
+			Unit     string  `json:"unit"`
+			EndValue int64   `json:"endValue"`
+			Samples  [][]int `json:"samples"`
+			Weights  []int64 `json:"weights"`
+		} `json:"profiles"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(b.String()), &file))
+	assert.Equal(t, speedscopeSchema, file.Schema)
+	assert.Len(t, file.Shared.Frames, 3)
+	assert.Equal(t, "main.main", file.Shared.Frames[0].Name)
+	assert.Equal(t, "sampled", file.Profiles[0].Type)
+	assert.Equal(t, "nanoseconds", file.Profiles[0].Unit)
+	assert.Equal(t, int64(500), file.Profiles[0].EndValue)
+	assert.Equal(t, [][]int{{0, 1}, {0, 2}, {0, 1}}, file.Profiles[0].Samples)
+	assert.Equal(t, []int64{300, 100, 100}, file.Profiles[0].Weights)
+}
+
+func TestExportRequiresSampleTypes(t *testing.T) {
+	assert.Error(t, WriteFolded(&strings.Builder{}, &profile.Profile{}))
+	assert.Error(t, WriteSpeedscope(&strings.Builder{}, "empty", &profile.Profile{}))
+}
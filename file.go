@@ -1,9 +1,11 @@
 package profiler
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // CreateProfileFile takes the user defined folder (or working dir) if omitted
@@ -12,18 +14,103 @@ import (
 // File names are currently not customisable and are provided by the caller
 // based on the profile mode selected.
 func CreateProfileFile(folder string, name string) (*os.File, error) {
-	if err := os.MkdirAll(folder, 0777); err != nil {
-		// User provided path failed, use a globally unique
-		// temp dir
-		folder, err = os.MkdirTemp(os.TempDir(), "profiler")
-		if err != nil {
-			return nil, fmt.Errorf("failed to create temp folder: %w", err)
-		}
-	}
-	joined := filepath.Join(folder, name)
-	path, err := os.Create(joined)
+	resolved, err := resolveFolder(OSFS{}, folder, "")
+	if err != nil {
+		return nil, err
+	}
+	f, err := createFile(OSFS{}, resolved, name)
+	if err != nil {
+		return nil, err
+	}
+	return f.(*os.File), nil
+}
+
+// datePartition returns the folder beneath root that artifacts captured
+// at t are written to when date partitioning is enabled, root/yyyy/mm/dd.
+func datePartition(root string, t time.Time) string {
+	return filepath.Join(root, t.Format("2006"), t.Format("01"), t.Format("02"))
+}
+
+// resolveFolder attempts to make the full folder tree of folder in fsys.
+// If that fails a globally unique folder is created inside of fallback
+// instead.  An empty fallback defers to os.TempDir(), which is not always
+// appropriate in containers with a small /tmp mount.
+func resolveFolder(fsys FS, folder string, fallback string) (string, error) {
+	if err := fsys.MkdirAll(folder, 0777); err == nil {
+		return folder, nil
+	}
+	if fallback == "" {
+		fallback = os.TempDir()
+	}
+	if err := fsys.MkdirAll(fallback, 0777); err != nil {
+		return "", fmt.Errorf("failed to create fallback folder: %w", err)
+	}
+	// User provided path failed, use a globally unique
+	// temp dir
+	resolved, err := mkdirTemp(fsys, fallback)
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp folder: %w", err)
+	}
+	return resolved, nil
+}
+
+// mkdirTemp creates a uniquely named folder inside of dir in fsys.
+func mkdirTemp(fsys FS, dir string) (string, error) {
+	if _, ok := fsys.(OSFS); ok {
+		return os.MkdirTemp(dir, "profiler")
+	}
+	folder := filepath.Join(dir, fmt.Sprintf("profiler%d", time.Now().UnixNano()))
+	return folder, fsys.MkdirAll(folder, 0777)
+}
+
+// createFile creates the named profile file inside of an already
+// resolved folder of fsys.
+func createFile(fsys FS, folder string, name string) (File, error) {
+	f, err := fsys.Create(filepath.Join(folder, name))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create profile file: %w", err)
 	}
-	return path, nil
+	return f, nil
+}
+
+// lockedFileRetries is the number of times an operation on a file which
+// another process holds open is retried, backing off exponentially from
+// 10ms for a little over a second in total.
+const lockedFileRetries = 7
+
+// retryLocked invokes op, retrying while the file it operates on is held
+// open by another process, such as a virus scanner inspecting a freshly
+// written artifact on Windows.
+func retryLocked(op func() error) error {
+	delay := 10 * time.Millisecond
+	err := op()
+	for i := 0; i < lockedFileRetries && lockedFile(err); i++ {
+		time.Sleep(delay)
+		delay *= 2
+		err = op()
+	}
+	return err
+}
+
+// replaceFile renames from to to, replacing to.
+func replaceFile(from string, to string) error {
+	return retryLocked(func() error { return os.Rename(from, to) })
+}
+
+// syncFile is a File which commits its contents to stable storage before
+// it is closed, files which cannot be synced are closed as usual.
+type syncFile struct {
+	File
+}
+
+// Close syncs the file before closing it.
+func (s syncFile) Close() error {
+	f, ok := s.File.(syncer)
+	if !ok {
+		return s.File.Close()
+	}
+	if err := f.Sync(); err != nil {
+		return errors.Join(fmt.Errorf("failed to sync %s: %w", s.Name(), err), s.File.Close())
+	}
+	return s.File.Close()
 }
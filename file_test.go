@@ -0,0 +1,81 @@
+package profiler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveFolderUsesFallbackWhenUnwritable(t *testing.T) {
+	root := t.TempDir()
+	blocker := filepath.Join(root, "file")
+	if err := os.WriteFile(blocker, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fallback := filepath.Join(root, "fallback")
+
+	// A folder cannot be created beneath a regular file.
+	resolved, err := resolveFolder(OSFS{}, filepath.Join(blocker, "nested"), fallback)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(resolved, fallback))
+}
+
+func TestResolveFolderPrefersUserFolder(t *testing.T) {
+	folder := filepath.Join(t.TempDir(), "a", "b")
+	resolved, err := resolveFolder(OSFS{}, folder, "")
+	assert.NoError(t, err)
+	assert.Equal(t, folder, resolved)
+}
+
+func TestDatePartition(t *testing.T) {
+	at := time.Date(2024, time.March, 7, 23, 59, 0, 0, time.UTC)
+	assert.Equal(t, filepath.Join("profiles", "2024", "03", "07"), datePartition("profiles", at))
+}
+
+func TestWithDatePartitioning(t *testing.T) {
+	root := t.TempDir()
+	p := New(WithProfileFileLocation(root), WithDatePartitioning(), WithQuietOutput())
+	w, err := p.createArtifact(HeapFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, w.Close())
+	assert.FileExists(t, filepath.Join(datePartition(root, time.Now()), HeapFileName))
+}
+
+func TestDatePartitioningUsesSessionStart(t *testing.T) {
+	root := t.TempDir()
+	p := New(WithProfileFileLocation(root), WithDatePartitioning(), WithQuietOutput())
+	// A session started before midnight keeps writing to that date.
+	p.partitionedAt = time.Date(2024, time.March, 7, 23, 59, 0, 0, time.UTC)
+	w, err := p.createArtifact(HeapFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, w.Close())
+	assert.FileExists(t, filepath.Join(root, "2024", "03", "07", HeapFileName))
+}
+
+func TestRetryLockedReturnsOtherErrors(t *testing.T) {
+	calls := 0
+	err := retryLocked(func() error {
+		calls++
+		return os.ErrNotExist
+	})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Equal(t, 1, calls)
+}
+
+func TestReplaceFile(t *testing.T) {
+	dir := t.TempDir()
+	from, to := filepath.Join(dir, "from"), filepath.Join(dir, "to")
+	assert.NoError(t, os.WriteFile(from, []byte("new"), 0644))
+	assert.NoError(t, os.WriteFile(to, []byte("old"), 0644))
+	assert.NoError(t, replaceFile(from, to))
+	data, _ := os.ReadFile(to)
+	assert.Equal(t, "new", string(data))
+}
@@ -0,0 +1,20 @@
+package profiler
+
+import (
+	"errors"
+	"syscall"
+)
+
+// Windows error codes returned while another process, such as a virus
+// scanner or search indexer, has a file open without FILE_SHARE_DELETE.
+const (
+	errorAccessDenied     syscall.Errno = 5
+	errorSharingViolation syscall.Errno = 32
+	errorLockViolation    syscall.Errno = 33
+)
+
+// lockedFile reports whether err is the result of another process holding
+// the file open, a condition which clears once it closes the file.
+func lockedFile(err error) bool {
+	return errors.Is(err, errorSharingViolation) || errors.Is(err, errorLockViolation) || errors.Is(err, errorAccessDenied)
+}
@@ -0,0 +1,57 @@
+package profiler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// longFolder returns a folder whose path exceeds MAX_PATH (260 characters).
+func longFolder(t *testing.T) string {
+	folder := t.TempDir()
+	for len(folder) <= 300 {
+		folder = filepath.Join(folder, strings.Repeat("a", 50))
+	}
+	return folder
+}
+
+func TestWindowsStrategiesWriteToLongPaths(t *testing.T) {
+	for _, mode := range []Mode{CPUMode, MemoryHeapMode, ThreadCreateMode} {
+		t.Run(mode.String(), func(t *testing.T) {
+			p, err := Capture(context.Background(), 50*time.Millisecond, WithMode(mode), WithProfileFileLocation(longFolder(t)), WithQuietOutput())
+			require.NoError(t, err)
+			require.Len(t, p.ArtifactPaths(), 1)
+			prof, err := ReadProfile(p.ArtifactPaths()[0])
+			require.NoError(t, err)
+			assert.NotEmpty(t, prof.SampleType)
+		})
+	}
+}
+
+func TestWindowsReplaceFileRetriesWhileLocked(t *testing.T) {
+	dir := t.TempDir()
+	from, to := filepath.Join(dir, "from"), filepath.Join(dir, "to")
+	require.NoError(t, os.WriteFile(from, []byte("new"), 0644))
+	require.NoError(t, os.WriteFile(to, []byte("old"), 0644))
+	// Files are opened without FILE_SHARE_DELETE, so to cannot be replaced
+	// until it is closed.
+	locked, err := os.Open(to)
+	require.NoError(t, err)
+	time.AfterFunc(100*time.Millisecond, func() { _ = locked.Close() })
+
+	require.NoError(t, replaceFile(from, to))
+	data, err := os.ReadFile(to)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(data))
+}
+
+func TestWindowsLockedFile(t *testing.T) {
+	assert.True(t, lockedFile(&os.LinkError{Op: "rename", Err: errorSharingViolation}))
+	assert.False(t, lockedFile(os.ErrNotExist))
+}
@@ -0,0 +1,35 @@
+package profiler
+
+import "sync"
+
+// finalizeEach runs independent finalization tasks, such as uploading or
+// converting each artifact, on a bounded pool of at most the number of
+// goroutines set by WithFinalizeConcurrency, returning once all of them
+// have completed.  Tasks run serially, in order, by default.  Tasks which
+// must happen in order (stopping the CPU profiler before closing its file)
+// belong within a single task.
+func (p *Profiler) finalizeEach(tasks []func()) {
+	workers := min(max(p.finalizeConcurrency, 1), len(tasks))
+	if workers <= 1 {
+		for _, task := range tasks {
+			task()
+		}
+		return
+	}
+	queue := make(chan func())
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		goInternal(func() {
+			defer wg.Done()
+			for task := range queue {
+				task()
+			}
+		})
+	}
+	for _, task := range tasks {
+		queue <- task
+	}
+	close(queue)
+	wg.Wait()
+}
@@ -0,0 +1,81 @@
+package profiler
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// lockedSink is a memorySink which is safe for concurrent use.
+type lockedSink struct {
+	mu     sync.Mutex
+	memory memorySink
+}
+
+func (s *lockedSink) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.memory.Create(ctx, name)
+}
+
+func TestFinalizeEachIsBounded(t *testing.T) {
+	p := New(WithFinalizeConcurrency(3))
+	var running, peak, completed atomic.Int32
+	tasks := make([]func(), 10)
+	for i := range tasks {
+		tasks[i] = func() {
+			n := running.Add(1)
+			for {
+				current := peak.Load()
+				if n <= current || peak.CompareAndSwap(current, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			running.Add(-1)
+			completed.Add(1)
+		}
+	}
+	p.finalizeEach(tasks)
+	assert.Equal(t, int32(10), completed.Load())
+	assert.LessOrEqual(t, peak.Load(), int32(3))
+	assert.Greater(t, peak.Load(), int32(1))
+}
+
+func TestFinalizeEachIsSerialByDefault(t *testing.T) {
+	var order []int
+	tasks := make([]func(), 5)
+	for i := range tasks {
+		tasks[i] = func() { order = append(order, i) }
+	}
+	New().finalizeEach(tasks)
+	assert.Equal(t, []int{0, 1, 2, 3, 4}, order)
+}
+
+func TestFinalizeConcurrencyPreservesArtifactOrder(t *testing.T) {
+	dir := t.TempDir()
+	sink := &lockedSink{memory: memorySink{}}
+	p := Start(
+		WithMemoryProfiler(),
+		WithProfileFileLocation(dir),
+		WithHTMLReport(),
+		WithUpload(sink),
+		WithFinalizeConcurrency(4),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	p.Stop()
+	var names []string
+	for _, path := range p.ArtifactPaths() {
+		names = append(names, filepath.Base(path))
+	}
+	assert.Equal(t, []string{HeapFileName, AllocsFileName, "heap.html", "allocs.html"}, names)
+	assert.Contains(t, sink.memory, HeapFileName)
+	assert.Contains(t, sink.memory, AllocsFileName)
+}
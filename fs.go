@@ -0,0 +1,126 @@
+package profiler
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// FS is the filesystem a session writes its artifacts to, reads them
+// back from for post processing and uploads, and removes them from, see
+// WithFS.  Paths are slash or OS separated as produced by filepath.
+type FS interface {
+	// Open opens the named file for reading.
+	Open(name string) (fs.File, error)
+	// Create creates or truncates the named file for writing.
+	Create(name string) (File, error)
+	// Stat describes the named file.
+	Stat(name string) (fs.FileInfo, error)
+	// MkdirAll creates the folder path along with any missing parents.
+	MkdirAll(path string, perm fs.FileMode) error
+	// Remove removes the named file or empty folder.
+	Remove(name string) error
+	// Rename renames the file from to to, replacing to if it exists.
+	Rename(from string, to string) error
+	// ReadDir returns the entries of the named folder, sorted by name.
+	ReadDir(name string) ([]fs.DirEntry, error)
+}
+
+// File is a file created by an FS.
+type File interface {
+	io.WriteCloser
+	// Name returns the path the file was created at.
+	Name() string
+}
+
+// syncer is a File which can commit its contents to stable storage.
+type syncer interface {
+	Sync() error
+}
+
+// OSFS is the FS of the operating system, used unless WithFS is provided.
+type OSFS struct{}
+
+// Open opens the named file with os.Open.
+func (OSFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// Create creates the named file with os.Create.
+func (OSFS) Create(name string) (File, error) {
+	return os.Create(name)
+}
+
+// Stat describes the named file with os.Stat.
+func (OSFS) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+// MkdirAll creates path with os.MkdirAll.
+func (OSFS) MkdirAll(path string, perm fs.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+// Remove removes the named file with os.Remove, retrying while another
+// process holds it open.
+func (OSFS) Remove(name string) error {
+	return retryLocked(func() error { return os.Remove(name) })
+}
+
+// Rename renames from to to, retrying while another process holds either
+// open.
+func (OSFS) Rename(from string, to string) error {
+	return replaceFile(from, to)
+}
+
+// ReadDir returns the entries of the named folder with os.ReadDir.
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+// removeAll removes path of fsys along with everything beneath it.
+func removeAll(fsys FS, path string) error {
+	if _, ok := fsys.(OSFS); ok {
+		return retryLocked(func() error { return os.RemoveAll(path) })
+	}
+	entries, err := fsys.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		child := filepath.Join(path, entry.Name())
+		if entry.IsDir() {
+			err = removeAll(fsys, child)
+		} else {
+			err = fsys.Remove(child)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return fsys.Remove(path)
+}
+
+// readFile returns the contents of the named file of fsys.
+func readFile(fsys FS, name string) ([]byte, error) {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return io.ReadAll(f)
+}
+
+// writeFile writes data to the named file of fsys.
+func writeFile(fsys FS, name string, data []byte) error {
+	f, err := fsys.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
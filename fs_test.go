@@ -0,0 +1,52 @@
+package profiler
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// bufferFile is a File which cannot be synced.
+type bufferFile struct {
+	bytes.Buffer
+	closed bool
+}
+
+func (b *bufferFile) Close() error {
+	b.closed = true
+	return nil
+}
+
+func (b *bufferFile) Name() string { return "buffer" }
+
+func TestOSFSReadWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.txt")
+	require.NoError(t, writeFile(OSFS{}, path, []byte("hello")))
+	data, err := readFile(OSFS{}, path)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(data))
+	info, err := OSFS{}.Stat(path)
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, info.Size())
+	require.NoError(t, OSFS{}.Remove(path))
+	_, err = readFile(OSFS{}, path)
+	assert.Error(t, err)
+}
+
+func TestSyncFileClosesFilesWhichCannotSync(t *testing.T) {
+	f := &bufferFile{}
+	require.NoError(t, syncFile{f}.Close())
+	assert.True(t, f.closed)
+}
+
+func TestCreateArtifactWithFsync(t *testing.T) {
+	dir := t.TempDir()
+	p := New(WithProfileFileLocation(dir), WithFsyncOnClose(), WithQuietOutput())
+	w, err := p.createArtifact("a.pprof")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, []string{filepath.Join(dir, "a.pprof")}, p.ArtifactPaths())
+}
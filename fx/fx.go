@@ -0,0 +1,55 @@
+// Package fx provides an fx.Module managing a profiler.Service as part of
+// the lifecycle of an fx application.  It is a separate module so that
+// the profiler itself does not depend on go.uber.org/fx.
+package fx
+
+import (
+	"github.com/symonk/profiler"
+	"go.uber.org/fx"
+)
+
+// optionsGroup is the value group of the options supplied by Option.
+const optionsGroup = "profiler_options"
+
+// Module provides a *profiler.Service, configured by the profiler.Config
+// of the graph if there is one, which starts and stops with the
+// application:
+//
+//	fx.New(
+//		fx.Supply(profiler.Config{Mode: "heap", OutputDir: "/var/profiles"}),
+//		profilerfx.Module,
+//	)
+var Module = fx.Module("profiler",
+	fx.Provide(New),
+	// The service is always constructed, nothing else need depend on it.
+	fx.Invoke(func(*profiler.Service) {}),
+)
+
+// Params are the dependencies of New.
+type Params struct {
+	fx.In
+
+	Lifecycle fx.Lifecycle
+	// Config is optional, the zero Config is used if the graph has none.
+	Config profiler.Config `optional:"true"`
+	// Options are those supplied by Option, applied after Config.
+	Options []profiler.ProfileOption `group:"profiler_options"`
+}
+
+// New returns a Service configured by params whose Start and Stop are
+// hooked to the lifecycle of the application.
+func New(params Params) (*profiler.Service, error) {
+	options, err := params.Config.Options()
+	if err != nil {
+		return nil, err
+	}
+	svc := profiler.NewService(append(options, params.Options...)...)
+	params.Lifecycle.Append(fx.Hook{OnStart: svc.Start, OnStop: svc.Stop})
+	return svc, nil
+}
+
+// Option supplies option to the Service of Module, for options which
+// cannot be expressed by a profiler.Config such as hooks and sinks.
+func Option(option profiler.ProfileOption) fx.Option {
+	return fx.Supply(fx.Annotated{Group: optionsGroup, Target: option})
+}
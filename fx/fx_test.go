@@ -0,0 +1,42 @@
+package fx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/symonk/profiler"
+	"go.uber.org/fx"
+)
+
+func TestModule(t *testing.T) {
+	dir := t.TempDir()
+	var svc *profiler.Service
+	var stopped bool
+	app := fx.New(
+		fx.NopLogger,
+		fx.Supply(profiler.Config{Mode: "heap", OutputDir: dir, Quiet: true}),
+		Option(profiler.WithCallback(func(*profiler.Profiler) { stopped = true })),
+		Module,
+		fx.Populate(&svc),
+	)
+	require.NoError(t, app.Err())
+	require.NoError(t, app.Start(context.Background()))
+	require.NotNil(t, svc.Profiler())
+	assert.Equal(t, profiler.MemoryHeapMode, svc.Profiler().Mode())
+	require.NoError(t, app.Stop(context.Background()))
+	assert.True(t, stopped)
+	assert.Len(t, svc.Profiler().ArtifactPaths(), 1)
+}
+
+func TestModuleWithoutConfig(t *testing.T) {
+	app := fx.New(fx.NopLogger, Module, Option(profiler.WithEnabledFunc(func() bool { return false })))
+	require.NoError(t, app.Start(context.Background()))
+	require.NoError(t, app.Stop(context.Background()))
+}
+
+func TestModuleInvalidConfig(t *testing.T) {
+	app := fx.New(fx.NopLogger, fx.Supply(profiler.Config{Mode: "bogus"}), Module)
+	assert.ErrorContains(t, app.Err(), `unknown profiler mode "bogus"`)
+}
@@ -0,0 +1,67 @@
+package profiler
+
+import (
+	"fmt"
+	"runtime/metrics"
+	"time"
+)
+
+// The runtime/metrics histograms of stop the world GC pauses, the former
+// replaces the latter from Go 1.22.
+var gcPauseMetrics = []string{"/sched/pauses/total/gc:seconds", "/gc/pauses:seconds"}
+
+// readGCPauses reads the GC pause histogram, nil if unsupported.
+func readGCPauses() *metrics.Float64Histogram {
+	for _, name := range gcPauseMetrics {
+		sample := []metrics.Sample{{Name: name}}
+		metrics.Read(sample)
+		if sample[0].Value.Kind() == metrics.KindFloat64Histogram {
+			return sample[0].Value.Float64Histogram()
+		}
+	}
+	return nil
+}
+
+// GCPauseCondition is met when a GC pause of at least threshold occurred
+// since the condition was last polled.  Pauses are bucketed by the
+// runtime, a pause is counted when the lower bound of its bucket is at
+// least threshold.
+func GCPauseCondition(threshold time.Duration) Condition {
+	previous := readGCPauses()
+	return func() (bool, string) {
+		current := readGCPauses()
+		if current == nil || previous == nil {
+			return false, ""
+		}
+		var pauses uint64
+		longest := 0.0
+		for i, count := range current.Counts {
+			if i < len(previous.Counts) {
+				count -= previous.Counts[i]
+			}
+			if count == 0 || current.Buckets[i] < threshold.Seconds() {
+				continue
+			}
+			pauses += count
+			longest = current.Buckets[i]
+		}
+		previous = current
+		if pauses == 0 {
+			return false, ""
+		}
+		return true, fmt.Sprintf("%d GC pauses of at least %s, the longest at least %s", pauses, threshold, bucketDuration(longest))
+	}
+}
+
+// GCPauseTrigger returns a Trigger capturing a short execution trace each
+// time a GC pause of at least threshold occurs, recording what the runtime
+// and application were doing around pathological pauses.  Options
+// configure the captures.
+func GCPauseTrigger(threshold time.Duration, options ...ProfileOption) Trigger {
+	return Trigger{
+		Condition: GCPauseCondition(threshold),
+		Interval:  100 * time.Millisecond,
+		Duration:  2 * time.Second,
+		Options:   append([]ProfileOption{WithTracing()}, options...),
+	}
+}
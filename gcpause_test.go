@@ -0,0 +1,24 @@
+package profiler
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGCPauseCondition(t *testing.T) {
+	condition := GCPauseCondition(0)
+	runtime.GC()
+	met, reason := condition()
+	assert.True(t, met)
+	assert.Contains(t, reason, "GC pauses")
+}
+
+func TestGCPauseConditionThreshold(t *testing.T) {
+	condition := GCPauseCondition(time.Hour)
+	runtime.GC()
+	met, _ := condition()
+	assert.False(t, met)
+}
@@ -0,0 +1,43 @@
+// Package gin adapts the HTTP integration of the profiler to gin.  It is
+// a separate module so that the profiler itself does not depend on
+// github.com/gin-gonic/gin.
+package gin
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/symonk/profiler"
+)
+
+// Middleware returns gin middleware tracing the requests armed on
+// tracer, see profiler.RequestTracer.
+//
+//	r.Use(profilergin.Middleware(tracer))
+func Middleware(tracer *profiler.RequestTracer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tracer.Do(c.Request.Context(), c.GetHeader(tracer.Header()), func(ctx context.Context) {
+			c.Request = c.Request.WithContext(ctx)
+			c.Next()
+		})
+	}
+}
+
+// RegisterArtifacts serves the artifacts beneath dir at path, see
+// profiler.ArtifactHandler.
+//
+//	profilergin.RegisterArtifacts(r, "/artifacts", "/var/log/profiles")
+func RegisterArtifacts(r gin.IRoutes, path string, dir string) {
+	handler := profiler.ArtifactHandler(dir)
+	serve := func(c *gin.Context) {
+		req := new(http.Request)
+		*req = *c.Request
+		u := *c.Request.URL
+		u.Path, u.RawPath = c.Param("name"), ""
+		req.URL = &u
+		handler.ServeHTTP(c.Writer, req)
+	}
+	r.GET(path+"/*name", serve)
+	r.HEAD(path+"/*name", serve)
+}
@@ -4,12 +4,12 @@ go 1.22
 
 require (
 	github.com/felixge/fgprof v0.9.5
+	github.com/google/pprof v0.0.0-20241023014458-598669927662
 	github.com/stretchr/testify v1.9.0
 )
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
-	github.com/google/pprof v0.0.0-20241023014458-598669927662 // indirect
 	github.com/pmezard/go-difflib v1.0.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
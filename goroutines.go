@@ -0,0 +1,155 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/pprof/profile"
+)
+
+// dominantShare is the fraction of goroutines above which a bucket is
+// considered to dominate a goroutine profile.
+const dominantShare = 0.25
+
+// GoroutineBucket is a group of goroutines blocked in the same way at the
+// same place, such as those receiving on a channel in one function.
+type GoroutineBucket struct {
+	// State is why the goroutines are waiting, such as "chan receive" or
+	// "io wait", "other" if they are not parked in a known way.
+	State string
+	// Frame is the function the goroutines are blocked in, the first frame
+	// beneath the standard library, such as the caller of sync.Mutex.Lock.
+	Frame string
+	// Count is the number of goroutines in the bucket.
+	Count int64
+	// Share is the fraction (0 to 1) of all goroutines in the bucket.
+	Share float64
+}
+
+// Dominant reports whether the bucket holds a disproportionate share of
+// the goroutines, typically the first place to look.
+func (b GoroutineBucket) Dominant() bool {
+	return b.Share >= dominantShare
+}
+
+// String describes the bucket, such as "chan receive in main.worker".
+func (b GoroutineBucket) String() string {
+	return fmt.Sprintf("%s in %s", b.State, b.Frame)
+}
+
+// ClassifyGoroutines buckets the goroutines of a goroutine profile by their
+// wait reason and blocking frame, largest first, turning a dump of many
+// thousands of goroutines into a handful of rows.
+func ClassifyGoroutines(prof *profile.Profile) ([]GoroutineBucket, error) {
+	if len(prof.SampleType) == 0 {
+		return nil, errors.New("profile has no sample types")
+	}
+	counts := make(map[GoroutineBucket]int64)
+	var total int64
+	for _, sample := range prof.Sample {
+		names := sampleFunctions(sample)
+		key := GoroutineBucket{State: goroutineState(names), Frame: blockingFrame(names)}
+		counts[key] += sample.Value[0]
+		total += sample.Value[0]
+	}
+	buckets := make([]GoroutineBucket, 0, len(counts))
+	for bucket, count := range counts {
+		bucket.Count = count
+		if total != 0 {
+			bucket.Share = float64(count) / float64(total)
+		}
+		buckets = append(buckets, bucket)
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if buckets[i].Count != buckets[j].Count {
+			return buckets[i].Count > buckets[j].Count
+		}
+		return buckets[i].String() < buckets[j].String()
+	})
+	return buckets, nil
+}
+
+// blockingFrame returns the first function of names, leaf first, outside
+// of the standard library, falling back to the first outside the runtime.
+func blockingFrame(names []string) string {
+	for _, name := range names {
+		if !standardLibrary(name) {
+			return name
+		}
+	}
+	for _, name := range names {
+		if !strings.HasPrefix(name, "runtime.") {
+			return name
+		}
+	}
+	return "(unknown)"
+}
+
+// standardLibrary reports whether the function name belongs to a package
+// of the standard library, whose import paths have no dot in their first
+// element.
+func standardLibrary(name string) bool {
+	first, _, nested := strings.Cut(name, "/")
+	if !nested {
+		// A package at the root, such as runtime or main.
+		pkg, _, _ := strings.Cut(name, ".")
+		return pkg != "main"
+	}
+	return !strings.Contains(first, ".")
+}
+
+// WriteGoroutineBuckets writes the n largest buckets as a text table, those
+// which dominate are marked with an asterisk.
+func WriteGoroutineBuckets(w io.Writer, buckets []GoroutineBucket, n int) error {
+	if n < 0 {
+		return fmt.Errorf("the number of buckets must not be negative, got %d", n)
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "goroutines\tshare\tstate\tframe\n")
+	for _, b := range buckets[:min(n, len(buckets))] {
+		share := fmt.Sprintf("%.1f%%", b.Share*100)
+		if b.Dominant() {
+			share += " *"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", b.Count, share, b.State, b.Frame)
+	}
+	return tw.Flush()
+}
+
+// classifyGoroutines records the buckets of the goroutine artifact of the
+// session, reporting those which dominate.
+func (p *Profiler) classifyGoroutines() {
+	if !p.selectedMode(GoroutineMode) {
+		return
+	}
+	for _, path := range p.ArtifactPaths() {
+		// The artifact may be compressed.
+		if !strings.HasPrefix(filepath.Base(path), GoroutineFileName) {
+			continue
+		}
+		prof, err := readProfile(p.fs, path)
+		if err != nil {
+			continue
+		}
+		buckets, _ := ClassifyGoroutines(prof)
+		p.mu.Lock()
+		p.goroutineBuckets = buckets
+		p.mu.Unlock()
+		for _, b := range buckets {
+			if !b.Dominant() {
+				break
+			}
+			// Goroutines which are not parked, such as the one writing the
+			// profile, are not blocked.
+			if b.State == "other" {
+				continue
+			}
+			p.report("%.1f%% of goroutines (%d) are blocked on %s", b.Share*100, b.Count, b)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package profiler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+// goroutineProfile builds a goroutine profile with a sample per stack,
+// leaf first, counting the goroutines of each.
+func goroutineProfile(stacks map[string]int64) *profile.Profile {
+	prof := &profile.Profile{SampleType: []*profile.ValueType{{Type: "goroutine", Unit: "count"}}}
+	var id uint64
+	for stack, count := range stacks {
+		var locations []*profile.Location
+		for _, name := range strings.Split(stack, ";") {
+			id++
+			locations = append(locations, &profile.Location{ID: id, Line: []profile.Line{{Function: &profile.Function{ID: id, Name: name}}}})
+		}
+		prof.Sample = append(prof.Sample, &profile.Sample{Location: locations, Value: []int64{count}})
+	}
+	return prof
+}
+
+func TestClassifyGoroutines(t *testing.T) {
+	buckets, err := ClassifyGoroutines(goroutineProfile(map[string]int64{
+		"runtime.gopark;runtime.chanrecv;runtime.chanrecv1;main.worker;runtime.goexit":                                    60,
+		"runtime.gopark;runtime.chanrecv;runtime.chanrecv2;main.worker;runtime.goexit":                                    20,
+		"runtime.gopark;sync.runtime_SemacquireMutex;sync.(*Mutex).lockSlow;sync.(*Mutex).Lock;github.com/a/b.(*C).Store": 15,
+		"runtime.gopark;runtime.netpollblock;internal/poll.runtime_pollWait;net.(*conn).Read;net/http.(*conn).serve":      4,
+		"main.main": 1,
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, []GoroutineBucket{
+		{State: "chan receive", Frame: "main.worker", Count: 80, Share: 0.8},
+		{State: "mutex", Frame: "github.com/a/b.(*C).Store", Count: 15, Share: 0.15},
+		{State: "io wait", Frame: "internal/poll.runtime_pollWait", Count: 4, Share: 0.04},
+		{State: "other", Frame: "main.main", Count: 1, Share: 0.01},
+	}, buckets)
+	assert.True(t, buckets[0].Dominant())
+	assert.False(t, buckets[1].Dominant())
+	assert.Equal(t, "chan receive in main.worker", buckets[0].String())
+
+	var b strings.Builder
+	assert.NoError(t, WriteGoroutineBuckets(&b, buckets, 2))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Regexp(t, `^80\s+80.0% \*\s+chan receive\s+main.worker$`, lines[1])
+	assert.Regexp(t, `^15\s+15.0%\s+mutex`, lines[2])
+	assert.ErrorContains(t, WriteGoroutineBuckets(&b, buckets, -1), "must not be negative")
+}
+
+func TestStandardLibrary(t *testing.T) {
+	assert.True(t, standardLibrary("runtime.gopark"))
+	assert.True(t, standardLibrary("net/http.(*conn).serve"))
+	assert.False(t, standardLibrary("main.worker"))
+	assert.False(t, standardLibrary("github.com/symonk/profiler.Start"))
+}
+
+// parkedWorker blocks until release is closed.
+func parkedWorker(started *sync.WaitGroup, wg *sync.WaitGroup, release chan struct{}) {
+	defer wg.Done()
+	started.Done()
+	<-release
+}
+
+func TestGoroutineSessionRecordsBuckets(t *testing.T) {
+	var started, wg sync.WaitGroup
+	release := make(chan struct{})
+	for range 100 {
+		started.Add(1)
+		wg.Add(1)
+		go parkedWorker(&started, &wg, release)
+	}
+	defer wg.Wait()
+	defer close(release)
+	started.Wait()
+	// Allow the workers to park on the channel.
+	time.Sleep(10 * time.Millisecond)
+	p, err := Capture(context.Background(), time.Millisecond, WithMode(GoroutineMode), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.NoError(t, err)
+	buckets := p.Report().GoroutineBuckets
+	if assert.NotEmpty(t, buckets) {
+		assert.Equal(t, GoroutineBucket{State: "chan receive", Frame: "github.com/symonk/profiler.parkedWorker"}, GoroutineBucket{State: buckets[0].State, Frame: buckets[0].Frame})
+		assert.True(t, buckets[0].Dominant())
+	}
+}
@@ -0,0 +1,88 @@
+package profiler
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// governorMaxBackoff caps how far the overhead governor backs off, at
+// most one cycle in 2^governorMaxBackoff is captured.
+const governorMaxBackoff = 6
+
+// OverheadBudget bounds the overhead continuous profiling may add to the
+// process, amortised over the capture interval.  A zero field is not
+// enforced.
+type OverheadBudget struct {
+	// CPU is the fraction of GOMAXPROCS the captures may consume above
+	// the baseline of the process, 0.01 allows 1%.
+	CPU float64
+	// Alloc is the fraction the captures may increase the allocation
+	// rate of the process by.
+	Alloc float64
+}
+
+// exceeded reports whether the cpu and alloc overheads exceed the budget.
+func (b OverheadBudget) exceeded(cpu float64, alloc float64) bool {
+	return (b.CPU > 0 && cpu > b.CPU) || (b.Alloc > 0 && alloc > b.Alloc)
+}
+
+// governor measures the overhead of each continuous capture cycle by
+// comparing the runtime during the cycle with the baseline observed
+// between cycles.  While the budget is exceeded it backs off, capturing
+// one cycle in 2^backoff, and resumes as headroom returns.
+type governor struct {
+	budget  OverheadBudget
+	procs   int
+	backoff int
+	skipped int
+	// idle is the observation at the end of the previous capture, the
+	// baseline is measured from it.
+	idle observation
+}
+
+// admit reports whether the next cycle is captured.
+func (g *governor) admit() bool {
+	if g.skipped+1 >= 1<<g.backoff {
+		g.skipped = 0
+		return true
+	}
+	g.skipped++
+	return false
+}
+
+// overhead estimates the cpu and allocation overhead of the capture
+// between start and end above the baseline, amortised over the cycles
+// it stands in for at the current backoff.
+func (g *governor) overhead(start observation, end observation, interval time.Duration) (float64, float64) {
+	idle := start.at.Sub(g.idle.at).Seconds()
+	capture := end.at.Sub(start.at).Seconds()
+	period := interval.Seconds() * float64(int(1)<<g.backoff)
+	if g.idle.at.IsZero() || idle <= 0 || capture <= 0 || period <= 0 {
+		return 0, 0
+	}
+	baselineCPU := (start.userCPU - g.idle.userCPU) / idle
+	cpu := math.Max(0, end.userCPU-start.userCPU-baselineCPU*capture) / (period * float64(g.procs))
+	var alloc float64
+	if baselineAllocs := float64(start.allocs-g.idle.allocs) / idle; baselineAllocs > 0 {
+		alloc = math.Max(0, float64(end.allocs-start.allocs)-baselineAllocs*capture) / (baselineAllocs * period)
+	}
+	return cpu, alloc
+}
+
+// record adjusts the backoff from the overhead of the capture between
+// start and end, describing any change.
+func (g *governor) record(start observation, end observation, interval time.Duration) string {
+	cpu, alloc := g.overhead(start, end, interval)
+	g.idle = end
+	if g.budget.exceeded(cpu, alloc) && g.backoff < governorMaxBackoff {
+		g.backoff++
+		return fmt.Sprintf("profiling overhead (%.2f%% cpu, %.2f%% allocs) exceeds the budget, backing off to one cycle in %d", cpu*100, alloc*100, 1<<g.backoff)
+	}
+	// Halving the backoff doubles the amortised overhead.
+	if g.backoff > 0 && !g.budget.exceeded(cpu*2, alloc*2) {
+		g.backoff--
+		return fmt.Sprintf("profiling overhead (%.2f%% cpu, %.2f%% allocs) has headroom, resuming to one cycle in %d", cpu*100, alloc*100, 1<<g.backoff)
+	}
+	return ""
+}
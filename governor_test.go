@@ -0,0 +1,62 @@
+package profiler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGovernorBacksOffAndResumes(t *testing.T) {
+	epoch := time.Now()
+	at := func(seconds float64, cpu float64, allocs uint64) observation {
+		return observation{at: epoch.Add(time.Duration(seconds * float64(time.Second))), userCPU: cpu, allocs: allocs}
+	}
+	g := &governor{budget: OverheadBudget{CPU: 0.01}, procs: 1, idle: at(0, 0, 0)}
+
+	// A 1s capture burning 0.5s of cpu above an idle baseline, every 10s.
+	assert.True(t, g.admit())
+	assert.Contains(t, g.record(at(9, 0.9, 0), at(10, 1.5, 0), 10*time.Second), "one cycle in 2")
+	assert.Equal(t, 1, g.backoff)
+	assert.False(t, g.admit())
+	assert.True(t, g.admit())
+
+	// The overhead falls, doubling it would still fit within budget.
+	assert.Contains(t, g.record(at(29, 2.9, 0), at(30, 3.0, 0), 10*time.Second), "resuming to one cycle in 1")
+	assert.Equal(t, 0, g.backoff)
+	assert.True(t, g.admit())
+	assert.True(t, g.admit())
+}
+
+func TestGovernorAllocBudget(t *testing.T) {
+	epoch := time.Now()
+	g := &governor{budget: OverheadBudget{Alloc: 0.5}, procs: 1, idle: observation{at: epoch}}
+	start := observation{at: epoch.Add(9 * time.Second), allocs: 9 << 20}
+	// The capture allocates 10MiB above the 1MiB/s baseline, doubling the
+	// allocations over the 10s interval.
+	end := observation{at: epoch.Add(10 * time.Second), allocs: 20 << 20}
+	cpu, alloc := g.overhead(start, end, 10*time.Second)
+	assert.Zero(t, cpu)
+	assert.InDelta(t, 1.0, alloc, 0.001)
+	assert.NotEmpty(t, g.record(start, end, 10*time.Second))
+	assert.Equal(t, 1, g.backoff)
+}
+
+func TestGovernorCapsBackoff(t *testing.T) {
+	g := &governor{budget: OverheadBudget{CPU: 0.01}, procs: 1, backoff: governorMaxBackoff, idle: observation{at: time.Now()}}
+	start := observation{at: g.idle.at.Add(time.Second)}
+	end := observation{at: start.at.Add(time.Second), userCPU: 1}
+	assert.Empty(t, g.record(start, end, time.Second))
+	assert.Equal(t, governorMaxBackoff, g.backoff)
+}
+
+func TestContinuousWithOverheadBudget(t *testing.T) {
+	config := ContinuousConfig{Interval: time.Hour, Duration: time.Millisecond, Modes: []string{"heap"}, OutputDir: t.TempDir()}
+	c, err := StartContinuous(context.Background(), StaticConfig(config), WithOverheadBudget(OverheadBudget{CPU: 0.01}), WithQuietOutput(), WithoutSignalHandling())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	assert.NotNil(t, c.governor)
+}
@@ -0,0 +1,117 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"runtime/pprof"
+	"sync"
+)
+
+// group owns a set of goroutines, waiting on them and retaining the first
+// error returned, in the manner of golang.org/x/sync/errgroup.  Unlike a
+// sync.WaitGroup, goroutines may be added while another goroutine waits.
+type group struct {
+	mu      sync.Mutex
+	running int
+	idle    chan struct{}
+	err     error
+}
+
+// start runs fn in a new goroutine owned by the group, failed is invoked
+// with its error, if any.
+func (g *group) start(fn func() error, failed func(error)) {
+	g.mu.Lock()
+	if g.running == 0 {
+		g.idle = make(chan struct{})
+	}
+	g.running++
+	g.mu.Unlock()
+	go func() {
+		err := fn()
+		if err != nil && failed != nil {
+			failed(err)
+		}
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if err != nil && g.err == nil {
+			g.err = err
+		}
+		if g.running--; g.running == 0 {
+			close(g.idle)
+		}
+	}()
+}
+
+// wait blocks until every goroutine of the group has returned, returning
+// the first error.
+func (g *group) wait() error {
+	for {
+		g.mu.Lock()
+		running, idle, err := g.running, g.idle, g.err
+		g.mu.Unlock()
+		if running == 0 {
+			return err
+		}
+		<-idle
+	}
+}
+
+// Go runs fn in a goroutine owned by the session, rather than a fire and
+// forget goroutine which may leak, such as a Trigger watching for the
+// lifetime of the session:
+//
+//	p.Go(func() error { return trigger.Watch(p.Context()) })
+//
+// An error returned by fn is recorded in the Report and cancels Context,
+// in the manner of errgroup, see Wait.  context.Canceled returned once
+// Context is done is not an error, the session stopping ended fn.
+func (p *Profiler) Go(fn func() error) {
+	owned := func() error {
+		err := fn()
+		if errors.Is(err, context.Canceled) && p.ctx.Err() != nil {
+			return nil
+		}
+		return err
+	}
+	p.goroutines.start(owned, func(err error) {
+		p.recordError(err)
+		p.cancel()
+	})
+}
+
+// LabeledGo runs fn in a goroutine owned by the session, as Go, with the
+// pprof labels applied for its entire lifetime, so that background work
+// such as a worker pool shows up distinctly in the CPU and goroutine
+// profiles of the session.  ctx is Context carrying the labels, goroutines
+// started by fn inherit them.
+//
+//	p.LabeledGo(pprof.Labels("pool", "indexer"), func(ctx context.Context) error { return indexer.Run(ctx) })
+func (p *Profiler) LabeledGo(labels pprof.LabelSet, fn func(ctx context.Context) error) {
+	p.Go(func() (err error) {
+		pprof.Do(p.ctx, labels, func(ctx context.Context) {
+			err = fn(ctx)
+		})
+		return err
+	})
+}
+
+// Context returns a context which is done once the session has stopped
+// or a goroutine started with Go has failed.
+func (p *Profiler) Context() context.Context {
+	return p.ctx
+}
+
+// Wait blocks until the session has stopped and every goroutine it owns
+// has returned, including its signal handling and those started with Go,
+// returning the first error of a goroutine started with Go.  A session
+// which was never started is not waited for.  Triggers are only owned
+// when started with Go, Continuous and Agent own their goroutines and wait
+// for them in Close.
+func (p *Profiler) Wait() error {
+	select {
+	case <-p.started:
+		<-p.done
+	default:
+	}
+	return p.goroutines.wait()
+}
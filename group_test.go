@@ -0,0 +1,120 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime/pprof"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGroupWaitsAndRetainsTheFirstError(t *testing.T) {
+	var g group
+	assert.NoError(t, g.wait())
+	first := errors.New("first")
+	var failures atomic.Int32
+	release := make(chan struct{})
+	g.start(func() error { return first }, func(error) { failures.Add(1) })
+	g.start(func() error {
+		<-release
+		return errors.New("second")
+	}, func(error) { failures.Add(1) })
+	time.AfterFunc(20*time.Millisecond, func() { close(release) })
+	assert.Equal(t, first, g.wait())
+	assert.Equal(t, int32(2), failures.Load())
+}
+
+func TestProfilerGoIsOwnedBySession(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := Start(
+		WithHeapProfiler(),
+		WithProfileFileLocation(t.TempDir()),
+		WithShutdownContext(ctx),
+		WithQuietOutput(),
+	)
+	var watched atomic.Bool
+	p.Go(func() error {
+		<-p.Context().Done()
+		watched.Store(true)
+		return p.Context().Err()
+	})
+	cancel()
+	assert.NoError(t, p.Wait())
+	assert.True(t, watched.Load())
+	assert.Len(t, p.ArtifactPaths(), 1)
+	assert.Empty(t, p.Report().Errors)
+}
+
+func TestProfilerGoPropagatesErrors(t *testing.T) {
+	p := Start(
+		WithHeapProfiler(),
+		WithProfileFileLocation(t.TempDir()),
+		WithErrorHandler(func(error) {}),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	failed := errors.New("trigger failed")
+	p.Go(func() error { return failed })
+	<-p.Context().Done()
+	p.Stop()
+	assert.ErrorIs(t, p.Wait(), failed)
+	assert.Contains(t, p.Report().Errors, failed)
+}
+
+func TestProfilerLabeledGo(t *testing.T) {
+	p := Start(
+		WithMode(GoroutineMode),
+		WithProfileFileLocation(t.TempDir()),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	started := make(chan struct{})
+	p.LabeledGo(pprof.Labels("pool", "indexer"), func(ctx context.Context) error {
+		value, _ := pprof.Label(ctx, "pool")
+		assert.Equal(t, "indexer", value)
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	<-started
+	// The goroutine profile of the session was written as it started, so
+	// the labelled goroutine is checked in a profile of its own.
+	var buf bytes.Buffer
+	assert.NoError(t, pprof.Lookup("goroutine").WriteTo(&buf, 0))
+	prof, err := profile.Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labelled := false
+	for _, sample := range prof.Sample {
+		if values := sample.Label["pool"]; len(values) == 1 && values[0] == "indexer" {
+			labelled = true
+		}
+	}
+	assert.True(t, labelled)
+	p.Stop()
+	assert.NoError(t, p.Wait())
+}
+
+func TestProfilerWaitBlocksUntilStopped(t *testing.T) {
+	p := Start(
+		WithHeapProfiler(),
+		WithProfileFileLocation(t.TempDir()),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	waited := make(chan error, 1)
+	go func() { waited <- p.Wait() }()
+	select {
+	case <-waited:
+		t.Fatal("Wait returned before the session stopped")
+	case <-time.After(50 * time.Millisecond):
+	}
+	p.Stop()
+	assert.NoError(t, <-waited)
+}
@@ -0,0 +1,46 @@
+package profiler
+
+import "time"
+
+// ArtifactInfo describes the artifacts produced by a capture.
+type ArtifactInfo struct {
+	// Paths are the absolute paths of the artifacts written.
+	Paths []string
+	// Started is when the capture began.
+	Started time.Time
+	// Duration is how long the capture ran for, including finalization.
+	Duration time.Duration
+}
+
+// BeforeCaptureFunc is invoked immediately before the strategy for
+// mode begins capturing.
+type BeforeCaptureFunc func(mode Mode)
+
+// AfterCaptureFunc is invoked once the strategy for mode has been
+// finalized, or failed to start, err is the error of the strategy.
+type AfterCaptureFunc func(mode Mode, info ArtifactInfo, err error)
+
+// beforeCapture invokes every before capture hook.
+func (p *Profiler) beforeCapture() {
+	p.emit(EventCaptureBegan, nil, nil)
+	mode := p.Mode()
+	for _, hook := range p.beforeHooks {
+		hook(mode)
+	}
+}
+
+// afterCapture invokes every after capture hook, a hook which panics is
+// recorded as an error and the remaining hooks are still invoked.
+func (p *Profiler) afterCapture(err error) {
+	p.mu.Lock()
+	started := p.startedAt
+	p.mu.Unlock()
+	info := ArtifactInfo{Paths: p.ArtifactPaths(), Started: started, Duration: time.Since(started)}
+	p.emit(EventCaptureFinished, info.Paths, err)
+	mode := p.Mode()
+	for _, hook := range p.afterHooks {
+		if panicked := guard("after capture hook", func() error { hook(mode, info, err); return nil }); panicked != nil {
+			p.recordError(panicked)
+		}
+	}
+}
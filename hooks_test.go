@@ -0,0 +1,58 @@
+package profiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaptureHooks(t *testing.T) {
+	var events []string
+	var info ArtifactInfo
+	p := Start(
+		WithHeapProfiler(),
+		WithProfileFileLocation(t.TempDir()),
+		WithBeforeCapture(func(mode Mode) { events = append(events, "before "+mode.String()) }),
+		WithAfterCapture(func(mode Mode, i ArtifactInfo, err error) {
+			assert.NoError(t, err)
+			info = i
+			events = append(events, "after "+mode.String())
+		}),
+		WithCallback(func(*Profiler) { events = append(events, "callback") }),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	events = append(events, "running")
+	p.Stop()
+	assert.Equal(t, []string{"before heap", "running", "after heap", "callback"}, events)
+	assert.Equal(t, p.ArtifactPaths(), info.Paths)
+	assert.False(t, info.Started.IsZero())
+	assert.Positive(t, info.Duration)
+}
+
+func TestStrategyMiddlewareOrder(t *testing.T) {
+	var events []string
+	named := func(name string) StrategyMiddleware {
+		return func(next StrategyFunc) StrategyFunc {
+			return func(p *Profiler) (FinalizerFunc, error) {
+				events = append(events, "start "+name)
+				finalizer, err := next(p)
+				if err != nil {
+					return nil, err
+				}
+				return func() error {
+					events = append(events, "finalize "+name)
+					return finalizer()
+				}, nil
+			}
+		}
+	}
+	Start(
+		WithHeapProfiler(),
+		WithProfileFileLocation(t.TempDir()),
+		WithStrategyMiddleware(named("outer"), named("inner")),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	).Stop()
+	assert.Equal(t, []string{"start outer", "start inner", "finalize outer", "finalize inner"}, events)
+}
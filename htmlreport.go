@@ -0,0 +1,275 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"io"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// The geometry of the flame graph in an HTML report.
+const (
+	flameWidth     = 1200.0
+	flameRowHeight = 18.0
+	flameMinWidth  = 0.5
+	flameCharWidth = 7.0
+	htmlReportTop  = 25
+)
+
+// flameNode is a frame of the flame graph, the value of a node is the
+// sum of the samples whose stack passes through it.
+type flameNode struct {
+	name     string
+	value    int64
+	children map[string]*flameNode
+}
+
+// child returns the child of n named name, creating it if necessary.
+func (n *flameNode) child(name string) *flameNode {
+	if n.children == nil {
+		n.children = make(map[string]*flameNode)
+	}
+	c, ok := n.children[name]
+	if !ok {
+		c = &flameNode{name: name}
+		n.children[name] = c
+	}
+	return c
+}
+
+// flameRect is a frame of the flame graph as it is drawn.
+type flameRect struct {
+	X, Y, Width float64
+	Label       string
+	Title       string
+	Color       string
+}
+
+// htmlReport is the data rendered by htmlReportTemplate.
+type htmlReport struct {
+	Title       string
+	Generated   string
+	SampleType  string
+	Total       string
+	Height      float64
+	Width       float64
+	Rects       []flameRect
+	Top         []htmlReportRow
+	EmptyReason string
+}
+
+// htmlReportRow is a row of the top functions table.
+type htmlReportRow struct {
+	Name  string
+	Flat  string
+	Share string
+	Cum   string
+}
+
+var htmlReportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+svg text { font-family: monospace; font-size: 12px; pointer-events: none; }
+svg rect { stroke: #fff; stroke-width: 0.5; }
+svg g:hover rect { stroke: #000; }
+table { border-collapse: collapse; margin-top: 1em; }
+th, td { padding: 0.3em 0.8em; border-bottom: 1px solid #ddd; text-align: right; }
+th:first-child, td:first-child { text-align: left; font-family: monospace; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Generated {{.Generated}}, {{.Total}} of {{.SampleType}} in total.</p>
+<h2>Flame graph</h2>
+{{if .EmptyReason}}<p>{{.EmptyReason}}</p>{{else}}<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}">
+{{range .Rects}}<g><title>{{.Title}}</title><rect x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="18" fill="{{.Color}}"></rect>{{if .Label}}<text x="{{.X}}" y="{{.Y}}" dx="3" dy="13">{{.Label}}</text>{{end}}</g>
+{{end}}</svg>{{end}}
+<h2>Top functions</h2>
+<table>
+<tr><th>Function</th><th>Flat</th><th>Flat %</th><th>Cum</th></tr>
+{{range .Top}}<tr><td>{{.Name}}</td><td>{{.Flat}}</td><td>{{.Share}}</td><td>{{.Cum}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// WriteHTMLReport renders prof as a static, self-contained HTML page with
+// a flame graph and a table of the top functions of its default sample
+// type, viewable in any browser without installing go tooling.
+func WriteHTMLReport(w io.Writer, title string, prof *profile.Profile) error {
+	index := defaultSampleIndex(prof)
+	if index < 0 {
+		return errors.New("profile has no sample types")
+	}
+	sampleType := prof.SampleType[index]
+	format := formatSampleValue(sampleType.Unit)
+	root := &flameNode{name: "root"}
+	for _, sample := range prof.Sample {
+		value := sample.Value[index]
+		if value == 0 {
+			continue
+		}
+		root.value += value
+		node := root
+		names := sampleFunctions(sample)
+		for i := len(names) - 1; i >= 0; i-- {
+			node = node.child(names[i])
+			node.value += value
+		}
+	}
+	report := htmlReport{
+		Title:      title,
+		Generated:  time.Now().Format(time.RFC3339),
+		SampleType: sampleType.Type,
+		Total:      format(root.value),
+		Width:      flameWidth,
+	}
+	if root.value == 0 {
+		report.EmptyReason = "The profile has no samples."
+	} else {
+		depth := layoutFlame(root, 0, 0, flameWidth/float64(root.value), root.value, format, &report.Rects)
+		report.Height = float64(depth) * flameRowHeight
+	}
+	top, err := TopFunctions(prof, sampleType.Type, htmlReportTop)
+	if err != nil {
+		return err
+	}
+	for _, s := range top {
+		report.Top = append(report.Top, htmlReportRow{Name: s.Name, Flat: format(s.Flat), Share: fmt.Sprintf("%.1f%%", s.Share*100), Cum: format(s.Cum)})
+	}
+	return htmlReportTemplate.Execute(w, report)
+}
+
+// layoutFlame appends the rects of node and its descendants, widest
+// children first, returning the depth of the deepest rect drawn.
+func layoutFlame(node *flameNode, x float64, depth int, scale float64, total int64, format func(int64) string, rects *[]flameRect) int {
+	width := float64(node.value) * scale
+	if width < flameMinWidth {
+		return depth
+	}
+	rect := flameRect{
+		X:     math.Round(x*100) / 100,
+		Y:     float64(depth) * flameRowHeight,
+		Width: math.Round(width*100) / 100,
+		Title: fmt.Sprintf("%s: %s (%.2f%%)", node.name, format(node.value), float64(node.value)/float64(total)*100),
+		Color: flameColor(node.name),
+	}
+	if chars := int(width/flameCharWidth) - 1; chars >= 3 {
+		rect.Label = node.name
+		if len(rect.Label) > chars {
+			rect.Label = rect.Label[:chars-2] + ".."
+		}
+	}
+	*rects = append(*rects, rect)
+	children := make([]*flameNode, 0, len(node.children))
+	for _, c := range node.children {
+		children = append(children, c)
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].value != children[j].value {
+			return children[i].value > children[j].value
+		}
+		return children[i].name < children[j].name
+	})
+	deepest := depth + 1
+	for _, c := range children {
+		deepest = max(deepest, layoutFlame(c, x, depth+1, scale, total, format, rects))
+		x += float64(c.value) * scale
+	}
+	return deepest
+}
+
+// flameColor returns a warm colour derived from the package of name, so
+// that frames of the same package share a colour.
+func flameColor(name string) string {
+	pkg := name
+	if i := strings.LastIndex(pkg, "/"); i >= 0 {
+		pkg = pkg[i+1:]
+	}
+	if i := strings.Index(pkg, "."); i >= 0 {
+		pkg = pkg[:i]
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(pkg))
+	sum := h.Sum32()
+	return fmt.Sprintf("rgb(%d,%d,%d)", 205+sum%50, 80+(sum>>8)%130, 40+(sum>>16)%50)
+}
+
+// formatSampleValue returns a formatter for sample values of unit.
+func formatSampleValue(unit string) func(int64) string {
+	switch unit {
+	case "nanoseconds":
+		return func(v int64) string { return time.Duration(v).String() }
+	case "bytes":
+		return formatBytes
+	}
+	return func(v int64) string { return fmt.Sprintf("%d", v) }
+}
+
+// htmlReports writes a `<name>.html` report alongside every pprof artifact
+// when WithHTMLReport is provided.
+func (p *Profiler) htmlReports() {
+	if !p.htmlReport {
+		return
+	}
+	paths := p.ArtifactPaths()
+	sizes := make([]int64, len(paths))
+	var total int64
+	for i, path := range paths {
+		if info, err := p.fs.Stat(path); err == nil {
+			sizes[i] = info.Size()
+			total += sizes[i]
+		}
+	}
+	progress := p.trackProgress("html reports", total)
+	defer progress.finish()
+	// Reports are written in parallel, but recorded as artifacts in the
+	// order of the profiles they describe.
+	written := make([]string, len(paths))
+	tasks := make([]func(), len(paths))
+	for i, path := range paths {
+		tasks[i] = func() {
+			prof, err := readProfile(p.fs, path)
+			progress.add(sizes[i])
+			if err != nil {
+				// Execution traces and label breakdowns are not profiles.
+				return
+			}
+			name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+			name = strings.TrimSuffix(name, ".pprof")
+			htmlPath := filepath.Join(filepath.Dir(path), name+".html")
+			if err := writeHTMLReportFile(p.fs, htmlPath, name+" profile", prof); err != nil {
+				p.recordError(fmt.Errorf("failed to write html report: %w", err))
+				return
+			}
+			written[i] = htmlPath
+		}
+	}
+	p.finalizeEach(tasks)
+	for _, htmlPath := range written {
+		if htmlPath != "" {
+			p.addArtifact(htmlPath)
+		}
+	}
+}
+
+// writeHTMLReportFile writes the HTML report of prof to path of fsys.
+func writeHTMLReportFile(fsys FS, path string, title string, prof *profile.Profile) error {
+	f, err := fsys.Create(path)
+	if err != nil {
+		return err
+	}
+	return errors.Join(WriteHTMLReport(f, title, prof), f.Close())
+}
@@ -0,0 +1,59 @@
+package profiler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithHTMLReportWritesReportArtifact(t *testing.T) {
+	dir := t.TempDir()
+	p, err := Capture(context.Background(), time.Millisecond, WithMode(GoroutineMode), WithHTMLReport(), WithProfileFileLocation(dir), WithQuietOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := filepath.Join(dir, "goroutine.html")
+	assert.Equal(t, []string{filepath.Join(dir, GoroutineFileName), report}, p.ArtifactPaths())
+	contents, err := os.ReadFile(report)
+	assert.NoError(t, err)
+	assert.Contains(t, string(contents), "<svg")
+	assert.Contains(t, string(contents), "TestWithHTMLReportWritesReportArtifact")
+}
+
+func TestWriteHTMLReport(t *testing.T) {
+	fn := func(id uint64, name string) *profile.Location {
+		return &profile.Location{ID: id, Line: []profile.Line{{Function: &profile.Function{ID: id, Name: name}}}}
+	}
+	main, work, idle := fn(1, "main.main"), fn(2, "main.work"), fn(3, "main.idle")
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{work, main}, Value: []int64{3, int64(3 * time.Millisecond)}},
+			{Location: []*profile.Location{idle, main}, Value: []int64{1, int64(time.Millisecond)}},
+		},
+	}
+	var b strings.Builder
+	assert.NoError(t, WriteHTMLReport(&b, "cpu <profile>", prof))
+	html := b.String()
+	assert.Contains(t, html, "<title>cpu &lt;profile&gt;</title>")
+	assert.Contains(t, html, "4ms of cpu in total")
+	assert.Contains(t, html, "<title>main.work: 3ms (75.00%)</title>")
+	// main.work is drawn before main.idle, beneath main.main.
+	assert.Contains(t, html, `<rect x="0" y="36" width="900"`)
+	assert.Contains(t, html, `<rect x="900" y="36" width="300"`)
+	assert.Contains(t, html, "<td>main.work</td><td>3ms</td><td>75.0%</td><td>3ms</td>")
+}
+
+func TestWriteHTMLReportWithoutSamples(t *testing.T) {
+	var b strings.Builder
+	prof := &profile.Profile{SampleType: []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}}}
+	assert.NoError(t, WriteHTMLReport(&b, "heap", prof))
+	assert.Contains(t, b.String(), "The profile has no samples.")
+	assert.Error(t, WriteHTMLReport(&b, "empty", &profile.Profile{}))
+}
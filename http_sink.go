@@ -0,0 +1,306 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHTTPChunkSize = 8 << 20
+	defaultHTTPRetries   = 3
+	defaultHTTPBackoff   = time.Second
+)
+
+// UploadProgress is provided to a progress callback after each chunk of
+// an artifact has been uploaded.
+type UploadProgress struct {
+	// Name is the name of the artifact being uploaded.
+	Name string
+	// Bytes is the number of bytes uploaded so far.
+	Bytes int64
+	// Done is true once the artifact has been uploaded in full.
+	Done bool
+}
+
+// HTTPSinkOption is a functional option to configure HTTP sinks.
+type HTTPSinkOption func(*HTTPSink)
+
+// HTTPSink uploads artifacts with HTTP PUT requests to <url>/<name>.
+// Artifacts larger than the chunk size are uploaded as a sequence of
+// requests carrying a Content-Range header, each chunk is retried
+// independently so a flaky network only resends the failed chunk rather
+// than the entire (potentially multi gigabyte) artifact.  As in resumable
+// upload protocols, a server may acknowledge a chunk with 308 Permanent
+// Redirect, reporting the bytes it has committed with a Range header such
+// as bytes=0-1023, and a retry first queries them with an empty request
+// whose Content-Range is bytes */<size>, resuming from there.  The upload
+// only succeeds once the final chunk is answered with a 2xx status.
+// Artifacts which fit within a single chunk are uploaded with a plain PUT.
+// Object stores requiring signed requests (S3 etc) can be supported by
+// providing a client whose transport signs requests, see WithHTTPClient.
+type HTTPSink struct {
+	url       string
+	client    *http.Client
+	header    http.Header
+	chunkSize int
+	retries   int
+	backoff   time.Duration
+	progress  func(UploadProgress)
+	tls       *tls.Config
+	err       error
+}
+
+// NewHTTPSink returns a sink uploading artifacts beneath rawURL.
+func NewHTTPSink(rawURL string, options ...HTTPSinkOption) *HTTPSink {
+	s := &HTTPSink{
+		url:       strings.TrimSuffix(rawURL, "/"),
+		client:    http.DefaultClient,
+		header:    make(http.Header),
+		chunkSize: defaultHTTPChunkSize,
+		retries:   defaultHTTPRetries,
+		backoff:   defaultHTTPBackoff,
+	}
+	for _, opt := range options {
+		opt(s)
+	}
+	if s.tls != nil {
+		s.client, s.err = tlsClient(s.client, s.tls)
+	}
+	return s
+}
+
+// WithHTTPClient sets the client used to perform uploads.
+func WithHTTPClient(client *http.Client) HTTPSinkOption {
+	return func(s *HTTPSink) {
+		s.client = client
+	}
+}
+
+// WithHTTPTLS uploads over TLS configured by config, such as the client
+// certificate of mTLS, see ClientTLSConfig.  It applies to the client of
+// WithHTTPClient, whose transport must then be an *http.Transport.
+func WithHTTPTLS(config *tls.Config) HTTPSinkOption {
+	return func(s *HTTPSink) {
+		s.tls = config
+	}
+}
+
+// tlsClient returns a copy of client whose transport uses config.
+func tlsClient(client *http.Client, config *tls.Config) (*http.Client, error) {
+	var transport http.RoundTripper = http.DefaultTransport
+	if client.Transport != nil {
+		transport = client.Transport
+	}
+	t, ok := transport.(*http.Transport)
+	if !ok {
+		return nil, fmt.Errorf("unable to configure tls of a %T transport, an *http.Transport is required", transport)
+	}
+	t = t.Clone()
+	t.TLSClientConfig = config
+	tlsClient := *client
+	tlsClient.Transport = t
+	return &tlsClient, nil
+}
+
+// WithHTTPHeader adds a header (authorization etc) to every request.
+func WithHTTPHeader(key string, value string) HTTPSinkOption {
+	return func(s *HTTPSink) {
+		s.header.Add(key, value)
+	}
+}
+
+// WithHTTPChunkSize sets the size in bytes of each uploaded chunk,
+// by default this is 8MiB.
+func WithHTTPChunkSize(size int) HTTPSinkOption {
+	return func(s *HTTPSink) {
+		s.chunkSize = size
+	}
+}
+
+// WithHTTPRetries sets how many times a failed chunk is retried and
+// the initial backoff between attempts, which doubles each attempt.
+// By default a chunk is retried 3 times with a 1s initial backoff.
+func WithHTTPRetries(retries int, backoff time.Duration) HTTPSinkOption {
+	return func(s *HTTPSink) {
+		s.retries = retries
+		s.backoff = backoff
+	}
+}
+
+// WithHTTPProgress invokes fn after each chunk has been uploaded.
+func WithHTTPProgress(fn func(UploadProgress)) HTTPSinkOption {
+	return func(s *HTTPSink) {
+		s.progress = fn
+	}
+}
+
+// Create returns a writer uploading the artifact in chunks as it is
+// written, the final chunk is uploaded on Close.
+func (s *HTTPSink) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.chunkSize <= 0 {
+		return nil, errors.New("http sink chunk size must be positive")
+	}
+	return &httpUpload{ctx: ctx, sink: s, name: name, url: s.url + "/" + url.PathEscape(name)}, nil
+}
+
+// httpUpload buffers a single chunk of an artifact in memory.
+type httpUpload struct {
+	ctx    context.Context
+	sink   *HTTPSink
+	name   string
+	url    string
+	buf    bytes.Buffer
+	offset int64
+}
+
+// Write buffers p, uploading every complete chunk.
+func (u *httpUpload) Write(p []byte) (int, error) {
+	n, _ := u.buf.Write(p)
+	for u.buf.Len() >= u.sink.chunkSize {
+		if err := u.send(u.buf.Next(u.sink.chunkSize), false); err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// Close uploads the remaining data as the final chunk.
+func (u *httpUpload) Close() error {
+	return u.send(u.buf.Bytes(), true)
+}
+
+// errUploadLost is returned when the server has lost bytes of a chunked
+// upload which have already been discarded, so that it cannot resume.
+var errUploadLost = errors.New("the server lost bytes of the upload")
+
+// send uploads chunk, which begins at the current offset, retrying with
+// exponential backoff.  Before each retry a chunked upload asks the server
+// for the bytes it has committed, resuming from there rather than
+// resending those it already holds.
+func (u *httpUpload) send(chunk []byte, final bool) error {
+	start := u.offset
+	end := start + int64(len(chunk))
+	// A plain PUT is sufficient when the artifact fits in a single chunk.
+	chunked := start > 0 || !final
+	backoff := u.sink.backoff
+	var complete bool
+	var err error
+	for attempt := 0; attempt <= u.sink.retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-time.After(backoff):
+				backoff *= 2
+			case <-u.ctx.Done():
+				return errors.Join(err, u.ctx.Err())
+			}
+			if chunked {
+				// The failed request may have been committed in part
+				// or in full.
+				if complete, err = u.put(nil, true, end, final); err != nil {
+					continue
+				}
+			}
+		}
+		if u.offset < start {
+			return fmt.Errorf("failed to upload %s: %w, %d of the first %d bytes were committed", u.name, errUploadLost, u.offset, start)
+		}
+		if u.offset < end || (final && !complete) {
+			if complete, err = u.put(chunk[u.offset-start:], chunked, end, final); err != nil {
+				continue
+			}
+		}
+		if u.offset < end {
+			err = fmt.Errorf("the server committed %d of %d bytes", u.offset, end)
+			continue
+		}
+		if final && !complete {
+			err = errors.New("the server did not complete the upload")
+			continue
+		}
+		if u.sink.progress != nil {
+			u.sink.progress(UploadProgress{Name: u.name, Bytes: u.offset, Done: final})
+		}
+		return nil
+	}
+	return fmt.Errorf("failed to upload %s after %d attempts: %w", u.name, u.sink.retries+1, err)
+}
+
+// put performs a single PUT request of body, the bytes of the artifact
+// from the current offset, an empty body of a chunked upload querying its
+// status.  end is the offset the chunk ends at, the size of the artifact
+// if final.  The offset is advanced to the bytes committed by the server,
+// returning whether the upload is complete.
+func (u *httpUpload) put(body []byte, chunked bool, end int64, final bool) (bool, error) {
+	req, err := http.NewRequestWithContext(u.ctx, http.MethodPut, u.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	for key, values := range u.sink.header {
+		req.Header[key] = values
+	}
+	for key, value := range ContextTags(u.ctx) {
+		req.Header.Set(TagHeaderPrefix+key, value)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	if chunked {
+		total := "*"
+		if final {
+			total = strconv.FormatInt(end, 10)
+		}
+		contentRange := "bytes */" + total
+		if len(body) > 0 {
+			contentRange = fmt.Sprintf("bytes %d-%d/%s", u.offset, u.offset+int64(len(body))-1, total)
+		}
+		req.Header.Set("Content-Range", contentRange)
+	}
+	resp, err := u.sink.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+	committed := u.offset + int64(len(body))
+	switch {
+	case resp.StatusCode/100 == 2:
+		u.offset = committed
+		return final, nil
+	case resp.StatusCode == http.StatusPermanentRedirect:
+		// Resumable upload protocols acknowledge the bytes committed so
+		// far with 308, reported by its Range header if not all of them.
+		if r := resp.Header.Get("Range"); r != "" {
+			if committed, err = committedBytes(r); err != nil {
+				return false, err
+			}
+		}
+		u.offset = min(committed, end)
+		return false, nil
+	default:
+		return false, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+}
+
+// committedBytes returns the number of bytes committed according to the
+// Range header of a 308 response, such as bytes=0-1023.
+func committedBytes(header string) (int64, error) {
+	last, ok := strings.CutPrefix(header, "bytes=0-")
+	if !ok {
+		return 0, fmt.Errorf("invalid range %q", header)
+	}
+	n, err := strconv.ParseInt(last, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid range %q", header)
+	}
+	return n + 1, nil
+}
@@ -0,0 +1,163 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPSinkChunkedUploadRetries(t *testing.T) {
+	var mu sync.Mutex
+	var received strings.Builder
+	var ranges []string
+	failed := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, "/uploads/trace.out", r.URL.Path)
+		if !failed {
+			failed = true
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		received.Write(body)
+		ranges = append(ranges, r.Header.Get("Content-Range"))
+	}))
+	defer server.Close()
+
+	var progress []UploadProgress
+	sink := NewHTTPSink(server.URL+"/uploads/",
+		WithHTTPChunkSize(4),
+		WithHTTPRetries(1, time.Millisecond),
+		WithHTTPProgress(func(p UploadProgress) { progress = append(progress, p) }),
+	)
+	w, err := sink.Create(context.Background(), "trace.out")
+	assert.NoError(t, err)
+	_, err = io.WriteString(w, "0123456789")
+	assert.NoError(t, err)
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, "0123456789", received.String())
+	// The retry first queried the bytes committed.
+	assert.Equal(t, []string{"bytes */*", "bytes 0-3/*", "bytes 4-7/*", "bytes 8-9/10"}, ranges)
+	assert.Equal(t, UploadProgress{Name: "trace.out", Bytes: 10, Done: true}, progress[len(progress)-1])
+}
+
+// resumableServer commits the bytes of each chunk, acknowledging them
+// with 308 and a Range header until the upload is complete.  fail is
+// consulted with each chunk, returning how many of its bytes to commit
+// before failing the request, or -1 to accept it.
+func resumableServer(t *testing.T, fail func(contentRange string) int) (*httptest.Server, *bytes.Buffer, *[]string) {
+	var mu sync.Mutex
+	var committed bytes.Buffer
+	var ranges []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		contentRange := r.Header.Get("Content-Range")
+		ranges = append(ranges, contentRange)
+		body, _ := io.ReadAll(r.Body)
+		if n := fail(contentRange); n >= 0 {
+			committed.Write(body[:n])
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		committed.Write(body)
+		if _, total, _ := strings.Cut(contentRange, "/"); total == strconv.Itoa(committed.Len()) {
+			return
+		}
+		if committed.Len() > 0 {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", committed.Len()-1))
+		}
+		w.WriteHeader(http.StatusPermanentRedirect)
+	}))
+	t.Cleanup(server.Close)
+	return server, &committed, &ranges
+}
+
+func TestHTTPSinkResumesFromTheCommittedOffset(t *testing.T) {
+	failed := false
+	server, committed, ranges := resumableServer(t, func(contentRange string) int {
+		if contentRange == "bytes 4-7/*" && !failed {
+			failed = true
+			return 2
+		}
+		return -1
+	})
+	w, err := NewHTTPSink(server.URL, WithHTTPChunkSize(4), WithHTTPRetries(1, time.Millisecond)).Create(context.Background(), "trace.out")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "0123456789")
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, "0123456789", committed.String())
+	// Only the bytes of the chunk which were not committed are resent.
+	assert.Equal(t, []string{"bytes 0-3/*", "bytes 4-7/*", "bytes */*", "bytes 6-7/*", "bytes 8-9/10"}, *ranges)
+}
+
+func TestHTTPSinkRequiresTheFinalChunkToComplete(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusPermanentRedirect)
+	}))
+	defer server.Close()
+	w, err := NewHTTPSink(server.URL, WithHTTPChunkSize(4), WithHTTPRetries(1, time.Millisecond)).Create(context.Background(), "trace.out")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "0123456789")
+	require.NoError(t, err)
+	assert.ErrorContains(t, w.Close(), "did not complete the upload")
+}
+
+func TestHTTPSinkFailsWhenCommittedBytesAreLost(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Range") == "bytes 0-3/*" {
+			w.Header().Set("Range", "bytes=0-3")
+			w.WriteHeader(http.StatusPermanentRedirect)
+			return
+		}
+		if r.Header.Get("Content-Range") == "bytes */*" {
+			// The server restarted, losing the first chunk.
+			w.Header().Set("Range", "bytes=0-1")
+			w.WriteHeader(http.StatusPermanentRedirect)
+			return
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	w, err := NewHTTPSink(server.URL, WithHTTPChunkSize(4), WithHTTPRetries(3, time.Millisecond)).Create(context.Background(), "trace.out")
+	require.NoError(t, err)
+	_, err = io.WriteString(w, "01234567")
+	assert.ErrorIs(t, err, errUploadLost)
+}
+
+func TestHTTPSinkSingleChunkIsPlainPut(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Content-Range"))
+		assert.Equal(t, "token", r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+	w, err := NewHTTPSink(server.URL, WithHTTPHeader("Authorization", "token")).Create(context.Background(), "cpu.pprof")
+	assert.NoError(t, err)
+	_, _ = fmt.Fprint(w, "profile")
+	assert.NoError(t, w.Close())
+}
+
+func TestHTTPSinkGivesUp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	w, err := NewHTTPSink(server.URL, WithHTTPRetries(2, time.Millisecond)).Create(context.Background(), "cpu.pprof")
+	assert.NoError(t, err)
+	assert.ErrorContains(t, w.Close(), "after 3 attempts")
+}
@@ -0,0 +1,100 @@
+package profiler
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// InternalLabel is the pprof label key carried by the goroutines of the
+// profiler itself, such as its signal handling and upload workers, with
+// the value InternalLabelValue.  Goroutines they start inherit it.
+const (
+	InternalLabel      = "profiler"
+	InternalLabelValue = "internal"
+)
+
+// InternalRegion is the execution trace region spanning the goroutines
+// of the profiler started while tracing, so that trace tooling can tell
+// them apart from those of the application.
+const InternalRegion = InternalLabel + "=" + InternalLabelValue
+
+// internalLabels mark a goroutine as internal to the profiler.
+var internalLabels = pprof.Labels(InternalLabel, InternalLabelValue)
+
+// internalFunctions are the functions of goroutines started by the
+// runtime and dependencies on behalf of the profiler, which cannot carry
+// its labels.
+var internalFunctions = []string{
+	"runtime/pprof.profileWriter",
+	"runtime/trace.",
+	"github.com/felixge/fgprof.",
+}
+
+// internal returns fn, run with the labels marking its goroutine as
+// internal to the profiler.
+func internal(fn func() error) func() error {
+	return func() (err error) {
+		pprof.Do(context.Background(), internalLabels, func(ctx context.Context) {
+			trace.WithRegion(ctx, InternalRegion, func() { err = fn() })
+		})
+		return err
+	}
+}
+
+// goInternal runs fn in a new goroutine marked as internal to the profiler.
+func goInternal(fn func()) {
+	go pprof.Do(context.Background(), internalLabels, func(ctx context.Context) {
+		trace.WithRegion(ctx, InternalRegion, fn)
+	})
+}
+
+// ExcludeInternalGoroutines is a PostProcessor removing the samples of the
+// profiler's own goroutines, so that it does not pollute the data it
+// collects.  Goroutines labelled InternalLabel are removed along with
+// those the runtime and fgprof start on its behalf, identified by their
+// root function.  It applies to pprof artifacts such as the goroutine
+// profile, the goroutines of the profiler are marked in execution traces
+// by the InternalRegion instead.
+//
+// TODO: Remove the InternalRegion goroutines from execution traces, this
+// needs a trace writer which neither the standard library nor
+// golang.org/x/exp/trace provide.
+//
+//	profiler.Start(profiler.WithMode(profiler.GoroutineMode), profiler.WithPostProcessor(profiler.ExcludeInternalGoroutines))
+func ExcludeInternalGoroutines(prof *profile.Profile) (*profile.Profile, error) {
+	samples := prof.Sample[:0]
+	for _, sample := range prof.Sample {
+		if !isInternal(sample) {
+			samples = append(samples, sample)
+		}
+	}
+	prof.Sample = samples
+	return prof.Compact(), nil
+}
+
+// isInternal reports whether sample was recorded by a goroutine of the
+// profiler.
+func isInternal(sample *profile.Sample) bool {
+	for _, value := range sample.Label[InternalLabel] {
+		if value == InternalLabelValue {
+			return true
+		}
+	}
+	// The root of the stack is the function the goroutine was started
+	// with.
+	functions := sampleFunctions(sample)
+	if len(functions) == 0 {
+		return false
+	}
+	root := functions[len(functions)-1]
+	for _, prefix := range internalFunctions {
+		if strings.HasPrefix(root, prefix) {
+			return true
+		}
+	}
+	return false
+}
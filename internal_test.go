@@ -0,0 +1,83 @@
+package profiler
+
+import (
+	"bytes"
+	"runtime/pprof"
+	"runtime/trace"
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExcludeInternalGoroutines(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	goInternal(func() {
+		close(started)
+		<-release
+	})
+	<-started
+	// A goroutine of the application.
+	parked := make(chan struct{})
+	go func() {
+		close(parked)
+		<-release
+	}()
+	<-parked
+
+	var buf bytes.Buffer
+	assert.NoError(t, pprof.Lookup("goroutine").WriteTo(&buf, 0))
+	prof, err := profile.Parse(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labelled := func(prof *profile.Profile) int {
+		var n int
+		for _, sample := range prof.Sample {
+			if len(sample.Label[InternalLabel]) > 0 {
+				n++
+			}
+		}
+		return n
+	}
+	assert.Positive(t, labelled(prof))
+
+	excluded, err := ExcludeInternalGoroutines(prof)
+	assert.NoError(t, err)
+	assert.Zero(t, labelled(excluded))
+	var user bool
+	for _, sample := range excluded.Sample {
+		for _, name := range sampleFunctions(sample) {
+			user = user || strings.HasPrefix(name, "github.com/symonk/profiler.TestExcludeInternalGoroutines.func")
+		}
+	}
+	assert.True(t, user)
+}
+
+func TestIsInternalByRootFunction(t *testing.T) {
+	sample := func(names ...string) *profile.Sample {
+		s := &profile.Sample{}
+		for _, name := range names {
+			s.Location = append(s.Location, &profile.Location{Line: []profile.Line{{Function: &profile.Function{Name: name}}}})
+		}
+		return s
+	}
+	assert.True(t, isInternal(sample("runtime.gopark", "github.com/felixge/fgprof.Start.func1")))
+	assert.True(t, isInternal(sample("runtime.gopark", "runtime/pprof.profileWriter")))
+	assert.False(t, isInternal(sample("runtime.gopark", "github.com/symonk/profiler.Start", "main.main", "runtime.main")))
+	assert.False(t, isInternal(sample()))
+}
+
+func TestInternalGoroutinesAreMarkedInTraces(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, trace.Start(&buf))
+	done := make(chan struct{})
+	goInternal(func() { close(done) })
+	<-done
+	trace.Stop()
+	assert.True(t, bytes.Contains(buf.Bytes(), []byte(InternalRegion)))
+}
@@ -0,0 +1,160 @@
+package profiler
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// UnlabeledValue is the value samples without the label are grouped under.
+const UnlabeledValue = "(unlabeled)"
+
+// LabelShare is the share of a profile attributed to a single value of
+// a pprof label, such as the CPU time consumed by one tenant.
+type LabelShare struct {
+	// Value is the value of the label, UnlabeledValue for samples which
+	// did not carry the label.
+	Value string
+	// Total is the sum of the default sample type, nanoseconds of CPU
+	// time for a CPU profile.
+	Total int64
+	// Share is the fraction (0 to 1) of the profile total.
+	Share float64
+}
+
+// BreakdownByLabel parses the profile in r and groups its samples by the
+// value of the label key, largest first.  Nil is returned if no sample
+// carries the label.
+func BreakdownByLabel(r io.Reader, key string) ([]LabelShare, error) {
+	prof, err := profile.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	index := defaultSampleIndex(prof)
+	if index < 0 {
+		return nil, errors.New("profile has no sample types")
+	}
+	totals := make(map[string]int64)
+	var total int64
+	labelled := false
+	for _, sample := range prof.Sample {
+		value := UnlabeledValue
+		if values := sample.Label[key]; len(values) > 0 {
+			value = strings.Join(values, ",")
+			labelled = true
+		}
+		totals[value] += sample.Value[index]
+		total += sample.Value[index]
+	}
+	if !labelled {
+		return nil, nil
+	}
+	return labelShares(totals, total), nil
+}
+
+// labelShares returns the share of total of each value of totals, largest
+// first.
+func labelShares(totals map[string]int64, total int64) []LabelShare {
+	shares := make([]LabelShare, 0, len(totals))
+	for value, t := range totals {
+		share := LabelShare{Value: value, Total: t}
+		if total != 0 {
+			share.Share = float64(t) / float64(total)
+		}
+		shares = append(shares, share)
+	}
+	sort.Slice(shares, func(i, j int) bool {
+		if shares[i].Total != shares[j].Total {
+			return shares[i].Total > shares[j].Total
+		}
+		return shares[i].Value < shares[j].Value
+	})
+	return shares
+}
+
+// defaultSampleIndex returns the index of the default sample type of
+// prof, the last sample type if there is no default, or -1 if there are
+// no sample types.
+func defaultSampleIndex(prof *profile.Profile) int {
+	index := len(prof.SampleType) - 1
+	if prof.DefaultSampleType != "" {
+		for i, sampleType := range prof.SampleType {
+			if sampleType.Type == prof.DefaultSampleType {
+				index = i
+			}
+		}
+	}
+	return index
+}
+
+// breakdownLabels writes a `<name>.<key>.csv` breakdown alongside every
+// artifact whose samples carry the label configured by WithLabelBreakdown.
+// The breakdowns of every artifact, such as the profile of each phase,
+// are merged into that of the report.
+func (p *Profiler) breakdownLabels() {
+	if p.labelKey == "" {
+		return
+	}
+	totals := make(map[string]int64)
+	var total int64
+	for _, path := range p.ArtifactPaths() {
+		shares, err := breakdownFile(p.fs, path, p.labelKey)
+		if err != nil || shares == nil {
+			continue
+		}
+		for _, share := range shares {
+			totals[share.Value] += share.Total
+			total += share.Total
+		}
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		name = strings.TrimSuffix(name, ".pprof")
+		csvPath := filepath.Join(filepath.Dir(path), fmt.Sprintf("%s.%s.csv", name, p.labelKey))
+		if err := writeLabelShares(p.fs, csvPath, p.labelKey, shares); err != nil {
+			p.recordError(fmt.Errorf("failed to write label breakdown: %w", err))
+			continue
+		}
+		p.addArtifact(csvPath)
+		for _, share := range shares {
+			p.report("%s=%s: %.2f%%", p.labelKey, share.Value, share.Share*100)
+		}
+	}
+	if len(totals) > 0 {
+		shares := labelShares(totals, total)
+		p.mu.Lock()
+		p.labelShares = shares
+		p.mu.Unlock()
+	}
+}
+
+// breakdownFile opens the profile at path of fsys and breaks it down by
+// key.
+func breakdownFile(fsys FS, path string, key string) ([]LabelShare, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return BreakdownByLabel(f, key)
+}
+
+// writeLabelShares writes shares as csv to path of fsys.
+func writeLabelShares(fsys FS, path string, key string, shares []LabelShare) error {
+	f, err := fsys.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	_ = w.Write([]string{key, "total", "share"})
+	for _, share := range shares {
+		_ = w.Write([]string{share.Value, strconv.FormatInt(share.Total, 10), strconv.FormatFloat(share.Share, 'f', 4, 64)})
+	}
+	w.Flush()
+	return errors.Join(w.Error(), f.Close())
+}
@@ -0,0 +1,85 @@
+package profiler
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+func labelledProfile(t *testing.T, path string) []byte {
+	t.Helper()
+	fn := &profile.Function{ID: 1, Name: "work"}
+	location := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	sample := func(tenant string, value int64) *profile.Sample {
+		s := &profile.Sample{Location: []*profile.Location{location}, Value: []int64{1, value}}
+		if tenant != "" {
+			s.Label = map[string][]string{"tenant": {tenant}}
+		}
+		return s
+	}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Sample:     []*profile.Sample{sample("a", 60), sample("b", 30), sample("a", 0), sample("", 10)},
+		Location:   []*profile.Location{location},
+		Function:   []*profile.Function{fn},
+	}
+	var b bytes.Buffer
+	if err := prof.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	if path != "" {
+		if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return b.Bytes()
+}
+
+func TestBreakdownByLabel(t *testing.T) {
+	shares, err := BreakdownByLabel(bytes.NewReader(labelledProfile(t, "")), "tenant")
+	assert.NoError(t, err)
+	assert.Equal(t, []LabelShare{
+		{Value: "a", Total: 60, Share: 0.6},
+		{Value: "b", Total: 30, Share: 0.3},
+		{Value: UnlabeledValue, Total: 10, Share: 0.1},
+	}, shares)
+}
+
+func TestBreakdownByLabelMissingLabel(t *testing.T) {
+	shares, err := BreakdownByLabel(bytes.NewReader(labelledProfile(t, "")), "region")
+	assert.NoError(t, err)
+	assert.Nil(t, shares)
+}
+
+func TestBreakdownLabelsWritesCSV(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, CPUFileName)
+	labelledProfile(t, path)
+	p := New(WithLabelBreakdown("tenant"), WithQuietOutput())
+	p.artifacts = []string{path}
+	p.breakdownLabels()
+
+	csvPath := filepath.Join(dir, "cpu.tenant.csv")
+	assert.Equal(t, []string{path, csvPath}, p.ArtifactPaths())
+	b, err := os.ReadFile(csvPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "tenant,total,share\na,60,0.6000\nb,30,0.3000\n(unlabeled),10,0.1000\n", string(b))
+	assert.Len(t, p.Report().LabelBreakdown, 3)
+}
+
+func TestBreakdownLabelsMergesArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	first, second := filepath.Join(dir, CPUFileName), filepath.Join(dir, "cpu.load.pprof")
+	labelledProfile(t, first)
+	labelledProfile(t, second)
+	p := New(WithLabelBreakdown("tenant"), WithQuietOutput())
+	p.artifacts = []string{first, second}
+	p.breakdownLabels()
+
+	assert.Equal(t, []string{first, second, filepath.Join(dir, "cpu.tenant.csv"), filepath.Join(dir, "cpu.load.tenant.csv")}, p.ArtifactPaths())
+	assert.Equal(t, []LabelShare{{Value: "a", Total: 120, Share: 0.6}, {Value: "b", Total: 60, Share: 0.3}, {Value: UnlabeledValue, Total: 20, Share: 0.1}}, p.Report().LabelBreakdown)
+}
@@ -0,0 +1,161 @@
+package profiler
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/google/pprof/profile"
+)
+
+// inuseObjects is the sample type of the objects in use in a heap profile.
+const inuseObjects = "inuse_objects"
+
+// LeakSuspect is an allocation site whose objects in use grew across a
+// series of heap profiles without ever shrinking, a candidate for a leak.
+type LeakSuspect struct {
+	// Site is the function which allocated the objects.
+	Site string
+	// Objects are the objects in use allocated by Site in each profile of
+	// the series, oldest first.
+	Objects []int64
+	// Bytes are the bytes in use allocated by Site in the latest profile.
+	Bytes int64
+}
+
+// Growth returns the objects in use gained between the first and latest
+// profile of the series.
+func (s LeakSuspect) Growth() int64 {
+	return s.Objects[len(s.Objects)-1] - s.Objects[0]
+}
+
+// SuspectLeaks compares a series of heap profiles, oldest first, and returns
+// the n allocation sites whose objects in use never shrank and grew by at
+// least minGrowth overall, largest growth first.  This is a heuristic for
+// the first pass of leak triage, a cache warming up looks the same as a leak
+// over a short series.
+func SuspectLeaks(series []*profile.Profile, minGrowth int64, n int) ([]LeakSuspect, error) {
+	if len(series) < 2 {
+		return nil, errors.New("suspecting leaks requires at least two heap profiles")
+	}
+	if n < 0 {
+		return nil, fmt.Errorf("the number of suspects must not be negative, got %d", n)
+	}
+	minGrowth = max(minGrowth, 1)
+	objects := make(map[string][]int64)
+	bytes := make(map[string]int64)
+	for i, prof := range series {
+		objectIndex, spaceIndex := -1, -1
+		for j, st := range prof.SampleType {
+			switch st.Type {
+			case inuseObjects:
+				objectIndex = j
+			case "inuse_space":
+				spaceIndex = j
+			}
+		}
+		if objectIndex < 0 {
+			return nil, fmt.Errorf("profile %d of the series has no %s samples", i, inuseObjects)
+		}
+		for _, sample := range prof.Sample {
+			site := allocationSite(sample)
+			if _, ok := objects[site]; !ok {
+				objects[site] = make([]int64, len(series))
+			}
+			objects[site][i] += sample.Value[objectIndex]
+			if i == len(series)-1 && spaceIndex >= 0 {
+				bytes[site] += sample.Value[spaceIndex]
+			}
+		}
+	}
+	var suspects []LeakSuspect
+	for site, counts := range objects {
+		if !monotonic(counts) || counts[len(counts)-1]-counts[0] < minGrowth {
+			continue
+		}
+		suspects = append(suspects, LeakSuspect{Site: site, Objects: counts, Bytes: bytes[site]})
+	}
+	sort.Slice(suspects, func(i, j int) bool {
+		if suspects[i].Growth() != suspects[j].Growth() {
+			return suspects[i].Growth() > suspects[j].Growth()
+		}
+		return suspects[i].Site < suspects[j].Site
+	})
+	return suspects[:min(n, len(suspects))], nil
+}
+
+// allocationSite returns the function which allocated the objects of sample.
+func allocationSite(sample *profile.Sample) string {
+	if functions := sampleFunctions(sample); len(functions) > 0 {
+		return functions[0]
+	}
+	return "(unknown)"
+}
+
+// monotonic reports whether counts never decrease.
+func monotonic(counts []int64) bool {
+	for i := 1; i < len(counts); i++ {
+		if counts[i] < counts[i-1] {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadSnapshotSeries reads the heap profile of every snapshot written to dir
+// by Snapshot, oldest first, ready for SuspectLeaks.
+func ReadSnapshotSeries(dir string) ([]*profile.Profile, error) {
+	// Snapshot folders are named by time, so sort chronologically.
+	paths, err := filepath.Glob(filepath.Join(dir, "snapshot-*", HeapFileName))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	series := make([]*profile.Profile, 0, len(paths))
+	for _, path := range paths {
+		prof, err := ReadProfile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		series = append(series, prof)
+	}
+	return series, nil
+}
+
+// WriteLeakSuspects writes suspects as a text table, the objects in use of
+// each profile of the series shown oldest first.
+func WriteLeakSuspects(w io.Writer, suspects []LeakSuspect) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "growth\tinuse\tobjects\tsite\n")
+	for _, s := range suspects {
+		fmt.Fprintf(tw, "+%d\t%s\t%s\t%s\n", s.Growth(), formatBytes(s.Bytes), joinCounts(s.Objects, " -> "), s.Site)
+	}
+	return tw.Flush()
+}
+
+// WriteLeakSuspectsCSV writes suspects as csv, for export to spreadsheets
+// and issue trackers.
+func WriteLeakSuspectsCSV(w io.Writer, suspects []LeakSuspect) error {
+	cw := csv.NewWriter(w)
+	_ = cw.Write([]string{"site", "growth", "inuse_space", "inuse_objects"})
+	for _, s := range suspects {
+		_ = cw.Write([]string{s.Site, strconv.FormatInt(s.Growth(), 10), strconv.FormatInt(s.Bytes, 10), joinCounts(s.Objects, " ")})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// joinCounts formats counts separated by sep.
+func joinCounts(counts []int64, sep string) string {
+	formatted := make([]string, len(counts))
+	for i, count := range counts {
+		formatted[i] = strconv.FormatInt(count, 10)
+	}
+	return strings.Join(formatted, sep)
+}
@@ -0,0 +1,80 @@
+package profiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+// heapSeries builds a heap profile per snapshot from the objects in use by
+// each site, the bytes in use are ten per object.
+func heapSeries(sites map[string][]int64) []*profile.Profile {
+	var series []*profile.Profile
+	for i := 0; ; i++ {
+		prof := &profile.Profile{SampleType: []*profile.ValueType{{Type: "inuse_objects", Unit: "count"}, {Type: "inuse_space", Unit: "bytes"}}}
+		var id uint64
+		for site, counts := range sites {
+			if i >= len(counts) {
+				return series
+			}
+			id++
+			location := &profile.Location{ID: id, Line: []profile.Line{{Function: &profile.Function{ID: id, Name: site}}}}
+			prof.Sample = append(prof.Sample, &profile.Sample{Location: []*profile.Location{location}, Value: []int64{counts[i], counts[i] * 10}})
+		}
+		series = append(series, prof)
+	}
+}
+
+func TestSuspectLeaks(t *testing.T) {
+	series := heapSeries(map[string][]int64{
+		"main.cache":  {10, 20, 20, 40},
+		"main.leak":   {1, 100, 200, 300},
+		"main.churn":  {50, 10, 60, 90},
+		"main.steady": {5, 5, 5, 5},
+		"main.slow":   {1, 1, 2, 2},
+	})
+	suspects, err := SuspectLeaks(series, 2, 10)
+	assert.NoError(t, err)
+	assert.Len(t, suspects, 2)
+	assert.Equal(t, "main.leak", suspects[0].Site)
+	assert.Equal(t, int64(299), suspects[0].Growth())
+	assert.Equal(t, int64(3000), suspects[0].Bytes)
+	assert.Equal(t, []int64{10, 20, 20, 40}, suspects[1].Objects)
+
+	suspects, err = SuspectLeaks(series, 0, 1)
+	assert.NoError(t, err)
+	assert.Len(t, suspects, 1)
+
+	_, err = SuspectLeaks(series[:1], 0, 1)
+	assert.Error(t, err)
+	_, err = SuspectLeaks(series, 0, -1)
+	assert.ErrorContains(t, err, "must not be negative")
+	_, err = SuspectLeaks([]*profile.Profile{exportProfile(), exportProfile()}, 0, 1)
+	assert.ErrorContains(t, err, "inuse_objects")
+}
+
+func TestWriteLeakSuspects(t *testing.T) {
+	suspects := []LeakSuspect{{Site: "main.leak", Objects: []int64{1, 5, 9}, Bytes: 2048}}
+	var b strings.Builder
+	assert.NoError(t, WriteLeakSuspects(&b, suspects))
+	assert.Regexp(t, `\+8\s+2.0KiB\s+1 -> 5 -> 9\s+main.leak`, b.String())
+
+	b.Reset()
+	assert.NoError(t, WriteLeakSuspectsCSV(&b, suspects))
+	assert.Equal(t, "site,growth,inuse_space,inuse_objects\nmain.leak,8,2048,1 5 9\n", b.String())
+}
+
+func TestReadSnapshotSeries(t *testing.T) {
+	dir := t.TempDir()
+	for range 2 {
+		_, err := Snapshot(dir)
+		assert.NoError(t, err)
+	}
+	series, err := ReadSnapshotSeries(dir)
+	assert.NoError(t, err)
+	assert.Len(t, series, 2)
+	_, err = SuspectLeaks(series, 1, 10)
+	assert.NoError(t, err)
+}
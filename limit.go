@@ -0,0 +1,84 @@
+package profiler
+
+import (
+	"io"
+	"sync"
+)
+
+// SizeLimitPolicy controls what happens when an artifact exceeds the
+// size provided by WithMaxArtifactSize.
+type SizeLimitPolicy int
+
+const (
+	// SizeLimitTruncate discards everything written beyond the limit,
+	// the capture continues and the artifact is kept but incomplete.
+	SizeLimitTruncate SizeLimitPolicy = iota
+	// SizeLimitAbort discards everything written beyond the limit and
+	// stops the profiling session early, as if it were interrupted.
+	SizeLimitAbort
+)
+
+// limitWriter discards writes once limit bytes have been written,
+// invoking exceeded the first time that happens.
+type limitWriter struct {
+	io.WriteCloser
+	limit    int64
+	written  int64
+	once     sync.Once
+	exceeded func()
+}
+
+// Write writes p up to the limit.  Writes beyond the limit are reported
+// as successful so that the runtime keeps draining profiling data rather
+// than blocking or failing the session.
+func (l *limitWriter) Write(p []byte) (int, error) {
+	remaining := l.limit - l.written
+	if int64(len(p)) > remaining {
+		l.once.Do(l.exceeded)
+		if remaining <= 0 {
+			return len(p), nil
+		}
+		n, err := l.WriteCloser.Write(p[:remaining])
+		l.written += int64(n)
+		if err != nil {
+			return n, err
+		}
+		return len(p), nil
+	}
+	n, err := l.WriteCloser.Write(p)
+	l.written += int64(n)
+	return n, err
+}
+
+// limit wraps w, recording the artifact at path as truncated and
+// applying the size limit policy when the maximum size is exceeded.
+func (p *Profiler) limit(w io.WriteCloser, path string) io.WriteCloser {
+	return &limitWriter{WriteCloser: w, limit: p.maxArtifactSize, exceeded: func() {
+		p.mu.Lock()
+		p.truncated = append(p.truncated, path)
+		p.mu.Unlock()
+		if p.sizeLimitPolicy == SizeLimitAbort {
+			// Writes may originate from within teardown, stopping
+			// asynchronously avoids waiting on ourselves.
+			goInternal(func() {
+				// The session cannot be stopped before it has started.
+				<-p.started
+				if p.finalizer == nil {
+					return
+				}
+				p.report("%s exceeded the maximum size of %d bytes, stopping", path, p.maxArtifactSize)
+				p.fatal(p.stop(true))
+			})
+		}
+	}}
+}
+
+// TruncatedArtifacts returns the paths of artifacts which exceeded the
+// size provided by WithMaxArtifactSize and are therefore incomplete.
+func (p *Profiler) TruncatedArtifacts() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	paths := make([]string, len(p.truncated))
+	copy(paths, p.truncated)
+	return paths
+}
@@ -0,0 +1,36 @@
+package profiler
+
+import (
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxArtifactSizeTruncates(t *testing.T) {
+	p := New(WithMaxArtifactSize(4, SizeLimitTruncate), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	w, err := p.createArtifact(TraceFileName)
+	assert.NoError(t, err)
+	n, err := io.WriteString(w, "012")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, n)
+	n, err = io.WriteString(w, "3456789")
+	assert.NoError(t, err)
+	assert.Equal(t, 7, n)
+	assert.NoError(t, w.Close())
+
+	data, err := os.ReadFile(p.ArtifactPaths()[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "0123", string(data))
+	assert.Equal(t, p.ArtifactPaths(), p.TruncatedArtifacts())
+}
+
+func TestMaxArtifactSizeAborts(t *testing.T) {
+	p := Start(WithTracing(), WithMaxArtifactSize(1, SizeLimitAbort), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput())
+	// The trace header alone exceeds the limit, the session stops itself.
+	<-p.done
+	assert.True(t, p.interrupted)
+	assert.Equal(t, p.ArtifactPaths(), p.TruncatedArtifacts())
+	p.Stop()
+}
@@ -0,0 +1,100 @@
+package profiler
+
+import (
+	"fmt"
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+)
+
+// The runtime/metrics used to calculate memory counted against the
+// GOMEMLIMIT, as the runtime itself does.
+const (
+	totalMemoryMetric    = "/memory/classes/total:bytes"
+	releasedMemoryMetric = "/memory/classes/heap/released:bytes"
+)
+
+// MemoryLimitCondition is met when the memory in use crosses fraction
+// (0 to 1) of the limit set by GOMEMLIMIT or debug.SetMemoryLimit.  Near
+// the limit the garbage collector runs ever more frequently, which can
+// spiral, this is exactly when a heap profile matters.  The condition is
+// met once per crossing, usage must fall below the threshold before it
+// is met again, and never when no limit is set.
+func MemoryLimitCondition(fraction float64) Condition {
+	above := false
+	return func() (bool, string) {
+		limit := debug.SetMemoryLimit(-1)
+		if limit <= 0 || limit == math.MaxInt64 {
+			return false, ""
+		}
+		used := memoryInUse()
+		threshold := uint64(float64(limit) * fraction)
+		if used < threshold {
+			above = false
+			return false, ""
+		}
+		if above {
+			return false, ""
+		}
+		above = true
+		return true, fmt.Sprintf("memory in use %d bytes is %.0f%% of the memory limit %d bytes", used, float64(used)/float64(limit)*100, limit)
+	}
+}
+
+// memoryInUse returns the memory counted against the memory limit.
+func memoryInUse() uint64 {
+	samples := []metrics.Sample{{Name: totalMemoryMetric}, {Name: releasedMemoryMetric}}
+	metrics.Read(samples)
+	if samples[0].Value.Kind() != metrics.KindUint64 || samples[1].Value.Kind() != metrics.KindUint64 {
+		return 0
+	}
+	return samples[0].Value.Uint64() - samples[1].Value.Uint64()
+}
+
+// MemoryLimitTrigger returns a Trigger capturing a heap profile each time
+// the memory in use crosses fraction of the memory limit, see
+// MemoryLimitCondition.  Options configure the captures.
+//
+//	go profiler.MemoryLimitTrigger(0.9, profiler.WithProfileFileLocation("/var/log/profiles")).Watch(ctx)
+func MemoryLimitTrigger(fraction float64, options ...ProfileOption) Trigger {
+	return Trigger{
+		Condition: MemoryLimitCondition(fraction),
+		Options:   append([]ProfileOption{WithHeapProfiler()}, options...),
+	}
+}
+
+// ContainerMemoryCondition is met when the memory in use crosses percent
+// (0 to 100) of the memory limit of the container, see
+// ContainerMemoryLimit, so that the same threshold suits pods of any size.
+// The limit is read on every poll, following pods resized in place.  Like
+// MemoryLimitCondition it is met once per crossing and never when no limit
+// is set.
+func ContainerMemoryCondition(percent float64) Condition {
+	above := false
+	return func() (bool, string) {
+		limit, ok := ContainerMemoryLimit()
+		if !ok {
+			return false, ""
+		}
+		used := memoryInUse()
+		if float64(used) < float64(limit)*percent/100 {
+			above = false
+			return false, ""
+		}
+		if above {
+			return false, ""
+		}
+		above = true
+		return true, fmt.Sprintf("memory in use %s is %.0f%% of the container memory limit %s", formatBytes(int64(used)), float64(used)/float64(limit)*100, formatBytes(int64(limit)))
+	}
+}
+
+// ContainerMemoryTrigger returns a Trigger capturing a heap profile each
+// time the memory in use crosses percent of the memory limit of the
+// container, see WithHeapTriggerPercent.  Options configure the captures.
+// Watch returns an error if percent is not above 0 and at most 100.
+//
+//	go profiler.ContainerMemoryTrigger(80, profiler.WithProfileFileLocation("/var/log/profiles")).Watch(ctx)
+func ContainerMemoryTrigger(percent float64, options ...ProfileOption) Trigger {
+	return Trigger{Options: append([]ProfileOption{WithHeapTriggerPercent(percent)}, options...)}
+}
@@ -0,0 +1,91 @@
+package profiler
+
+import (
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryLimitCondition(t *testing.T) {
+	previous := debug.SetMemoryLimit(math.MaxInt64)
+	defer debug.SetMemoryLimit(previous)
+
+	condition := MemoryLimitCondition(0.5)
+	met, _ := condition()
+	assert.False(t, met, "no limit is set")
+
+	debug.SetMemoryLimit(int64(memoryInUse()))
+	met, reason := condition()
+	assert.True(t, met)
+	assert.Contains(t, reason, "of the memory limit")
+	met, _ = condition()
+	assert.False(t, met, "met once per crossing")
+
+	debug.SetMemoryLimit(math.MaxInt64 - 1)
+	met, _ = condition()
+	assert.False(t, met)
+	debug.SetMemoryLimit(int64(memoryInUse()))
+	met, _ = condition()
+	assert.True(t, met, "met again after falling below the threshold")
+}
+
+func TestContainerMemoryCondition(t *testing.T) {
+	fakeCgroup(t, nil)
+	condition := ContainerMemoryCondition(10)
+	met, _ := condition()
+	assert.False(t, met, "no limit is set")
+
+	setLimit := func(limit uint64) {
+		if err := os.WriteFile(filepath.Join(cgroupRoot, "memory.max"), []byte(strconv.FormatUint(limit, 10)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	setLimit(memoryInUse() * 2)
+	met, reason := condition()
+	assert.True(t, met)
+	assert.Contains(t, reason, "of the container memory limit")
+	met, _ = condition()
+	assert.False(t, met, "met once per crossing")
+
+	setLimit(math.MaxInt64)
+	met, _ = condition()
+	assert.False(t, met)
+	setLimit(memoryInUse() * 2)
+	met, _ = condition()
+	assert.True(t, met, "met again after falling below the threshold")
+}
+
+func TestHeapTriggerPercent(t *testing.T) {
+	for _, percent := range []float64{0, -5, 100.5, math.NaN()} {
+		assert.Error(t, ContainerMemoryTrigger(percent).Watch(context.Background()), "percent %v", percent)
+	}
+	fakeCgroup(t, map[string]string{"memory.max": strconv.FormatUint(memoryInUse()*2, 10)})
+	captures := make(chan []string, 10)
+	trigger := Trigger{
+		Interval: 5 * time.Millisecond,
+		Duration: time.Millisecond,
+		Options: []ProfileOption{WithHeapTriggerPercent(10), WithProfileFileLocation(t.TempDir()), WithQuietOutput(), WithCallback(func(p *Profiler) {
+			captures <- p.ArtifactPaths()
+		})},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- trigger.Watch(ctx) }()
+	paths := <-captures
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	require.Len(t, paths, 1)
+	assert.Equal(t, MemoryFileName, filepath.Base(paths[0]))
+
+	// Outside a trigger the option would otherwise be silently ignored.
+	_, err := Capture(context.Background(), time.Millisecond, WithHeapTriggerPercent(80), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.ErrorContains(t, err, "only applies to the Options of a Trigger")
+}
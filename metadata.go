@@ -0,0 +1,215 @@
+package profiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// MetadataFileName is the session metadata written by WithMetadataFile.
+const MetadataFileName = "metadata.json"
+
+// MetadataSchemaVersion is the version of the wire format of
+// SessionMetadata and EventMetadata.  Within a version fields are only
+// ever added, never removed, renamed or given a different meaning, so
+// readers must ignore fields they do not know.  Any other change
+// increments the version.
+const MetadataSchemaVersion = 1
+
+// SessionMetadata is the stable wire format of a Report, for external
+// collectors and tooling which should not depend on the Go structs of
+// this package.  It is encoded as JSON, see WriteMetadata and
+// ParseMetadata.
+type SessionMetadata struct {
+	// SchemaVersion is the MetadataSchemaVersion of the encoding.
+	SchemaVersion int `json:"schema_version"`
+	// Host and PID identify the process profiled, empty and zero if it
+	// is unknown, such as for reprocessed artifacts.
+	Host string `json:"host"`
+	PID  int    `json:"pid"`
+	// Mode is the name of the profiling mode, see ParseMode.
+	Mode string `json:"mode"`
+	// OutputDir is the folder artifacts were written to.
+	OutputDir string `json:"output_dir"`
+	// DurationNanos is how long the capture ran for.
+	DurationNanos int64 `json:"duration_ns"`
+	// Artifacts are the artifacts of the session.
+	Artifacts []ArtifactMetadata `json:"artifacts"`
+	// Tags are the session tags, see WithTags.
+	Tags map[string]string `json:"tags,omitempty"`
+	// GoVersion, GOOS and GOARCH describe the runtime.
+	GoVersion string `json:"go_version"`
+	GOOS      string `json:"goos"`
+	GOARCH    string `json:"goarch"`
+	// Interrupted is true if the session was not stopped by Stop.
+	Interrupted bool `json:"interrupted"`
+	// Errors are the messages of the errors of the session.
+	Errors []string `json:"errors,omitempty"`
+	// Events are the events of the session up to the writing of its
+	// metadata file, see WithMetadataFile.
+	Events []EventMetadata `json:"events,omitempty"`
+}
+
+// ArtifactMetadata is the wire format of an artifact of a session.
+type ArtifactMetadata struct {
+	// Path is the absolute path of the artifact.
+	Path string `json:"path"`
+	// Size is the size of the artifact in bytes, -1 if unknown.
+	Size int64 `json:"size"`
+	// Samples is the number of samples of a pprof profile, -1 for other
+	// artifacts or if unknown.
+	Samples int `json:"samples"`
+}
+
+// EventMetadata is the stable wire format of an Event.
+type EventMetadata struct {
+	// SchemaVersion is the MetadataSchemaVersion of the encoding.
+	SchemaVersion int `json:"schema_version"`
+	// Type is the name of the event type, such as "capture_finished".
+	Type string `json:"type"`
+	// Time is when the event occurred.
+	Time time.Time `json:"time"`
+	// Mode is the name of the profiling mode of the session.
+	Mode string `json:"mode"`
+	// Artifacts are the paths of the artifacts the event relates to.
+	Artifacts []string `json:"artifacts,omitempty"`
+	// Error is the message of the error the event relates to.
+	Error string `json:"error,omitempty"`
+	// Tags are the session tags, see WithTags.
+	Tags map[string]string `json:"tags,omitempty"`
+	// Progress is the progress of a progress event.
+	Progress *ProgressMetadata `json:"progress,omitempty"`
+}
+
+// ProgressMetadata is the wire format of a Progress.
+type ProgressMetadata struct {
+	Task         string `json:"task"`
+	Done         int64  `json:"done"`
+	Total        int64  `json:"total"`
+	ElapsedNanos int64  `json:"elapsed_ns"`
+}
+
+// Metadata returns the wire format of the report.
+func (r Report) Metadata() SessionMetadata {
+	stats := make(map[string]ArtifactStat, len(r.ArtifactStats))
+	for _, stat := range r.ArtifactStats {
+		stats[stat.Path] = stat
+	}
+	artifacts := make([]ArtifactMetadata, 0, len(r.Artifacts))
+	for _, path := range r.Artifacts {
+		artifact := ArtifactMetadata{Path: path, Size: -1, Samples: -1}
+		if stat, ok := stats[path]; ok {
+			artifact.Size, artifact.Samples = stat.Size, stat.Samples
+		}
+		artifacts = append(artifacts, artifact)
+	}
+	var errs []string
+	for _, err := range r.Errors {
+		errs = append(errs, err.Error())
+	}
+	return SessionMetadata{
+		SchemaVersion: MetadataSchemaVersion,
+		Host:          r.Environment.Host,
+		PID:           r.Environment.PID,
+		Mode:          r.Mode.String(),
+		OutputDir:     r.OutputDir,
+		DurationNanos: int64(r.Duration),
+		Artifacts:     artifacts,
+		Tags:          r.Tags,
+		GoVersion:     r.Environment.GoVersion,
+		GOOS:          r.Environment.GOOS,
+		GOARCH:        r.Environment.GOARCH,
+		Interrupted:   r.Interrupted,
+		Errors:        errs,
+	}
+}
+
+// Metadata returns the wire format of the event.
+func (e Event) Metadata() EventMetadata {
+	m := EventMetadata{
+		SchemaVersion: MetadataSchemaVersion,
+		Type:          e.Type.String(),
+		Time:          e.Time,
+		Mode:          e.Mode.String(),
+		Artifacts:     e.Artifacts,
+		Tags:          e.Tags,
+	}
+	if e.Err != nil {
+		m.Error = e.Err.Error()
+	}
+	if e.Progress != nil {
+		m.Progress = &ProgressMetadata{Task: e.Progress.Task, Done: e.Progress.Done, Total: e.Progress.Total, ElapsedNanos: int64(e.Progress.Elapsed)}
+	}
+	return m
+}
+
+// WriteMetadata writes m, a SessionMetadata or EventMetadata, as a single
+// line of JSON, so that a stream of metadata such as the events of a
+// session is newline delimited.
+func WriteMetadata(w io.Writer, m any) error {
+	return json.NewEncoder(w).Encode(m)
+}
+
+// ParseMetadata decodes the JSON of a SessionMetadata, returning an
+// error if it was written with a newer schema version than is understood.
+func ParseMetadata(data []byte) (SessionMetadata, error) {
+	var m SessionMetadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		return SessionMetadata{}, err
+	}
+	if err := checkSchemaVersion(m.SchemaVersion); err != nil {
+		return SessionMetadata{}, err
+	}
+	return m, nil
+}
+
+// ParseEventMetadata decodes the JSON of an EventMetadata, a single line
+// of a stream written by WriteMetadata, returning an error if it was
+// written with a newer schema version than is understood.
+func ParseEventMetadata(data []byte) (EventMetadata, error) {
+	var m EventMetadata
+	if err := json.Unmarshal(data, &m); err != nil {
+		return EventMetadata{}, err
+	}
+	if err := checkSchemaVersion(m.SchemaVersion); err != nil {
+		return EventMetadata{}, err
+	}
+	return m, nil
+}
+
+// metadataFile writes the metadata of the session, with the events
+// emitted so far, into the output folder.
+func (p *Profiler) metadataFile() {
+	if !p.writeMetadata {
+		return
+	}
+	// The stats of the artifacts are not otherwise recorded until after
+	// the upload which the metadata file is a part of.
+	p.recordStats()
+	m := p.Report().Metadata()
+	p.mu.Lock()
+	m.Events = append([]EventMetadata(nil), p.eventLog...)
+	p.mu.Unlock()
+	var buf bytes.Buffer
+	if err := WriteMetadata(&buf, m); err != nil {
+		p.recordError(fmt.Errorf("failed to encode metadata: %w", err))
+		return
+	}
+	path := filepath.Join(p.OutputDir(), MetadataFileName)
+	if err := writeFile(p.fs, path, buf.Bytes()); err != nil {
+		p.recordError(fmt.Errorf("failed to write metadata: %w", err))
+		return
+	}
+	p.addArtifact(path)
+}
+
+// checkSchemaVersion returns an error if version cannot be read.
+func checkSchemaVersion(version int) error {
+	if version < 1 || version > MetadataSchemaVersion {
+		return fmt.Errorf("unsupported metadata schema version %d, versions up to %d are supported", version, MetadataSchemaVersion)
+	}
+	return nil
+}
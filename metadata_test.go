@@ -0,0 +1,123 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The encodings below are the wire format of schema version 1, they may
+// only change by adding fields.
+const (
+	sessionMetadataV1 = `{"schema_version":1,"host":"web-1","pid":42,"mode":"cpu","output_dir":"/profiles","duration_ns":1000000000,"artifacts":[{"path":"/profiles/cpu.pprof","size":2048,"samples":10}],"tags":{"service":"api"},"go_version":"go1.22.0","goos":"linux","goarch":"amd64","interrupted":true,"errors":["upload failed"]}` + "\n"
+	eventMetadataV1   = `{"schema_version":1,"type":"progress","time":"2024-01-02T03:04:05Z","mode":"trace","artifacts":["/profiles/trace.out"],"error":"slow","progress":{"task":"upload of trace.out","done":10,"total":20,"elapsed_ns":5000000000}}` + "\n"
+)
+
+func TestSessionMetadataWireFormat(t *testing.T) {
+	m := SessionMetadata{
+		SchemaVersion: 1,
+		Host:          "web-1",
+		PID:           42,
+		Mode:          "cpu",
+		OutputDir:     "/profiles",
+		DurationNanos: int64(time.Second),
+		Artifacts:     []ArtifactMetadata{{Path: "/profiles/cpu.pprof", Size: 2048, Samples: 10}},
+		Tags:          map[string]string{"service": "api"},
+		GoVersion:     "go1.22.0",
+		GOOS:          "linux",
+		GOARCH:        "amd64",
+		Interrupted:   true,
+		Errors:        []string{"upload failed"},
+	}
+	var b bytes.Buffer
+	require.NoError(t, WriteMetadata(&b, m))
+	assert.Equal(t, sessionMetadataV1, b.String())
+	parsed, err := ParseMetadata(b.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, m, parsed)
+}
+
+func TestEventMetadataWireFormat(t *testing.T) {
+	event := Event{
+		Type:      EventProgress,
+		Time:      time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Mode:      TraceMode,
+		Artifacts: []string{"/profiles/trace.out"},
+		Err:       errors.New("slow"),
+		Progress:  &Progress{Task: "upload of trace.out", Done: 10, Total: 20, Elapsed: 5 * time.Second},
+	}
+	var b bytes.Buffer
+	require.NoError(t, WriteMetadata(&b, event.Metadata()))
+	assert.Equal(t, eventMetadataV1, b.String())
+	parsed, err := ParseEventMetadata(b.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, event.Metadata(), parsed)
+}
+
+func TestReportMetadata(t *testing.T) {
+	report := Report{
+		Mode:          MemoryHeapMode,
+		Artifacts:     []string{"/p/heap.pprof", "/p/heap.html"},
+		ArtifactStats: []ArtifactStat{{Path: "/p/heap.pprof", Size: 100, Samples: 3}},
+		Duration:      time.Second,
+		Environment:   captureEnvironment(),
+		Errors:        []error{errors.New("boom")},
+	}
+	m := report.Metadata()
+	assert.Equal(t, MetadataSchemaVersion, m.SchemaVersion)
+	assert.Equal(t, os.Getpid(), m.PID)
+	assert.Equal(t, "heap", m.Mode)
+	assert.Equal(t, []ArtifactMetadata{{Path: "/p/heap.pprof", Size: 100, Samples: 3}, {Path: "/p/heap.html", Size: -1, Samples: -1}}, m.Artifacts)
+	assert.Equal(t, report.Environment.GoVersion, m.GoVersion)
+	assert.Equal(t, []string{"boom"}, m.Errors)
+	assert.Empty(t, Report{}.Metadata().Host, "the process of a report without an environment is unknown")
+}
+
+func TestWithMetadataFile(t *testing.T) {
+	dir := t.TempDir()
+	p, err := Capture(context.Background(), time.Millisecond, WithMode(GoroutineMode), WithMetadataFile(),
+		WithProfileFileLocation(dir), WithQuietOutput())
+	require.NoError(t, err)
+	path := filepath.Join(dir, MetadataFileName)
+	assert.Contains(t, p.ArtifactPaths(), path)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	m, err := ParseMetadata(data)
+	require.NoError(t, err)
+	assert.Equal(t, os.Getpid(), m.PID)
+	assert.Equal(t, "goroutine", m.Mode)
+	require.NotEmpty(t, m.Artifacts)
+	assert.Equal(t, filepath.Join(dir, GoroutineFileName), m.Artifacts[0].Path)
+	require.NotEmpty(t, m.Events)
+	assert.Equal(t, "started", m.Events[0].Type)
+
+	reprocessed, err := Reprocess(dir, WithMetadataFile(), WithQuietOutput())
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(dir, GoroutineFileName), path}, reprocessed.ArtifactPaths())
+	data, err = os.ReadFile(path)
+	require.NoError(t, err)
+	m, err = ParseMetadata(data)
+	require.NoError(t, err)
+	assert.Zero(t, m.PID, "reprocessing does not know the process profiled")
+}
+
+func TestParseMetadataCompatibility(t *testing.T) {
+	// Fields added later in the same version are ignored.
+	m, err := ParseMetadata([]byte(`{"schema_version":1,"mode":"cpu","added_later":true}`))
+	require.NoError(t, err)
+	assert.Equal(t, "cpu", m.Mode)
+
+	_, err = ParseMetadata([]byte(`{"schema_version":2}`))
+	assert.ErrorContains(t, err, "unsupported metadata schema version 2")
+	_, err = ParseEventMetadata([]byte(`{"type":"started"}`))
+	assert.ErrorContains(t, err, "unsupported metadata schema version 0")
+	_, err = ParseMetadata([]byte(`{`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,65 @@
+package profiler
+
+// ModeSpec describes the capabilities of a Mode.  It is the single source
+// of truth consulted by the profiler itself and by tooling such as the
+// CLI, configuration validation and remote commands.
+type ModeSpec struct {
+	// Mode is the mode described.
+	Mode Mode
+	// Name is the name used to refer to the mode, see ParseMode.
+	Name string
+	// FileName is the default name of the artifact written, empty for
+	// the memory mode which writes HeapFileName and AllocsFileName and
+	// the auto mode which writes those of the modes it selects.
+	FileName string
+	// Exclusive is true if the runtime permits only a single capture of
+	// the mode at a time across the process, such as the CPU profiler.
+	Exclusive bool
+	// NeedsRate is true if the runtime records nothing for the mode until
+	// a sampling rate is set, see runtime.SetBlockProfileRate and
+	// runtime.SetMutexProfileFraction.
+	NeedsRate bool
+	// CaptureAtStop is true if the profile is written when the session
+	// is stopped, otherwise the mode binds its output as it starts, either
+	// streaming as it captures or writing immediately.
+	CaptureAtStop bool
+}
+
+// modeSpecs are the specs of every mode, in Mode order.  Specs are looked
+// up by their Mode, not their position.
+var modeSpecs = []ModeSpec{
+	{Mode: CPUMode, Name: "cpu", FileName: CPUFileName, Exclusive: true},
+	{Mode: MemoryHeapMode, Name: heapProfileName, FileName: MemoryFileName, CaptureAtStop: true},
+	{Mode: MemoryAllocMode, Name: allocProfileName, FileName: MemoryFileName, CaptureAtStop: true},
+	{Mode: BlockMode, Name: "block", FileName: BlockFileName, NeedsRate: true, CaptureAtStop: true},
+	{Mode: GoroutineMode, Name: "goroutine", FileName: GoroutineFileName},
+	{Mode: MutexMode, Name: "mutex", FileName: MutexFileName, NeedsRate: true},
+	{Mode: ThreadCreateMode, Name: "threadcreate", FileName: ThreadCreateFileName, CaptureAtStop: true},
+	{Mode: TraceMode, Name: "trace", FileName: TraceFileName, Exclusive: true},
+	{Mode: ClockMode, Name: "clock", FileName: ClockFileName},
+	{Mode: MemoryMode, Name: "memory", CaptureAtStop: true},
+	{Mode: SchedLatencyMode, Name: "schedlatency", FileName: SchedLatencyFileName, CaptureAtStop: true},
+	{Mode: AutoMode, Name: "auto"},
+}
+
+// ModeSpecs returns the specs of every mode, in Mode order.
+func ModeSpecs() []ModeSpec {
+	return append([]ModeSpec(nil), modeSpecs...)
+}
+
+// Spec returns the spec of the mode, false if the mode is unknown.
+func (m Mode) Spec() (ModeSpec, bool) {
+	for _, spec := range modeSpecs {
+		if spec.Mode == m {
+			return spec, true
+		}
+	}
+	return ModeSpec{}, false
+}
+
+// fileName returns the default artifact name of the mode, see
+// ModeSpec.FileName.
+func (m Mode) fileName() string {
+	spec, _ := m.Spec()
+	return spec.FileName
+}
@@ -0,0 +1,51 @@
+package profiler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModeSpecsCoverEveryStrategy(t *testing.T) {
+	specs := ModeSpecs()
+	assert.Len(t, specs, len(StrategyMap))
+	for i, spec := range specs {
+		assert.Equal(t, Mode(i), spec.Mode)
+		assert.Contains(t, StrategyMap, spec.Mode)
+		parsed, err := ParseMode(spec.Name)
+		assert.NoError(t, err)
+		assert.Equal(t, spec.Mode, parsed)
+	}
+}
+
+func TestModeSpec(t *testing.T) {
+	spec, ok := CPUMode.Spec()
+	assert.True(t, ok)
+	assert.Equal(t, ModeSpec{Mode: CPUMode, Name: "cpu", FileName: CPUFileName, Exclusive: true}, spec)
+	spec, ok = BlockMode.Spec()
+	assert.True(t, ok)
+	assert.True(t, spec.NeedsRate)
+	assert.True(t, spec.CaptureAtStop)
+	_, ok = Mode(-1).Spec()
+	assert.False(t, ok)
+	_, ok = Mode(len(modeSpecs)).Spec()
+	assert.False(t, ok)
+}
+
+func TestModeSpecLooksUpByMode(t *testing.T) {
+	defer func(specs []ModeSpec) { modeSpecs = specs }(modeSpecs)
+	// The order of the registry is not relied upon.
+	modeSpecs = []ModeSpec{{Mode: TraceMode, Name: "trace", FileName: TraceFileName}, {Mode: CPUMode, Name: "cpu", FileName: CPUFileName}}
+	spec, ok := CPUMode.Spec()
+	assert.True(t, ok)
+	assert.Equal(t, CPUMode, spec.Mode)
+	assert.Equal(t, TraceFileName, TraceMode.fileName())
+	_, ok = BlockMode.Spec()
+	assert.False(t, ok)
+}
+
+func TestModeSpecsReturnsCopy(t *testing.T) {
+	specs := ModeSpecs()
+	specs[0].Name = "changed"
+	assert.Equal(t, "cpu", CPUMode.String())
+}
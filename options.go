@@ -1,5 +1,11 @@
 package profiler
 
+import (
+	"context"
+	"crypto/tls"
+	"time"
+)
+
 // ProfileOption is a functional option to configure
 // profiler instances.
 type ProfileOption func(*Profiler)
@@ -12,6 +18,26 @@ func WithProfileFileLocation(path string) ProfileOption {
 	}
 }
 
+// WithFallbackDir sets the folder in which a unique temporary folder
+// is created when the profile file location cannot be used.  By default
+// os.TempDir() is used, which is not always suitable in containers with
+// a small /tmp mount.  Sinks which spool artifacts before uploading them,
+// such as the sftp sink, spool to this folder too.
+func WithFallbackDir(path string) ProfileOption {
+	return func(p *Profiler) {
+		p.fallbackFolder = path
+	}
+}
+
+// WithMode enables the profiler for the given mode.  This is
+// useful when the mode is only known at runtime, for example
+// from configuration or a remote command, see ParseMode.
+func WithMode(mode Mode) ProfileOption {
+	return func(p *Profiler) {
+		p.profileMode = mode
+	}
+}
+
 // WithCPUProfiler enables the CPU Profiler.
 // CPU Profiling is useful for determining where a program is
 // spending CPU cycles (as opposed) to sleeping or waiting for
@@ -47,18 +73,102 @@ func WithAllocProfiler() ProfileOption {
 	}
 }
 
+// WithMemoryProfiler enables both the Heap and Alloc profilers
+// for the same run, writing each view into its own file.  This
+// is typically what you want when debugging memory leaks.
+func WithMemoryProfiler() ProfileOption {
+	return func(p *Profiler) {
+		p.profileMode = MemoryMode
+	}
+}
+
+// WithSchedulerLatencyProfiler enables scheduler latency profiling,
+// recording how long goroutines spent runnable but not running during
+// the session.  This is invaluable for diagnosing GOMAXPROCS and CPU
+// throttling issues, the artifact is a pprof compatible profile with a
+// sample per latency bucket.
+func WithSchedulerLatencyProfiler() ProfileOption {
+	return func(p *Profiler) {
+		p.profileMode = SchedLatencyMode
+	}
+}
+
+// WithAutoMode is a guided experience for those unsure of which profiler
+// to reach for.  The runtime is observed for a short period (CPU busy vs
+// blocked, heap growth and goroutine growth) before every relevant
+// profiler is selected, its reasoning logged, and run for the remainder
+// of the session.  At most one of the cpu and clock profilers is run,
+// Mode reports it once selected.
+func WithAutoMode() ProfileOption {
+	return func(p *Profiler) {
+		p.profileMode = AutoMode
+	}
+}
+
+// WithHeapTriggerPercent sets the threshold of a heap Trigger as percent
+// (above 0, at most 100) of the memory limit of the container, read from
+// cgroup v1 or v2 on every poll, rather than an absolute size, so that
+// the same configuration suits differently sized pods.  A Trigger without
+// a Condition whose Options include it captures a heap profile each time
+// the memory in use crosses the threshold, see ContainerMemoryCondition.
+// It only applies to a Trigger, sessions provided it fail to start.
+//
+//	go profiler.Trigger{Options: []profiler.ProfileOption{profiler.WithHeapTriggerPercent(80)}}.Watch(ctx)
+func WithHeapTriggerPercent(percent float64) ProfileOption {
+	return func(p *Profiler) {
+		p.heapTrigger = true
+		p.heapTriggerPercent = percent
+	}
+}
+
 // WithMemoryProfilingRate sets the rate at which the
 // memory profiler samples memory allocations for both
-// Heap and Alloc profiling.  By default this is set to
-// the runtime.MemProfileRate value which is 512 * 1024.
-// This can be set to a higher value to increase the
-// resolution of the memory profile.
+// Heap and Alloc profiling.  By default the global
+// runtime.MemProfileRate (512 * 1024) is left untouched,
+// providing this option opts in to modifying it.
+// The rate is one allocation sampled per rate bytes, lower
+// values increase the resolution of the memory profile.
+// A rate of zero leaves the runtime default in place.
+// Allocations made before profiling starts were sampled at
+// the previous rate, so the profile may be misleading unless
+// the rate is set early, see WithMemProfileRateScope.
 func WithMemoryProfilingRate(rate int) ProfileOption {
 	return func(p *Profiler) {
 		p.memoryProfileRate = rate
 	}
 }
 
+// WithSamplingRates overrides the sampling rates of the runtime profilers
+// for this capture only, restoring them once it stops, so that each
+// CaptureSpec or Trigger can sample at its own rates.  A MemProfileRate
+// is applied as WithMemoryProfilingRate, scoped to the session.  The
+// runtime does not expose the block profile rate, so a BlockProfileRate
+// is restored to 0 (off) rather than to its previous value.  The mutex
+// mode writes its profile as it starts, before the rates of the capture
+// have sampled anything, so its profile reflects the rates in place
+// beforehand.  Overriding CPUHz makes the runtime print a "cannot set cpu
+// profile rate" warning to stderr, which is expected and harmless.
+func WithSamplingRates(rates SamplingRates) ProfileOption {
+	return func(p *Profiler) {
+		p.rates = rates
+		if rates.MemProfileRate > 0 {
+			p.memoryProfileRate = rates.MemProfileRate
+			p.memoryRateScope = MemProfileRateSession
+		}
+	}
+}
+
+// WithMemProfileRateScope controls how long a rate provided by
+// WithMemoryProfilingRate remains in effect.  By default it is
+// restored on Stop (MemProfileRateSession), MemProfileRateProcess
+// leaves the rate in place to avoid racing other code which reads
+// or writes runtime.MemProfileRate.
+func WithMemProfileRateScope(scope MemProfileRateScope) ProfileOption {
+	return func(p *Profiler) {
+		p.memoryRateScope = scope
+	}
+}
+
 // TODO: Doc
 func WithBlockProfiler() ProfileOption {
 	return func(p *Profiler) {
@@ -84,6 +194,399 @@ func WithoutSignalHandling() ProfileOption {
 	}
 }
 
+// WithExitOnSignal controls whether the process exits after the
+// profiler has torn down in response to SIGINT or SIGTERM.  By
+// default the process exits, providing false only flushes the
+// profile and allows the applications own signal handling and
+// shutdown to proceed.
+func WithExitOnSignal(exit bool) ProfileOption {
+	return func(p *Profiler) {
+		p.exitOnSignal = exit
+	}
+}
+
+// WithShutdownContext ties teardown of the profiler to ctx, typically
+// one derived from signal.NotifyContext.  When provided the profiler
+// does not install its own signal handler or exit the process, it
+// flushes the profile once ctx is done and leaves the remainder of
+// the shutdown to the application.
+func WithShutdownContext(ctx context.Context) ProfileOption {
+	return func(p *Profiler) {
+		p.shutdownCtx = ctx
+	}
+}
+
+// WithInstanceTags identifies the instance (service, region, shard etc)
+// for remote commands.  Commands with a selector are only performed by
+// instances whose tags match and results include the tags so it is clear
+// which instance produced which artifact.
+func WithInstanceTags(tags map[string]string) ProfileOption {
+	return func(p *Profiler) {
+		p.instanceTags = make(map[string]string, len(tags))
+		for key, value := range tags {
+			p.instanceTags[key] = value
+		}
+	}
+}
+
+// WithAgentTLS serves an Agent over TLS configured by config, such as a
+// config requiring client certificates (mTLS), see ServerTLSConfig.  The
+// gops CLI does not speak TLS, captures are requested with
+// AgentCaptureTLS instead.
+func WithAgentTLS(config *tls.Config) ProfileOption {
+	return func(p *Profiler) {
+		p.agentTLS = config
+	}
+}
+
+// WithTags attaches tags (service, version, environment, experiment etc)
+// to the session so that centralized storage can index its artifacts.
+// Tags are included in the Report, every Event and its metadata, the
+// context passed to every sink (see ContextTags), the headers of HTTP
+// uploads and the comments of pprof profiles.  Unlike WithInstanceTags
+// they are not used to select the instances performing remote commands.
+func WithTags(tags map[string]string) ProfileOption {
+	return func(p *Profiler) {
+		p.tags = make(map[string]string, len(tags))
+		for key, value := range tags {
+			p.tags[key] = value
+		}
+	}
+}
+
+// WithUpload copies every artifact to sink during teardown, prior
+// to any callback being invoked.  The local copy of each artifact is
+// always retained and failed uploads are reported rather than fatal.
+// This option may be provided multiple times.
+func WithUpload(sink Sink) ProfileOption {
+	return func(p *Profiler) {
+		p.uploads = append(p.uploads, sink)
+	}
+}
+
+// WithSFTPUpload pushes every artifact into folder on host during
+// teardown using the system sftp client, see SFTPSink.
+func WithSFTPUpload(host string, folder string, auth SSHAuth) ProfileOption {
+	return WithUpload(NewSFTPSink(host, folder, auth))
+}
+
+// WithTee streams every artifact to each of the sinks as it is written
+// to local disk, rather than uploading it during teardown.  The local copy
+// always survives, a sink failing mid capture is abandoned and the failure
+// recorded in the Report without affecting the local file.  Wrap slow
+// sinks with BufferedSink so that they cannot stall the profiler.
+func WithTee(sinks ...Sink) ProfileOption {
+	return func(p *Profiler) {
+		p.tees = append(p.tees, sinks...)
+	}
+}
+
+// WithCompression compresses artifacts with c as they are written to
+// disk, appending the extension of c to the file name.  pprof files are
+// already gzip compressed so only artifacts which benefit, such as
+// execution traces, are compressed.  Use CompressedSink to compress
+// uploads.
+func WithCompression(c Compression) ProfileOption {
+	return func(p *Profiler) {
+		p.compression = &c
+	}
+}
+
+// WithUploadBandwidth limits the uploads of the session to bytesPerSec,
+// shared between every sink and concurrent upload, so that flushing a
+// large artifact does not saturate the network of the host.  Uploads are
+// unlimited if bytesPerSec is not positive.
+func WithUploadBandwidth(bytesPerSec int64) ProfileOption {
+	return func(p *Profiler) {
+		p.uploadLimiter = newBandwidthLimiter(bytesPerSec)
+	}
+}
+
+// WithUploadTimeout bounds the uploads of a teardown to d, so that a slow
+// or throttled (see WithUploadBandwidth) network cannot stall the exit of
+// the process.  Uploads still in progress at the deadline fail and are
+// reported, the local artifacts are retained.  It is ten minutes by
+// default, uploads are unbounded if d is not positive.
+func WithUploadTimeout(d time.Duration) ProfileOption {
+	return func(p *Profiler) {
+		p.uploadTimeout = d
+	}
+}
+
+// WithHTTPUpload uploads every artifact beneath url during teardown,
+// large artifacts are uploaded in chunks, see HTTPSink.
+func WithHTTPUpload(url string, options ...HTTPSinkOption) ProfileOption {
+	return WithUpload(NewHTTPSink(url, options...))
+}
+
+// WithMaxArtifactSize limits the size in bytes of every artifact
+// written to disk, so that a runaway trace cannot fill the disk of a
+// production host.  Anything written beyond the limit is discarded
+// and the artifact is recorded as truncated, see TruncatedArtifacts.
+// policy controls whether the capture continues or stops early.
+func WithMaxArtifactSize(bytes int64, policy SizeLimitPolicy) ProfileOption {
+	return func(p *Profiler) {
+		p.maxArtifactSize = bytes
+		p.sizeLimitPolicy = policy
+	}
+}
+
+// WithFS writes the artifacts of the session to fsys rather than the
+// filesystem of the operating system, such as an in memory filesystem in
+// unit tests (see profilertest.MemFS) or an exotic mount.  Artifacts are
+// also read back from fsys for post processing, reports and uploads.
+func WithFS(fsys FS) ProfileOption {
+	return func(p *Profiler) {
+		p.fs = fsys
+	}
+}
+
+// WithFsyncOnClose commits every artifact to stable storage as it is
+// closed, so that artifacts survive a power loss or the process being
+// killed immediately after Stop.
+func WithFsyncOnClose() ProfileOption {
+	return func(p *Profiler) {
+		p.fsync = true
+	}
+}
+
+// WithErrorHandler invokes handler with each error that occurs during
+// teardown, such as a profile failing to be written to a full disk or
+// an upload failing.  By default a failure to write the profile causes
+// an exit, when a handler is provided the process is left running and
+// the errors are also recorded in the Report.
+func WithErrorHandler(handler ErrorHandlerFunc) ProfileOption {
+	return func(p *Profiler) {
+		p.errorHandler = handler
+	}
+}
+
+// WithBeforeCapture invokes hook immediately before profiling begins,
+// this allows cross cutting concerns such as pausing background jobs
+// or recording timings to be implemented without modifying strategies.
+// This option may be provided multiple times.
+func WithBeforeCapture(hook BeforeCaptureFunc) ProfileOption {
+	return func(p *Profiler) {
+		p.beforeHooks = append(p.beforeHooks, hook)
+	}
+}
+
+// WithAfterCapture invokes hook once profiling has been finalized (or
+// failed to start) with the artifacts written and any error, prior to
+// uploads and callbacks.  This option may be provided multiple times.
+func WithAfterCapture(hook AfterCaptureFunc) ProfileOption {
+	return func(p *Profiler) {
+		p.afterHooks = append(p.afterHooks, hook)
+	}
+}
+
+// WithStrategyMiddleware wraps the strategy of the selected mode with
+// middleware, the first middleware provided is the outermost.  This
+// option may be provided multiple times, appending to the chain.
+func WithStrategyMiddleware(middleware ...StrategyMiddleware) ProfileOption {
+	return func(p *Profiler) {
+		p.middleware = append(p.middleware, middleware...)
+	}
+}
+
+// WithEnabledFunc consults enabled before every capture performed by
+// Capture, continuous profiling, remote commands and the agent, so that
+// an external feature flag or remote config system can switch profiling
+// on and off at runtime for a subset of instances.  Captures skipped
+// while disabled return ErrDisabled.
+func WithEnabledFunc(enabled func() bool) ProfileOption {
+	return func(p *Profiler) {
+		p.enabled = enabled
+	}
+}
+
+// WithProbability only enables profiling in the given fraction (0 to 1)
+// of processes, so that always on instrumentation can be deployed fleet
+// wide while bounding the aggregate overhead and storage.  The decision
+// is derived from the hostname and PID, it is stable for the lifetime of
+// the process.  Start returns a profiler which does nothing and captures
+// return ErrNotSampled in processes which are not selected.
+func WithProbability(probability float64) ProfileOption {
+	return func(p *Profiler) {
+		p.probability = &probability
+	}
+}
+
+// WithDeduplication discards artifacts whose samples are identical, or
+// at least as similar as similarity (0 to 1), to the previous artifact
+// of the same name captured with this option.  A similarity of zero
+// discards only artifacts whose samples are identical, 0.95 also those
+// whose sample values differ by at most 5%.  This is typically used with
+// continuous profiling, where consecutive near identical heap profiles
+// waste space.  Discarded artifacts are not uploaded.
+func WithDeduplication(similarity float64) ProfileOption {
+	d := &deduplicator{similarity: similarity, previous: make(map[string]normalizedProfile)}
+	return func(p *Profiler) {
+		p.deduplicator = d
+	}
+}
+
+// WithLabelBreakdown groups the samples of labelled profiles by the
+// value of the pprof label key, for example the CPU share of each tenant,
+// reporting it and writing it alongside the profile as `<name>.<key>.csv`.
+// See pprof.Do for labelling the work of goroutines.
+func WithLabelBreakdown(key string) ProfileOption {
+	return func(p *Profiler) {
+		p.labelKey = key
+	}
+}
+
+// WithDeadlockDetection writes a full goroutine dump (debug=2) alongside
+// goroutine profiles and checks it for goroutines blocked on each other,
+// reporting the groups suspected of deadlock.  See SuspectDeadlocks.
+func WithDeadlockDetection() ProfileOption {
+	return func(p *Profiler) {
+		p.deadlockDetection = true
+	}
+}
+
+// WithExclusiveQueueing waits for the active profiling session to finish
+// before starting, rather than failing with an ActiveSessionError.  Only a
+// single session may be active at a time, the runtime CPU profiler and
+// fgprof in particular cannot reliably run together.
+func WithExclusiveQueueing() ProfileOption {
+	return func(p *Profiler) {
+		p.queue = true
+	}
+}
+
+// WithWarmup delays capture until d after the session starts, letting
+// caches warm and initial GC churn pass so that it is not profiled.
+// Start returns immediately, stopping the session before the warmup has
+// elapsed captures nothing.  The warmup is recorded in the Report.
+func WithWarmup(d time.Duration) ProfileOption {
+	return func(p *Profiler) {
+		p.warmup = d
+	}
+}
+
+// WithDryRun validates the configuration without profiling, resolving
+// the options, checking the output directory is writable, uploads are
+// reachable and the mode is supported by the platform, then reporting
+// what would be captured and where.  This is useful for validating
+// deployment manifests before a real incident.  Start exits if a problem
+// is found (unless an error handler is provided) and Capture returns it.
+func WithDryRun() ProfileOption {
+	return func(p *Profiler) {
+		p.dryRunOnly = true
+	}
+}
+
+// WithServeTrace serves the execution trace with `go tool trace` on addr
+// once the session stops, so that a trace captured on a remote host can
+// be viewed by port forwarding to it.  The go command must be installed,
+// the child process is stopped with StopTraceServer and is not started
+// when the process exits following a signal.
+func WithServeTrace(addr string) ProfileOption {
+	return func(p *Profiler) {
+		p.serveTraceAddr = addr
+	}
+}
+
+// WithPostProcessor transforms every pprof artifact between capture and
+// write with fn, enabling user defined transforms without forking the
+// strategies.  Post processors run in the order they are provided, the
+// profile is buffered in memory until the artifact is closed.  Nothing is
+// written if a post processor fails.
+func WithPostProcessor(fn PostProcessor) ProfileOption {
+	return func(p *Profiler) {
+		p.postProcessors = append(p.postProcessors, fn)
+	}
+}
+
+// WithOverheadBudget governs continuous profiling, measuring the cpu and
+// allocation overhead of each capture cycle and capturing less often
+// while the budget is exceeded, resuming every cycle as headroom
+// returns.  It has no effect on one off captures.
+func WithOverheadBudget(budget OverheadBudget) ProfileOption {
+	return func(p *Profiler) {
+		p.overheadBudget = budget
+	}
+}
+
+// WithHTMLReport writes a static, self-contained `<name>.html` report
+// alongside every pprof artifact, rendering a flame graph and the top
+// functions so the profile can be shared with those without go tooling.
+func WithHTMLReport() ProfileOption {
+	return func(p *Profiler) {
+		p.htmlReport = true
+	}
+}
+
+// WithMarkdownSummary writes a `summary.md` into the output folder as
+// part of Stop, with the environment and the top functions of every
+// pprof artifact formatted for pasting into issues or pull requests.
+// When baseline is the path of a previous profile the top functions are
+// compared with it.
+func WithMarkdownSummary(baseline string) ProfileOption {
+	return func(p *Profiler) {
+		p.summary = true
+		p.summaryBaseline = baseline
+	}
+}
+
+// WithMetadataFile writes a `metadata.json` into the output folder as
+// part of Stop, the SessionMetadata of the session with the events
+// emitted up to then, for external collectors and `profilerctl metadata`.
+// It is uploaded with the other artifacts.
+func WithMetadataFile() ProfileOption {
+	return func(p *Profiler) {
+		p.writeMetadata = true
+	}
+}
+
+// WithDatePartitioning writes artifacts beneath a folder for the date the
+// capture started, <location>/yyyy/mm/dd, keeping long running continuous
+// captures manageable and compatible with the lifecycle policies of
+// object stores mounted as filesystems.
+func WithDatePartitioning() ProfileOption {
+	return func(p *Profiler) {
+		p.datePartitioning = true
+	}
+}
+
+// WithFinalizeConcurrency finalizes independent artifacts, such as the
+// uploads of each artifact to each sink and the conversion of each to an
+// HTML report, on up to n goroutines rather than one after another.
+// Steps which must happen in order, such as stopping the CPU profiler
+// before its file is closed, are unaffected.  Upload sinks must be safe
+// for concurrent use.
+func WithFinalizeConcurrency(n int) ProfileOption {
+	return func(p *Profiler) {
+		p.finalizeConcurrency = n
+	}
+}
+
+// WithFinalizeTimeout abandons the finalizer of the strategy if it has not
+// completed within d, such as when fgprof teardown or a stalled disk hangs.
+// The artifacts which were completed are salvaged and teardown continues,
+// those which were not are reported as partial and processed no further.
+// The session remains active until the abandoned finalizer returns.
+func WithFinalizeTimeout(d time.Duration) ProfileOption {
+	return func(p *Profiler) {
+		p.finalizeTimeout = d
+	}
+}
+
+// WithHostCoordination staggers captures across the processes of a host,
+// such as the replicas of a systemd template unit, which share the lock
+// file at path.  Each capture holds an exclusive lock on the file, a
+// capture started while another process holds it waits for it to finish
+// rather than all of them profiling at the same scheduled minute, failing
+// after five minutes if the lock is not released.  It is only supported on
+// unix platforms.
+func WithHostCoordination(path string) ProfileOption {
+	return func(p *Profiler) {
+		// The lock is outermost, held for the whole of the capture.
+		p.middleware = append([]StrategyMiddleware{hostCoordination(path)}, p.middleware...)
+	}
+}
+
 // WithCallback executes a user defined function when
 // clean up occurs.  This function is also fired on
 // sigterm handling when the option is enabled.
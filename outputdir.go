@@ -0,0 +1,54 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SetOutputDir changes the folder the captures requested with
+// RequestCapture are written to, such as when a new volume is mounted or
+// a date based partition rolls over.  The folder is created and checked
+// to be writable before the change is applied, an error leaves the current
+// folder in effect.  The change applies from the next capture, a capture
+// in progress (including the session of p itself) completes in the folder
+// it started with.  A CaptureSpec with an Output takes precedence.
+func (p *Profiler) SetOutputDir(path string) error {
+	if err := prepareOutputDir(p.fs, path); err != nil {
+		return err
+	}
+	p.requestMu.Lock()
+	p.outputDir = path
+	p.requestMu.Unlock()
+	return nil
+}
+
+// SetOutputDir changes the folder each capture cycle writes its timestamped
+// folder to, applying from the next cycle.  The folder is created and
+// checked to be writable before the change is applied.  A subsequent
+// Reload replaces it with the folder of the reloaded configuration.
+func (c *Continuous) SetOutputDir(path string) error {
+	if err := prepareOutputDir(c.reporter.fs, path); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	previous := c.config.OutputDir
+	c.config.OutputDir = path
+	c.mu.Unlock()
+	c.reporter.report("output directory changed from %s to %s", previous, path)
+	return nil
+}
+
+// prepareOutputDir creates the folder at path of fsys, verifying it is
+// writable.
+func prepareOutputDir(fsys FS, path string) error {
+	if path == "" {
+		return errors.New("output directory must not be empty")
+	}
+	if err := fsys.MkdirAll(path, 0777); err != nil {
+		return fmt.Errorf("unable to create output directory: %w", err)
+	}
+	if err := checkWritable(fsys, path); err != nil {
+		return fmt.Errorf("output directory %s is not writable: %w", path, err)
+	}
+	return nil
+}
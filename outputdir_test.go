@@ -0,0 +1,52 @@
+package profiler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetOutputDirAppliesToTheNextCapture(t *testing.T) {
+	before, after := t.TempDir(), filepath.Join(t.TempDir(), "mounted")
+	p := New(WithProfileFileLocation(before), WithQuietOutput())
+	spec := CaptureSpec{Mode: GoroutineMode, Duration: 10 * time.Millisecond}
+
+	ticket, err := p.RequestCapture(spec)
+	assert.NoError(t, err)
+	captured, err := ticket.Wait(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, before, captured.OutputDir())
+
+	assert.NoError(t, p.SetOutputDir(after))
+	ticket, err = p.RequestCapture(spec)
+	assert.NoError(t, err)
+	captured, err = ticket.Wait(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, after, captured.OutputDir())
+	assert.FileExists(t, filepath.Join(after, GoroutineFileName))
+}
+
+func TestSetOutputDirRejectsUnusableFolders(t *testing.T) {
+	p := New(WithQuietOutput())
+	assert.ErrorContains(t, p.SetOutputDir(""), "must not be empty")
+	file := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(file, nil, 0644))
+	assert.ErrorContains(t, p.SetOutputDir(filepath.Join(file, "profiles")), "unable to create output directory")
+	assert.Empty(t, p.outputDir)
+}
+
+func TestContinuousSetOutputDir(t *testing.T) {
+	config := ContinuousConfig{Interval: time.Hour, Duration: time.Millisecond, Modes: []string{"heap"}, OutputDir: t.TempDir()}
+	c, err := StartContinuous(context.Background(), StaticConfig(config), WithQuietOutput(), WithoutSignalHandling())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	after := filepath.Join(t.TempDir(), "partition")
+	assert.NoError(t, c.SetOutputDir(after))
+	assert.Equal(t, after, c.Config().OutputDir)
+}
@@ -0,0 +1,253 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// OverviewFileName is the combined report written once a multi-mode
+// session completes.
+const OverviewFileName = "overview.md"
+
+// errNothingToSummarise is returned by WriteOverview when none of the
+// artifacts are summarised.
+var errNothingToSummarise = errors.New("no cpu, memory or goroutine artifacts to summarise")
+
+// overviewTop is the number of functions in each table of the overview.
+const overviewTop = 10
+
+// goroutineStates classifies a goroutine by the runtime function it is
+// parked in, the first match from the leaf of its stack wins.
+var goroutineStates = []struct {
+	function string
+	state    string
+}{
+	{"runtime.chanrecv", "chan receive"},
+	{"runtime.chansend", "chan send"},
+	{"runtime.selectgo", "select"},
+	{"sync.runtime_SemacquireMutex", "mutex"},
+	{"sync.runtime_SemacquireRWMutex", "mutex"},
+	{"sync.runtime_notifyListWait", "cond wait"},
+	{"sync.runtime_Semacquire", "semacquire"},
+	{"internal/poll.runtime_pollWait", "io wait"},
+	{"time.Sleep", "sleep"},
+	{"syscall.Syscall", "syscall"},
+	{"syscall.Syscall6", "syscall"},
+	{"syscall.RawSyscall6", "syscall"},
+}
+
+// goroutineState classifies the goroutine whose stack is names.
+func goroutineState(names []string) string {
+	for _, name := range names {
+		for _, s := range goroutineStates {
+			if name == s.function {
+				return s.state
+			}
+		}
+	}
+	return "other"
+}
+
+// WriteOverview writes a one page markdown overview of a session to w,
+// cross-referencing the top CPU consumers, the top allocators and the
+// states of goroutines found amongst artifacts.  Artifacts of other
+// modes are ignored.
+func WriteOverview(w io.Writer, artifacts []string) error {
+	return writeOverview(OSFS{}, w, artifacts)
+}
+
+// writeOverview is WriteOverview of the artifacts of fsys.
+func writeOverview(fsys FS, w io.Writer, artifacts []string) error {
+	var cpu, allocs []FunctionShare
+	var goroutines *profile.Profile
+	var sections []string
+	for _, path := range artifacts {
+		var err error
+		switch filepath.Base(path) {
+		case CPUFileName:
+			cpu, err = readTop(fsys, path, "cpu")
+		case HeapFileName, AllocsFileName, MemoryFileName:
+			if allocs == nil {
+				allocs, err = readTop(fsys, path, "alloc_space")
+			}
+		case GoroutineFileName:
+			goroutines, err = readProfile(fsys, path)
+		default:
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		sections = append(sections, "`"+filepath.Base(path)+"`")
+	}
+	if len(sections) == 0 {
+		return errNothingToSummarise
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Profiling overview\n\nGenerated %s from %s.\n", time.Now().Format(time.RFC3339), strings.Join(sections, ", "))
+	if cpu != nil {
+		b.WriteString("\n## Top CPU consumers\n\n")
+		writeShareTable(&b, cpu, func(v int64) string { return time.Duration(v).String() })
+	}
+	if allocs != nil {
+		b.WriteString("\n## Top allocators\n\n")
+		writeShareTable(&b, allocs, formatBytes)
+	}
+	if cpu != nil && allocs != nil {
+		writeHotspots(&b, cpu, allocs)
+	}
+	if goroutines != nil {
+		writeGoroutineStates(&b, goroutines)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// readTop returns the top functions of sampleType in the profile at path
+// of fsys.
+func readTop(fsys FS, path string, sampleType string) ([]FunctionShare, error) {
+	prof, err := readProfile(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	return TopFunctions(prof, sampleType, overviewTop)
+}
+
+// writeShareTable writes the functions as a markdown table.
+func writeShareTable(b *strings.Builder, shares []FunctionShare, format func(int64) string) {
+	if len(shares) == 0 {
+		b.WriteString("No samples were recorded.\n")
+		return
+	}
+	b.WriteString("| Function | Flat | Flat % | Cum |\n| --- | ---: | ---: | ---: |\n")
+	for _, s := range shares {
+		fmt.Fprintf(b, "| `%s` | %s | %.1f%% | %s |\n", s.Name, format(s.Flat), s.Share*100, format(s.Cum))
+	}
+}
+
+// writeHotspots writes the functions which are amongst both the top CPU
+// consumers and the top allocators.
+func writeHotspots(b *strings.Builder, cpu []FunctionShare, allocs []FunctionShare) {
+	allocated := make(map[string]FunctionShare, len(allocs))
+	for _, s := range allocs {
+		allocated[s.Name] = s
+	}
+	b.WriteString("\n## Hot in both CPU and allocations\n\n")
+	var found bool
+	for _, s := range cpu {
+		if a, ok := allocated[s.Name]; ok {
+			if !found {
+				b.WriteString("| Function | CPU % | Alloc % |\n| --- | ---: | ---: |\n")
+				found = true
+			}
+			fmt.Fprintf(b, "| `%s` | %.1f%% | %.1f%% |\n", s.Name, s.Share*100, a.Share*100)
+		}
+	}
+	if !found {
+		b.WriteString("No function is amongst both the top CPU consumers and the top allocators.\n")
+	}
+}
+
+// writeGoroutineStates writes the number of goroutines in each state,
+// followed by the largest buckets of ClassifyGoroutines.
+func writeGoroutineStates(b *strings.Builder, prof *profile.Profile) {
+	counts := make(map[string]int64)
+	var total int64
+	for _, sample := range prof.Sample {
+		counts[goroutineState(sampleFunctions(sample))] += sample.Value[0]
+		total += sample.Value[0]
+	}
+	states := make([]string, 0, len(counts))
+	for state := range counts {
+		states = append(states, state)
+	}
+	sort.Slice(states, func(i, j int) bool {
+		if counts[states[i]] != counts[states[j]] {
+			return counts[states[i]] > counts[states[j]]
+		}
+		return states[i] < states[j]
+	})
+	fmt.Fprintf(b, "\n## Goroutines\n\n%d goroutines were captured.\n\n| State | Goroutines |\n| --- | ---: |\n", total)
+	for _, state := range states {
+		fmt.Fprintf(b, "| %s | %d |\n", state, counts[state])
+	}
+	buckets, err := ClassifyGoroutines(prof)
+	if err != nil || len(buckets) == 0 {
+		return
+	}
+	b.WriteString("\n### Blocked on\n\nBuckets holding a dominant share of the goroutines are in bold.\n\n| State | Frame | Goroutines | Share |\n| --- | --- | ---: | ---: |\n")
+	for _, bucket := range buckets[:min(overviewTop, len(buckets))] {
+		row := fmt.Sprintf("| %s | `%s` | %d | %.1f%% |", bucket.State, bucket.Frame, bucket.Count, bucket.Share*100)
+		if bucket.Dominant() {
+			row = fmt.Sprintf("| **%s** | **`%s`** | **%d** | **%.1f%%** |", bucket.State, bucket.Frame, bucket.Count, bucket.Share*100)
+		}
+		b.WriteString(row + "\n")
+	}
+}
+
+// formatBytes formats n bytes in binary units.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit && n > -unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	value, suffix := float64(n)/unit, "KiB"
+	for _, next := range []string{"MiB", "GiB", "TiB"} {
+		if value < unit && value > -unit {
+			break
+		}
+		value, suffix = value/unit, next
+	}
+	return fmt.Sprintf("%.1f%s", value, suffix)
+}
+
+// writeOverviews writes an overview into every folder the profilers
+// wrote artifacts of more than one mode to.
+func writeOverviews(profilers []*Profiler) error {
+	artifacts := make(map[string][]string)
+	modes := make(map[string]map[Mode]bool)
+	filesystems := make(map[string]FS)
+	var dirs []string
+	for _, p := range profilers {
+		if p == nil || len(p.ArtifactPaths()) == 0 {
+			continue
+		}
+		dir := p.OutputDir()
+		if modes[dir] == nil {
+			modes[dir] = make(map[Mode]bool)
+			filesystems[dir] = p.fs
+			dirs = append(dirs, dir)
+		}
+		modes[dir][p.Mode()] = true
+		artifacts[dir] = append(artifacts[dir], p.ArtifactPaths()...)
+	}
+	var errs []error
+	for _, dir := range dirs {
+		if len(modes[dir]) < 2 {
+			continue
+		}
+		if err := writeOverviewFile(filesystems[dir], filepath.Join(dir, OverviewFileName), artifacts[dir]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeOverviewFile writes the overview of artifacts to path of fsys,
+// nothing is written when there is nothing to summarise.
+func writeOverviewFile(fsys FS, path string, artifacts []string) error {
+	var b strings.Builder
+	if err := writeOverview(fsys, &b, artifacts); errors.Is(err, errNothingToSummarise) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	return writeFile(fsys, path, []byte(b.String()))
+}
@@ -0,0 +1,88 @@
+package profiler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/symonk/profiler/profilertest/workload"
+)
+
+func TestRunWritesOverviewForMultiModeSessions(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		workload.Mixed(ctx)
+	}()
+	_, err := Run(context.Background(), []CaptureSpec{
+		{Mode: CPUMode, Duration: 100 * time.Millisecond},
+		{Mode: MemoryHeapMode, Duration: time.Millisecond},
+		{Mode: GoroutineMode, Duration: time.Millisecond},
+	}, WithProfileFileLocation(dir), WithQuietOutput())
+	cancel()
+	<-done
+	assert.NoError(t, err)
+
+	overview, err := os.ReadFile(filepath.Join(dir, OverviewFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, heading := range []string{"# Profiling overview", "## Top CPU consumers", "## Top allocators", "## Hot in both CPU and allocations", "## Goroutines", "### Blocked on"} {
+		assert.Contains(t, string(overview), heading)
+	}
+}
+
+func TestRunSkipsOverviewForSingleMode(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Run(context.Background(), []CaptureSpec{{Mode: GoroutineMode, Duration: time.Millisecond}}, WithProfileFileLocation(dir), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.NoFileExists(t, filepath.Join(dir, OverviewFileName))
+}
+
+func TestWriteOverviewRequiresArtifacts(t *testing.T) {
+	assert.ErrorIs(t, WriteOverview(&strings.Builder{}, []string{"trace.out"}), errNothingToSummarise)
+}
+
+func TestTopFunctions(t *testing.T) {
+	fn := func(id uint64, name string) *profile.Location {
+		return &profile.Location{ID: id, Line: []profile.Line{{Function: &profile.Function{ID: id, Name: name}}}}
+	}
+	main, work, hash := fn(1, "main.main"), fn(2, "main.work"), fn(3, "crypto/sha256.block")
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{
+			{Location: []*profile.Location{hash, work, main}, Value: []int64{3, 300}},
+			{Location: []*profile.Location{work, main}, Value: []int64{1, 100}},
+		},
+	}
+	top, err := TopFunctions(prof, "cpu", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []FunctionShare{
+		{Name: "crypto/sha256.block", Flat: 300, Cum: 300, Share: 0.75, CumShare: 0.75},
+		{Name: "main.work", Flat: 100, Cum: 400, Share: 0.25, CumShare: 1},
+	}, top)
+	top, err = TopCumulativeFunctions(prof, "cpu", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"main.work", "main.main"}, []string{top[0].Name, top[1].Name})
+	_, err = TopFunctions(prof, "alloc_space", 2)
+	assert.ErrorContains(t, err, "no alloc_space samples")
+}
+
+func TestGoroutineState(t *testing.T) {
+	assert.Equal(t, "chan receive", goroutineState([]string{"runtime.gopark", "runtime.chanrecv", "runtime.chanrecv1", "main.main"}))
+	assert.Equal(t, "mutex", goroutineState([]string{"runtime.gopark", "sync.runtime_SemacquireMutex", "sync.(*Mutex).Lock"}))
+	assert.Equal(t, "other", goroutineState([]string{"main.work"}))
+}
+
+func TestFormatBytes(t *testing.T) {
+	assert.Equal(t, "512B", formatBytes(512))
+	assert.Equal(t, "1.5KiB", formatBytes(1536))
+	assert.Equal(t, "2.0GiB", formatBytes(2<<30))
+}
@@ -0,0 +1,155 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// PhaseLabel is the pprof label key carried by every sample of a profile
+// captured during a phase, see Phase.
+const PhaseLabel = "phase"
+
+// UnphasedName names the phase of the profile captured before the first
+// phase began.
+const UnphasedName = "(start)"
+
+// PhaseStat describes a phase of a session, see Phase.
+type PhaseStat struct {
+	// Name is the name of the phase, UnphasedName for the profile
+	// captured before the first phase began.
+	Name string
+	// Duration is how long the phase ran for.
+	Duration time.Duration
+	// CPU is the user CPU time the process consumed during the phase.
+	CPU time.Duration
+	// Artifact is the path of the profile of the phase.
+	Artifact string
+}
+
+// String describes the phase, such as "load took 1.2s using 900ms of CPU".
+func (s PhaseStat) String() string {
+	return fmt.Sprintf("%s took %s using %s of CPU", s.Name, s.Duration.Round(time.Millisecond), s.CPU.Round(time.Millisecond))
+}
+
+// phaseName restricts phase names to those safe within a file name.
+var phaseName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Phase marks the beginning of a phase of the application, such as the
+// load, transform and flush stages of a batch pipeline, producing a
+// profile per phase from a single run.  The CPU profile so far is closed
+// and profiling continues into `cpu.<name>.pprof`, whose samples carry the
+// PhaseLabel.  The duration and CPU time of each phase are recorded in
+// Report().Phases.  Phases are only supported by the CPU profiler while it
+// is running, and each name may only be used once per session so that its
+// profile is not overwritten.
+func (p *Profiler) Phase(name string) error {
+	if !phaseName.MatchString(name) {
+		return fmt.Errorf("invalid phase name %q, only letters, digits, '_' and '-' are permitted", name)
+	}
+	if mode := p.Mode(); mode != CPUMode {
+		return fmt.Errorf("phases are only supported by the cpu profiler, not %s", mode)
+	}
+	p.phaseMu.Lock()
+	defer p.phaseMu.Unlock()
+	if p.rollover == nil {
+		return errors.New("the cpu profiler is not running")
+	}
+	if p.phaseBegun(name) {
+		return fmt.Errorf("phase %s has already been profiled", name)
+	}
+	if err := p.rollover(name); err != nil {
+		return fmt.Errorf("failed to begin phase %s: %w", name, err)
+	}
+	p.report("cpu profiling phase %s began", name)
+	return nil
+}
+
+// RunPhase begins the phase name and runs fn, returning its error, for
+// batch jobs whose steps are functions:
+//
+//	err := p.RunPhase("load", load)
+//
+// Failing to begin the phase is reported rather than returned, profiling
+// does not fail the job.
+func (p *Profiler) RunPhase(name string, fn func() error) error {
+	if err := p.Phase(name); err != nil {
+		p.report("[warning] %s", err)
+	}
+	return fn()
+}
+
+// phaseBegun reports whether the phase name is running or has run.
+func (p *Profiler) phaseBegun(name string) bool {
+	if p.phase == name {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, stat := range p.phases {
+		if stat.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// recordPhase records the stats of the phase name, profiled into path,
+// which began at before.
+func (p *Profiler) recordPhase(name string, path string, before observation) {
+	if name == "" {
+		name = UnphasedName
+	}
+	now := observe()
+	stat := PhaseStat{
+		Name:     name,
+		Duration: now.at.Sub(before.at),
+		CPU:      time.Duration((now.userCPU - before.userCPU) * float64(time.Second)),
+		Artifact: path,
+	}
+	p.mu.Lock()
+	p.phases = append(p.phases, stat)
+	p.mu.Unlock()
+}
+
+// reportPhases reports the stats of each phase of the session.
+func (p *Profiler) reportPhases() {
+	for _, stat := range p.Report().Phases {
+		p.report("phase %s (%s)", stat, filepath.Base(stat.Artifact))
+	}
+}
+
+// setRollover sets the function rolling the profile over to a new phase,
+// nil once the profiler is no longer running.
+func (p *Profiler) setRollover(rollover func(name string) error) {
+	p.phaseMu.Lock()
+	defer p.phaseMu.Unlock()
+	p.rollover = rollover
+}
+
+// phaseFileName returns the name of the artifact of the phase of the
+// profile file name, such as cpu.load.pprof.
+func phaseFileName(name string, phase string) string {
+	base, ext, _ := strings.Cut(name, ".")
+	return base + "." + phase + "." + ext
+}
+
+// phaseProfile returns a PostProcessor labelling every sample with the
+// phase and recording it as a comment of the profile.
+func phaseProfile(phase string) PostProcessor {
+	return func(prof *profile.Profile) (*profile.Profile, error) {
+		for _, sample := range prof.Sample {
+			if sample.Label == nil {
+				sample.Label = make(map[string][]string)
+			}
+			sample.Label[PhaseLabel] = []string{phase}
+		}
+		prof.Comments = append(prof.Comments, "phase "+phase)
+		return prof, nil
+	}
+}
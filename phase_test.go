@@ -0,0 +1,100 @@
+package profiler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPhaseRollsOverTheCPUProfile(t *testing.T) {
+	dir := t.TempDir()
+	p := Start(WithCPUProfiler(), WithProfileFileLocation(dir), WithoutSignalHandling(), WithQuietOutput())
+	assert.NoError(t, p.Phase("load"))
+	assert.NoError(t, p.Phase("flush"))
+	p.Stop()
+	assert.Empty(t, p.Report().Errors)
+	var names []string
+	for _, path := range p.ArtifactPaths() {
+		names = append(names, filepath.Base(path))
+	}
+	assert.Equal(t, []string{CPUFileName, "cpu.load.pprof", "cpu.flush.pprof"}, names)
+
+	first, err := ReadProfile(filepath.Join(dir, CPUFileName))
+	assert.NoError(t, err)
+	assert.Empty(t, first.Comments)
+	load, err := ReadProfile(filepath.Join(dir, "cpu.load.pprof"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"phase load"}, load.Comments)
+	for _, sample := range load.Sample {
+		assert.Equal(t, []string{"load"}, sample.Label[PhaseLabel])
+	}
+
+	phases := p.Report().Phases
+	if assert.Len(t, phases, 3) {
+		assert.Equal(t, []string{UnphasedName, "load", "flush"}, []string{phases[0].Name, phases[1].Name, phases[2].Name})
+		assert.Equal(t, filepath.Join(dir, "cpu.flush.pprof"), phases[2].Artifact)
+		assert.True(t, phases[2].Duration > 0)
+	}
+
+	assert.ErrorContains(t, p.Phase("late"), "not running")
+}
+
+func TestRunPhase(t *testing.T) {
+	dir := t.TempDir()
+	p := Start(WithCPUProfiler(), WithMarkdownSummary(""), WithProfileFileLocation(dir), WithoutSignalHandling(), WithQuietOutput())
+	failed := errors.New("load failed")
+	assert.NoError(t, p.RunPhase("transform", func() error { return nil }))
+	assert.Equal(t, failed, p.RunPhase("load", func() error { return failed }))
+	p.Stop()
+	assert.Len(t, p.Report().Phases, 3)
+	summary, err := os.ReadFile(filepath.Join(dir, SummaryFileName))
+	assert.NoError(t, err)
+	assert.Contains(t, string(summary), "### Phases")
+	assert.Contains(t, string(summary), "| transform |")
+
+	// The job runs even when the phase cannot begin.
+	ran := false
+	assert.NoError(t, p.RunPhase("late", func() error { ran = true; return nil }))
+	assert.True(t, ran)
+}
+
+func TestPhaseRejectsRepeatedNames(t *testing.T) {
+	dir := t.TempDir()
+	p := Start(WithCPUProfiler(), WithProfileFileLocation(dir), WithoutSignalHandling(), WithQuietOutput())
+	assert.NoError(t, p.Phase("load"))
+	assert.ErrorContains(t, p.Phase("load"), "already been profiled")
+	assert.NoError(t, p.Phase("flush"))
+	assert.ErrorContains(t, p.Phase("load"), "already been profiled")
+	p.Stop()
+	assert.Empty(t, p.Report().Errors)
+	assert.Equal(t, []string{filepath.Join(dir, CPUFileName), filepath.Join(dir, "cpu.load.pprof"), filepath.Join(dir, "cpu.flush.pprof")}, p.ArtifactPaths())
+	load, err := ReadProfile(filepath.Join(dir, "cpu.load.pprof"))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"phase load"}, load.Comments)
+}
+
+func TestPhaseRequiresTheCPUProfiler(t *testing.T) {
+	p := Start(WithHeapProfiler(), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput())
+	defer p.Stop()
+	assert.ErrorContains(t, p.Phase("load"), "only supported by the cpu profiler")
+	assert.ErrorContains(t, p.Phase("../load"), "invalid phase name")
+}
+
+func TestPhaseProfileLabelsSamples(t *testing.T) {
+	prof, err := phaseProfile("transform")(exportProfile())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"phase transform"}, prof.Comments)
+	for _, sample := range prof.Sample {
+		assert.Equal(t, []string{"transform"}, sample.Label[PhaseLabel])
+	}
+	assert.Equal(t, "cpu.transform.pprof", phaseFileName(CPUFileName, "transform"))
+}
+
+func TestPhaseStatString(t *testing.T) {
+	stat := PhaseStat{Name: "load", Duration: 1200 * time.Millisecond, CPU: 900 * time.Millisecond}
+	assert.Equal(t, "load took 1.2s using 900ms of CPU", stat.String())
+}
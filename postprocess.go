@@ -0,0 +1,75 @@
+package profiler
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// PostProcessor transforms a profile between capture and write, such as
+// scrubbing label values containing PII, dropping samples of vendored
+// packages or rescaling values.  The returned profile is written.
+type PostProcessor func(*profile.Profile) (*profile.Profile, error)
+
+// postProcessWriter buffers a pprof artifact in memory so that it can
+// be parsed and post processed when it is closed.
+type postProcessWriter struct {
+	w          io.WriteCloser
+	buf        bytes.Buffer
+	processors []PostProcessor
+}
+
+// postProcess wraps the writer of the named artifact with the post
+// processors, only pprof artifacts are post processed.
+func (p *Profiler) postProcess(w io.WriteCloser, name string) io.WriteCloser {
+	processors := p.processorsFor(name)
+	if len(processors) == 0 {
+		return w
+	}
+	return &postProcessWriter{w: w, processors: processors}
+}
+
+// processorsFor returns the post processors of the named artifact, none
+// unless it is a pprof artifact.
+func (p *Profiler) processorsFor(name string) []PostProcessor {
+	if !strings.HasSuffix(name, ".pprof") {
+		return nil
+	}
+	processors := p.postProcessors
+	if len(p.tags) > 0 {
+		processors = append(append([]PostProcessor{}, processors...), p.tagProfile)
+	}
+	if p.phase != "" {
+		processors = append(append([]PostProcessor{}, processors...), phaseProfile(p.phase))
+	}
+	return processors
+}
+
+// Write buffers b.
+func (pw *postProcessWriter) Write(b []byte) (int, error) {
+	return pw.buf.Write(b)
+}
+
+// Close runs the post processors and writes the result.  Nothing is
+// written if parsing or post processing fails, so that data which was
+// to be scrubbed is never persisted.  An artifact discarded before it was
+// written, such as by SetOutput, is closed as is.
+func (pw *postProcessWriter) Close() error {
+	if pw.buf.Len() == 0 {
+		return pw.w.Close()
+	}
+	prof, err := profile.Parse(&pw.buf)
+	if err != nil {
+		return errors.Join(fmt.Errorf("failed to parse the profile for post processing: %w", err), pw.w.Close())
+	}
+	for _, process := range pw.processors {
+		if prof, err = process(prof); err != nil {
+			return errors.Join(fmt.Errorf("post processing failed: %w", err), pw.w.Close())
+		}
+	}
+	return errors.Join(prof.Write(pw.w), pw.w.Close())
+}
@@ -0,0 +1,50 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPostProcessorTransformsProfile(t *testing.T) {
+	var calls []string
+	first := func(p *profile.Profile) (*profile.Profile, error) {
+		calls = append(calls, "first")
+		p.Comments = append(p.Comments, "post processed")
+		return p, nil
+	}
+	second := func(p *profile.Profile) (*profile.Profile, error) {
+		calls = append(calls, "second")
+		p.Sample = nil
+		return p, nil
+	}
+	p, err := Capture(context.Background(), time.Millisecond, WithHeapProfiler(), WithPostProcessor(first), WithPostProcessor(second), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"first", "second"}, calls)
+	prof, err := ReadProfile(p.ArtifactPaths()[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"post processed"}, prof.Comments)
+	assert.Empty(t, prof.Sample)
+}
+
+func TestPostProcessorFailureWritesNothing(t *testing.T) {
+	failing := func(*profile.Profile) (*profile.Profile, error) { return nil, errors.New("scrubbing failed") }
+	p, err := Capture(context.Background(), time.Millisecond, WithHeapProfiler(), WithPostProcessor(failing), WithProfileFileLocation(t.TempDir()), WithErrorHandler(func(error) {}), WithQuietOutput())
+	assert.ErrorContains(t, err, "scrubbing failed")
+	info, statErr := os.Stat(p.ArtifactPaths()[0])
+	assert.NoError(t, statErr)
+	assert.Zero(t, info.Size())
+}
+
+func TestPostProcessorIgnoresTraces(t *testing.T) {
+	called := false
+	processor := func(p *profile.Profile) (*profile.Profile, error) { called = true; return p, nil }
+	_, err := Capture(context.Background(), time.Millisecond, WithTracing(), WithPostProcessor(processor), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.False(t, called)
+}
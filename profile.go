@@ -1,15 +1,20 @@
 package profiler
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"os/exec"
 	"os/signal"
 	"path/filepath"
-	"runtime"
 	"strings"
-	"sync/atomic"
+	"sync"
 	"syscall"
+	"time"
 )
 
 const (
@@ -17,21 +22,34 @@ const (
 	heapProfileName  = "heap"
 )
 
+// The default file names of each mode, see ModeSpec.
 const (
 	CPUFileName          = "cpu.pprof"
 	MemoryFileName       = "memory.pprof" // Covers heap and alloc
+	HeapFileName         = "heap.pprof"
+	AllocsFileName       = "allocs.pprof"
 	BlockFileName        = "block.pprof"
 	GoroutineFileName    = "goroutine.pprof"
 	MutexFileName        = "mutex.pprof"
 	ThreadCreateFileName = "threadcreate.pprof"
 	TraceFileName        = "trace.out"
 	ClockFileName        = "clock.pprof"
+	SchedLatencyFileName = "schedlatency.pprof"
 )
 
+// ErrAlreadyStarted is returned when a profiling instance is started
+// while another is still active.
+var ErrAlreadyStarted = errors.New("profiler instance has already been started")
+
 // FinalizerFunc is a function that is invokved during the teardown period
 // of the profiling instance.
 type FinalizerFunc func() error
 
+// ErrorHandlerFunc is a function that can be supplied with the
+// WithErrorHandler option to be invoked with each error that occurs
+// while the profiling instance is performing teardown.
+type ErrorHandlerFunc func(err error)
+
 // CallbackFunc is a function that can be supplied with the
 // WithCallback option to be executed when the profiling instance
 // is performing teardown.  It has access to the *Profiler instance.
@@ -50,36 +68,169 @@ const (
 	ThreadCreateMode
 	TraceMode
 	ClockMode
+	MemoryMode
+	SchedLatencyMode
+	AutoMode
 )
 
-// profileActive is used as a flag to determine if a profiling
-// session has begun to manage cases of Start/Stop calls out of
-// order, prevent any human error.
-var profilingActive uint32
+// String returns the name of the mode.
+func (m Mode) String() string {
+	if spec, ok := m.Spec(); ok {
+		return spec.Name
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// ParseMode returns the Mode for the given name, as returned by
+// Mode.String.
+func ParseMode(name string) (Mode, error) {
+	for _, spec := range modeSpecs {
+		if strings.EqualFold(name, spec.Name) {
+			return spec.Mode, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown profiler mode %q", name)
+}
+
+// MemProfileRateScope controls if and for how long the global
+// runtime.MemProfileRate is modified by the memory profilers.
+type MemProfileRateScope int
+
+const (
+	// MemProfileRateSession applies the configured rate for the lifetime
+	// of the profiling session, restoring the previous rate on Stop.
+	MemProfileRateSession MemProfileRateScope = iota
+	// MemProfileRateProcess applies the configured rate and leaves it in
+	// place after Stop, avoiding racing other code that reads or writes
+	// runtime.MemProfileRate during teardown.
+	MemProfileRateProcess
+)
 
 // Profiler encapsulates a profiling instance.
 type Profiler struct {
-	profileFolder     string
-	profileFile       *os.File
-	signalHandling    bool
-	profileMode       Mode
-	memoryProfileRate int
-	quiet             bool
-	callback          CallbackFunc
-	finalizer         FinalizerFunc
-	live              bool
-	interrupted       bool
-	port              int
+	profileFolder       string
+	fallbackFolder      string
+	resolvedFolder      string
+	profileFile         io.WriteCloser
+	artifacts           []string
+	signalHandling      bool
+	exitOnSignal        bool
+	profileMode         Mode
+	autoModes           []Mode
+	memoryProfileRate   int
+	memoryRateScope     MemProfileRateScope
+	quiet               bool
+	callback            CallbackFunc
+	finalizer           FinalizerFunc
+	live                bool
+	interrupted         bool
+	port                int
+	instanceTags        map[string]string
+	uploads             []Sink
+	uploadLimiter       *bandwidthLimiter
+	compression         *Compression
+	maxArtifactSize     int64
+	fsync               bool
+	fs                  FS
+	sizeLimitPolicy     SizeLimitPolicy
+	mu                  sync.Mutex
+	truncated           []string
+	errorHandler        ErrorHandlerFunc
+	auditHandlers       []AuditHandler
+	agentTLS            *tls.Config
+	errs                []error
+	beforeHooks         []BeforeCaptureFunc
+	afterHooks          []AfterCaptureFunc
+	startedAt           time.Time
+	middleware          []StrategyMiddleware
+	enabled             func() bool
+	probability         *float64
+	deduplicator        *deduplicator
+	duplicates          []string
+	throttlingStart     *CPUThrottling
+	throttling          *CPUThrottling
+	environment         Environment
+	labelKey            string
+	labelShares         []LabelShare
+	goroutineBuckets    []GoroutineBucket
+	deadlockDetection   bool
+	deadlocks           []SuspectedDeadlock
+	phaseMu             sync.Mutex
+	phase               string
+	rollover            func(phase string) error
+	phases              []PhaseStat
+	rates               SamplingRates
+	queue               bool
+	warmup              time.Duration
+	profileName         string
+	profilePath         string
+	dryRunOnly          bool
+	serveTraceAddr      string
+	traceServer         *exec.Cmd
+	tees                []Sink
+	postProcessors      []PostProcessor
+	tags                map[string]string
+	overheadBudget      OverheadBudget
+	options             []ProfileOption
+	requestMu           sync.Mutex
+	requests            map[Mode]*pendingCapture
+	outputDir           string
+	datePartitioning    bool
+	partitionedAt       time.Time
+	elapsed             time.Duration
+	artifactStats       []ArtifactStat
+	finalizeConcurrency int
+	finalizeTimeout     time.Duration
+	completed           map[string]bool
+	partial             []string
+	htmlReport          bool
+	summary             bool
+	summaryBaseline     string
+	writeMetadata       bool
+	heapTrigger         bool
+	heapTriggerPercent  float64
+	uploadTimeout       time.Duration
+	eventLog            []EventMetadata
+	events              chan Event
+	shutdownCtx         context.Context
+	startCtx            context.Context
+	ctx                 context.Context
+	cancel              context.CancelFunc
+	goroutines          group
+	stopOnce            sync.Once
+	stopErr             error
+	started             chan struct{}
+	done                chan struct{}
 }
 
+// OutputDirEnv is the environment variable which, when set, replaces the
+// default profile file location of ".", allowing a wrapper such as
+// `profiler run` to collect the artifacts of a child process.  An explicit
+// WithProfileFileLocation takes precedence.
+const OutputDirEnv = "PROFILER_OUTPUT_DIR"
+
 // New returns a new instance of the Profiler.
 func New(options ...ProfileOption) *Profiler {
+	folder := "."
+	if dir := os.Getenv(OutputDirEnv); dir != "" {
+		folder = dir
+		if os.Getenv(WorkerEnv) != "" {
+			folder = workerFolder(dir, os.Getpid())
+		}
+	}
 	p := &Profiler{
-		profileFolder:     ".",
-		signalHandling:    true,
-		memoryProfileRate: runtime.MemProfileRate,
-		port:              8080,
+		profileFolder:  folder,
+		signalHandling: true,
+		exitOnSignal:   true,
+		port:           8080,
+		started:        make(chan struct{}),
+		events:         make(chan Event, eventBufferSize),
+		done:           make(chan struct{}),
+		options:        options,
+		fs:             OSFS{},
+		uploadTimeout:  defaultUploadTimeout,
 	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
 	for _, opt := range options {
 		opt(p)
 	}
@@ -89,49 +240,333 @@ func New(options ...ProfileOption) *Profiler {
 // Stop stops the profiling instance.
 // If no profiling instance is active, this function
 // will cause an exit.
+// Stop is idempotent per instance, subsequent calls after
+// the first (for example a deferred Stop after signal
+// handling has already torn down) are a no-op.
+// Stop is safe to call concurrently with the signal handler,
+// the first caller performs the teardown and any other callers
+// block until it has completed.
 func (p *Profiler) Stop() {
-	if !atomic.CompareAndSwapUint32(&profilingActive, 1, 0) {
-		die("profiler instance was not started")
+	p.fatal(p.stop(false))
+}
+
+// stop performs the teardown exactly once for the instance.
+// interrupted is only recorded by the caller that wins the race
+// to avoid unsynchronised writes from the signal handler.
+// Every caller observes the error of the teardown.
+func (p *Profiler) stop(interrupted bool) error {
+	p.stopOnce.Do(func() {
+		defer p.cancel()
+		defer close(p.done)
+		defer close(p.events)
+		p.interrupted = interrupted
+		if interrupted {
+			p.emit(EventInterrupted, nil, nil)
+		}
+		p.stopErr = p.teardown()
+		p.emit(EventStopped, p.ArtifactPaths(), p.stopErr)
+	})
+	return p.stopErr
+}
+
+// teardown finalizes the profile and reports the results.
+func (p *Profiler) teardown() error {
+	if !session.owns(p) {
+		return errors.New("profiler instance was not started")
 	}
-	if err := p.finalizer(); err != nil {
-		die(err.Error())
+	// A failure (panic or timeout) to finalize does not prevent the
+	// remainder of the teardown, any artifacts written are still uploaded
+	// and reported.
+	err := p.finalize()
+	if err != nil {
+		p.recordError(err)
 	}
+	p.elapsed = time.Since(p.startedAt)
+	p.recordThrottling()
+	p.afterCapture(err)
+	p.deduplicate()
+	p.classifyGoroutines()
+	p.reportDeadlocks()
+	p.reportPhases()
+	p.breakdownLabels()
+	p.htmlReports()
+	p.markdownSummary()
+	p.metadataFile()
+	p.upload(context.Background())
+	p.recordStats()
 	if p.callback != nil {
-		p.callback(p)
+		if err := guard("callback", func() error { p.callback(p); return nil }); err != nil {
+			p.recordError(err)
+		}
 	}
 
-	absPath, err := filepath.Abs(p.profileFile.Name())
-	if err != nil {
-		die(err.Error())
-	}
 	// Handle reporting data for improved user experience when not running
 	// in a suppressed mode.
-	extension := filepath.Ext(absPath)
-	wasTrace := strings.HasSuffix(absPath, ".out")
-	cmd := fmt.Sprintf("go tool pprof -http :%d", p.port)
-	if wasTrace {
-		cmd = "go tool trace"
-	}
-	p.report("profiling completed.  You can find the %s file at %s", extension, absPath)
-	p.report("to view the profile, run `%s %s`", cmd, absPath)
+	wasTrace := false
+	for _, path := range p.artifacts {
+		uncompressed := path
+		if p.compression != nil {
+			uncompressed = strings.TrimSuffix(path, p.compression.Extension)
+		}
+		extension := filepath.Ext(uncompressed)
+		cmd := fmt.Sprintf("go tool pprof -http :%d", p.port)
+		if strings.HasSuffix(uncompressed, ".out") {
+			cmd = "go tool trace"
+			wasTrace = true
+		}
+		if stat, ok := p.artifactStat(path); ok {
+			p.report("profiling completed in %s.  You can find the %s file at %s (%s)", p.elapsed.Round(time.Millisecond), extension, path, stat)
+		} else {
+			p.report("profiling completed in %s.  You can find the %s file at %s", p.elapsed.Round(time.Millisecond), extension, path)
+		}
+		if uncompressed != path {
+			p.report("the file is compressed, decompress it to %s before viewing", uncompressed)
+			path = uncompressed
+		}
+		p.report("to view the profile, run `%s %s`", cmd, path)
+	}
 	if p.interrupted {
 		p.report("[warning] profiling was interrupted, data may be incomplete")
 	}
+	for _, path := range p.TruncatedArtifacts() {
+		p.report("[warning] %s exceeded the maximum size of %d bytes and was truncated", path, p.maxArtifactSize)
+	}
 	if !wasTrace {
 		p.report("port can be any ephemeral port you wish to use.")
 		p.report("Graph interpretation is outlined here: https://github.com/google/pprof/blob/main/doc/README.md#graphical-reports")
 	}
+	p.serveTrace()
+	return err
 }
 
 // SetProfileFile sets the profile file for the profiler instance.
 // not to be confused with the folder location provided by the functional
 // options.
+//
+// Deprecated: SetProfileFile exits the process on error, use SetOutput.
 func (p *Profiler) SetProfileFile(name string) {
-	profileFile, err := CreateProfileFile(p.profileFolder, name)
-	if err != nil {
+	if err := p.redirectable(); err != nil {
+		die(err.Error())
+	}
+	if err := p.openProfileFile(name); err != nil {
 		die(err.Error())
 	}
-	p.profileFile = profileFile
+}
+
+// SetOutput redirects the profile of the active capture to sink, rather
+// than the profile file location.  The local file opened for the profile
+// is closed and removed, it is no longer an artifact of the session.
+// Profilers which write as they start (cpu, trace, clock, mutex and
+// goroutine) have already bound their output, an error is returned for
+// them, as it is for strategies which write more than a single profile.
+// The profile is compressed, size limited and post processed as the file
+// would have been.
+func (p *Profiler) SetOutput(sink Sink) error {
+	if sink == nil {
+		return errors.New("output sink must not be nil")
+	}
+	if err := p.redirectable(); err != nil {
+		return err
+	}
+	name := p.profileName
+	compressed := p.compression != nil && compressible(name)
+	if compressed {
+		name += p.compression.Extension
+	}
+	w, err := sink.Create(p.sinkContext(context.Background()), name)
+	if err != nil {
+		return err
+	}
+	wrapped, err := p.wrapArtifact(w, name, name, compressed)
+	if err != nil {
+		return errors.Join(err, w.Close())
+	}
+	return p.rotateProfileFile(wrapped, "")
+}
+
+// redirectable returns an error if the profile of the active capture
+// cannot be redirected, as there is none or it is already being written.
+func (p *Profiler) redirectable() error {
+	p.mu.Lock()
+	bound := p.profileFile != nil
+	p.mu.Unlock()
+	if !bound {
+		return errors.New("the profiler has no profile file to redirect")
+	}
+	mode := p.Mode()
+	if spec, _ := mode.Spec(); !spec.CaptureAtStop {
+		return fmt.Errorf("the %s profiler has already bound its output", mode)
+	}
+	return nil
+}
+
+// openProfileFile creates the named profile file and sets it as the
+// profile file for the profiler instance, rotating any profile file
+// previously opened.
+func (p *Profiler) openProfileFile(name string) error {
+	profileFile, err := p.createArtifact(name)
+	if err != nil {
+		return err
+	}
+	p.profileName = name
+	paths := p.ArtifactPaths()
+	return p.rotateProfileFile(profileFile, paths[len(paths)-1])
+}
+
+// rotateProfileFile sets w as the profile file, closing and discarding
+// the previous profile file.  path is the artifact w writes to, empty
+// if it is not a local file.
+func (p *Profiler) rotateProfileFile(w io.WriteCloser, path string) error {
+	p.mu.Lock()
+	previous, previousPath := p.profileFile, p.profilePath
+	p.profileFile, p.profilePath = w, path
+	if previous != nil && previousPath != "" {
+		for i, artifact := range p.artifacts {
+			if artifact == previousPath {
+				p.artifacts = append(p.artifacts[:i], p.artifacts[i+1:]...)
+				break
+			}
+		}
+	}
+	p.mu.Unlock()
+	if previous == nil {
+		return nil
+	}
+	err := previous.Close()
+	if previousPath != "" {
+		err = errors.Join(err, p.fs.Remove(previousPath))
+	}
+	return err
+}
+
+// createArtifact creates a named profile file in the resolved output
+// folder and records it as an artifact of the profiler instance.
+// Strategies which write more than a single file use this directly.
+// When compression is enabled, artifacts which benefit from it are
+// compressed as they are written.
+func (p *Profiler) createArtifact(name string) (io.WriteCloser, error) {
+	target := p.outputFolder()
+	folder, err := resolveFolder(p.fs, target, p.fallbackFolder)
+	if err != nil {
+		return nil, err
+	}
+	if folder != target {
+		p.report("unable to use %s, falling back to %s", target, folder)
+	}
+	compressed := p.compression != nil && compressible(name)
+	if compressed {
+		name += p.compression.Extension
+	}
+	file, err := createFile(p.fs, folder, name)
+	if err != nil {
+		return nil, err
+	}
+	path := file.Name()
+	if _, ok := p.fs.(OSFS); ok {
+		// Paths of other filesystems are not relative to the working dir.
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+	p.mu.Lock()
+	p.resolvedFolder = folder
+	p.mu.Unlock()
+	p.addArtifact(path)
+	var w io.WriteCloser = file
+	if p.fsync {
+		w = syncFile{file}
+	}
+	w, err = p.wrapArtifact(p.tee(w, name), name, path, compressed)
+	if err != nil {
+		return nil, err
+	}
+	return &completedArtifact{w, func() { p.markCompleted(path) }}, nil
+}
+
+// wrapArtifact applies the size limit, compression and post processing of
+// the session to w, which writes the artifact name at path.
+func (p *Profiler) wrapArtifact(w io.WriteCloser, name string, path string, compressed bool) (io.WriteCloser, error) {
+	if p.maxArtifactSize > 0 {
+		w = p.limit(w, path)
+	}
+	if compressed {
+		var err error
+		if w, err = compress(w, *p.compression); err != nil {
+			return nil, err
+		}
+	}
+	return p.postProcess(w, name), nil
+}
+
+// outputFolder returns the folder artifacts are written to, partitioned
+// by the date the session started when WithDatePartitioning is provided,
+// so that a session crossing midnight is not split across folders.
+func (p *Profiler) outputFolder() string {
+	if p.datePartitioning {
+		at := p.partitionedAt
+		if at.IsZero() {
+			at = time.Now()
+		}
+		return datePartition(p.profileFolder, at)
+	}
+	return p.profileFolder
+}
+
+// ArtifactPaths returns the absolute paths of every profile file
+// written by the profiler instance.  This is typically useful from
+// within a CallbackFunc to persist the profiles elsewhere.
+func (p *Profiler) ArtifactPaths() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.artifactPaths()
+}
+
+// artifactPaths returns a copy of the artifacts, p.mu must be held.
+func (p *Profiler) artifactPaths() []string {
+	paths := make([]string, len(p.artifacts))
+	copy(paths, p.artifacts)
+	return paths
+}
+
+// addArtifact records path as an artifact of the profiler instance.
+// Strategies started after a delay add artifacts while the session is
+// reported on concurrently.
+func (p *Profiler) addArtifact(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.artifacts = append(p.artifacts, path)
+}
+
+// OutputDir returns the folder profile files are written to.  This
+// is the resolved folder, which may differ from the location provided
+// by WithProfileFileLocation if the fallback folder had to be used.
+func (p *Profiler) OutputDir() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.currentOutputDir()
+}
+
+// currentOutputDir is OutputDir, p.mu must be held.
+func (p *Profiler) currentOutputDir() string {
+	if p.resolvedFolder != "" {
+		return p.resolvedFolder
+	}
+	return p.profileFolder
+}
+
+// Mode returns the profiling mode of the profiler instance.
+func (p *Profiler) Mode() Mode {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.profileMode
+}
+
+// setMode changes the mode of a running session, such as once auto mode
+// has selected the profiler to delegate to.
+func (p *Profiler) setMode(mode Mode) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.profileMode = mode
 }
 
 // report writes a formatted log statement to stderr.
@@ -153,38 +588,140 @@ func (p *Profiler) report(format string, args ...any) {
 // example is wise, this should be used with the option:
 // WithNoSignalShutdownHandling.
 func Start(options ...ProfileOption) *Profiler {
+	if p := New(options...); p.dryRunOnly {
+		if err := p.dryRun(); err != nil {
+			p.recordError(err)
+			p.fatal(err)
+		}
+		return p.inert()
+	} else if !p.sampled() {
+		p.report("profiling skipped, this process was not sampled (probability %v)", *p.probability)
+		return p.inert()
+	}
+	p, err := start(options...)
+	if err != nil {
+		die(err.Error())
+	}
 
-	// Ensure that StartProfiling is not invoked multiple times
-	if !atomic.CompareAndSwapUint32(&profilingActive, 0, 1) {
-		die("profiler instance has already been started")
+	// Register an asynchronous sig term handler if the user
+	// has not opted to take full control of exit handling
+	// themselves.
+	// A shutdown context takes precedence, participating in the
+	// applications own shutdown orchestration.
+	switch {
+	case p.shutdownCtx != nil:
+		p.goroutines.start(internal(func() error {
+			select {
+			case <-p.shutdownCtx.Done():
+				p.report("shutdown context done, performing tear down")
+				p.fatal(p.stop(true))
+			case <-p.done:
+			}
+			return nil
+		}), nil)
+	case p.signalHandling:
+		ch := make(chan os.Signal, 1)
+		signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+		p.goroutines.start(internal(func() error {
+			// Restore default behaviour for subsequent signals, any
+			// handlers registered by the application still receive them.
+			defer signal.Stop(ch)
+			select {
+			case <-ch:
+				p.report("sigterm received, performing tear down")
+				p.fatal(p.stop(true))
+				if p.exitOnSignal {
+					os.Exit(0)
+				}
+			case <-p.done:
+			}
+			return nil
+		}), nil)
 	}
+	return p
+}
+
+// inert leaves the process untouched, the profiler is stopped without
+// having started so that Stop is a no-op.
+func (p *Profiler) inert() *Profiler {
+	p.stopOnce.Do(func() {
+		close(p.events)
+		close(p.done)
+		p.cancel()
+	})
+	return p
+}
 
+// start begins a new profiling instance without installing any
+// shutdown handling, returning an error rather than exiting.
+func start(options ...ProfileOption) (*Profiler, error) {
+	return startContext(context.Background(), options...)
+}
+
+// startContext is start, waiting until ctx is done at most for the
+// active session to finish when queueing.
+func startContext(ctx context.Context, options ...ProfileOption) (*Profiler, error) {
 	p := New(options...)
+	p.startCtx = ctx
+	if p.heapTrigger {
+		return nil, errors.New("WithHeapTriggerPercent only applies to the Options of a Trigger")
+	}
+	// Ensure that only a single session is active at a time.
+	if err := session.acquire(ctx, p); err != nil {
+		return nil, err
+	}
+	// Strategies may write (and therefore stop) before they return.
+	defer close(p.started)
 	profileFunc, ok := StrategyMap[p.profileMode]
 	if !ok {
-		die("profiler mode not implemented, this should never happen")
+		session.release(p)
+		return nil, fmt.Errorf("profiler mode %d not implemented", p.profileMode)
 	}
-	finalizer, err := profileFunc(p)
+	p.emit(EventStarted, nil, nil)
+	strategy := chainStrategy(profileFunc, p.middleware)
+	capture := func(p *Profiler) (FinalizerFunc, error) {
+		p.beforeCapture()
+		p.recordEnvironment()
+		throttling, ok := readCPUThrottling()
+		p.mu.Lock()
+		if ok {
+			p.throttlingStart = &throttling
+		}
+		p.startedAt = time.Now()
+		p.mu.Unlock()
+		restore := p.applySamplingRates()
+		finalizer, err := strategy(p)
+		if err != nil {
+			restore()
+			return nil, err
+		}
+		return func() error {
+			defer restore()
+			return finalizer()
+		}, nil
+	}
+	p.startedAt = time.Now()
+	p.partitionedAt = p.startedAt
+	if p.warmup > 0 {
+		capture = warmupStrategy(capture)
+	}
+	finalizer, err := capture(p)
 	if err != nil {
-		die(err.Error())
+		session.release(p)
+		p.afterCapture(err)
+		return nil, err
 	}
 	p.finalizer = finalizer
+	return p, nil
+}
 
-	// Register an asynchronous sig term handler if the user
-	// has not opted to take full control of exit handling
-	// themselves.
-	if p.signalHandling {
-		go func() {
-			ch := make(chan os.Signal, 1)
-			signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
-			<-ch
-			p.report("sigterm received, performing tear down")
-			p.interrupted = true
-			p.Stop()
-			os.Exit(0)
-		}()
+// fatal causes the profiler instance to die with err unless an error
+// handler has been provided, in which case it has already been handed
+// the error.
+func (p *Profiler) fatal(err error) {
+	if err != nil && p.errorHandler == nil {
+		die(err.Error())
 	}
-	return p
 }
 
 // die causes the profiler instance to die with a message.
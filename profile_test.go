@@ -2,14 +2,23 @@ package profiler
 
 import (
 	"bytes"
+	"context"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"runtime/trace"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/google/pprof/profile"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // CheckFunc encapsulates the file descriptor and exit code
@@ -41,7 +50,7 @@ func main() {
 				exitedZero,
 				emptyStdOut,
 				stdErrOutMatchLines(
-					".*profiling completed.  You can find the .*cpu.pprof.*",
+					".*profiling completed in .*s.  You can find the .*cpu.pprof \\(.*B, [0-9]+ samples\\)",
 					".*to view the profile, run.*cpu.pprof",
 					"port can be any ephemeral port you wish to use",
 					"Graph interpretation is outlined here.*graphical-reports",
@@ -120,6 +129,123 @@ require github.com/symonk/profiler v0.0.0-20241021143805-788e1dbe92a9
 	}
 }
 
+func TestCallbackArtifactAccessors(t *testing.T) {
+	storage := t.TempDir()
+	var paths []string
+	var dir string
+	var mode Mode
+	Start(
+		WithHeapProfiler(),
+		WithProfileFileLocation(storage),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+		WithCallback(func(p *Profiler) {
+			paths = p.ArtifactPaths()
+			dir = p.OutputDir()
+			mode = p.Mode()
+		}),
+	).Stop()
+	assert.Equal(t, []string{filepath.Join(storage, MemoryFileName)}, paths)
+	assert.Equal(t, storage, dir)
+	assert.Equal(t, MemoryHeapMode, mode)
+	assert.FileExists(t, paths[0])
+}
+
+func TestStopIsIdempotent(t *testing.T) {
+	p := Start(WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput())
+	assert.NoError(t, p.stop(false))
+	stopped := 0
+	for event := range p.Events() {
+		if event.Type == EventStopped {
+			stopped++
+		}
+	}
+	assert.NoError(t, p.stop(false))
+	assert.Equal(t, 1, stopped)
+	_, open := <-p.Events()
+	assert.False(t, open, "the second stop emitted an event")
+}
+
+func TestConcurrentStopTearsDownOnce(t *testing.T) {
+	var calls int32
+	p := Start(
+		WithProfileFileLocation(t.TempDir()),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+		WithCallback(func(*Profiler) { atomic.AddInt32(&calls, 1) }),
+	)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(interrupted bool) {
+			defer wg.Done()
+			p.stop(interrupted)
+		}(i%2 == 0)
+	}
+	wg.Wait()
+	assert.Equal(t, int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestShutdownContextTearsDown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan bool, 1)
+	p := Start(
+		WithProfileFileLocation(t.TempDir()),
+		WithQuietOutput(),
+		WithShutdownContext(ctx),
+		WithCallback(func(p *Profiler) { stopped <- p.interrupted }),
+	)
+	cancel()
+	assert.True(t, <-stopped)
+	p.Stop()
+}
+
+func TestMemoryProfilingRateScope(t *testing.T) {
+	original := runtime.MemProfileRate
+	defer func() { runtime.MemProfileRate = original }()
+
+	Start(WithHeapProfiler(), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput()).Stop()
+	assert.Equal(t, original, runtime.MemProfileRate)
+
+	Start(WithHeapProfiler(), WithMemoryProfilingRate(1), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput()).Stop()
+	assert.Equal(t, original, runtime.MemProfileRate)
+
+	Start(WithHeapProfiler(), WithMemoryProfilingRate(1), WithMemProfileRateScope(MemProfileRateProcess), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput()).Stop()
+	assert.Equal(t, 1, runtime.MemProfileRate)
+}
+
+func TestMemoryProfilerWritesHeapAndAllocs(t *testing.T) {
+	storage := t.TempDir()
+	p := Start(WithMemoryProfiler(), WithProfileFileLocation(storage), WithoutSignalHandling(), WithQuietOutput())
+	p.Stop()
+	assert.Equal(t, []string{filepath.Join(storage, HeapFileName), filepath.Join(storage, AllocsFileName)}, p.ArtifactPaths())
+	for _, path := range p.ArtifactPaths() {
+		info, err := os.Stat(path)
+		assert.NoError(t, err)
+		assert.NotZero(t, info.Size())
+	}
+}
+
+func TestTraceIsClosedAndSynced(t *testing.T) {
+	p, err := Capture(context.Background(), 10*time.Millisecond, WithTracing(), WithFsyncOnClose(), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.NoError(t, err)
+	// Closing an already closed file fails, proving the finalizer closed it.
+	assert.ErrorIs(t, p.profileFile.Close(), os.ErrClosed)
+	info, err := os.Stat(p.ArtifactPaths()[0])
+	assert.NoError(t, err)
+	assert.NotZero(t, info.Size())
+}
+
+func TestTraceIsClosedWhenItCannotStart(t *testing.T) {
+	// The runtime only permits a single trace at a time.
+	require.NoError(t, trace.Start(io.Discard))
+	defer trace.Stop()
+	p := New(WithTracing(), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	_, err := traceStrategyFn(p)
+	assert.Error(t, err)
+	assert.ErrorIs(t, p.profileFile.Close(), os.ErrClosed)
+}
+
 func TestWithCustomPort(t *testing.T) {
 	t.Skip("not implemented yet")
 }
@@ -167,3 +293,60 @@ func patternMatchLines(t *testing.T, input string, patterns ...string) bool {
 func emptyStdOut(t *testing.T, stdout, _ string, _ int) {
 	assert.Empty(t, stdout)
 }
+
+func TestSetOutputRedirectsProfile(t *testing.T) {
+	dir := t.TempDir()
+	p, err := start(WithHeapProfiler(), WithProfileFileLocation(dir), WithoutSignalHandling(), WithQuietOutput())
+	assert.NoError(t, err)
+	sink := memorySink{}
+	assert.NoError(t, p.SetOutput(sink))
+	assert.NoError(t, p.stop(false))
+
+	assert.Empty(t, p.ArtifactPaths())
+	_, err = os.Stat(filepath.Join(dir, MemoryFileName))
+	assert.True(t, os.IsNotExist(err))
+	assert.Positive(t, sink[MemoryFileName].Len())
+}
+
+func TestSetOutputPostProcessesProfile(t *testing.T) {
+	comment := func(prof *profile.Profile) (*profile.Profile, error) {
+		prof.Comments = append(prof.Comments, "redirected")
+		return prof, nil
+	}
+	p, err := start(WithHeapProfiler(), WithProfileFileLocation(t.TempDir()), WithPostProcessor(comment), WithoutSignalHandling(), WithQuietOutput())
+	assert.NoError(t, err)
+	sink := memorySink{}
+	assert.NoError(t, p.SetOutput(sink))
+	assert.NoError(t, p.stop(false))
+
+	prof, err := profile.Parse(sink[MemoryFileName])
+	if assert.NoError(t, err) {
+		assert.Contains(t, prof.Comments, "redirected")
+	}
+}
+
+func TestSetOutputRejectsBoundModes(t *testing.T) {
+	p, err := start(WithCPUProfiler(), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput())
+	assert.NoError(t, err)
+	defer p.stop(false)
+	assert.ErrorContains(t, p.SetOutput(memorySink{}), "already bound")
+	assert.Error(t, p.SetOutput(nil))
+}
+
+func TestSetProfileFileRotates(t *testing.T) {
+	dir := t.TempDir()
+	p, err := start(WithHeapProfiler(), WithProfileFileLocation(dir), WithoutSignalHandling(), WithQuietOutput())
+	assert.NoError(t, err)
+	p.SetProfileFile("renamed.pprof")
+	assert.NoError(t, p.stop(false))
+	assert.Equal(t, []string{filepath.Join(dir, "renamed.pprof")}, p.ArtifactPaths())
+	_, err = os.Stat(filepath.Join(dir, MemoryFileName))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestOutputDirEnvReplacesDefaultLocation(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(OutputDirEnv, dir)
+	assert.Equal(t, dir, New().profileFolder)
+	assert.Equal(t, "explicit", New(WithProfileFileLocation("explicit")).profileFolder)
+}
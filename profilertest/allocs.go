@@ -0,0 +1,63 @@
+package profilertest
+
+import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// AssertMaxAllocs runs fn and fails the test if it allocated more than
+// maxBytes or maxObjects.  Unlike testing.AllocsPerRun the allocations
+// are read from the alloc profile, sampling every allocation, so that
+// only allocations made beneath fn are counted and the failure message
+// attributes them to the stacks responsible, showing exactly where new
+// allocations came from.  runtime.MemProfileRate is set to one while fn
+// runs, which is expensive, fn should be a small unit of work.
+func AssertMaxAllocs(t testing.TB, fn func(), maxBytes int64, maxObjects int64) bool {
+	t.Helper()
+	previousRate := runtime.MemProfileRate
+	runtime.MemProfileRate = 1
+	defer func() { runtime.MemProfileRate = previousRate }()
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	// The alloc profile is only as up to date as the most recently
+	// completed garbage collection.
+	runtime.GC()
+	before, err := lookup("allocs")
+	if err != nil {
+		t.Errorf("failed to read the allocs profile: %v", err)
+		return false
+	}
+	fn()
+	runtime.GC()
+	after, err := lookup("allocs")
+	if err != nil {
+		t.Errorf("failed to read the allocs profile: %v", err)
+		return false
+	}
+	diff, err := delta(before, after)
+	if err != nil {
+		t.Errorf("failed to diff the allocs profile: %v", err)
+		return false
+	}
+	objectsIndex, err := sampleIndex(diff, "alloc_objects")
+	if err != nil {
+		t.Errorf("invalid allocs profile: %v", err)
+		return false
+	}
+	bytesIndex, err := sampleIndex(diff, "alloc_space")
+	if err != nil {
+		t.Errorf("invalid allocs profile: %v", err)
+		return false
+	}
+	match := anyFrame(func(frame string) bool { return frame == name })
+	objects, _ := attribute(diff, objectsIndex, match)
+	bytes, stacks := attribute(diff, bytesIndex, match)
+	if bytes <= maxBytes && objects <= maxObjects {
+		return true
+	}
+	t.Errorf("%s allocated %d bytes in %d objects, exceeding the maximum of %d bytes in %d objects, the largest allocating stacks were:\n%s", name, bytes, objects, maxBytes, maxObjects, formatStacks(stacks, func(v int64) string {
+		return fmt.Sprintf("%d bytes", v)
+	}))
+	return false
+}
@@ -0,0 +1,30 @@
+package profilertest
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var sink []byte
+
+func allocate() {
+	for i := 0; i < 10; i++ {
+		sink = make([]byte, 1024)
+	}
+}
+
+func TestAssertMaxAllocsFails(t *testing.T) {
+	r := &recordingT{TB: t}
+	assert.False(t, AssertMaxAllocs(r, allocate, 1024, 100))
+	assert.Len(t, r.failures, 1)
+	assert.Contains(t, r.failures[0], "allocated 10240 bytes in 10 objects")
+	assert.Contains(t, r.failures[0], "profilertest.allocate")
+}
+
+func TestAssertMaxAllocsPasses(t *testing.T) {
+	r := &recordingT{TB: t}
+	assert.True(t, AssertMaxAllocs(r, allocate, 10240, 10))
+	assert.True(t, AssertMaxAllocs(r, func() {}, 0, 0))
+	assert.Empty(t, r.failures)
+}
@@ -0,0 +1,70 @@
+package profilertest
+
+import (
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// contentionProfiles are the runtime profiles recording contention.
+var contentionProfiles = []string{"mutex", "block"}
+
+// AssertMaxContention runs fn under mutex and block profiling and fails
+// the test if the time goroutines spent contended, blocked on a mutex or
+// channel, within fn exceeds max.  Only contention in stacks including a
+// function of one of the packages (import paths) is counted, all
+// contention is counted when none are given.  The most contended stacks
+// are included in the failure message, turning contention regressions in
+// hot paths into CI failures.  The block profile rate is reset to zero
+// once fn returns.
+func AssertMaxContention(t testing.TB, fn func(), max time.Duration, packages ...string) bool {
+	t.Helper()
+	previousFraction := runtime.SetMutexProfileFraction(1)
+	runtime.SetBlockProfileRate(1)
+	defer func() {
+		runtime.SetMutexProfileFraction(previousFraction)
+		runtime.SetBlockProfileRate(0)
+	}()
+	before := make(map[string]*profile.Profile, len(contentionProfiles))
+	for _, name := range contentionProfiles {
+		p, err := lookup(name)
+		if err != nil {
+			t.Errorf("failed to read the %s profile: %v", name, err)
+			return false
+		}
+		before[name] = p
+	}
+	fn()
+
+	var total int64
+	var stacks []stack
+	for _, name := range contentionProfiles {
+		after, err := lookup(name)
+		if err != nil {
+			t.Errorf("failed to read the %s profile: %v", name, err)
+			return false
+		}
+		diff, err := delta(before[name], after)
+		if err != nil {
+			t.Errorf("failed to diff the %s profile: %v", name, err)
+			return false
+		}
+		index, err := sampleIndex(diff, "delay")
+		if err != nil {
+			t.Errorf("invalid %s profile: %v", name, err)
+			return false
+		}
+		subtotal, s := attribute(diff, index, inPackages(packages))
+		total += subtotal
+		stacks = append(stacks, s...)
+	}
+	if time.Duration(total) <= max {
+		return true
+	}
+	t.Errorf("contention of %s exceeded the maximum of %s, the most contended stacks were:\n%s", time.Duration(total), max, formatStacks(stacks, func(v int64) string {
+		return time.Duration(v).String()
+	}))
+	return false
+}
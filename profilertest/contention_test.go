@@ -0,0 +1,57 @@
+package profilertest
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// recordingT records failures rather than failing the test.
+type recordingT struct {
+	testing.TB
+	failures []string
+}
+
+func (r *recordingT) Helper() {}
+
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.failures = append(r.failures, fmt.Sprintf(format, args...))
+}
+
+func contend() {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			mu.Lock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestAssertMaxContentionFails(t *testing.T) {
+	r := &recordingT{TB: t}
+	assert.False(t, AssertMaxContention(r, contend, time.Millisecond, "github.com/symonk/profiler/profilertest"))
+	assert.Len(t, r.failures, 1)
+	assert.Contains(t, r.failures[0], "exceeded the maximum of 1ms")
+	assert.Contains(t, r.failures[0], "profilertest.contend")
+}
+
+func TestAssertMaxContentionIgnoresOtherPackages(t *testing.T) {
+	r := &recordingT{TB: t}
+	assert.True(t, AssertMaxContention(r, contend, time.Millisecond, "example.com/elsewhere"))
+	assert.Empty(t, r.failures)
+}
+
+func TestAssertMaxContentionPasses(t *testing.T) {
+	r := &recordingT{TB: t}
+	assert.True(t, AssertMaxContention(r, func() {}, time.Second))
+	assert.Empty(t, r.failures)
+}
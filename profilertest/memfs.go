@@ -0,0 +1,237 @@
+package profilertest
+
+import (
+	"bytes"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/symonk/profiler"
+)
+
+// MemFS is an in memory profiler.FS, so that tests can exercise how
+// artifacts are written, post processed and removed without touching
+// the real filesystem:
+//
+//	fsys := profilertest.NewMemFS()
+//	p, err := profiler.Capture(ctx, time.Second, profiler.WithFS(fsys))
+//
+// Files are readable once they have been closed.  It is safe for
+// concurrent use.
+type MemFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	dirs  map[string]bool
+	// CreateErr, if set, is returned by every Create, simulating a full
+	// or read-only filesystem.
+	CreateErr error
+}
+
+// NewMemFS returns an empty MemFS.
+func NewMemFS() *MemFS {
+	return &MemFS{files: make(map[string][]byte), dirs: map[string]bool{".": true}}
+}
+
+// ReadFile returns the contents of the named file.
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	data, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "read", Path: name, Err: fs.ErrNotExist}
+	}
+	return bytes.Clone(data), nil
+}
+
+// Paths returns the paths of every file, sorted.
+func (m *MemFS) Paths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	paths := make([]string, 0, len(m.files))
+	for path := range m.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Open opens the named file for reading.
+func (m *MemFS) Open(name string) (fs.File, error) {
+	data, err := m.ReadFile(name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return &memFile{name: filepath.Clean(name), Reader: bytes.NewReader(data), size: int64(len(data))}, nil
+}
+
+// Create creates or truncates the named file, its folder must exist.
+func (m *MemFS) Create(name string) (profiler.File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.CreateErr != nil {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: m.CreateErr}
+	}
+	name = filepath.Clean(name)
+	if !m.dirs[filepath.Dir(name)] {
+		return nil, &fs.PathError{Op: "create", Path: name, Err: fs.ErrNotExist}
+	}
+	m.files[name] = nil
+	return &memWriter{fs: m, name: name}, nil
+}
+
+// Stat describes the named file or folder.
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if data, ok := m.files[name]; ok {
+		return memInfo{name: filepath.Base(name), size: int64(len(data))}, nil
+	}
+	if m.dirs[name] {
+		return memInfo{name: filepath.Base(name), dir: true}, nil
+	}
+	return nil, &fs.PathError{Op: "stat", Path: name, Err: fs.ErrNotExist}
+}
+
+// MkdirAll creates the folder path along with any missing parents.
+func (m *MemFS) MkdirAll(path string, _ fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for path = filepath.Clean(path); !m.dirs[path]; path = filepath.Dir(path) {
+		if _, ok := m.files[path]; ok {
+			return &fs.PathError{Op: "mkdir", Path: path, Err: fs.ErrExist}
+		}
+		m.dirs[path] = true
+	}
+	return nil
+}
+
+// Remove removes the named file or empty folder.
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if _, ok := m.files[name]; ok {
+		delete(m.files, name)
+		return nil
+	}
+	if !m.dirs[name] {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	prefix := name + string(filepath.Separator)
+	for path := range m.files {
+		if strings.HasPrefix(path, prefix) {
+			return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrExist}
+		}
+	}
+	delete(m.dirs, name)
+	return nil
+}
+
+// Rename renames the file from to to, replacing to if it exists.
+func (m *MemFS) Rename(from string, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	from, to = filepath.Clean(from), filepath.Clean(to)
+	data, ok := m.files[from]
+	if !ok {
+		return &fs.PathError{Op: "rename", Path: from, Err: fs.ErrNotExist}
+	}
+	if !m.dirs[filepath.Dir(to)] {
+		return &fs.PathError{Op: "rename", Path: to, Err: fs.ErrNotExist}
+	}
+	delete(m.files, from)
+	m.files[to] = data
+	return nil
+}
+
+// ReadDir returns the files and folders directly within the named folder,
+// sorted by name.
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = filepath.Clean(name)
+	if !m.dirs[name] {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	var entries []fs.DirEntry
+	for path, data := range m.files {
+		if filepath.Dir(path) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memInfo{name: filepath.Base(path), size: int64(len(data))}))
+		}
+	}
+	for path := range m.dirs {
+		if path != name && filepath.Dir(path) == name {
+			entries = append(entries, fs.FileInfoToDirEntry(memInfo{name: filepath.Base(path), dir: true}))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+// memWriter is a file of a MemFS being written, its contents are stored
+// as it is closed.
+type memWriter struct {
+	fs   *MemFS
+	name string
+	buf  bytes.Buffer
+}
+
+// Write buffers p.
+func (w *memWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+// Close stores the contents written.
+func (w *memWriter) Close() error {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+	w.fs.files[w.name] = w.buf.Bytes()
+	return nil
+}
+
+// Name returns the path of the file.
+func (w *memWriter) Name() string {
+	return w.name
+}
+
+// memFile is a file of a MemFS open for reading.
+type memFile struct {
+	*bytes.Reader
+	name string
+	size int64
+}
+
+// Stat describes the file.
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	return memInfo{name: filepath.Base(f.name), size: f.size}, nil
+}
+
+// Close does nothing.
+func (f *memFile) Close() error {
+	return nil
+}
+
+// memInfo describes a file or folder of a MemFS.
+type memInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) ModTime() time.Time { return time.Time{} }
+func (i memInfo) IsDir() bool        { return i.dir }
+func (i memInfo) Sys() any           { return nil }
+
+// Mode returns the mode of the file or folder.
+func (i memInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0777
+	}
+	return 0666
+}
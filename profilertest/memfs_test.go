@@ -0,0 +1,123 @@
+package profilertest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/symonk/profiler"
+)
+
+func TestMemFS(t *testing.T) {
+	fsys := NewMemFS()
+	_, err := fsys.Create("missing/a.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	require.NoError(t, fsys.MkdirAll("out/nested", 0777))
+	f, err := fsys.Create("out/nested/a.txt")
+	require.NoError(t, err)
+	_, _ = io.WriteString(f, "hello")
+	require.NoError(t, f.Close())
+	assert.Equal(t, filepath.Join("out", "nested", "a.txt"), f.Name())
+
+	info, err := fsys.Stat("out/nested/a.txt")
+	require.NoError(t, err)
+	assert.EqualValues(t, 5, info.Size())
+	r, err := fsys.Open("out/nested/a.txt")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(r)
+	assert.Equal(t, "hello", string(data))
+
+	entries, err := fsys.ReadDir("out")
+	require.NoError(t, err)
+	if assert.Len(t, entries, 1) {
+		assert.Equal(t, "nested", entries[0].Name())
+		assert.True(t, entries[0].IsDir())
+	}
+	require.NoError(t, fsys.Rename("out/nested/a.txt", "out/nested/b.txt"))
+	_, err = fsys.Stat("out/nested/a.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+	require.NoError(t, fsys.Rename("out/nested/b.txt", "out/nested/a.txt"))
+
+	assert.ErrorIs(t, fsys.Remove("out/nested"), fs.ErrExist)
+	require.NoError(t, fsys.Remove("out/nested/a.txt"))
+	require.NoError(t, fsys.Remove("out/nested"))
+	assert.Empty(t, fsys.Paths())
+	_, err = fsys.Stat("out/nested")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestCaptureToMemFS(t *testing.T) {
+	fsys := NewMemFS()
+	p, err := profiler.Capture(context.Background(), 10*time.Millisecond, profiler.WithMode(profiler.GoroutineMode), profiler.WithProfileFileLocation("profiles"), profiler.WithFS(fsys), profiler.WithQuietOutput(), profiler.WithMarkdownSummary(""))
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join("profiles", profiler.GoroutineFileName), filepath.Join("profiles", profiler.SummaryFileName)}, fsys.Paths())
+	assert.Equal(t, fsys.Paths(), p.ArtifactPaths())
+	// The artifact was read back from fsys to describe it.
+	stats := p.Report().ArtifactStats
+	require.NotEmpty(t, stats)
+	assert.Positive(t, stats[0].Samples)
+}
+
+func TestCaptureToFailingMemFS(t *testing.T) {
+	fsys := NewMemFS()
+	fsys.CreateErr = errors.New("read-only filesystem")
+	_, err := profiler.Capture(context.Background(), time.Millisecond, profiler.WithMode(profiler.GoroutineMode), profiler.WithFS(fsys), profiler.WithQuietOutput())
+	assert.ErrorContains(t, err, "read-only filesystem")
+	assert.Empty(t, fsys.Paths())
+}
+
+func TestReprocessMemFS(t *testing.T) {
+	fsys := NewMemFS()
+	_, err := profiler.Capture(context.Background(), 10*time.Millisecond, profiler.WithMode(profiler.GoroutineMode), profiler.WithProfileFileLocation("profiles"), profiler.WithFS(fsys), profiler.WithQuietOutput())
+	require.NoError(t, err)
+	comment := func(prof *profile.Profile) (*profile.Profile, error) {
+		prof.Comments = append(prof.Comments, "reprocessed")
+		return prof, nil
+	}
+	p, err := profiler.Reprocess("profiles", profiler.WithPostProcessor(comment), profiler.WithFS(fsys), profiler.WithQuietOutput())
+	require.NoError(t, err)
+	path := filepath.Join("profiles", profiler.GoroutineFileName)
+	assert.Equal(t, []string{path}, p.ArtifactPaths())
+	assert.Equal(t, []string{path}, fsys.Paths())
+	data, err := fsys.ReadFile(path)
+	require.NoError(t, err)
+	prof, err := profile.ParseData(data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"reprocessed"}, prof.Comments)
+}
+
+// commandBus delivers a single command and records the result published.
+type commandBus struct {
+	command []byte
+	result  profiler.CommandResult
+}
+
+func (b *commandBus) Subscribe(ctx context.Context, handle func(ctx context.Context, data []byte)) error {
+	handle(ctx, b.command)
+	return nil
+}
+
+func (b *commandBus) Publish(_ context.Context, _ string, data []byte) error {
+	return json.Unmarshal(data, &b.result)
+}
+
+func TestCommandCaptureMemFS(t *testing.T) {
+	fsys := NewMemFS()
+	bus := &commandBus{command: []byte(`{"mode": "goroutine", "duration": "10ms", "reply_to": "results"}`)}
+	err := profiler.ServeCommands(context.Background(), bus, bus, profiler.WithProfileFileLocation("profiles"), profiler.WithFS(fsys), profiler.WithQuietOutput())
+	require.NoError(t, err)
+	require.Empty(t, bus.result.Error)
+	require.Len(t, bus.result.Artifacts, 1)
+	want, err := fsys.ReadFile(filepath.Join("profiles", profiler.GoroutineFileName))
+	require.NoError(t, err)
+	assert.Equal(t, want, bus.result.Artifacts[0].Data)
+}
@@ -0,0 +1,128 @@
+// Package profilertest provides test helpers which turn performance
+// regressions, such as new contention or allocations, into test failures.
+package profilertest
+
+import (
+	"bytes"
+	"fmt"
+	"runtime/pprof"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// maxReportedStacks is the number of stacks included in failure messages.
+const maxReportedStacks = 5
+
+// lookup parses the named runtime profile.
+func lookup(name string) (*profile.Profile, error) {
+	var b bytes.Buffer
+	if err := pprof.Lookup(name).WriteTo(&b, 0); err != nil {
+		return nil, err
+	}
+	return profile.Parse(&b)
+}
+
+// delta returns the samples of the cumulative profile after which were
+// not already present in before.
+func delta(before *profile.Profile, after *profile.Profile) (*profile.Profile, error) {
+	before = before.Copy()
+	before.Scale(-1)
+	diff, err := profile.Merge([]*profile.Profile{after, before})
+	if err != nil {
+		return nil, err
+	}
+	return diff.Compact(), nil
+}
+
+// sampleIndex returns the index of the named sample type.
+func sampleIndex(p *profile.Profile, sampleType string) (int, error) {
+	for i, st := range p.SampleType {
+		if st.Type == sampleType {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("profile has no %s samples", sampleType)
+}
+
+// matcher reports whether a sample should be attributed.
+type matcher func(sample *profile.Sample) bool
+
+// anyFrame returns a matcher reporting whether the name of any function
+// in the stack of a sample satisfies match.
+func anyFrame(match func(name string) bool) matcher {
+	return func(sample *profile.Sample) bool {
+		for _, location := range sample.Location {
+			for _, line := range location.Line {
+				if line.Function != nil && match(line.Function.Name) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// inPackages matches samples with a frame belonging to one of packages,
+// every sample matches when no packages are given.
+func inPackages(packages []string) matcher {
+	if len(packages) == 0 {
+		return func(*profile.Sample) bool { return true }
+	}
+	return anyFrame(func(name string) bool {
+		for _, pkg := range packages {
+			if strings.HasPrefix(name, pkg+".") {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// stack is a call stack and the value attributed to it.
+type stack struct {
+	frames []string
+	value  int64
+}
+
+// attribute sums the value at index of the samples matching match,
+// returning the total and the stacks responsible.
+func attribute(p *profile.Profile, index int, match matcher) (int64, []stack) {
+	var total int64
+	var stacks []stack
+	for _, sample := range p.Sample {
+		value := sample.Value[index]
+		if value <= 0 || !match(sample) {
+			continue
+		}
+		total += value
+		var frames []string
+		for _, location := range sample.Location {
+			for _, line := range location.Line {
+				if line.Function != nil {
+					frames = append(frames, fmt.Sprintf("%s (%s:%d)", line.Function.Name, line.Function.Filename, line.Line))
+				}
+			}
+		}
+		stacks = append(stacks, stack{frames: frames, value: value})
+	}
+	return total, stacks
+}
+
+// formatStacks describes the largest stacks, formatting values with format.
+func formatStacks(stacks []stack, format func(int64) string) string {
+	sort.Slice(stacks, func(i, j int) bool { return stacks[i].value > stacks[j].value })
+	var b strings.Builder
+	for i, s := range stacks {
+		if i == maxReportedStacks {
+			fmt.Fprintf(&b, "... and %d more stacks\n", len(stacks)-i)
+			break
+		}
+		fmt.Fprintf(&b, "%s:\n", format(s.value))
+		for _, frame := range s.frames {
+			fmt.Fprintf(&b, "\t%s\n", frame)
+		}
+	}
+	return b.String()
+}
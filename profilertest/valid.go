@@ -0,0 +1,113 @@
+package profilertest
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/symonk/profiler"
+)
+
+// maxClockSkew is how far in the future a profile may claim to have
+// been captured.
+const maxClockSkew = time.Minute
+
+// traceMagic prefixes every execution trace.
+var traceMagic = []byte("go 1.")
+
+// memorySampleTypes are the sample types of the heap and allocs profiles.
+var memorySampleTypes = []string{"alloc_objects", "alloc_space", "inuse_objects", "inuse_space"}
+
+// sampleTypes are the sample types each mode is expected to produce.
+var sampleTypes = map[profiler.Mode][]string{
+	profiler.CPUMode:          {"samples", "cpu"},
+	profiler.MemoryHeapMode:   memorySampleTypes,
+	profiler.MemoryAllocMode:  memorySampleTypes,
+	profiler.MemoryMode:       memorySampleTypes,
+	profiler.MutexMode:        {"contentions", "delay"},
+	profiler.BlockMode:        {"contentions", "delay"},
+	profiler.GoroutineMode:    {"goroutine"},
+	profiler.ThreadCreateMode: {"threadcreate"},
+	profiler.ClockMode:        {"samples", "time"},
+	profiler.SchedLatencyMode: {"goroutines", "latency"},
+}
+
+// AssertValidProfile fails the test unless the artifact at path, captured
+// in mode, parses with the pprof library, has samples of the sample types
+// the mode produces and was captured at a sane time.  Execution traces are
+// verified to carry the trace header.  Artifacts compressed with gzip are
+// decompressed.  Unlike inspecting the output of the profiler, this
+// detects profiles which are empty or corrupt.
+func AssertValidProfile(t testing.TB, path string, mode profiler.Mode) bool {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Errorf("failed to open %s: %v", path, err)
+		return false
+	}
+	defer f.Close()
+	if mode == profiler.TraceMode {
+		return assertValidTrace(t, path, f)
+	}
+	prof, err := profile.Parse(f)
+	if err != nil {
+		t.Errorf("%s is not a valid pprof profile: %v", path, err)
+		return false
+	}
+	valid := true
+	if expected, ok := sampleTypes[mode]; ok {
+		if len(prof.SampleType) != len(expected) {
+			t.Errorf("%s has %d sample types, a %s profile has %d", path, len(prof.SampleType), mode, len(expected))
+			valid = false
+		}
+		for i := 0; i < len(expected) && i < len(prof.SampleType); i++ {
+			if prof.SampleType[i].Type != expected[i] {
+				t.Errorf("%s sample type %d is %q, a %s profile expects %q", path, i, prof.SampleType[i].Type, mode, expected[i])
+				valid = false
+			}
+		}
+	}
+	if len(prof.Sample) == 0 {
+		t.Errorf("%s has no samples", path)
+		valid = false
+	}
+	if prof.TimeNanos <= 0 {
+		t.Errorf("%s has no capture time", path)
+		valid = false
+	} else if captured := time.Unix(0, prof.TimeNanos); captured.After(time.Now().Add(maxClockSkew)) {
+		t.Errorf("%s claims to have been captured in the future at %s", path, captured)
+		valid = false
+	}
+	if prof.DurationNanos < 0 {
+		t.Errorf("%s has a negative duration of %s", path, time.Duration(prof.DurationNanos))
+		valid = false
+	}
+	return valid
+}
+
+// assertValidTrace fails the test unless r, decompressed if necessary,
+// begins with the execution trace header.
+func assertValidTrace(t testing.TB, path string, r io.Reader) bool {
+	t.Helper()
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			t.Errorf("%s is not valid gzip: %v", path, err)
+			return false
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
+	header, _ := br.Peek(len(traceMagic))
+	if !bytes.Equal(header, traceMagic) {
+		t.Errorf("%s is not an execution trace", path)
+		return false
+	}
+	return true
+}
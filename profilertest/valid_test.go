@@ -0,0 +1,60 @@
+package profilertest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/symonk/profiler"
+	"github.com/symonk/profiler/profilertest/workload"
+)
+
+func TestAssertValidProfileAcceptsCaptures(t *testing.T) {
+	for _, mode := range []profiler.Mode{profiler.CPUMode, profiler.MemoryHeapMode, profiler.GoroutineMode, profiler.TraceMode, profiler.ThreadCreateMode} {
+		t.Run(mode.String(), func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				workload.Mixed(ctx)
+			}()
+			p, err := profiler.Capture(context.Background(), 200*time.Millisecond, profiler.WithMode(mode), profiler.WithProfileFileLocation(t.TempDir()), profiler.WithQuietOutput())
+			cancel()
+			<-done
+			if !assert.NoError(t, err) {
+				return
+			}
+			for _, path := range p.ArtifactPaths() {
+				assert.True(t, AssertValidProfile(t, path, mode))
+			}
+		})
+	}
+}
+
+func TestAssertValidProfileRejectsInvalidArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	garbage := filepath.Join(dir, "garbage.pprof")
+	if err := os.WriteFile(garbage, []byte("not a profile"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	r := &recordingT{TB: t}
+	assert.False(t, AssertValidProfile(r, garbage, profiler.CPUMode))
+	assert.False(t, AssertValidProfile(r, garbage, profiler.TraceMode))
+	assert.False(t, AssertValidProfile(r, filepath.Join(dir, "missing.pprof"), profiler.CPUMode))
+	assert.Len(t, r.failures, 3)
+	assert.Contains(t, r.failures[0], "not a valid pprof profile")
+	assert.Contains(t, r.failures[1], "not an execution trace")
+}
+
+func TestAssertValidProfileRejectsWrongMode(t *testing.T) {
+	p, err := profiler.Capture(context.Background(), time.Millisecond, profiler.WithMode(profiler.GoroutineMode), profiler.WithProfileFileLocation(t.TempDir()), profiler.WithQuietOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &recordingT{TB: t}
+	assert.False(t, AssertValidProfile(r, p.ArtifactPaths()[0], profiler.MutexMode))
+	assert.Contains(t, r.failures[0], "a mutex profile has 2")
+}
@@ -0,0 +1,158 @@
+// Package workload generates synthetic load in controlled ways, burning
+// CPU, allocating, contending mutexes, blocking on channels and spawning
+// goroutines, so that profiling pipelines can be validated end to end.
+// Every function runs until ctx is done and only returns once all of the
+// goroutines it started have exited.
+package workload
+
+import (
+	"context"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// sink retains the results of the workload so that it cannot be
+// optimised away.
+var sink struct {
+	mu    sync.Mutex
+	value any
+}
+
+// keep stores v in the sink.
+func keep(v any) {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.value = v
+}
+
+// hash performs a fixed amount of CPU bound work on b.
+func hash(b []byte) {
+	for i := 0; i < 16; i++ {
+		sum := sha256.Sum256(b)
+		copy(b, sum[:])
+	}
+}
+
+// BurnCPU keeps goroutines busy on CPU bound work.
+func BurnCPU(ctx context.Context, goroutines int) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			b := make([]byte, 4*1024)
+			for ctx.Err() == nil {
+				hash(b)
+			}
+			keep(b)
+		}()
+	}
+}
+
+// Allocate repeatedly allocates objects of size bytes, retaining the most
+// recent retain of them on the heap, and returns the number of bytes
+// allocated.
+func Allocate(ctx context.Context, size int, retain int) uint64 {
+	retained := make([][]byte, retain)
+	var allocated uint64
+	for i := 0; ctx.Err() == nil; i++ {
+		b := make([]byte, size)
+		b[0] = byte(i)
+		if retain > 0 {
+			retained[i%retain] = b
+		}
+		allocated += uint64(size)
+	}
+	keep(retained)
+	return allocated
+}
+
+// Contend has goroutines repeatedly acquire a single mutex, holding it
+// for hold, so that the others wait.
+func Contend(ctx context.Context, goroutines int, hold time.Duration) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				mu.Lock()
+				time.Sleep(hold)
+				mu.Unlock()
+			}
+		}()
+	}
+}
+
+// Block has goroutines wait to receive from a channel which is sent to
+// once every interval.
+func Block(ctx context.Context, goroutines int, interval time.Duration) {
+	ch := make(chan struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ch:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			select {
+			case ch <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// SpawnGoroutines starts n goroutines which remain parked until ctx is
+// done, as a goroutine leak would.
+func SpawnGoroutines(ctx context.Context, n int) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-ctx.Done()
+		}()
+	}
+}
+
+// Mixed runs every workload at once, on a small scale, so that each
+// profiler has data to record.
+func Mixed(ctx context.Context) {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for _, fn := range []func(){
+		func() { BurnCPU(ctx, 1) },
+		func() { Allocate(ctx, 64*1024, 16) },
+		func() { Contend(ctx, 2, time.Millisecond) },
+		func() { Block(ctx, 2, time.Millisecond) },
+		func() { SpawnGoroutines(ctx, 8) },
+	} {
+		wg.Add(1)
+		go func(fn func()) {
+			defer wg.Done()
+			fn()
+		}(fn)
+	}
+}
@@ -0,0 +1,63 @@
+package workload
+
+import (
+	"context"
+	"runtime"
+	"runtime/metrics"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func read(name string) metrics.Value {
+	samples := []metrics.Sample{{Name: name}}
+	metrics.Read(samples)
+	return samples[0].Value
+}
+
+func TestAllocate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	before := read("/gc/heap/allocs:bytes").Uint64()
+	allocated := Allocate(ctx, 1024, 8)
+	assert.Greater(t, allocated, uint64(0))
+	assert.GreaterOrEqual(t, read("/gc/heap/allocs:bytes").Uint64()-before, allocated)
+}
+
+func TestContend(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	before := read("/sync/mutex/wait/total:seconds").Float64()
+	Contend(ctx, 4, time.Millisecond)
+	assert.Greater(t, read("/sync/mutex/wait/total:seconds").Float64(), before)
+}
+
+func TestSpawnGoroutinesExitWithContext(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		SpawnGoroutines(ctx, 100)
+	}()
+	assert.Eventually(t, func() bool { return runtime.NumGoroutine() >= before+100 }, time.Second, time.Millisecond)
+	cancel()
+	<-done
+	assert.Eventually(t, func() bool { return runtime.NumGoroutine() < before+100 }, time.Second, time.Millisecond)
+}
+
+func TestMixedReturnsOnceDone(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Mixed(ctx)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Mixed did not return once ctx was done")
+	}
+}
@@ -0,0 +1,115 @@
+package profiler
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval is how often the progress of a long running teardown
+// task is reported, tasks which complete sooner report nothing.
+var progressInterval = 5 * time.Second
+
+// Progress describes how far a long running teardown task, such as the
+// upload or conversion of a large artifact, has got.  It is reported
+// periodically so that operators waiting on teardown can distinguish
+// working from hung.
+type Progress struct {
+	// Task describes the work, such as "upload of cpu.pprof".
+	Task string
+	// Done is the number of bytes processed so far.
+	Done int64
+	// Total is the number of bytes to process, zero if unknown.
+	Total int64
+	// Elapsed is how long the task has been running.
+	Elapsed time.Duration
+}
+
+// Percent returns the percentage (0 to 100) of the task complete, zero
+// if the total is unknown.
+func (p Progress) Percent() float64 {
+	if p.Total <= 0 {
+		return 0
+	}
+	return min(float64(p.Done)/float64(p.Total)*100, 100)
+}
+
+// ETA estimates the time remaining from the rate so far, zero if it
+// cannot be estimated.
+func (p Progress) ETA() time.Duration {
+	if p.Total <= 0 || p.Done <= 0 || p.Done >= p.Total {
+		return 0
+	}
+	return time.Duration(float64(p.Elapsed) * float64(p.Total-p.Done) / float64(p.Done))
+}
+
+// String describes the progress, such as "upload of cpu.pprof: 45%
+// (12.3MiB of 27.0MiB), about 3s remaining".
+func (p Progress) String() string {
+	if p.Total <= 0 {
+		return fmt.Sprintf("%s: %s after %s", p.Task, formatBytes(p.Done), p.Elapsed.Round(time.Second))
+	}
+	s := fmt.Sprintf("%s: %.0f%% (%s of %s)", p.Task, p.Percent(), formatBytes(p.Done), formatBytes(p.Total))
+	if eta := p.ETA(); eta > 0 {
+		s += fmt.Sprintf(", about %s remaining", eta.Round(time.Second))
+	}
+	return s
+}
+
+// progressTracker counts the bytes processed by a task, reporting its
+// progress every progressInterval until finished.  It is an io.Writer so
+// that it can observe a copy with io.MultiWriter or io.TeeReader.
+type progressTracker struct {
+	task    string
+	total   int64
+	started time.Time
+	done    atomic.Int64
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+// trackProgress begins tracking task, finish must be invoked once the
+// task completes.
+func (p *Profiler) trackProgress(task string, total int64) *progressTracker {
+	t := &progressTracker{task: task, total: total, started: time.Now(), stop: make(chan struct{})}
+	t.wg.Add(1)
+	goInternal(func() {
+		defer t.wg.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-t.stop:
+				return
+			case <-ticker.C:
+				progress := t.progress()
+				p.report("%s", progress)
+				p.emitProgress(progress)
+			}
+		}
+	})
+	return t
+}
+
+// Write counts len(b) bytes as processed.
+func (t *progressTracker) Write(b []byte) (int, error) {
+	t.add(int64(len(b)))
+	return len(b), nil
+}
+
+// add counts n bytes as processed.
+func (t *progressTracker) add(n int64) {
+	t.done.Add(n)
+}
+
+// progress returns the current progress of the task.
+func (t *progressTracker) progress() Progress {
+	return Progress{Task: t.task, Done: t.done.Load(), Total: t.total, Elapsed: time.Since(t.started)}
+}
+
+// finish stops reporting the progress of the task.
+func (t *progressTracker) finish() {
+	close(t.stop)
+	t.wg.Wait()
+}
@@ -0,0 +1,48 @@
+package profiler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgress(t *testing.T) {
+	progress := Progress{Task: "upload of cpu.pprof", Done: 1 << 20, Total: 4 << 20, Elapsed: 2 * time.Second}
+	assert.Equal(t, 25.0, progress.Percent())
+	assert.Equal(t, 6*time.Second, progress.ETA())
+	assert.Equal(t, "upload of cpu.pprof: 25% (1.0MiB of 4.0MiB), about 6s remaining", progress.String())
+
+	unknown := Progress{Task: "html reports", Done: 512, Elapsed: 3 * time.Second}
+	assert.Zero(t, unknown.Percent())
+	assert.Zero(t, unknown.ETA())
+	assert.Equal(t, "html reports: 512B after 3s", unknown.String())
+}
+
+func TestUploadReportsProgress(t *testing.T) {
+	previous := progressInterval
+	progressInterval = 10 * time.Millisecond
+	defer func() { progressInterval = previous }()
+
+	gated := &gatedWriter{gate: make(chan struct{})}
+	p := Start(
+		WithHeapProfiler(),
+		WithProfileFileLocation(t.TempDir()),
+		WithUpload(gatedSink{gated}),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	go p.Stop()
+	var progress *Progress
+	for event := range p.Events() {
+		if event.Type == EventProgress && progress == nil {
+			progress = event.Progress
+			// The upload is blocked until progress has been reported.
+			close(gated.gate)
+		}
+	}
+	if assert.NotNil(t, progress) {
+		assert.Equal(t, "upload of "+MemoryFileName, progress.Task)
+		assert.Positive(t, progress.Total)
+	}
+}
@@ -0,0 +1,66 @@
+package profiler
+
+import (
+	"io"
+	"runtime"
+	"runtime/pprof"
+)
+
+// SamplingRates override the sampling of the runtime profilers for a
+// single capture, rather than for the process.  Zero values leave the
+// rate untouched, see WithSamplingRates.
+type SamplingRates struct {
+	// CPUHz is the rate of the CPU profiler in samples per second, 100 by
+	// default, see runtime.SetCPUProfileRate.  The runtime warns on stderr
+	// that it "cannot set cpu profile rate" when it is overridden.
+	CPUHz int
+	// MemProfileRate is the average bytes allocated per sample recorded,
+	// see runtime.MemProfileRate and WithMemoryProfilingRate.
+	MemProfileRate int
+	// BlockProfileRate is the average nanoseconds blocked per blocking
+	// event sampled, see runtime.SetBlockProfileRate.  It is restored to 0
+	// once the capture stops.
+	BlockProfileRate int
+	// MutexProfileFraction is the reciprocal of the fraction of mutex
+	// contention events sampled, see runtime.SetMutexProfileFraction.
+	MutexProfileFraction int
+}
+
+// applySamplingRates applies the rates of WithSamplingRates, other than
+// those of the CPU and memory profilers which apply them as they start,
+// returning a function restoring the previous rates.
+func (p *Profiler) applySamplingRates() func() {
+	var restores []func()
+	if rate := p.rates.BlockProfileRate; rate > 0 {
+		p.report("block profile rate set to %d for the capture", rate)
+		runtime.SetBlockProfileRate(rate)
+		// The runtime does not expose the block profile rate, it is
+		// disabled as the block profiler itself does.
+		restores = append(restores, func() { runtime.SetBlockProfileRate(0) })
+	}
+	if fraction := p.rates.MutexProfileFraction; fraction > 0 {
+		p.report("mutex profile fraction set to %d for the capture", fraction)
+		previous := runtime.SetMutexProfileFraction(fraction)
+		restores = append(restores, func() { runtime.SetMutexProfileFraction(previous) })
+	}
+	return func() {
+		for _, restore := range restores {
+			restore()
+		}
+	}
+}
+
+// startCPUProfile starts the CPU profiler writing to w, at the rate of
+// WithSamplingRates if one is set.
+func (p *Profiler) startCPUProfile(w io.Writer) error {
+	if hz := p.rates.CPUHz; hz > 0 {
+		// pprof.StartCPUProfile always requests 100hz, the runtime ignores
+		// the request, printing a warning to stderr, once a rate has been
+		// set.  The rate is reset when the profile is stopped.
+		runtime.SetCPUProfileRate(hz)
+	}
+	if err := pprof.StartCPUProfile(w); err != nil {
+		return cpuStartError(err)
+	}
+	return nil
+}
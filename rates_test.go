@@ -0,0 +1,41 @@
+package profiler
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSamplingRatesApplyToTheCaptureOnly(t *testing.T) {
+	previousFraction := runtime.SetMutexProfileFraction(-1)
+	previousRate := runtime.MemProfileRate
+	p := Start(
+		WithHeapProfiler(),
+		WithSamplingRates(SamplingRates{MemProfileRate: 1024, MutexProfileFraction: 5}),
+		WithProfileFileLocation(t.TempDir()),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	assert.Equal(t, 5, runtime.SetMutexProfileFraction(-1))
+	assert.Equal(t, 1024, runtime.MemProfileRate)
+	p.Stop()
+	assert.Equal(t, previousFraction, runtime.SetMutexProfileFraction(-1))
+	assert.Equal(t, previousRate, runtime.MemProfileRate)
+}
+
+func TestCaptureSpecRatesSetTheCPUProfileRate(t *testing.T) {
+	profilers, err := Run(context.Background(), []CaptureSpec{
+		{Mode: CPUMode, Duration: 20 * time.Millisecond, Output: t.TempDir(), Rates: SamplingRates{CPUHz: 500}},
+		{Mode: CPUMode, Duration: 20 * time.Millisecond, Output: t.TempDir()},
+	}, WithQuietOutput())
+	assert.NoError(t, err)
+	tuned, err := ReadProfile(profilers[0].ArtifactPaths()[0])
+	assert.NoError(t, err)
+	assert.Equal(t, int64(time.Second/500), tuned.Period)
+	standard, err := ReadProfile(profilers[1].ArtifactPaths()[0])
+	assert.NoError(t, err)
+	assert.Equal(t, int64(time.Second/100), standard.Period)
+}
@@ -0,0 +1,225 @@
+package profiler
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// ReadProfile parses the pprof profile at path, compressed or not, such
+// as an artifact just written, so that callbacks and tooling can inspect
+// it without learning the pprof library.
+func ReadProfile(path string) (*profile.Profile, error) {
+	return readProfile(OSFS{}, path)
+}
+
+// readProfile parses the pprof profile at path of fsys.
+func readProfile(fsys FS, path string) (*profile.Profile, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return profile.Parse(f)
+}
+
+// The execution trace batch framing, see internal/trace/tracev2.
+const (
+	traceEventBatch        = 1
+	traceStacks            = 2
+	traceStrings           = 4
+	traceCPUSamples        = 6
+	traceFrequency         = 8
+	traceExperimentalBatch = 49
+	traceSync              = 50
+	traceEndOfGeneration   = 52
+	traceMaxBatchSize      = 64 << 10
+	// traceBatchFormat is the first version whose events are batched.
+	traceBatchFormat = 22
+)
+
+// traceHeaderFormat is the header of every execution trace.
+const traceHeaderFormat = "go 1.%d trace\x00\x00\x00"
+
+// TraceSummary describes an execution trace without decoding its events.
+type TraceSummary struct {
+	// GoVersion is the version of the trace format, such as go1.22.
+	GoVersion string
+	// Size is the size of the trace in bytes, once decompressed.
+	Size int64
+	// Generations is the number of generations the trace is split into.
+	Generations int
+	// Batches is the number of batches of events.
+	Batches int
+	// Threads is the number of OS threads which recorded events.
+	Threads int
+	// Duration is the time spanned by the batches, zero if the trace
+	// has no clock frequency.
+	Duration time.Duration
+}
+
+// ReadTraceSummary summarises the execution trace at path, compressed
+// with gzip or not.  Only the GoVersion and Size of traces produced
+// prior to go1.22 are summarised, their events are not batched.
+func ReadTraceSummary(path string) (TraceSummary, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return TraceSummary{}, err
+	}
+	defer f.Close()
+	br := bufio.NewReader(f)
+	if magic, _ := br.Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return TraceSummary{}, err
+		}
+		defer gz.Close()
+		br = bufio.NewReader(gz)
+	}
+	r := &countingReader{r: br}
+	header := make([]byte, len(fmt.Sprintf(traceHeaderFormat, traceBatchFormat)))
+	var version int
+	if _, err := io.ReadFull(r, header); err != nil {
+		return TraceSummary{}, fmt.Errorf("%s is not an execution trace: %w", path, err)
+	}
+	if _, err := fmt.Sscanf(string(header), traceHeaderFormat, &version); err != nil {
+		return TraceSummary{}, fmt.Errorf("%s is not an execution trace: %w", path, err)
+	}
+	summary := TraceSummary{GoVersion: fmt.Sprintf("go1.%d", version)}
+	if version < traceBatchFormat {
+		_, err := io.Copy(io.Discard, r)
+		summary.Size = r.n
+		return summary, err
+	}
+	generations, threads := map[uint64]bool{}, map[uint64]bool{}
+	var first, last, frequency uint64
+	for {
+		batch, err := readTraceBatch(r)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return summary, fmt.Errorf("invalid execution trace %s: %w", path, err)
+		}
+		if batch.data == nil {
+			continue
+		}
+		summary.Batches++
+		generations[batch.gen] = true
+		if batch.recordsEvents() {
+			threads[batch.m] = true
+		}
+		if first == 0 || batch.time < first {
+			first = batch.time
+		}
+		last = max(last, batch.time)
+		if f := batch.frequency(); f > 0 {
+			frequency = f
+		}
+	}
+	summary.Size, summary.Generations, summary.Threads = r.n, len(generations), len(threads)
+	if frequency > 0 {
+		summary.Duration = time.Duration(float64(last-first) / float64(frequency) * float64(time.Second))
+	}
+	return summary, nil
+}
+
+// traceBatch is the framing of a batch of execution trace events.
+type traceBatch struct {
+	gen  uint64
+	m    uint64
+	time uint64
+	data []byte
+}
+
+// recordsEvents reports whether the batch holds the events of a thread,
+// rather than a table such as the stacks or strings.
+func (b traceBatch) recordsEvents() bool {
+	switch b.data[0] {
+	case traceStacks, traceStrings, traceCPUSamples, traceFrequency, traceSync:
+		return false
+	}
+	return true
+}
+
+// frequency returns the timestamp units per second carried by the
+// batch, zero if it carries none.
+func (b traceBatch) frequency() uint64 {
+	data := b.data
+	if len(data) > 1 && data[0] == traceSync {
+		data = data[1:]
+	}
+	if len(data) < 2 || data[0] != traceFrequency {
+		return 0
+	}
+	frequency, _ := binary.Uvarint(data[1:])
+	return frequency
+}
+
+// readTraceBatch reads the next batch, an end of generation marker is
+// returned as a batch without data.
+func readTraceBatch(r io.ByteReader) (traceBatch, error) {
+	typ, err := r.ReadByte()
+	if err != nil {
+		return traceBatch{}, err
+	}
+	switch typ {
+	case traceEndOfGeneration:
+		return traceBatch{}, nil
+	case traceExperimentalBatch:
+		if _, err := r.ReadByte(); err != nil {
+			return traceBatch{}, io.ErrUnexpectedEOF
+		}
+	case traceEventBatch:
+	default:
+		return traceBatch{}, fmt.Errorf("expected a batch, found event %d", typ)
+	}
+	var header [4]uint64
+	for i := range header {
+		if header[i], err = binary.ReadUvarint(r); err != nil {
+			return traceBatch{}, io.ErrUnexpectedEOF
+		}
+	}
+	if header[3] > traceMaxBatchSize {
+		return traceBatch{}, fmt.Errorf("batch size %d exceeds the maximum of %d", header[3], traceMaxBatchSize)
+	}
+	if header[3] == 0 {
+		// Every batch begins with the type of its events.
+		return traceBatch{}, errors.New("empty batch")
+	}
+	data := make([]byte, header[3])
+	for i := range data {
+		if data[i], err = r.ReadByte(); err != nil {
+			return traceBatch{}, io.ErrUnexpectedEOF
+		}
+	}
+	return traceBatch{gen: header[0], m: header[1], time: header[2], data: data}, nil
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r *bufio.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (c *countingReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.n++
+	}
+	return b, err
+}
@@ -0,0 +1,70 @@
+package profiler
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadProfile(t *testing.T) {
+	p, err := Capture(context.Background(), time.Millisecond, WithMode(GoroutineMode), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	prof, err := ReadProfile(p.ArtifactPaths()[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "goroutine", prof.SampleType[0].Type)
+	assert.NotEmpty(t, prof.Sample)
+
+	_, err = ReadProfile(filepath.Join(t.TempDir(), "missing.pprof"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestReadTraceSummary(t *testing.T) {
+	for name, options := range map[string][]ProfileOption{
+		"uncompressed": nil,
+		"gzip":         {WithCompression(Gzip)},
+	} {
+		t.Run(name, func(t *testing.T) {
+			options = append(options, WithTracing(), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+			p, err := Capture(context.Background(), 50*time.Millisecond, options...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			summary, err := ReadTraceSummary(p.ArtifactPaths()[0])
+			assert.NoError(t, err)
+			assert.Regexp(t, `^go1\.\d+$`, summary.GoVersion)
+			assert.Greater(t, summary.Size, int64(0))
+			if summary.Batches > 0 {
+				assert.Greater(t, summary.Generations, 0)
+				assert.Greater(t, summary.Threads, 0)
+				assert.Greater(t, summary.Duration, time.Duration(0))
+			}
+		})
+	}
+}
+
+func TestReadTraceSummaryRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cpu.pprof")
+	if err := os.WriteFile(path, []byte("not a trace at all"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ReadTraceSummary(path)
+	assert.ErrorContains(t, err, "not an execution trace")
+}
+
+func TestReadTraceSummaryRejectsEmptyBatches(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.out")
+	// A batch of generation 1, thread 1 and time 1 without any data.
+	trace := append([]byte(fmt.Sprintf(traceHeaderFormat, traceBatchFormat)), traceEventBatch, 1, 1, 1, 0)
+	if err := os.WriteFile(path, trace, 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := ReadTraceSummary(path)
+	assert.ErrorContains(t, err, "empty batch")
+}
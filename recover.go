@@ -0,0 +1,27 @@
+package profiler
+
+import "fmt"
+
+// PanicError is recorded in the Report when user code invoked during
+// teardown, such as a CallbackFunc or finalizer, panics.  The remainder
+// of the teardown continues regardless.
+type PanicError struct {
+	// Source describes what panicked, such as "callback".
+	Source string
+	// Value is the value passed to panic.
+	Value any
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("%s panicked: %v", e.Source, e.Value)
+}
+
+// guard invokes fn, recovering a panic as a *PanicError.
+func guard(source string, fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Source: source, Value: r}
+		}
+	}()
+	return fn()
+}
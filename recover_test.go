@@ -0,0 +1,74 @@
+package profiler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTeardownRecoversPanics(t *testing.T) {
+	panicking := func(next StrategyFunc) StrategyFunc {
+		return func(p *Profiler) (FinalizerFunc, error) {
+			finalizer, err := next(p)
+			if err != nil {
+				return nil, err
+			}
+			return func() error {
+				defer panic("finalizer boom")
+				return finalizer()
+			}, nil
+		}
+	}
+	var handled []error
+	hooked := false
+	p := Start(
+		WithHeapProfiler(),
+		WithProfileFileLocation(t.TempDir()),
+		WithStrategyMiddleware(panicking),
+		WithAfterCapture(func(Mode, ArtifactInfo, error) { panic("hook boom") }),
+		WithAfterCapture(func(Mode, ArtifactInfo, error) { hooked = true }),
+		WithCallback(func(*Profiler) { panic("callback boom") }),
+		WithErrorHandler(func(err error) { handled = append(handled, err) }),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	p.Stop()
+	assert.True(t, hooked)
+	assert.FileExists(t, p.ArtifactPaths()[0])
+	errs := p.Report().Errors
+	assert.Equal(t, handled, errs)
+	var sources []string
+	for _, err := range errs {
+		var panicked *PanicError
+		if assert.True(t, errors.As(err, &panicked)) {
+			sources = append(sources, panicked.Source)
+		}
+	}
+	assert.Equal(t, []string{"finalizer", "after capture hook", "callback"}, sources)
+	assert.EqualError(t, errs[2], "callback panicked: callback boom")
+}
+
+func TestFinalizerPanicClosesProfileFile(t *testing.T) {
+	panicking := func(next StrategyFunc) StrategyFunc {
+		return func(p *Profiler) (FinalizerFunc, error) {
+			if _, err := next(p); err != nil {
+				return nil, err
+			}
+			return func() error { panic("finalizer boom") }, nil
+		}
+	}
+	p := Start(
+		WithHeapProfiler(),
+		WithProfileFileLocation(t.TempDir()),
+		WithStrategyMiddleware(panicking),
+		WithErrorHandler(func(error) {}),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	p.Stop()
+	path := p.ArtifactPaths()[0]
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	assert.True(t, p.completed[path], "the profile file was closed")
+}
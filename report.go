@@ -0,0 +1,101 @@
+package profiler
+
+import "time"
+
+// Report summarises a profiling session, it is complete once the
+// session has been stopped and is typically inspected from within
+// a CallbackFunc.
+type Report struct {
+	// Mode is the profiling mode of the session.
+	Mode Mode
+	// OutputDir is the resolved folder artifacts were written to, which
+	// may be the fallback folder, see WithFallbackDir.
+	OutputDir string
+	// Artifacts are the absolute paths of every artifact written.
+	Artifacts []string
+	// ArtifactStats describe the size and number of samples of each
+	// artifact which remains on disk.
+	ArtifactStats []ArtifactStat
+	// Truncated are the artifacts which exceeded the maximum size.
+	Truncated []string
+	// Partial are the artifacts abandoned incomplete when their finalizer
+	// timed out, see WithFinalizeTimeout.
+	Partial []string
+	// Duplicates are the artifacts discarded as duplicates of the
+	// previous capture, see WithDeduplication.
+	Duplicates []string
+	// Tags are the session tags, see WithTags.
+	Tags map[string]string
+	// Duration is how long the capture ran for, from capture beginning
+	// to the profile being finalized.
+	Duration time.Duration
+	// Warmup is the delay between the session starting and capture
+	// beginning, see WithWarmup.
+	Warmup time.Duration
+	// Environment is the execution environment captured at the start
+	// of the session.
+	Environment Environment
+	// Throttling is the CFS throttling which occurred during the session,
+	// nil when not running in a cgroup with the cpu controller enabled.
+	Throttling *CPUThrottling
+	// LabelBreakdown is the share of the profiles attributed to each
+	// value of the label configured by WithLabelBreakdown, merged across
+	// every artifact of the session.
+	LabelBreakdown []LabelShare
+	// GoroutineBuckets are the goroutines of a goroutine profile bucketed
+	// by what they are blocked on, largest first, see ClassifyGoroutines.
+	GoroutineBuckets []GoroutineBucket
+	// Deadlocks are the groups of goroutines suspected of deadlock, see
+	// WithDeadlockDetection.
+	Deadlocks []SuspectedDeadlock
+	// Phases describe each phase of a session divided with Phase, in the
+	// order they ran.
+	Phases []PhaseStat
+	// Interrupted is true if the session was stopped by a signal,
+	// shutdown context or size limit rather than Stop.
+	Interrupted bool
+	// Errors are the errors which occurred during teardown, such as
+	// failing to write a profile or upload an artifact.
+	Errors []error
+}
+
+// Report returns the report of the profiling session.
+func (p *Profiler) Report() Report {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	errs := make([]error, len(p.errs))
+	copy(errs, p.errs)
+	truncated := make([]string, len(p.truncated))
+	copy(truncated, p.truncated)
+	return Report{
+		Mode:             p.profileMode,
+		OutputDir:        p.currentOutputDir(),
+		Artifacts:        p.artifactPaths(),
+		ArtifactStats:    append([]ArtifactStat(nil), p.artifactStats...),
+		Truncated:        truncated,
+		Partial:          append([]string(nil), p.partial...),
+		Duplicates:       append([]string(nil), p.duplicates...),
+		Tags:             copyTags(p.tags),
+		Duration:         p.elapsed,
+		Warmup:           p.warmup,
+		Environment:      p.environment,
+		Throttling:       p.throttling,
+		LabelBreakdown:   append([]LabelShare(nil), p.labelShares...),
+		GoroutineBuckets: append([]GoroutineBucket(nil), p.goroutineBuckets...),
+		Deadlocks:        append([]SuspectedDeadlock(nil), p.deadlocks...),
+		Phases:           append([]PhaseStat(nil), p.phases...),
+		Interrupted:      p.interrupted,
+		Errors:           errs,
+	}
+}
+
+// recordError records err in the report of the session and hands it
+// to the error handler, if one has been provided.
+func (p *Profiler) recordError(err error) {
+	p.mu.Lock()
+	p.errs = append(p.errs, err)
+	p.mu.Unlock()
+	if p.errorHandler != nil {
+		p.errorHandler(err)
+	}
+}
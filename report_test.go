@@ -0,0 +1,47 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, errors.New("disk full") }
+
+func (failingWriter) Close() error { return nil }
+
+type failingSink struct{}
+
+func (failingSink) Create(context.Context, string) (io.WriteCloser, error) {
+	return nil, errors.New("unreachable")
+}
+
+func TestCloseLookupSurfacesWriteErrors(t *testing.T) {
+	assert.ErrorContains(t, closeLookup(heapProfileName, failingWriter{}), "disk full")
+}
+
+func TestErrorsAreRecordedAndHandled(t *testing.T) {
+	var handled []error
+	var report Report
+	p := Start(
+		WithHeapProfiler(),
+		WithProfileFileLocation(t.TempDir()),
+		WithUpload(failingSink{}),
+		WithErrorHandler(func(err error) { handled = append(handled, err) }),
+		WithCallback(func(p *Profiler) { report = p.Report() }),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	p.Stop()
+	assert.Len(t, handled, 1)
+	assert.ErrorContains(t, handled[0], "unreachable")
+	assert.Equal(t, handled, report.Errors)
+	assert.Equal(t, MemoryHeapMode, report.Mode)
+	assert.Equal(t, p.ArtifactPaths(), report.Artifacts)
+	assert.False(t, report.Interrupted)
+}
@@ -0,0 +1,112 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// derivedExtensions are the extensions of the files generated from the
+// artifacts of a session, such as reports, which Reprocess generates again
+// rather than treating as artifacts.
+var derivedExtensions = map[string]bool{".html": true, ".csv": true, ".md": true}
+
+// Reprocess runs the post processors, reports and uploads configured by
+// options again for the artifacts previously captured into dir, such as
+// when the initial upload failed or a report format has been added since.
+// Reports are generated afresh alongside the artifacts, the post processors
+// rewrite pprof artifacts in place and, last of all, the callback is
+// invoked.  Nothing is captured.  The returned *Profiler describes the
+// reprocessed artifacts, the error joins every failure, which are also in
+// its Report.
+func Reprocess(dir string, options ...ProfileOption) (*Profiler, error) {
+	p := New(options...)
+	defer p.inert()
+	entries, err := p.fs.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	p.profileFolder, p.resolvedFolder = dir, dir
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") || derivedExtensions[filepath.Ext(name)] || name == MetadataFileName {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if _, ok := p.fs.(OSFS); ok {
+			// Paths of other filesystems are not relative to the working dir.
+			if path, err = filepath.Abs(path); err != nil {
+				return nil, err
+			}
+		}
+		if len(p.artifacts) == 0 {
+			p.profileMode = modeOf(name)
+		}
+		p.artifacts = append(p.artifacts, path)
+	}
+	if len(p.artifacts) == 0 {
+		return nil, fmt.Errorf("no artifacts found in %s", dir)
+	}
+	for _, path := range p.artifacts {
+		if err := p.reprocessFile(path); err != nil {
+			p.recordError(fmt.Errorf("failed to post process %s: %w", path, err))
+		}
+	}
+	p.breakdownLabels()
+	p.htmlReports()
+	p.markdownSummary()
+	p.metadataFile()
+	p.upload(context.Background())
+	p.recordStats()
+	if p.callback != nil {
+		if err := guard("callback", func() error { p.callback(p); return nil }); err != nil {
+			p.recordError(err)
+		}
+	}
+	for _, stat := range p.Report().ArtifactStats {
+		p.report("reprocessed %s (%s)", stat.Path, stat)
+	}
+	return p, errors.Join(p.Report().Errors...)
+}
+
+// reprocessFile runs the post processors over the pprof artifact at path,
+// replacing it only once post processing has succeeded.
+func (p *Profiler) reprocessFile(path string) error {
+	processors := p.processorsFor(filepath.Base(path))
+	if len(processors) == 0 {
+		return nil
+	}
+	data, err := readFile(p.fs, path)
+	if err != nil {
+		return err
+	}
+	// Hidden files are not artifacts, should reprocessing be interrupted.
+	tmp, err := p.fs.Create(filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".reprocess"))
+	if err != nil {
+		return err
+	}
+	w := &postProcessWriter{w: tmp, processors: processors}
+	if _, err := w.Write(data); err != nil {
+		return errors.Join(err, tmp.Close(), p.fs.Remove(tmp.Name()))
+	}
+	if err := w.Close(); err != nil {
+		return errors.Join(err, p.fs.Remove(tmp.Name()))
+	}
+	return p.fs.Rename(tmp.Name(), path)
+}
+
+// modeOf returns the mode whose default file name the named artifact,
+// which may be compressed, has.  CPUMode is returned if there is none.
+func modeOf(name string) Mode {
+	if strings.HasPrefix(name, HeapFileName) || strings.HasPrefix(name, AllocsFileName) {
+		return MemoryMode
+	}
+	for _, spec := range modeSpecs {
+		if spec.FileName != "" && strings.HasPrefix(name, spec.FileName) {
+			return spec.Mode
+		}
+	}
+	return CPUMode
+}
@@ -0,0 +1,55 @@
+package profiler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReprocess(t *testing.T) {
+	dir := t.TempDir()
+	_, err := Capture(context.Background(), 10*time.Millisecond, WithMode(GoroutineMode), WithProfileFileLocation(dir), WithQuietOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	comment := func(prof *profile.Profile) (*profile.Profile, error) {
+		prof.Comments = append(prof.Comments, "reprocessed")
+		return prof, nil
+	}
+	for i := 0; i < 2; i++ {
+		sink := memorySink{}
+		p, err := Reprocess(dir, WithHTMLReport(), WithPostProcessor(comment), WithUpload(sink), WithQuietOutput())
+		assert.NoError(t, err)
+		assert.Equal(t, GoroutineMode, p.Mode())
+		assert.Len(t, p.ArtifactPaths(), 2)
+		assert.Contains(t, sink, GoroutineFileName)
+		assert.Contains(t, sink, "goroutine.html")
+	}
+	prof, err := ReadProfile(filepath.Join(dir, GoroutineFileName))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"reprocessed", "reprocessed"}, prof.Comments)
+}
+
+func TestReprocessReportsFailures(t *testing.T) {
+	_, err := Reprocess(t.TempDir())
+	assert.ErrorContains(t, err, "no artifacts found")
+
+	dir := t.TempDir()
+	_, err = Capture(context.Background(), 10*time.Millisecond, WithMode(GoroutineMode), WithProfileFileLocation(dir), WithQuietOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := Reprocess(dir, WithUpload(failingSink{}), WithQuietOutput())
+	assert.ErrorContains(t, err, "unreachable")
+	assert.Len(t, p.Report().Errors, 1)
+}
+
+func TestModeOf(t *testing.T) {
+	assert.Equal(t, TraceMode, modeOf(TraceFileName+".gz"))
+	assert.Equal(t, MemoryMode, modeOf(AllocsFileName))
+	assert.Equal(t, ClockMode, modeOf(ClockFileName))
+}
@@ -0,0 +1,120 @@
+package profiler
+
+import (
+	"context"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"runtime/trace"
+	"sync"
+	"time"
+)
+
+// RequestIDHeader is the header RequestTracer matches by default.
+const RequestIDHeader = "X-Request-Id"
+
+// unsafeFolderChars are replaced when deriving a folder from a request ID.
+var unsafeFolderChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// RequestTracer captures an execution trace scoped to exactly one
+// request.  A request ID is armed ahead of time, when a request carrying
+// it arrives an execution trace is started and it is stopped as soon as
+// the request completes.  Traces are one-shot, the ID is disarmed once
+// traced.  The request is wrapped in a trace task so that it can be
+// isolated in `go tool trace` from the other work of the process.
+type RequestTracer struct {
+	header  string
+	options []ProfileOption
+	mu      sync.Mutex
+	armed   map[string]struct{}
+}
+
+// NewRequestTracer returns a RequestTracer matching request IDs in the
+// given header, RequestIDHeader if empty.  Options configure the trace
+// sessions, the trace of each request is written into a `request-<id>`
+// folder beneath the profile file location.
+func NewRequestTracer(header string, options ...ProfileOption) *RequestTracer {
+	if header == "" {
+		header = RequestIDHeader
+	}
+	return &RequestTracer{header: header, options: options, armed: make(map[string]struct{})}
+}
+
+// Header returns the header request IDs are matched in, for middleware
+// adapting the tracer to other routers.
+func (t *RequestTracer) Header() string {
+	return t.header
+}
+
+// Arm arms a one-shot trace for the request with the given ID.
+func (t *RequestTracer) Arm(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.armed[id] = struct{}{}
+}
+
+// Disarm disarms the trace for the request with the given ID.
+func (t *RequestTracer) Disarm(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.armed, id)
+}
+
+// take disarms id, reporting whether it was armed.
+func (t *RequestTracer) take(id string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, ok := t.armed[id]
+	delete(t.armed, id)
+	return ok
+}
+
+// Do runs fn, tracing it if id is armed.  It is the integration point
+// for transports other than net/http, such as a gRPC interceptor.  fn
+// is always run, even if the trace cannot be started because another
+// profiling session is active.  The trace is stopped even if fn panics,
+// a failure to stop it is reported rather than exiting the server.  Each
+// traced request is audited, see WithAuditHandler.
+func (t *RequestTracer) Do(ctx context.Context, id string, fn func(ctx context.Context)) {
+	t.do(ctx, id, "", fn)
+}
+
+// do is Do, auditing the trace as requested by requester if known.
+func (t *RequestTracer) do(ctx context.Context, id string, requester string, fn func(ctx context.Context)) {
+	if id == "" || !t.take(id) {
+		fn(ctx)
+		return
+	}
+	base := New(t.options...)
+	entry := AuditEntry{Time: time.Now(), Source: AuditSourceRequest, Requester: requester, Action: TraceMode.String(), Params: map[string]string{"request_id": id}}
+	base.auditReceived(ctx, entry)
+	folder := filepath.Join(base.profileFolder, "request-"+unsafeFolderChars.ReplaceAllString(id, "_"))
+	options := append(append([]ProfileOption{}, t.options...), WithTracing(), WithProfileFileLocation(folder), WithoutSignalHandling())
+	p, err := start(options...)
+	if err != nil {
+		base.report("[warning] unable to trace request %s: %v", id, err)
+		base.audit(ctx, entry, err)
+		fn(ctx)
+		return
+	}
+	defer func() {
+		err := p.stop(false)
+		if err != nil {
+			p.report("[warning] failed to stop the trace of request %s: %v", id, err)
+		}
+		entry.Artifacts = p.ArtifactPaths()
+		base.audit(ctx, entry, err)
+	}()
+	ctx, task := trace.NewTask(ctx, "request "+id)
+	defer task.End()
+	fn(ctx)
+}
+
+// Middleware returns net/http middleware tracing armed requests.
+func (t *RequestTracer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.do(r.Context(), r.Header.Get(t.header), r.RemoteAddr, func(ctx context.Context) {
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	})
+}
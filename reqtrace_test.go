@@ -0,0 +1,68 @@
+package profiler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestTracerTracesArmedRequestOnce(t *testing.T) {
+	dir := t.TempDir()
+	tracer := NewRequestTracer("", WithProfileFileLocation(dir), WithQuietOutput())
+	calls := 0
+	handler := tracer.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+	tracer.Arm("abc/123")
+
+	for i := 0; i < 2; i++ {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set(RequestIDHeader, "abc/123")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	assert.Equal(t, 2, calls)
+	info, err := os.Stat(filepath.Join(dir, "request-abc_123", TraceFileName))
+	assert.NoError(t, err)
+	assert.Positive(t, info.Size())
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+func TestRequestTracerIgnoresUnarmedRequests(t *testing.T) {
+	dir := t.TempDir()
+	tracer := NewRequestTracer("X-Trace", WithProfileFileLocation(dir), WithQuietOutput())
+	tracer.Arm("abc")
+	tracer.Disarm("abc")
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Trace", "abc")
+	tracer.Middleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), r)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestRequestTracerHeader(t *testing.T) {
+	assert.Equal(t, RequestIDHeader, NewRequestTracer("").Header())
+	assert.Equal(t, "X-Trace", NewRequestTracer("X-Trace").Header())
+}
+
+func TestRequestTracerStopsWhenHandlerPanics(t *testing.T) {
+	dir := t.TempDir()
+	tracer := NewRequestTracer("", WithProfileFileLocation(dir), WithQuietOutput())
+	tracer.Arm("panic")
+	assert.Panics(t, func() {
+		tracer.Do(context.Background(), "panic", func(context.Context) { panic("handler failed") })
+	})
+	assert.FileExists(t, filepath.Join(dir, "request-panic", TraceFileName))
+
+	// The session was released, so later requests are still traced.
+	tracer.Arm("next")
+	tracer.Do(context.Background(), "next", func(context.Context) {})
+	assert.FileExists(t, filepath.Join(dir, "request-next", TraceFileName))
+}
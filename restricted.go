@@ -0,0 +1,66 @@
+package profiler
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// ErrNoCPUSamples is returned when a CPU profile recorded no samples
+// despite the process consuming CPU, the SIGPROF signal driving the CPU
+// profiler is most likely blocked.
+var ErrNoCPUSamples = errors.New("the cpu profile recorded no samples")
+
+// minCPUForSamples is the CPU time consumed during a session above which
+// an empty CPU profile indicates SIGPROF is blocked, at the default rate
+// of 100 samples per second roughly 20 samples are expected.
+const minCPUForSamples = 200 * time.Millisecond
+
+// procStatusPath is the status file of the current process.
+var procStatusPath = "/proc/self/status"
+
+// seccompFiltered reports whether a seccomp filter is applied to the
+// process, always false off Linux.
+func seccompFiltered() bool {
+	f, err := os.Open(procStatusPath)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if value, ok := strings.CutPrefix(scanner.Text(), "Seccomp:"); ok {
+			// 2 is SECCOMP_MODE_FILTER.
+			return strings.TrimSpace(value) == "2"
+		}
+	}
+	return false
+}
+
+// checkCPUSamples returns an actionable error if the cpu profile at path
+// of fsys has no samples despite the process consuming cpu time.
+func checkCPUSamples(fsys FS, path string, cpu time.Duration) error {
+	if cpu < minCPUForSamples {
+		return nil
+	}
+	prof, err := readProfile(fsys, path)
+	if err != nil || len(prof.Sample) > 0 {
+		return nil
+	}
+	cause := "SIGPROF is most likely blocked, or timer_create/setitimer denied, by a seccomp or apparmor profile"
+	if seccompFiltered() {
+		cause = "a seccomp filter is applied to this process and is most likely blocking SIGPROF or timer_create/setitimer"
+	}
+	return fmt.Errorf("%w despite the process using %s of CPU: %s, allow them in the container security profile or use WithClockProfiling", ErrNoCPUSamples, cpu.Round(time.Millisecond), cause)
+}
+
+// cpuStartError explains why the runtime refused to start cpu profiling.
+func cpuStartError(err error) error {
+	if strings.Contains(err.Error(), "already in use") {
+		return fmt.Errorf("%w: another cpu profile is running, such as one requested through net/http/pprof", err)
+	}
+	return err
+}
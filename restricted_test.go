@@ -0,0 +1,49 @@
+package profiler
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeEmptyCPUProfile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), CPUFileName)
+	f, err := os.Create(path)
+	assert.NoError(t, err)
+	defer f.Close()
+	prof := &profile.Profile{SampleType: []*profile.ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}}}
+	assert.NoError(t, prof.Write(f))
+	return path
+}
+
+func TestCheckCPUSamples(t *testing.T) {
+	path := writeEmptyCPUProfile(t)
+	assert.NoError(t, checkCPUSamples(OSFS{}, path, time.Millisecond), "too little cpu was used to expect samples")
+	err := checkCPUSamples(OSFS{}, path, time.Second)
+	assert.ErrorIs(t, err, ErrNoCPUSamples)
+	assert.ErrorContains(t, err, "SIGPROF")
+}
+
+func TestCheckCPUSamplesSeccomp(t *testing.T) {
+	status := filepath.Join(t.TempDir(), "status")
+	assert.NoError(t, os.WriteFile(status, []byte("Name:\tapp\nSeccomp:\t2\n"), 0o644))
+	previous := procStatusPath
+	procStatusPath = status
+	defer func() { procStatusPath = previous }()
+	assert.True(t, seccompFiltered())
+	assert.ErrorContains(t, checkCPUSamples(OSFS{}, writeEmptyCPUProfile(t), time.Second), "a seccomp filter is applied")
+}
+
+func TestCPUProfileAlreadyInUse(t *testing.T) {
+	assert.NoError(t, pprof.StartCPUProfile(io.Discard))
+	defer pprof.StopCPUProfile()
+	_, err := start(WithCPUProfiler(), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput())
+	assert.ErrorContains(t, err, "net/http/pprof")
+}
@@ -0,0 +1,73 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CaptureSpec declares a single capture of a Run.
+type CaptureSpec struct {
+	// Mode is the profiling mode captured.
+	Mode Mode
+	// Delay is how long to wait, after the previous capture, before
+	// this capture begins.
+	Delay time.Duration
+	// Duration is how long the capture runs for.
+	Duration time.Duration
+	// Output is the folder the artifacts are written to, the profile
+	// file location of the Run options if empty.
+	Output string
+	// Rates override the sampling rates of the runtime profilers for this
+	// capture only, see WithSamplingRates.
+	Rates SamplingRates
+	// Options are applied to this capture only, after those of the Run.
+	Options []ProfileOption
+}
+
+// Run executes specs in order, such as 30s of CPU, then 10s of trace and
+// then a heap profile, returning the stopped *Profiler of each spec so
+// that its artifacts can be inspected.  Only a single profiling session
+// may be active at a time, so specs always run sequentially.  A failed
+// capture does not prevent the remainder running, the errors of every
+// capture are joined.  Run stops early once ctx is done.  Once every spec
+// has run, an overview cross-referencing the cpu, memory and goroutine
+// profiles is written to each folder that captured more than one mode,
+// see WriteOverview.
+func Run(ctx context.Context, specs []CaptureSpec, options ...ProfileOption) ([]*Profiler, error) {
+	profilers := make([]*Profiler, len(specs))
+	var errs []error
+	for i, spec := range specs {
+		if spec.Delay > 0 {
+			timer := time.NewTimer(spec.Delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return profilers, errors.Join(append(errs, ctx.Err())...)
+			}
+		}
+		specOptions := append([]ProfileOption{}, options...)
+		specOptions = append(specOptions, WithMode(spec.Mode))
+		if spec.Output != "" {
+			specOptions = append(specOptions, WithProfileFileLocation(spec.Output))
+		}
+		if spec.Rates != (SamplingRates{}) {
+			specOptions = append(specOptions, WithSamplingRates(spec.Rates))
+		}
+		specOptions = append(specOptions, spec.Options...)
+		p, err := Capture(ctx, spec.Duration, specOptions...)
+		profilers[i] = p
+		if err != nil {
+			errs = append(errs, fmt.Errorf("capture %d (%s): %w", i, spec.Mode, err))
+		}
+		if ctx.Err() != nil {
+			return profilers, errors.Join(errs...)
+		}
+	}
+	if err := writeOverviews(profilers); err != nil {
+		errs = append(errs, fmt.Errorf("overview: %w", err))
+	}
+	return profilers, errors.Join(errs...)
+}
@@ -0,0 +1,45 @@
+package profiler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunCapturesSpecsInOrder(t *testing.T) {
+	dir := t.TempDir()
+	var modes []Mode
+	hook := WithBeforeCapture(func(mode Mode) { modes = append(modes, mode) })
+	profilers, err := Run(context.Background(), []CaptureSpec{
+		{Mode: CPUMode, Duration: 20 * time.Millisecond},
+		{Mode: TraceMode, Delay: 10 * time.Millisecond, Duration: 10 * time.Millisecond, Output: filepath.Join(dir, "trace")},
+		{Mode: MemoryHeapMode, Duration: time.Millisecond},
+	}, WithProfileFileLocation(dir), WithQuietOutput(), hook)
+	assert.NoError(t, err)
+	assert.Equal(t, []Mode{CPUMode, TraceMode, MemoryHeapMode}, modes)
+	assert.Len(t, profilers, 3)
+	assert.Equal(t, []string{filepath.Join(dir, CPUFileName)}, profilers[0].ArtifactPaths())
+	assert.Equal(t, []string{filepath.Join(dir, "trace", TraceFileName)}, profilers[1].ArtifactPaths())
+	assert.Equal(t, []string{filepath.Join(dir, MemoryFileName)}, profilers[2].ArtifactPaths())
+}
+
+func TestRunJoinsErrorsAndContinues(t *testing.T) {
+	profilers, err := Run(context.Background(), []CaptureSpec{
+		{Mode: CPUMode},
+		{Mode: MemoryHeapMode, Duration: time.Millisecond},
+	}, WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.ErrorContains(t, err, "capture 0 (cpu)")
+	assert.Nil(t, profilers[0])
+	assert.NotNil(t, profilers[1])
+}
+
+func TestRunStopsWhenContextIsDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	profilers, err := Run(ctx, []CaptureSpec{{Mode: CPUMode, Delay: time.Second, Duration: time.Second}}, WithQuietOutput())
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Nil(t, profilers[0])
+}
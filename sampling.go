@@ -0,0 +1,31 @@
+package profiler
+
+import (
+	"errors"
+	"hash/fnv"
+	"math"
+	"os"
+	"strconv"
+)
+
+// ErrNotSampled is returned when a capture is skipped because this
+// process was not selected by WithProbability.
+var ErrNotSampled = errors.New("profiling is not sampled for this process")
+
+// sampled reports whether this process is selected to profile.  The
+// decision is derived from the hostname and PID so that it is stable
+// for the lifetime of the process but varies across a fleet.
+func (p *Profiler) sampled() bool {
+	if p.probability == nil {
+		return true
+	}
+	return processSample(hostname(), os.Getpid()) < *p.probability
+}
+
+// processSample maps a host and PID to a uniformly distributed value
+// in the range [0, 1).
+func processSample(host string, pid int) float64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(host + "/" + strconv.Itoa(pid)))
+	return float64(h.Sum64()) / (math.MaxUint64 + 1.0)
+}
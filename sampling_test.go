@@ -0,0 +1,35 @@
+package profiler
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessSampleIsStableAndUniform(t *testing.T) {
+	assert.Equal(t, processSample("host", 1), processSample("host", 1))
+	selected := 0
+	for pid := 0; pid < 10000; pid++ {
+		if processSample("host-"+strconv.Itoa(pid%7), pid) < 0.25 {
+			selected++
+		}
+	}
+	assert.InDelta(t, 2500, selected, 250)
+}
+
+func TestWithProbabilityZeroSkipsProfiling(t *testing.T) {
+	storage := t.TempDir()
+	p := Start(WithProbability(0), WithProfileFileLocation(storage), WithoutSignalHandling(), WithQuietOutput())
+	p.Stop()
+	assert.Empty(t, p.ArtifactPaths())
+
+	_, err := Capture(context.Background(), time.Millisecond, WithProbability(0), WithProfileFileLocation(storage), WithQuietOutput())
+	assert.ErrorIs(t, err, ErrNotSampled)
+
+	p = Start(WithProbability(1), WithProfileFileLocation(storage), WithoutSignalHandling(), WithQuietOutput())
+	p.Stop()
+	assert.Len(t, p.ArtifactPaths(), 1)
+}
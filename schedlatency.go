@@ -0,0 +1,129 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"runtime/metrics"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// schedLatencyMetric is the runtime/metrics histogram of the time
+// goroutines have spent runnable (scheduled) before actually running.
+const schedLatencyMetric = "/sched/latencies:seconds"
+
+// readSchedLatencies reads the current scheduler latency histogram.
+func readSchedLatencies() (*metrics.Float64Histogram, error) {
+	sample := []metrics.Sample{{Name: schedLatencyMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() != metrics.KindFloat64Histogram {
+		return nil, errors.New("scheduler latency metrics are not supported by this runtime")
+	}
+	return sample[0].Value.Float64Histogram(), nil
+}
+
+// schedLatencyStrategyFn records the scheduler latency histogram when
+// profiling begins and writes the latencies observed during the session,
+// one sample per histogram bucket, as a pprof compatible profile.  High
+// latencies indicate goroutines waiting on a P, typically a result of
+// GOMAXPROCS exceeding the CPU available or CPU throttling.
+func schedLatencyStrategyFn(p *Profiler) (FinalizerFunc, error) {
+	before, err := readSchedLatencies()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.openProfileFile(SchedLatencyMode.fileName()); err != nil {
+		return nil, err
+	}
+	started := time.Now()
+	return func() error {
+		after, err := readSchedLatencies()
+		if err != nil {
+			return errors.Join(err, p.profileFile.Close())
+		}
+		prof := schedLatencyProfile(before, after, started, time.Since(started))
+		if count, mean := schedLatencySummary(prof); count > 0 {
+			p.report("%d goroutines were scheduled, waiting a mean of %s runnable before running", count, mean)
+		}
+		return errors.Join(prof.Write(p.profileFile), p.profileFile.Close())
+	}, nil
+}
+
+// schedLatencyProfile builds a profile from the difference between two
+// readings of the scheduler latency histogram.
+func schedLatencyProfile(before *metrics.Float64Histogram, after *metrics.Float64Histogram, started time.Time, d time.Duration) *profile.Profile {
+	root := &profile.Function{ID: 1, Name: "scheduler latency"}
+	rootLocation := &profile.Location{ID: 1, Line: []profile.Line{{Function: root}}}
+	prof := &profile.Profile{
+		SampleType: []*profile.ValueType{
+			{Type: "goroutines", Unit: "count"},
+			{Type: "latency", Unit: "nanoseconds"},
+		},
+		PeriodType:    &profile.ValueType{Type: "latency", Unit: "nanoseconds"},
+		Period:        1,
+		TimeNanos:     started.UnixNano(),
+		DurationNanos: d.Nanoseconds(),
+		Function:      []*profile.Function{root},
+		Location:      []*profile.Location{rootLocation},
+	}
+	for i, count := range after.Counts {
+		if i < len(before.Counts) {
+			count -= before.Counts[i]
+		}
+		if count == 0 {
+			continue
+		}
+		low, high := after.Buckets[i], after.Buckets[i+1]
+		id := uint64(len(prof.Function) + 1)
+		fn := &profile.Function{ID: id, Name: fmt.Sprintf("runnable [%s, %s)", bucketDuration(low), bucketDuration(high))}
+		location := &profile.Location{ID: id, Line: []profile.Line{{Function: fn}}}
+		prof.Function = append(prof.Function, fn)
+		prof.Location = append(prof.Location, location)
+		prof.Sample = append(prof.Sample, &profile.Sample{
+			Location: []*profile.Location{location, rootLocation},
+			Value:    []int64{int64(count), int64(count) * bucketMidpoint(low, high).Nanoseconds()},
+		})
+	}
+	return prof
+}
+
+// schedLatencySummary returns the number of goroutines scheduled and
+// their mean latency.
+func schedLatencySummary(prof *profile.Profile) (int64, time.Duration) {
+	var count, total int64
+	for _, sample := range prof.Sample {
+		count += sample.Value[0]
+		total += sample.Value[1]
+	}
+	if count == 0 {
+		return 0, 0
+	}
+	return count, time.Duration(total / count)
+}
+
+// bucketMidpoint returns the midpoint of a histogram bucket, using the
+// finite boundary for the unbounded first and last buckets.
+func bucketMidpoint(low float64, high float64) time.Duration {
+	switch {
+	case math.IsInf(low, -1):
+		return bucketDurationValue(high)
+	case math.IsInf(high, 1):
+		return bucketDurationValue(low)
+	}
+	return bucketDurationValue((low + high) / 2)
+}
+
+// bucketDuration formats a histogram boundary in seconds.
+func bucketDuration(seconds float64) string {
+	if math.IsInf(seconds, 0) {
+		return fmt.Sprint(seconds)
+	}
+	return bucketDurationValue(seconds).String()
+}
+
+// bucketDurationValue converts a histogram boundary in seconds.
+func bucketDurationValue(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
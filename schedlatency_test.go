@@ -0,0 +1,42 @@
+package profiler
+
+import (
+	"context"
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchedulerLatencyProfile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.GOMAXPROCS(0)*4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				runtime.Gosched()
+			}
+		}()
+	}
+	p, err := Capture(context.Background(), 50*time.Millisecond, WithSchedulerLatencyProfiler(), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	cancel()
+	wg.Wait()
+	assert.NoError(t, err)
+
+	f, err := os.Open(p.ArtifactPaths()[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	prof, err := profile.Parse(f)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, prof.Sample)
+	count, _ := schedLatencySummary(prof)
+	assert.Positive(t, count)
+}
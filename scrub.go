@@ -0,0 +1,111 @@
+package profiler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+
+	"github.com/google/pprof/profile"
+)
+
+// Scrubber is a PostProcessor which removes, or hashes, personally
+// identifiable information before a profile leaves the process, for
+// teams whose pprof labels contain user identifiers.
+//
+//	profiler.WithPostProcessor(profiler.Scrubber{Labels: []string{"user_id"}, Hash: true}.Process)
+type Scrubber struct {
+	// Labels are the keys of pprof labels whose values are scrubbed.
+	Labels []string
+	// Patterns are scrubbed wherever they match in the strings of the
+	// profile, label keys and values, numeric label keys and units,
+	// sample and period types, function and file names, mappings and
+	// comments.
+	Patterns []*regexp.Regexp
+	// Hash replaces scrubbed values with a short sha256 hash, rather than
+	// removing them, so samples can still be grouped by the value.
+	Hash bool
+}
+
+// Process scrubs prof in place, it satisfies PostProcessor.
+func (s Scrubber) Process(prof *profile.Profile) (*profile.Profile, error) {
+	for _, sample := range prof.Sample {
+		for _, key := range s.Labels {
+			values, ok := sample.Label[key]
+			if !ok {
+				continue
+			}
+			if !s.Hash {
+				delete(sample.Label, key)
+				continue
+			}
+			for i, value := range values {
+				values[i] = s.hash(value)
+			}
+		}
+		for _, values := range sample.Label {
+			for i, value := range values {
+				values[i] = s.scrub(value)
+			}
+		}
+		for _, units := range sample.NumUnit {
+			for i, unit := range units {
+				units[i] = s.scrub(unit)
+			}
+		}
+		sample.Label = scrubKeys(s, sample.Label)
+		sample.NumLabel = scrubKeys(s, sample.NumLabel)
+		sample.NumUnit = scrubKeys(s, sample.NumUnit)
+	}
+	for _, valueType := range append(prof.SampleType, prof.PeriodType) {
+		if valueType != nil {
+			valueType.Type = s.scrub(valueType.Type)
+			valueType.Unit = s.scrub(valueType.Unit)
+		}
+	}
+	prof.DefaultSampleType = s.scrub(prof.DefaultSampleType)
+	for _, fn := range prof.Function {
+		fn.Name = s.scrub(fn.Name)
+		fn.SystemName = s.scrub(fn.SystemName)
+		fn.Filename = s.scrub(fn.Filename)
+	}
+	for _, mapping := range prof.Mapping {
+		mapping.File = s.scrub(mapping.File)
+	}
+	for i, comment := range prof.Comments {
+		prof.Comments[i] = s.scrub(comment)
+	}
+	return prof, nil
+}
+
+// scrubKeys returns labels with the patterns of s scrubbed from its keys,
+// the values of keys which scrub to the same key are merged.
+func scrubKeys[V any](s Scrubber, labels map[string][]V) map[string][]V {
+	if len(s.Patterns) == 0 || labels == nil {
+		return labels
+	}
+	scrubbed := make(map[string][]V, len(labels))
+	for key, values := range labels {
+		key = s.scrub(key)
+		scrubbed[key] = append(scrubbed[key], values...)
+	}
+	return scrubbed
+}
+
+// scrub replaces every match of the patterns in value.
+func (s Scrubber) scrub(value string) string {
+	for _, pattern := range s.Patterns {
+		value = pattern.ReplaceAllStringFunc(value, func(match string) string {
+			if s.Hash {
+				return s.hash(match)
+			}
+			return ""
+		})
+	}
+	return value
+}
+
+// hash returns a short, stable hash of value.
+func (s Scrubber) hash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return "sha256:" + hex.EncodeToString(sum[:8])
+}
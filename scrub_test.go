@@ -0,0 +1,66 @@
+package profiler
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+func scrubbable() *profile.Profile {
+	fn := &profile.Function{ID: 1, Name: "handle", Filename: "/home/alice/app/handler.go"}
+	location := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	return &profile.Profile{
+		SampleType: []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Sample: []*profile.Sample{{
+			Location: []*profile.Location{location},
+			Value:    []int64{1},
+			Label:    map[string][]string{"user_id": {"42"}, "email": {"contact alice@example.com"}, "route": {"/users"}},
+		}, {
+			Location: []*profile.Location{location},
+			Value:    []int64{1},
+			Label:    map[string][]string{"tenant_alice@example.com": {"gold"}},
+			NumLabel: map[string][]int64{"bytes_alice@example.com": {10}},
+			NumUnit:  map[string][]string{"bytes_alice@example.com": {"alice@example.com"}},
+		}},
+		Location: []*profile.Location{location},
+		Function: []*profile.Function{fn},
+		Comments: []string{"captured for alice@example.com"},
+	}
+}
+
+var emailPattern = regexp.MustCompile(`[a-z]+@example\.com`)
+
+func TestScrubberRemoves(t *testing.T) {
+	prof, err := Scrubber{Labels: []string{"user_id"}, Patterns: []*regexp.Regexp{emailPattern, regexp.MustCompile(`alice`)}}.Process(scrubbable())
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]string{"email": {"contact "}, "route": {"/users"}}, prof.Sample[0].Label)
+	assert.Equal(t, "/home//app/handler.go", prof.Function[0].Filename)
+	assert.Equal(t, []string{"captured for "}, prof.Comments)
+	assert.Equal(t, map[string][]string{"tenant_": {"gold"}}, prof.Sample[1].Label)
+	assert.Equal(t, map[string][]int64{"bytes_": {10}}, prof.Sample[1].NumLabel)
+	assert.Equal(t, map[string][]string{"bytes_": {""}}, prof.Sample[1].NumUnit)
+	assert.NoError(t, prof.CheckValid())
+}
+
+func TestScrubberScrubsSampleTypes(t *testing.T) {
+	prof := scrubbable()
+	prof.SampleType = []*profile.ValueType{{Type: "alice@example.com_requests", Unit: "count"}}
+	prof.PeriodType = &profile.ValueType{Type: "alice@example.com", Unit: "count"}
+	prof.DefaultSampleType = "alice@example.com_requests"
+	prof, err := Scrubber{Patterns: []*regexp.Regexp{emailPattern}}.Process(prof)
+	assert.NoError(t, err)
+	assert.Equal(t, "_requests", prof.SampleType[0].Type)
+	assert.Equal(t, "", prof.PeriodType.Type)
+	assert.Equal(t, "_requests", prof.DefaultSampleType)
+}
+
+func TestScrubberHashes(t *testing.T) {
+	scrubber := Scrubber{Labels: []string{"user_id"}, Patterns: []*regexp.Regexp{emailPattern}, Hash: true}
+	prof, err := scrubber.Process(scrubbable())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{scrubber.hash("42")}, prof.Sample[0].Label["user_id"])
+	assert.Equal(t, []string{"contact " + scrubber.hash("alice@example.com")}, prof.Sample[0].Label["email"])
+	assert.Regexp(t, `^sha256:[0-9a-f]{16}$`, scrubber.hash("42"))
+}
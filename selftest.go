@@ -0,0 +1,103 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/symonk/profiler/profilertest/workload"
+)
+
+// selfTestDuration is how long each mode is captured for by SelfTest.
+var selfTestDuration = 200 * time.Millisecond
+
+// SelfTestResult is the outcome of self testing a single mode.
+type SelfTestResult struct {
+	// Mode is the mode tested.
+	Mode Mode
+	// Err is the problem found, nil if the mode works.
+	Err error
+}
+
+// SelfTest verifies profiling works in the target environment before it
+// is needed.  The configuration is validated as by WithDryRun, then each
+// mode (every mode except AutoMode if none are given) captures a tiny
+// synthetic workload into a temporary folder and the profiles produced
+// are verified to be non-empty.  Problems such as a read-only output
+// directory or seccomp blocking SIGPROF, which silently produces empty
+// CPU profiles, are reported up front.  The results of every mode are
+// returned along with the joined errors of all of them.
+func SelfTest(ctx context.Context, modes []Mode, options ...ProfileOption) ([]SelfTestResult, error) {
+	errs := []error{}
+	if err := New(append(append([]ProfileOption{}, options...), WithQuietOutput())...).dryRun(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(modes) == 0 {
+		for mode := range StrategyMap {
+			if mode != AutoMode {
+				modes = append(modes, mode)
+			}
+		}
+		sort.Slice(modes, func(i, j int) bool { return modes[i] < modes[j] })
+	}
+	dir, err := os.MkdirTemp("", "profiler-selftest")
+	if err != nil {
+		return nil, errors.Join(append(errs, fmt.Errorf("unable to create a temporary folder: %w", err))...)
+	}
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	results := make([]SelfTestResult, 0, len(modes))
+	for _, mode := range modes {
+		err := selfTestMode(ctx, mode, dir, options)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", mode, err))
+		}
+		results = append(results, SelfTestResult{Mode: mode, Err: err})
+	}
+	return results, errors.Join(errs...)
+}
+
+// selfTestMode captures mode while running the synthetic workload and
+// verifies the artifacts produced.
+func selfTestMode(ctx context.Context, mode Mode, dir string, options []ProfileOption) error {
+	workCtx, stop := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		workload.Mixed(workCtx)
+	}()
+	options = append(append([]ProfileOption{}, options...), WithMode(mode), WithProfileFileLocation(dir), WithQuietOutput())
+	p, err := Capture(ctx, selfTestDuration, options...)
+	stop()
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+	if len(p.ArtifactPaths()) == 0 {
+		return errors.New("no artifacts were written")
+	}
+	for _, path := range p.ArtifactPaths() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if info.Size() == 0 {
+			return fmt.Errorf("%s is empty", path)
+		}
+		if mode == CPUMode {
+			prof, err := ReadProfile(path)
+			if err != nil {
+				return err
+			}
+			if len(prof.Sample) == 0 {
+				return errors.New("no CPU samples were recorded, SIGPROF may be blocked (seccomp) or the process denied CPU time")
+			}
+		}
+	}
+	return nil
+}
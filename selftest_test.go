@@ -0,0 +1,23 @@
+package profiler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfTest(t *testing.T) {
+	results, err := SelfTest(context.Background(), []Mode{CPUMode, MemoryMode, TraceMode}, WithProfileFileLocation(t.TempDir()))
+	assert.NoError(t, err)
+	assert.Equal(t, []SelfTestResult{{Mode: CPUMode}, {Mode: MemoryMode}, {Mode: TraceMode}}, results)
+}
+
+func TestSelfTestReportsUnwritableOutput(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file")
+	assert.NoError(t, os.WriteFile(file, nil, 0o644))
+	_, err := SelfTest(context.Background(), []Mode{MemoryHeapMode}, WithProfileFileLocation(file), WithFallbackDir(file))
+	assert.ErrorContains(t, err, "is not writable")
+}
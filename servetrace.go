@@ -0,0 +1,57 @@
+package profiler
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// goBinary is the go command used to serve traces.
+var goBinary = "go"
+
+// serveTrace serves the execution trace of the session with `go tool
+// trace`, as configured by WithServeTrace.  The trace is not served when
+// the process is about to exit following a signal.
+func (p *Profiler) serveTrace() {
+	if p.serveTraceAddr == "" || p.profileMode != TraceMode {
+		return
+	}
+	if p.interrupted && p.exitOnSignal {
+		p.report("[warning] the process is exiting, the trace will not be served")
+		return
+	}
+	var path string
+	for _, artifact := range p.artifacts {
+		if strings.HasSuffix(artifact, TraceFileName) {
+			path = artifact
+		}
+	}
+	if path == "" {
+		p.report("[warning] the trace cannot be served, it was not written locally or is compressed")
+		return
+	}
+	cmd := exec.Command(goBinary, "tool", "trace", "-http="+p.serveTraceAddr, path)
+	if err := cmd.Start(); err != nil {
+		p.report("[warning] unable to serve the trace: %s", err)
+		p.recordError(err)
+		return
+	}
+	p.mu.Lock()
+	p.traceServer = cmd
+	p.mu.Unlock()
+	p.report("serving the trace at http://%s, port forward to view it remotely", p.serveTraceAddr)
+	goInternal(func() { _ = cmd.Wait() })
+}
+
+// StopTraceServer stops the `go tool trace` process serving the trace of
+// the session, see WithServeTrace.
+func (p *Profiler) StopTraceServer() error {
+	p.mu.Lock()
+	cmd := p.traceServer
+	p.traceServer = nil
+	p.mu.Unlock()
+	if cmd == nil {
+		return errors.New("the trace is not being served")
+	}
+	return cmd.Process.Kill()
+}
@@ -0,0 +1,43 @@
+package profiler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeGo records its arguments and then waits to be killed, standing in
+// for `go tool trace`.
+const fakeGo = `#!/bin/sh
+echo "$@" > "$(dirname "$0")/args"
+exec sleep 60
+`
+
+func TestServeTrace(t *testing.T) {
+	bin := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(bin, "go"), []byte(fakeGo), 0o755))
+	previous := goBinary
+	goBinary = filepath.Join(bin, "go")
+	defer func() { goBinary = previous }()
+
+	dir := t.TempDir()
+	p, err := Capture(context.Background(), 10*time.Millisecond, WithTracing(), WithServeTrace("127.0.0.1:9999"), WithProfileFileLocation(dir), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.Eventually(t, func() bool {
+		args, err := os.ReadFile(filepath.Join(bin, "args"))
+		return err == nil && strings.TrimSpace(string(args)) == "tool trace -http=127.0.0.1:9999 "+filepath.Join(dir, TraceFileName)
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.NoError(t, p.StopTraceServer())
+	assert.Error(t, p.StopTraceServer())
+}
+
+func TestServeTraceIgnoresOtherModes(t *testing.T) {
+	p, err := Capture(context.Background(), time.Millisecond, WithHeapProfiler(), WithServeTrace("127.0.0.1:9999"), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.Error(t, p.StopTraceServer())
+}
@@ -0,0 +1,116 @@
+package profiler
+
+import (
+	"context"
+	"sync"
+)
+
+// Service runs a profiling session as a component of an application, with
+// the Start(ctx) and Stop(ctx) lifecycle expected by frameworks such as
+// fx, and Run(ctx) for run.Group and errgroup.  Unlike the package level
+// Start it never installs signal handling or exits the process, errors are
+// returned to the framework instead.
+//
+//	svc := profiler.NewService(profiler.WithHeapProfiler())
+//	lc.Append(fx.Hook{OnStart: svc.Start, OnStop: svc.Stop})
+//
+// A Service may be started again once stopped, beginning a new session.
+type Service struct {
+	options []ProfileOption
+	mu      sync.Mutex
+	p       *Profiler
+	running bool
+}
+
+// NewService returns a Service whose sessions are configured by options.
+func NewService(options ...ProfileOption) *Service {
+	return &Service{options: options}
+}
+
+// Start begins a profiling session, ctx bounds only the start up, such as
+// waiting for another session with WithExclusiveQueueing.  A process not
+// selected by WithProbability, or with profiling disabled by
+// WithEnabledFunc, starts nothing and Start returns nil.
+func (s *Service) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running {
+		return ErrAlreadyStarted
+	}
+	p := New(s.options...)
+	switch {
+	case p.dryRunOnly:
+		return p.dryRun()
+	case !p.sampled():
+		p.report("profiling skipped, this process was not sampled (probability %v)", *p.probability)
+		return nil
+	case p.enabled != nil && !p.enabled():
+		p.report("profiling is disabled, skipping the session")
+		return nil
+	}
+	p, err := startContext(ctx, append(append([]ProfileOption{}, s.options...), WithoutSignalHandling())...)
+	if err != nil {
+		return err
+	}
+	s.p, s.running = p, true
+	return nil
+}
+
+// take marks the Service as stopped, returning the session to stop, nil
+// if it is not running.
+func (s *Service) take() *Profiler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.running {
+		return nil
+	}
+	s.running = false
+	return s.p
+}
+
+// Stop ends the session, returning the errors of its teardown.  Stop
+// returns ctx.Err() if ctx is done before the teardown completes, which
+// continues in the background.  Stopping a Service which is not running
+// does nothing.
+func (s *Service) Stop(ctx context.Context) error {
+	p := s.take()
+	if p == nil {
+		return nil
+	}
+	stopped := make(chan error, 1)
+	go func() { stopped <- p.stop(false) }()
+	select {
+	case err := <-stopped:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Run starts a session and stops it once ctx is done, returning the
+// errors of both, to be run as an actor of run.Group or an errgroup:
+//
+//	g.Add(func() error { return svc.Run(ctx) }, func(error) { cancel() })
+//
+// The session is interrupted, as by a signal, and the teardown runs to
+// completion regardless of ctx.
+func (s *Service) Run(ctx context.Context) error {
+	if err := s.Start(ctx); err != nil {
+		return err
+	}
+	<-ctx.Done()
+	p := s.take()
+	if p == nil {
+		return nil
+	}
+	return p.stop(true)
+}
+
+// Profiler returns the running or most recently stopped session, nil if
+// none has started, for access to Report, Phase and the other methods of
+// a session.
+func (s *Service) Profiler() *Profiler {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.p
+}
@@ -0,0 +1,59 @@
+package profiler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServiceLifecycle(t *testing.T) {
+	svc := NewService(WithHeapProfiler(), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.Nil(t, svc.Profiler())
+	assert.NoError(t, svc.Stop(context.Background()), "stopping before starting does nothing")
+
+	require.NoError(t, svc.Start(context.Background()))
+	assert.ErrorIs(t, svc.Start(context.Background()), ErrAlreadyStarted)
+	require.NoError(t, svc.Stop(context.Background()))
+	assert.NoError(t, svc.Stop(context.Background()))
+	assert.Len(t, svc.Profiler().ArtifactPaths(), 1)
+	assert.False(t, svc.Profiler().Report().Interrupted)
+
+	// A stopped service starts a new session.
+	first := svc.Profiler()
+	require.NoError(t, svc.Start(context.Background()))
+	assert.NotSame(t, first, svc.Profiler())
+	require.NoError(t, svc.Stop(context.Background()))
+}
+
+func TestServiceRun(t *testing.T) {
+	svc := NewService(WithHeapProfiler(), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- svc.Run(ctx) }()
+	assert.Eventually(t, func() bool { return svc.Profiler() != nil }, time.Second, time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+	assert.True(t, svc.Profiler().Report().Interrupted)
+	assert.Len(t, svc.Profiler().ArtifactPaths(), 1)
+}
+
+func TestServiceSkipsDisabledProfiling(t *testing.T) {
+	svc := NewService(WithHeapProfiler(), WithEnabledFunc(func() bool { return false }), WithQuietOutput())
+	require.NoError(t, svc.Start(context.Background()))
+	assert.Nil(t, svc.Profiler())
+	assert.NoError(t, svc.Stop(context.Background()))
+}
+
+func TestServiceStopHonoursContext(t *testing.T) {
+	release := make(chan struct{})
+	svc := NewService(WithHeapProfiler(), WithProfileFileLocation(t.TempDir()), WithQuietOutput(), WithCallback(func(*Profiler) { <-release }))
+	require.NoError(t, svc.Start(context.Background()))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, svc.Stop(ctx), context.DeadlineExceeded)
+	close(release)
+	_ = svc.Profiler().Wait()
+}
@@ -0,0 +1,84 @@
+package profiler
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ActiveSessionError is returned when a profiling instance is started
+// while another is still active, it identifies the mode of the active
+// session.  Profilers such as the runtime CPU profiler and fgprof cannot
+// reliably run together, so only a single session may be active at a
+// time, see WithExclusiveQueueing to wait rather than fail.
+// errors.Is(err, ErrAlreadyStarted) reports true for an ActiveSessionError.
+type ActiveSessionError struct {
+	// Mode is the mode of the active session.
+	Mode Mode
+}
+
+func (e *ActiveSessionError) Error() string {
+	return fmt.Sprintf("%s: a %s session is active", ErrAlreadyStarted, e.Mode)
+}
+
+// Is allows matching an ActiveSessionError against ErrAlreadyStarted.
+func (e *ActiveSessionError) Is(target error) bool {
+	return target == ErrAlreadyStarted
+}
+
+// exclusivity guards the single active profiling session, queueing
+// sessions started with WithExclusiveQueueing until it is released.
+type exclusivity struct {
+	mu       sync.Mutex
+	owner    *Profiler
+	released chan struct{}
+}
+
+// session is the process wide exclusivity manager.
+var session = &exclusivity{}
+
+// acquire makes p the active session.  If another session is active an
+// ActiveSessionError is returned, unless p queues, in which case acquire
+// waits for it to be released or ctx to be done.
+func (e *exclusivity) acquire(ctx context.Context, p *Profiler) error {
+	for {
+		e.mu.Lock()
+		if e.owner == nil {
+			e.owner = p
+			e.released = make(chan struct{})
+			e.mu.Unlock()
+			return nil
+		}
+		active, released := e.owner.Mode(), e.released
+		e.mu.Unlock()
+		if !p.queue {
+			return &ActiveSessionError{Mode: active}
+		}
+		p.report("a %s session is active, waiting for it to finish before starting %s", active, p.Mode())
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// owns reports whether p is the active session.
+func (e *exclusivity) owns(p *Profiler) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.owner == p
+}
+
+// release releases the session held by p, reporting false if p is not
+// the active session.
+func (e *exclusivity) release(p *Profiler) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.owner != p {
+		return false
+	}
+	e.owner = nil
+	close(e.released)
+	return true
+}
@@ -0,0 +1,57 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentSessionIsRejected(t *testing.T) {
+	p, err := start(WithCPUProfiler(), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput())
+	assert.NoError(t, err)
+	defer p.stop(false)
+
+	_, err = start(WithClockProfiling(), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput())
+	assert.ErrorIs(t, err, ErrAlreadyStarted)
+	var active *ActiveSessionError
+	assert.True(t, errors.As(err, &active))
+	assert.Equal(t, CPUMode, active.Mode)
+}
+
+func TestExclusiveQueueingWaitsForActiveSession(t *testing.T) {
+	p, err := start(WithCPUProfiler(), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput())
+	assert.NoError(t, err)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = p.stop(false)
+	}()
+
+	queued, err := Capture(context.Background(), 10*time.Millisecond, WithHeapProfiler(), WithExclusiveQueueing(), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.Len(t, queued.ArtifactPaths(), 1)
+	<-p.done
+}
+
+func TestExclusiveQueueingRespectsContext(t *testing.T) {
+	p, err := start(WithCPUProfiler(), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput())
+	assert.NoError(t, err)
+	defer p.stop(false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = Capture(ctx, time.Second, WithHeapProfiler(), WithExclusiveQueueing(), WithQuietOutput())
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestStopOfUnstartedProfilerDoesNotReleaseActiveSession(t *testing.T) {
+	p, err := start(WithCPUProfiler(), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput())
+	assert.NoError(t, err)
+	defer p.stop(false)
+
+	assert.Error(t, New(WithQuietOutput()).stop(false))
+	_, err = start(WithCPUProfiler(), WithoutSignalHandling(), WithQuietOutput())
+	assert.ErrorIs(t, err, ErrAlreadyStarted)
+}
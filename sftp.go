@@ -0,0 +1,89 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// SSHAuth configures how the system OpenSSH client authenticates with
+// the remote host.  Any field may be left empty to defer to the users
+// ssh configuration (~/.ssh/config, agent etc).
+type SSHAuth struct {
+	// User is the remote user to log in as.
+	User string
+	// IdentityFile is the private key used for authentication.
+	IdentityFile string
+	// Port is the remote port, zero uses the ssh default.
+	Port int
+	// Options are additional ssh_config options, for example
+	// "StrictHostKeyChecking=accept-new".
+	Options []string
+}
+
+// SFTPSink uploads artifacts to a folder on a remote host using the system
+// `sftp` client in batch mode, this allows air gapped or firewalled hosts
+// to push artifacts to a bastion collection point without any additional
+// dependencies.  Authentication must be non interactive (keys or an agent).
+type SFTPSink struct {
+	host   string
+	folder string
+	auth   SSHAuth
+}
+
+// NewSFTPSink returns a sink uploading artifacts into folder on host.
+func NewSFTPSink(host string, folder string, auth SSHAuth) *SFTPSink {
+	return &SFTPSink{host: host, folder: folder, auth: auth}
+}
+
+// Create returns a writer spooling the artifact locally, into the
+// fallback folder if one is configured (see WithFallbackDir), the upload
+// is performed when it is closed.
+func (s *SFTPSink) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	return newSpoolFile(ctx, func(local string) error {
+		return s.put(ctx, local, path.Join(s.folder, name))
+	})
+}
+
+// put runs the sftp batch uploading local to remote.
+func (s *SFTPSink) put(ctx context.Context, local string, remote string) error {
+	// A leading '-' permits the mkdir to fail when the folder exists.
+	batch := fmt.Sprintf("-mkdir %s\nput %s %s\n", sftpQuote(s.folder), sftpQuote(local), sftpQuote(remote))
+	cmd := exec.CommandContext(ctx, "sftp", s.args()...)
+	cmd.Stdin = strings.NewReader(batch)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("sftp upload to %s failed: %w: %s", s.host, err, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// args builds the sftp command line arguments.
+func (s *SFTPSink) args() []string {
+	args := []string{"-b", "-", "-o", "BatchMode=yes"}
+	if s.auth.IdentityFile != "" {
+		args = append(args, "-i", s.auth.IdentityFile)
+	}
+	if s.auth.Port != 0 {
+		args = append(args, "-P", strconv.Itoa(s.auth.Port))
+	}
+	for _, option := range s.auth.Options {
+		args = append(args, "-o", option)
+	}
+	host := s.host
+	if s.auth.User != "" {
+		host = s.auth.User + "@" + host
+	}
+	return append(args, host)
+}
+
+// sftpQuote quotes a path for use in an sftp batch file.
+func sftpQuote(s string) string {
+	return `"` + strings.ReplaceAll(strings.ReplaceAll(s, `\`, `\\`), `"`, `\"`) + `"`
+}
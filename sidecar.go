@@ -0,0 +1,259 @@
+package profiler
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Source is a process which profiles are pulled from by RunSidecar.
+type Source interface {
+	// Pull writes a capture of mode to w, lasting d for the modes which
+	// capture over a duration.
+	Pull(ctx context.Context, mode Mode, d time.Duration, w io.Writer) error
+}
+
+// ModeSource is a Source which reports the modes it can serve, so that
+// RunSidecar rejects the others up front rather than failing every cycle.
+type ModeSource interface {
+	Source
+	// Serves reports whether mode can be pulled.
+	Serves(mode Mode) bool
+}
+
+// AgentSource pulls from the Agent listening on Addr, see StartAgent.  Only
+// heap, cpu and trace are supported, for the durations of AgentCapture.
+type AgentSource struct {
+	Addr string
+	// TLSConfig connects to an agent serving TLS, see WithAgentTLS.
+	TLSConfig *tls.Config
+}
+
+// Serves reports whether the agent can capture mode.
+func (a AgentSource) Serves(mode Mode) bool {
+	_, ok := agentSignals[mode]
+	return ok
+}
+
+// Pull requests a capture of mode from the agent.
+func (a AgentSource) Pull(ctx context.Context, mode Mode, _ time.Duration, w io.Writer) error {
+	return AgentCaptureTLS(ctx, a.Addr, mode, w, a.TLSConfig)
+}
+
+// debugEndpoints are the net/http/pprof endpoints of each mode.
+var debugEndpoints = map[Mode]string{
+	CPUMode:          "profile",
+	TraceMode:        "trace",
+	MemoryHeapMode:   "heap",
+	MemoryAllocMode:  "allocs",
+	BlockMode:        "block",
+	MutexMode:        "mutex",
+	GoroutineMode:    "goroutine",
+	ThreadCreateMode: "threadcreate",
+}
+
+// DebugSource pulls from the net/http/pprof endpoints beneath URL, such as
+// http://localhost:6060/debug/pprof, of a process which serves them.
+type DebugSource struct {
+	URL string
+	// Client performs the requests, http.DefaultClient if nil.  Its
+	// transport configures TLS for https urls.
+	Client *http.Client
+}
+
+// Serves reports whether net/http/pprof serves mode.
+func (s DebugSource) Serves(mode Mode) bool {
+	_, ok := debugEndpoints[mode]
+	return ok
+}
+
+// Pull requests a capture of mode from its endpoint.
+func (s DebugSource) Pull(ctx context.Context, mode Mode, d time.Duration, w io.Writer) error {
+	endpoint, ok := debugEndpoints[mode]
+	if !ok {
+		return fmt.Errorf("net/http/pprof does not serve %s profiles", mode)
+	}
+	url := strings.TrimSuffix(s.URL, "/") + "/" + endpoint
+	if mode == CPUMode || mode == TraceMode {
+		url += fmt.Sprintf("?seconds=%d", int(math.Max(1, math.Ceil(d.Seconds()))))
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s returned %s: %s", url, resp.Status, strings.TrimSpace(string(body)))
+	}
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+// SidecarConfig configures RunSidecar.
+type SidecarConfig struct {
+	// Source is the process profiles are pulled from.
+	Source Source
+	// Modes are the modes pulled each cycle, in turn.
+	Modes []Mode
+	// Interval is the time between the start of each cycle.
+	Interval time.Duration
+	// Duration is how long the modes which capture over a duration, cpu
+	// and trace, are captured for.  Their captures combined must fit
+	// within the Interval.
+	Duration time.Duration
+	// OutputDir is the folder each cycle writes a timestamped folder to.
+	OutputDir string
+	// Keep is the number of the newest cycle folders retained, all are
+	// retained if zero.
+	Keep int
+}
+
+// RunSidecar pulls profiles of config.Modes from config.Source every
+// interval until ctx is done, storing each cycle in a timestamped folder
+// like continuous profiling.  It is the basis of the standalone
+// profileragent binary, profiling a process as a sidecar without it
+// doing more than serve an Agent or net/http/pprof.  options configure
+// the logging, error handling, tags and uploads (see WithUpload) of the
+// sidecar, artifacts are uploaded as <cycle>/<name>.  A failed pull is
+// reported and does not stop the sidecar.  Modes without an artifact of
+// their own, modes a ModeSource does not serve and cycles whose captures
+// cannot complete within the interval are rejected up front.
+func RunSidecar(ctx context.Context, config SidecarConfig, options ...ProfileOption) error {
+	switch {
+	case config.Source == nil:
+		return errors.New("sidecar requires a source")
+	case len(config.Modes) == 0:
+		return errors.New("sidecar requires at least one mode")
+	case config.Interval < time.Second:
+		// Cycle folders are named to the second.
+		return errors.New("sidecar interval must be at least a second")
+	case config.Keep < 0:
+		return errors.New("sidecar keep must not be negative")
+	}
+	if err := validateSidecarModes(config); err != nil {
+		return err
+	}
+	if err := prepareOutputDir(OSFS{}, config.OutputDir); err != nil {
+		return err
+	}
+	reporter := New(options...)
+	ticker := time.NewTicker(config.Interval)
+	defer ticker.Stop()
+	for {
+		sidecarCycle(ctx, reporter, config)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// validateSidecarModes returns an error if a mode of config cannot be
+// pulled into a file of its own, or the cycle cannot complete within the
+// interval.
+func validateSidecarModes(config SidecarConfig) error {
+	files := make(map[string]Mode)
+	captures := 0
+	for _, mode := range config.Modes {
+		name := mode.fileName()
+		if name == "" {
+			return fmt.Errorf("sidecar mode %s cannot be pulled, it has no artifact of its own", mode)
+		}
+		if source, ok := config.Source.(ModeSource); ok && !source.Serves(mode) {
+			return fmt.Errorf("sidecar mode %s is not served by the source", mode)
+		}
+		if other, ok := files[name]; ok {
+			return fmt.Errorf("sidecar modes %s and %s both write %s", other, mode, name)
+		}
+		files[name] = mode
+		if mode == CPUMode || mode == TraceMode {
+			captures++
+		}
+	}
+	if total := time.Duration(captures) * config.Duration; total > config.Interval {
+		return fmt.Errorf("sidecar captures take %s, longer than the interval %s", total, config.Interval)
+	}
+	return nil
+}
+
+// sidecarCycle pulls every mode into a timestamped folder and uploads
+// them, applying retention once complete.
+func sidecarCycle(ctx context.Context, reporter *Profiler, config SidecarConfig) {
+	cycle := time.Now().Format(cycleTimeFormat)
+	folder := filepath.Join(config.OutputDir, cycle)
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		reporter.report("[warning] unable to create %s: %s", folder, err)
+		return
+	}
+	for _, mode := range config.Modes {
+		path := filepath.Join(folder, mode.fileName())
+		err := pullFile(ctx, config.Source, mode, config.Duration, path)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			reporter.report("[warning] sidecar %s pull failed: %s", mode, err)
+			if reporter.errorHandler != nil {
+				reporter.errorHandler(err)
+			}
+			continue
+		}
+		reporter.report("pulled %s", path)
+		for _, sink := range reporter.uploads {
+			if err := reporter.uploadAs(reporter.sinkContext(ctx), sink, cycle+"/"+mode.fileName(), path); err != nil {
+				reporter.report("[warning] failed to upload %s: %s", path, err)
+				if reporter.errorHandler != nil {
+					reporter.errorHandler(err)
+				}
+			}
+		}
+	}
+	if config.Keep > 0 {
+		if err := retainCycles(OSFS{}, config.OutputDir, config.Keep); err != nil {
+			reporter.report("[warning] sidecar retention failed: %s", err)
+		}
+	}
+}
+
+// pullFile pulls a capture of mode from source into the file at path,
+// which is removed if the pull fails.
+func pullFile(ctx context.Context, source Source, mode Mode, d time.Duration, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = errors.Join(source.Pull(ctx, mode, d, f), f.Close())
+	if err != nil {
+		_ = os.Remove(path)
+	}
+	return err
+}
+
+// uploadAs copies the file at path to sink as name, limited to the upload
+// bandwidth.
+func (p *Profiler) uploadAs(ctx context.Context, sink Sink, name string, path string) (err error) {
+	w, err := sink.Create(ctx, name)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, w.Close()) }()
+	return copyFile(p.throttle(ctx, w), OSFS{}, path)
+}
@@ -0,0 +1,118 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	httppprof "net/http/pprof"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// debugServer serves net/http/pprof beneath /debug/pprof.
+func debugServer(t *testing.T) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", httppprof.Index)
+	mux.HandleFunc("/debug/pprof/profile", httppprof.Profile)
+	mux.HandleFunc("/debug/pprof/trace", httppprof.Trace)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server.URL + "/debug/pprof"
+}
+
+func TestDebugSourcePull(t *testing.T) {
+	source := DebugSource{URL: debugServer(t)}
+	for _, mode := range []Mode{MemoryHeapMode, GoroutineMode, CPUMode} {
+		var buf bytes.Buffer
+		require.NoError(t, source.Pull(context.Background(), mode, time.Millisecond, &buf))
+		_, err := profile.Parse(&buf)
+		assert.NoError(t, err, mode.String())
+	}
+}
+
+func TestDebugSourcePullErrors(t *testing.T) {
+	source := DebugSource{URL: debugServer(t)}
+	assert.ErrorContains(t, source.Pull(context.Background(), ClockMode, 0, &bytes.Buffer{}), "does not serve clock profiles")
+
+	source.URL += "/missing"
+	assert.ErrorContains(t, source.Pull(context.Background(), MemoryHeapMode, 0, &bytes.Buffer{}), "404")
+}
+
+// unavailableSource fails to pull goroutine profiles, pulling every other
+// mode from net/http/pprof.  It does not report the modes it serves.
+type unavailableSource struct {
+	debug DebugSource
+}
+
+func (s unavailableSource) Pull(ctx context.Context, mode Mode, d time.Duration, w io.Writer) error {
+	if mode == GoroutineMode {
+		return errors.New("goroutine profiles are unavailable")
+	}
+	return s.debug.Pull(ctx, mode, d, w)
+}
+
+func TestRunSidecar(t *testing.T) {
+	dir := t.TempDir()
+	sink := memorySink{}
+	ctx, cancel := context.WithCancel(context.Background())
+	var errs []error
+	config := SidecarConfig{
+		Source:    unavailableSource{DebugSource{URL: debugServer(t)}},
+		Modes:     []Mode{GoroutineMode, MemoryHeapMode},
+		Interval:  time.Second,
+		OutputDir: dir,
+	}
+	// Cancelling once the first cycle has uploaded stops the sidecar.
+	err := RunSidecar(ctx, config, WithQuietOutput(), WithUpload(cancelSink{sink, cancel}), WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+	require.NoError(t, err)
+
+	cycles, err := cycleFolders(OSFS{}, dir)
+	require.NoError(t, err)
+	require.Len(t, cycles, 1)
+	entries, err := os.ReadDir(filepath.Join(dir, cycles[0]))
+	require.NoError(t, err)
+	require.Len(t, entries, 1, "failed pulls leave no artifact")
+	assert.Equal(t, MemoryFileName, entries[0].Name())
+	assert.Contains(t, sink, cycles[0]+"/"+MemoryFileName)
+	require.Len(t, errs, 1)
+	assert.ErrorContains(t, errs[0], "goroutine")
+}
+
+func TestRunSidecarValidation(t *testing.T) {
+	source := DebugSource{URL: "http://localhost"}
+	for name, config := range map[string]SidecarConfig{
+		"source":   {Modes: []Mode{CPUMode}, Interval: time.Second},
+		"mode":     {Source: source, Interval: time.Second},
+		"interval": {Source: source, Modes: []Mode{CPUMode}, Interval: time.Millisecond},
+		"keep":     {Source: source, Modes: []Mode{CPUMode}, Interval: time.Second, Keep: -1},
+		"artifact": {Source: source, Modes: []Mode{MemoryMode}, Interval: time.Second},
+		"served":   {Source: source, Modes: []Mode{ClockMode}, Interval: time.Second},
+		"both":     {Source: source, Modes: []Mode{MemoryHeapMode, MemoryAllocMode}, Interval: time.Second},
+		"longer":   {Source: source, Modes: []Mode{CPUMode, TraceMode, MemoryHeapMode}, Interval: time.Minute, Duration: 31 * time.Second},
+	} {
+		assert.ErrorContains(t, RunSidecar(context.Background(), config), name)
+	}
+	assert.ErrorContains(t, RunSidecar(context.Background(), SidecarConfig{Source: AgentSource{}, Modes: []Mode{GoroutineMode}, Interval: time.Second}), "served")
+}
+
+// cancelSink cancels a context once an artifact has been uploaded to it.
+type cancelSink struct {
+	memorySink
+	cancel context.CancelFunc
+}
+
+func (s cancelSink) Create(ctx context.Context, name string) (io.WriteCloser, error) {
+	defer s.cancel()
+	return s.memorySink.Create(ctx, name)
+}
@@ -0,0 +1,119 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// defaultUploadTimeout bounds the uploads of a teardown unless
+// WithUploadTimeout is provided.
+const defaultUploadTimeout = 10 * time.Minute
+
+// Sink is a destination that profile artifacts are written to, such as
+// a remote collection point.  Artifacts are written in full to the writer
+// returned by Create, the artifact is only complete once Close returns
+// without error.
+type Sink interface {
+	Create(ctx context.Context, name string) (io.WriteCloser, error)
+}
+
+// upload copies every artifact of the profiler instance to each of the
+// configured upload sinks, in parallel when WithFinalizeConcurrency is
+// provided, within the upload timeout.  Failures are reported but do not
+// prevent the remaining uploads, the local copy of the artifact is always
+// retained.
+func (p *Profiler) upload(ctx context.Context) {
+	if p.uploadTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.uploadTimeout)
+		defer cancel()
+	}
+	ctx = p.sinkContext(ctx)
+	var tasks []func()
+	for _, sink := range p.uploads {
+		for _, path := range p.artifacts {
+			tasks = append(tasks, func() {
+				if err := p.uploadFile(ctx, sink, path); err != nil {
+					p.report("[warning] failed to upload %s: %s", path, err)
+					p.recordError(fmt.Errorf("failed to upload %s: %w", path, err))
+					p.emit(EventUploadFailed, []string{path}, err)
+				}
+			})
+		}
+	}
+	p.finalizeEach(tasks)
+}
+
+// uploadFile copies the file at path to sink, named by its base name,
+// reporting the progress of large uploads and limited to the upload
+// bandwidth.
+func (p *Profiler) uploadFile(ctx context.Context, sink Sink, path string) (err error) {
+	w, err := sink.Create(ctx, filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, w.Close()) }()
+	var size int64
+	if info, err := p.fs.Stat(path); err == nil {
+		size = info.Size()
+	}
+	progress := p.trackProgress("upload of "+filepath.Base(path), size)
+	defer progress.finish()
+	if err := copyFile(io.MultiWriter(p.throttle(ctx, w), progress), p.fs, path); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", path, err)
+	}
+	return nil
+}
+
+// spoolDirKey is the context key of the folder sinks spool to.
+type spoolDirKey struct{}
+
+// sinkContext returns ctx carrying the tags of the session and the folder
+// sinks spool artifacts to, the fallback folder if one is configured (see
+// WithFallbackDir), so that spooling avoids a small /tmp mount.
+func (p *Profiler) sinkContext(ctx context.Context) context.Context {
+	ctx = withTags(ctx, p.tags)
+	if p.fallbackFolder == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, spoolDirKey{}, p.fallbackFolder)
+}
+
+// spoolFile is an io.WriteCloser buffering an artifact to a temporary
+// file, invoking flush with the path of the complete file on Close.
+// This suits sinks whose transport operates on whole files.
+type spoolFile struct {
+	*os.File
+	flush func(path string) error
+}
+
+// newSpoolFile creates a temporary file which is passed to flush and
+// removed when closed, in the spool folder carried by ctx or the default
+// temporary folder.
+func newSpoolFile(ctx context.Context, flush func(path string) error) (*spoolFile, error) {
+	dir, _ := ctx.Value(spoolDirKey{}).(string)
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0777); err != nil {
+			return nil, fmt.Errorf("failed to create spool folder: %w", err)
+		}
+	}
+	f, err := os.CreateTemp(dir, "profiler-spool")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool file: %w", err)
+	}
+	return &spoolFile{File: f, flush: flush}, nil
+}
+
+// Close closes the spooled file, flushes it and removes it.
+func (s *spoolFile) Close() error {
+	defer func() { _ = os.Remove(s.Name()) }()
+	if err := s.File.Close(); err != nil {
+		return err
+	}
+	return s.flush(s.Name())
+}
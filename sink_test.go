@@ -0,0 +1,80 @@
+package profiler
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSFTP is a stand in for the sftp binary which performs the batch
+// commands read from stdin against the local filesystem, logging the
+// local path of each put to $SPOOL_LOG if set.
+const fakeSFTP = `#!/bin/sh
+while read -r line; do
+	eval set -- $line
+	case "$1" in
+		-mkdir) mkdir -p "$2" ;;
+		put) cp "$2" "$3" && if [ -n "$SPOOL_LOG" ]; then echo "$2" >> "$SPOOL_LOG"; fi ;;
+	esac
+done
+`
+
+// installFakeSFTP puts fakeSFTP on the PATH of the test.
+func installFakeSFTP(t *testing.T) {
+	t.Helper()
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, "sftp"), []byte(fakeSFTP), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestSFTPUploadCopiesArtifacts(t *testing.T) {
+	installFakeSFTP(t)
+
+	remote := filepath.Join(t.TempDir(), "remote folder")
+	p := Start(
+		WithHeapProfiler(),
+		WithProfileFileLocation(t.TempDir()),
+		WithSFTPUpload("bastion", remote, SSHAuth{User: "profiler"}),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	p.Stop()
+
+	local, err := os.ReadFile(p.ArtifactPaths()[0])
+	assert.NoError(t, err)
+	uploaded, err := os.ReadFile(filepath.Join(remote, MemoryFileName))
+	assert.NoError(t, err)
+	assert.Equal(t, local, uploaded)
+}
+
+func TestSFTPUploadSpoolsToTheFallbackDir(t *testing.T) {
+	installFakeSFTP(t)
+	log := filepath.Join(t.TempDir(), "spool.log")
+	t.Setenv("SPOOL_LOG", log)
+
+	fallback := filepath.Join(t.TempDir(), "spool")
+	remote := t.TempDir()
+	p := Start(
+		WithHeapProfiler(),
+		WithProfileFileLocation(t.TempDir()),
+		WithFallbackDir(fallback),
+		WithSFTPUpload("bastion", remote, SSHAuth{}),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	p.Stop()
+
+	assert.Empty(t, p.Report().Errors)
+	spooled, err := os.ReadFile(log)
+	assert.NoError(t, err)
+	assert.Equal(t, fallback, filepath.Dir(strings.TrimSpace(string(spooled))))
+	assert.FileExists(t, filepath.Join(remote, MemoryFileName))
+	entries, err := os.ReadDir(fallback)
+	assert.NoError(t, err)
+	assert.Empty(t, entries, "the spool file is removed once uploaded")
+}
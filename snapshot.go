@@ -0,0 +1,98 @@
+package profiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"runtime/pprof"
+	"time"
+)
+
+const (
+	GoroutineDumpFileName = "goroutine.txt"
+	MemStatsFileName      = "memstats.json"
+	BuildInfoFileName     = "buildinfo.txt"
+)
+
+// snapshotTimeFormat is used to name the timestamped snapshot folder.
+const snapshotTimeFormat = "20060102T150405.000"
+
+// Snapshot instantly writes everything that is cheap to capture into a
+// timestamped folder inside of dir and returns the path of that folder.
+// The bundle contains a full goroutine dump (debug=2), the heap and allocs
+// profiles, the mutex and block profiles when they have been enabled
+// in the runtime, runtime.MemStats and the build information of the binary.
+// This is intended as a single call diagnostic bundle for support tickets
+// and does not require (or interfere with) an active profiling session.
+func Snapshot(dir string) (string, error) {
+	folder, err := resolveFolder(OSFS{}, filepath.Join(dir, "snapshot-"+time.Now().Format(snapshotTimeFormat)), "")
+	if err != nil {
+		return "", err
+	}
+	writers := map[string]func(w io.Writer) error{
+		GoroutineDumpFileName: lookupWriter("goroutine", 2),
+		HeapFileName:          lookupWriter(heapProfileName, 0),
+		AllocsFileName:        lookupWriter(allocProfileName, 0),
+		MemStatsFileName:      writeMemStats,
+		BuildInfoFileName:     writeBuildInfo,
+	}
+	// Mutex and block profiles are empty unless enabled by the application.
+	if pprof.Lookup("mutex").Count() > 0 {
+		writers[MutexFileName] = lookupWriter("mutex", 0)
+	}
+	if pprof.Lookup("block").Count() > 0 {
+		writers[BlockFileName] = lookupWriter("block", 0)
+	}
+	var errs []error
+	for name, write := range writers {
+		if err := writeSnapshotFile(folder, name, write); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return folder, errors.Join(errs...)
+}
+
+// writeSnapshotFile creates the named file in folder and populates it
+// with write.
+func writeSnapshotFile(folder string, name string, write func(w io.Writer) error) (err error) {
+	f, err := createFile(OSFS{}, folder, name)
+	if err != nil {
+		return err
+	}
+	defer func() { err = errors.Join(err, f.Close()) }()
+	if err := write(f); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// lookupWriter returns a function writing the named runtime profile.
+func lookupWriter(name string, debug int) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		return pprof.Lookup(name).WriteTo(w, debug)
+	}
+}
+
+// writeMemStats writes the current runtime.MemStats as indented json.
+func writeMemStats(w io.Writer) error {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(stats)
+}
+
+// writeBuildInfo writes the build information embedded in the binary.
+func writeBuildInfo(w io.Writer) error {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		_, err := fmt.Fprintf(w, "build information unavailable\ngo version: %s\n", runtime.Version())
+		return err
+	}
+	_, err := io.WriteString(w, info.String())
+	return err
+}
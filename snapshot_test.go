@@ -0,0 +1,21 @@
+package profiler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSnapshotWritesBundle(t *testing.T) {
+	storage := t.TempDir()
+	folder, err := Snapshot(storage)
+	assert.NoError(t, err)
+	assert.Equal(t, storage, filepath.Dir(folder))
+	for _, name := range []string{GoroutineDumpFileName, HeapFileName, AllocsFileName, MemStatsFileName, BuildInfoFileName} {
+		info, err := os.Stat(filepath.Join(folder, name))
+		assert.NoError(t, err)
+		assert.NotZero(t, info.Size(), name)
+	}
+}
@@ -0,0 +1,249 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/symonk/profiler/profilertest/workload"
+)
+
+// defaultMaxHeapGrowth is the heap growth tolerated by a soak when
+// SoakConfig.MaxHeapGrowth is zero.
+const defaultMaxHeapGrowth = 64 << 20
+
+// goroutineSlack is the goroutine growth tolerated by a soak, a capture
+// may be in progress when one sample is taken and not another.
+const goroutineSlack = 16
+
+// SoakConfig configures Soak.
+type SoakConfig struct {
+	// Continuous is the continuous profiling soaked, its OutputDir must be
+	// a folder dedicated to the soak.
+	Continuous ContinuousConfig
+	// Length is how long the soak runs for, typically hours.
+	Length time.Duration
+	// MaxHeapGrowth is the number of bytes the heap in use may grow by
+	// between the first and last sample, 64MB if zero.
+	MaxHeapGrowth uint64
+	// Workload is the load the process is placed under while soaking,
+	// workload.Mixed if nil.
+	Workload func(ctx context.Context)
+}
+
+// SoakSample is the state of the process and output folder of a soak,
+// sampled once per interval.
+type SoakSample struct {
+	// Elapsed is the time since the soak began.
+	Elapsed time.Duration
+	// HeapInUse is the bytes of the heap in use following a collection.
+	HeapInUse uint64
+	// Goroutines is the number of goroutines of the process.
+	Goroutines int
+	// Cycles is the number of cycle folders in the output folder.
+	Cycles int
+}
+
+// SoakReport is the outcome of Soak.
+type SoakReport struct {
+	// Elapsed is how long the soak ran for.
+	Elapsed time.Duration
+	// Cycles is the number of distinct cycle folders observed.
+	Cycles int
+	// Artifacts is the number of artifacts verified.
+	Artifacts int
+	// Samples are the samples taken, once per interval.
+	Samples []SoakSample
+	// Problems are the failures found, empty if the soak passed.
+	Problems []string
+}
+
+// Passed reports whether the soak found no problems.
+func (r SoakReport) Passed() bool {
+	return len(r.Problems) == 0
+}
+
+// HeapGrowth returns the bytes the heap in use grew by between the first
+// and last sample, negative if it shrank.
+func (r SoakReport) HeapGrowth() int64 {
+	if len(r.Samples) < 2 {
+		return 0
+	}
+	return int64(r.Samples[len(r.Samples)-1].HeapInUse) - int64(r.Samples[0].HeapInUse)
+}
+
+// Soak runs continuous profiling of config.Continuous against a synthetic
+// workload for config.Length, to build trust before always-on deployment.
+// The output folder is sampled every interval, verifying that each cycle
+// rotates into a new folder of non-empty artifacts, that no more than Keep
+// folders are retained and that the heap and goroutines of the process,
+// whose only other load is the steady workload, remain stable.  The report
+// is returned along with the joined problems found.
+func Soak(ctx context.Context, config SoakConfig, options ...ProfileOption) (SoakReport, error) {
+	if config.Length <= 0 {
+		return SoakReport{}, errors.New("soak length must be positive")
+	}
+	if config.Continuous.Interval < time.Second {
+		// Cycle folders are named to the second.
+		return SoakReport{}, errors.New("soak interval must be at least a second")
+	}
+	if config.Workload == nil {
+		config.Workload = workload.Mixed
+	}
+	if config.MaxHeapGrowth == 0 {
+		config.MaxHeapGrowth = defaultMaxHeapGrowth
+	}
+	if err := os.MkdirAll(config.Continuous.OutputDir, 0755); err != nil {
+		return SoakReport{}, fmt.Errorf("unable to create the output folder: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, config.Length)
+	defer cancel()
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		config.Workload(ctx)
+	}()
+	defer wg.Wait()
+
+	// Cycle folders are listed directly within the output folder.
+	options = append(append([]ProfileOption{}, options...), WithoutSignalHandling(), withoutDatePartitioning())
+	c, err := StartContinuous(ctx, StaticConfig(config.Continuous), options...)
+	if err != nil {
+		return SoakReport{}, err
+	}
+	s := &soak{config: config, began: time.Now(), seen: make(map[string]bool)}
+	ticker := time.NewTicker(config.Continuous.Interval)
+	defer ticker.Stop()
+	for ctx.Err() == nil {
+		select {
+		case <-ctx.Done():
+		case <-ticker.C:
+			s.sample()
+		}
+	}
+	_ = c.Close()
+	return s.finish()
+}
+
+// soak is the state of a soak in progress.
+type soak struct {
+	config SoakConfig
+	began  time.Time
+	seen   map[string]bool
+	report SoakReport
+}
+
+// sample records the state of the process and verifies the cycle folders
+// completed since the last sample.
+func (s *soak) sample() {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	root := s.config.Continuous.OutputDir
+	cycles, err := cycleFolders(OSFS{}, root)
+	if err != nil {
+		s.problem("unable to list the cycle folders: %s", err)
+	}
+	s.report.Samples = append(s.report.Samples, SoakSample{
+		Elapsed:    time.Since(s.began),
+		HeapInUse:  stats.HeapInuse,
+		Goroutines: runtime.NumGoroutine(),
+		Cycles:     len(cycles),
+	})
+	// Older folders are removed once a cycle completes, the folder of the
+	// cycle in progress is not yet counted against Keep.
+	if keep := s.config.Continuous.Keep; keep > 0 && len(cycles) > keep+1 {
+		s.problem("%d cycle folders are retained, exceeding the %d kept", len(cycles), keep)
+	}
+	for i, name := range cycles {
+		// The newest folder may still be being written.
+		if s.seen[name] || i == len(cycles)-1 {
+			continue
+		}
+		s.seen[name] = true
+		s.report.Cycles++
+		s.verifyCycle(filepath.Join(root, name))
+	}
+}
+
+// verifyCycle verifies every mode wrote a non-empty artifact to folder.
+func (s *soak) verifyCycle(folder string) {
+	for _, name := range s.config.Continuous.Modes {
+		mode, _ := ParseMode(name)
+		spec, _ := mode.Spec()
+		artifact := spec.FileName
+		if artifact == "" {
+			artifact = HeapFileName
+		}
+		// The artifact may be compressed.
+		matches, _ := filepath.Glob(filepath.Join(folder, strings.TrimSuffix(artifact, filepath.Ext(artifact))+"*"))
+		if len(matches) == 0 {
+			s.problem("cycle %s has no %s artifact", filepath.Base(folder), name)
+			continue
+		}
+		for _, path := range matches {
+			info, err := os.Stat(path)
+			if err != nil || info.Size() == 0 {
+				s.problem("%s is missing or empty", path)
+				continue
+			}
+			s.report.Artifacts++
+		}
+	}
+}
+
+// problem records a failure of the soak.
+func (s *soak) problem(format string, args ...any) {
+	s.report.Problems = append(s.report.Problems, fmt.Sprintf(format, args...))
+}
+
+// finish checks the samples for growth and completes the report.
+func (s *soak) finish() (SoakReport, error) {
+	s.report.Elapsed = time.Since(s.began)
+	// The final cycle is interrupted as the soak ends and is not verified.
+	if s.report.Cycles == 0 {
+		s.problem("no capture cycles completed")
+	}
+	if growth := s.report.HeapGrowth(); growth > int64(s.config.MaxHeapGrowth) {
+		s.problem("the heap grew by %s, exceeding the %s tolerated", formatBytes(growth), formatBytes(int64(s.config.MaxHeapGrowth)))
+	}
+	if samples := s.report.Samples; len(samples) >= 2 && samples[len(samples)-1].Goroutines > samples[0].Goroutines+goroutineSlack {
+		s.problem("goroutines grew from %d to %d", samples[0].Goroutines, samples[len(samples)-1].Goroutines)
+	}
+	var errs []error
+	for _, problem := range s.report.Problems {
+		errs = append(errs, errors.New(problem))
+	}
+	return s.report, errors.Join(errs...)
+}
+
+// WriteSoakReport writes the report as text, a table of its samples
+// followed by its verdict.
+func WriteSoakReport(w io.Writer, report SoakReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "elapsed\theap\tgoroutines\tcycles\n")
+	for _, sample := range report.Samples {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\n", sample.Elapsed.Round(time.Second), formatBytes(int64(sample.HeapInUse)), sample.Goroutines, sample.Cycles)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "\n%d cycles and %d artifacts verified over %s, the heap grew by %s\n", report.Cycles, report.Artifacts, report.Elapsed.Round(time.Second), formatBytes(report.HeapGrowth()))
+	if report.Passed() {
+		_, err := fmt.Fprintln(w, "PASS")
+		return err
+	}
+	for _, problem := range report.Problems {
+		fmt.Fprintf(w, "FAIL %s\n", problem)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSoak(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "soak")
+	config := SoakConfig{
+		Continuous: ContinuousConfig{Interval: time.Second, Duration: 20 * time.Millisecond, Modes: []string{"heap", "goroutine"}, OutputDir: dir, Keep: 1},
+		Length:     3500 * time.Millisecond,
+	}
+	report, err := Soak(context.Background(), config, WithQuietOutput())
+	require.NoError(t, err)
+	assert.True(t, report.Passed())
+	assert.GreaterOrEqual(t, report.Cycles, 2)
+	assert.GreaterOrEqual(t, report.Artifacts, 4)
+	assert.Len(t, report.Samples, 3)
+	// Retention leaves the newest cycle.
+	cycles, err := cycleFolders(OSFS{}, dir)
+	require.NoError(t, err)
+	assert.Len(t, cycles, 1)
+}
+
+func TestSoakRejectsInvalidConfig(t *testing.T) {
+	_, err := Soak(context.Background(), SoakConfig{Continuous: ContinuousConfig{Interval: time.Second}})
+	assert.ErrorContains(t, err, "soak length must be positive")
+	_, err = Soak(context.Background(), SoakConfig{Length: time.Second, Continuous: ContinuousConfig{Interval: time.Millisecond}})
+	assert.ErrorContains(t, err, "at least a second")
+}
+
+func TestSoakFinishReportsGrowth(t *testing.T) {
+	s := &soak{config: SoakConfig{MaxHeapGrowth: 1024}}
+	s.report.Samples = []SoakSample{{HeapInUse: 1 << 20, Goroutines: 10}, {HeapInUse: 3 << 20, Goroutines: 100}}
+	report, err := s.finish()
+	require.Error(t, err)
+	assert.False(t, report.Passed())
+	assert.EqualValues(t, 2<<20, report.HeapGrowth())
+	assert.Equal(t, []string{
+		"no capture cycles completed",
+		"the heap grew by 2.0MiB, exceeding the 1.0KiB tolerated",
+		"goroutines grew from 10 to 100",
+	}, report.Problems)
+}
+
+func TestWriteSoakReport(t *testing.T) {
+	report := SoakReport{
+		Elapsed:   time.Hour,
+		Cycles:    60,
+		Artifacts: 120,
+		Samples:   []SoakSample{{Elapsed: time.Minute, HeapInUse: 4 << 20, Goroutines: 12, Cycles: 1}, {Elapsed: time.Hour, HeapInUse: 5 << 20, Goroutines: 12, Cycles: 10}},
+	}
+	var b bytes.Buffer
+	require.NoError(t, WriteSoakReport(&b, report))
+	assert.Contains(t, b.String(), "1h0m0s   5.0MiB  12          10")
+	assert.Contains(t, b.String(), "60 cycles and 120 artifacts verified over 1h0m0s, the heap grew by 1.0MiB\nPASS\n")
+
+	report.Problems = []string{"goroutines grew from 12 to 40"}
+	b.Reset()
+	require.NoError(t, WriteSoakReport(&b, report))
+	assert.Contains(t, b.String(), "FAIL goroutines grew from 12 to 40\n")
+}
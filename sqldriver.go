@@ -0,0 +1,286 @@
+package profiler
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"runtime/pprof"
+	"strings"
+)
+
+// The pprof label keys carried by the goroutine executing a query through
+// a driver wrapped by WrapDriver or WrapConnector.
+const (
+	// QueryLabel is the name of the query, see WithQueryName.
+	QueryLabel = "query"
+	// QueryDigestLabel is the digest of the query text, see QueryDigest.
+	QueryDigestLabel = "query_digest"
+)
+
+// queryNameKey is the context key of the name given by WithQueryName.
+type queryNameKey struct{}
+
+// WithQueryName returns a copy of ctx naming the queries executed with
+// it, such as "load_user", the name is the value of QueryLabel.
+func WithQueryName(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, queryNameKey{}, name)
+}
+
+// QueryDigest returns a short digest of query, which is the same for
+// queries differing only in whitespace.  Parameterised queries share a
+// digest regardless of their arguments, queries with inlined literals do
+// not.
+func QueryDigest(query string) string {
+	h := fnv.New32a()
+	h.Write([]byte(strings.Join(strings.Fields(query), " ")))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
+
+// labelQuery runs fn with the labels of query applied, so that the CPU,
+// block and mutex samples of its execution are attributed to it.
+func labelQuery(ctx context.Context, query string, fn func(ctx context.Context)) {
+	labels := []string{QueryDigestLabel, QueryDigest(query)}
+	if name, _ := ctx.Value(queryNameKey{}).(string); name != "" {
+		labels = append(labels, QueryLabel, name)
+	}
+	pprof.Do(ctx, pprof.Labels(labels...), fn)
+}
+
+// WrapDriver returns d with pprof labels applied around the execution of
+// every query, see QueryLabel and QueryDigestLabel, for registration
+// with sql.Register:
+//
+//	sql.Register("postgres-labelled", profiler.WrapDriver(&pq.Driver{}))
+//
+// Labels cover the execution of a query until its rows are returned, the
+// iteration of the rows is not labelled.  Break profiles down by query
+// with WithLabelBreakdown(profiler.QueryLabel).
+func WrapDriver(d driver.Driver) driver.Driver {
+	return labelledDriver{d}
+}
+
+// WrapConnector returns c with the labels of WrapDriver applied, for use
+// with sql.OpenDB.
+func WrapConnector(c driver.Connector) driver.Connector {
+	return labelledConnector{c}
+}
+
+// labelledDriver is a driver.Driver whose connections label queries.
+type labelledDriver struct {
+	driver.Driver
+}
+
+func (d labelledDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &labelledConn{conn}, nil
+}
+
+// OpenConnector supports drivers opened through a driver.Connector.
+func (d labelledDriver) OpenConnector(name string) (driver.Connector, error) {
+	if dc, ok := d.Driver.(driver.DriverContext); ok {
+		c, err := dc.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return labelledConnector{c}, nil
+	}
+	return dsnConnector{name: name, driver: d}, nil
+}
+
+// dsnConnector is the driver.Connector of a driver without one.
+type dsnConnector struct {
+	name   string
+	driver labelledDriver
+}
+
+func (c dsnConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.driver.Open(c.name)
+}
+
+func (c dsnConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// labelledConnector is a driver.Connector whose connections label
+// queries.
+type labelledConnector struct {
+	driver.Connector
+}
+
+func (c labelledConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &labelledConn{conn}, nil
+}
+
+func (c labelledConnector) Driver() driver.Driver {
+	return labelledDriver{c.Connector.Driver()}
+}
+
+// labelledConn is a driver.Conn labelling the queries it executes.  It
+// implements every optional interface of a connection, falling back to
+// the behaviour database/sql has for connections without them.
+type labelledConn struct {
+	driver.Conn
+}
+
+func (c *labelledConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *labelledConn) PrepareContext(ctx context.Context, query string) (stmt driver.Stmt, err error) {
+	labelQuery(ctx, query, func(ctx context.Context) {
+		if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+			stmt, err = pc.PrepareContext(ctx, query)
+		} else {
+			stmt, err = c.Conn.Prepare(query)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &labelledStmt{Stmt: stmt, conn: c, query: query}, nil
+}
+
+func (c *labelledConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if bc, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return bc.BeginTx(ctx, opts)
+	}
+	// As database/sql does for drivers without BeginTx.
+	if opts.Isolation != 0 || opts.ReadOnly {
+		return nil, errors.New("the driver does not support non-default transaction options")
+	}
+	return c.Conn.Begin()
+}
+
+func (c *labelledConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (result driver.Result, err error) {
+	switch ec := c.Conn.(type) {
+	case driver.ExecerContext:
+		labelQuery(ctx, query, func(ctx context.Context) {
+			result, err = ec.ExecContext(ctx, query, args)
+		})
+	case driver.Execer:
+		labelQuery(ctx, query, func(context.Context) {
+			var values []driver.Value
+			if values, err = namedValues(args); err == nil {
+				result, err = ec.Exec(query, values)
+			}
+		})
+	default:
+		// database/sql prepares the statement instead.
+		return nil, driver.ErrSkip
+	}
+	return result, err
+}
+
+func (c *labelledConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (rows driver.Rows, err error) {
+	switch qc := c.Conn.(type) {
+	case driver.QueryerContext:
+		labelQuery(ctx, query, func(ctx context.Context) {
+			rows, err = qc.QueryContext(ctx, query, args)
+		})
+	case driver.Queryer:
+		labelQuery(ctx, query, func(context.Context) {
+			var values []driver.Value
+			if values, err = namedValues(args); err == nil {
+				rows, err = qc.Query(query, values)
+			}
+		})
+	default:
+		return nil, driver.ErrSkip
+	}
+	return rows, err
+}
+
+func (c *labelledConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *labelledConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *labelledConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *labelledConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	// database/sql applies its default conversion.
+	return driver.ErrSkip
+}
+
+// labelledStmt is a prepared driver.Stmt labelling its executions with
+// the query it was prepared from.
+type labelledStmt struct {
+	driver.Stmt
+	conn  *labelledConn
+	query string
+}
+
+func (s *labelledStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (result driver.Result, err error) {
+	labelQuery(ctx, s.query, func(ctx context.Context) {
+		if ec, ok := s.Stmt.(driver.StmtExecContext); ok {
+			result, err = ec.ExecContext(ctx, args)
+			return
+		}
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			result, err = s.Stmt.Exec(values)
+		}
+	})
+	return result, err
+}
+
+func (s *labelledStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (rows driver.Rows, err error) {
+	labelQuery(ctx, s.query, func(ctx context.Context) {
+		if qc, ok := s.Stmt.(driver.StmtQueryContext); ok {
+			rows, err = qc.QueryContext(ctx, args)
+			return
+		}
+		var values []driver.Value
+		if values, err = namedValues(args); err == nil {
+			rows, err = s.Stmt.Query(values)
+		}
+	})
+	return rows, err
+}
+
+// CheckNamedValue checks with the statement, or the connection as
+// database/sql does for statements without a checker of their own.
+func (s *labelledStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return s.conn.CheckNamedValue(nv)
+}
+
+// namedValues converts args for drivers predating named arguments.
+func namedValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, fmt.Errorf("the driver does not support the named argument %s", arg.Name)
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
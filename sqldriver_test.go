@@ -0,0 +1,176 @@
+package profiler
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"runtime/pprof"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// labelRecorder records the query labels of each context a fake driver
+// executes with.
+type labelRecorder struct {
+	mu     sync.Mutex
+	labels []map[string]string
+}
+
+func (r *labelRecorder) record(ctx context.Context) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	labels := make(map[string]string)
+	for _, key := range []string{QueryLabel, QueryDigestLabel} {
+		if value, ok := pprof.Label(ctx, key); ok {
+			labels[key] = value
+		}
+	}
+	r.labels = append(r.labels, labels)
+}
+
+// fakeConnector connects fakeConns, or fakeQueryConns if query is true.
+type fakeConnector struct {
+	query    bool
+	recorder *labelRecorder
+}
+
+func (c fakeConnector) Connect(context.Context) (driver.Conn, error) {
+	conn := fakeConn{recorder: c.recorder}
+	if c.query {
+		return fakeQueryConn{conn}, nil
+	}
+	return conn, nil
+}
+
+func (c fakeConnector) Driver() driver.Driver {
+	return fakeDriver{c}
+}
+
+// fakeDriver opens the connections of its connector.
+type fakeDriver struct {
+	connector fakeConnector
+}
+
+func (d fakeDriver) Open(string) (driver.Conn, error) {
+	return d.connector.Connect(context.Background())
+}
+
+// fakeConn only supports prepared statements.
+type fakeConn struct {
+	recorder *labelRecorder
+}
+
+func (c fakeConn) Prepare(string) (driver.Stmt, error) { return fakeStmt(c), nil }
+func (c fakeConn) Close() error                        { return nil }
+func (c fakeConn) Begin() (driver.Tx, error)           { return fakeTx{}, nil }
+
+// fakeQueryConn executes queries without preparing them.
+type fakeQueryConn struct {
+	fakeConn
+}
+
+func (c fakeQueryConn) ExecContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Result, error) {
+	c.recorder.record(ctx)
+	return driver.RowsAffected(1), nil
+}
+
+func (c fakeQueryConn) QueryContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	c.recorder.record(ctx)
+	return fakeRows{}, nil
+}
+
+type fakeStmt struct {
+	recorder *labelRecorder
+}
+
+func (s fakeStmt) Close() error                               { return nil }
+func (s fakeStmt) NumInput() int                              { return -1 }
+func (s fakeStmt) Exec([]driver.Value) (driver.Result, error) { return driver.RowsAffected(1), nil }
+func (s fakeStmt) Query([]driver.Value) (driver.Rows, error)  { return fakeRows{}, nil }
+
+func (s fakeStmt) ExecContext(ctx context.Context, _ []driver.NamedValue) (driver.Result, error) {
+	s.recorder.record(ctx)
+	return driver.RowsAffected(1), nil
+}
+
+func (s fakeStmt) QueryContext(ctx context.Context, _ []driver.NamedValue) (driver.Rows, error) {
+	s.recorder.record(ctx)
+	return fakeRows{}, nil
+}
+
+type fakeTx struct{}
+
+func (fakeTx) Commit() error   { return nil }
+func (fakeTx) Rollback() error { return nil }
+
+type fakeRows struct{}
+
+func (fakeRows) Columns() []string         { return []string{"n"} }
+func (fakeRows) Close() error              { return nil }
+func (fakeRows) Next([]driver.Value) error { return io.EOF }
+
+func TestWrapConnectorLabelsQueries(t *testing.T) {
+	for name, query := range map[string]bool{"direct": true, "prepared": false} {
+		t.Run(name, func(t *testing.T) {
+			recorder := &labelRecorder{}
+			db := sql.OpenDB(WrapConnector(fakeConnector{query: query, recorder: recorder}))
+			defer db.Close()
+			ctx := WithQueryName(context.Background(), "load_user")
+
+			rows, err := db.QueryContext(ctx, "SELECT * FROM users WHERE id = ?", 1)
+			require.NoError(t, err)
+			require.NoError(t, rows.Close())
+			_, err = db.ExecContext(context.Background(), "DELETE FROM users", 1)
+			require.NoError(t, err)
+
+			require.Len(t, recorder.labels, 2)
+			assert.Equal(t, map[string]string{QueryLabel: "load_user", QueryDigestLabel: QueryDigest("SELECT * FROM users WHERE id = ?")}, recorder.labels[0])
+			assert.Equal(t, map[string]string{QueryDigestLabel: QueryDigest("DELETE FROM users")}, recorder.labels[1])
+		})
+	}
+}
+
+// fakeRecorder records the labels of the registered "profiler-fake"
+// driver, drivers can only be registered once per test binary.
+var fakeRecorder = &labelRecorder{}
+
+func init() {
+	sql.Register("profiler-fake", WrapDriver(fakeDriver{fakeConnector{recorder: fakeRecorder}}))
+}
+
+func TestWrapDriverLabelsPreparedStatements(t *testing.T) {
+	recorder := fakeRecorder
+	recorder.labels = nil
+	db, err := sql.Open("profiler-fake", "")
+	require.NoError(t, err)
+	defer db.Close()
+
+	stmt, err := db.Prepare("UPDATE users SET name = ?")
+	require.NoError(t, err)
+	defer stmt.Close()
+	_, err = stmt.ExecContext(WithQueryName(context.Background(), "rename"), "x")
+	require.NoError(t, err)
+	require.Len(t, recorder.labels, 1)
+	assert.Equal(t, "rename", recorder.labels[0][QueryLabel])
+	assert.Equal(t, QueryDigest("UPDATE users SET name = ?"), recorder.labels[0][QueryDigestLabel])
+}
+
+func TestWrapConnectorTransactionOptions(t *testing.T) {
+	db := sql.OpenDB(WrapConnector(fakeConnector{recorder: &labelRecorder{}}))
+	defer db.Close()
+	tx, err := db.BeginTx(context.Background(), nil)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	_, err = db.BeginTx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	assert.ErrorContains(t, err, "does not support non-default transaction options")
+}
+
+func TestQueryDigest(t *testing.T) {
+	assert.Equal(t, QueryDigest("SELECT 1"), QueryDigest("  SELECT\n\t1 "))
+	assert.NotEqual(t, QueryDigest("SELECT 1"), QueryDigest("SELECT 2"))
+	assert.Len(t, QueryDigest("SELECT 1"), 8)
+}
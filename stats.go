@@ -0,0 +1,68 @@
+package profiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ArtifactStat describes the size and content of an artifact, so that
+// whether a capture is worth downloading can be judged from the report
+// or completion log alone.
+type ArtifactStat struct {
+	// Path is the absolute path of the artifact.
+	Path string
+	// Size is the number of bytes written.
+	Size int64
+	// Samples is the number of samples in a pprof profile, -1 for
+	// artifacts which are not pprof profiles, such as traces.
+	Samples int
+}
+
+// String returns a short description of the artifact, such as
+// "12.3KiB, 456 samples".
+func (s ArtifactStat) String() string {
+	if s.Samples < 0 {
+		return formatBytes(s.Size)
+	}
+	return fmt.Sprintf("%s, %d samples", formatBytes(s.Size), s.Samples)
+}
+
+// statArtifacts describes each of the artifacts at paths of fsys, artifacts
+// which no longer exist (such as discarded duplicates) are omitted.
+func statArtifacts(fsys FS, paths []string) []ArtifactStat {
+	var stats []ArtifactStat
+	for _, path := range paths {
+		info, err := fsys.Stat(path)
+		if err != nil {
+			continue
+		}
+		stat := ArtifactStat{Path: path, Size: info.Size(), Samples: -1}
+		if strings.Contains(info.Name(), ".pprof") {
+			if prof, err := readProfile(fsys, path); err == nil {
+				stat.Samples = len(prof.Sample)
+			}
+		}
+		stats = append(stats, stat)
+	}
+	return stats
+}
+
+// recordStats describes every artifact in the report of the session.
+func (p *Profiler) recordStats() {
+	stats := statArtifacts(p.fs, p.ArtifactPaths())
+	p.mu.Lock()
+	p.artifactStats = stats
+	p.mu.Unlock()
+}
+
+// artifactStat returns the description of the artifact at path.
+func (p *Profiler) artifactStat(path string) (ArtifactStat, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, stat := range p.artifactStats {
+		if stat.Path == path {
+			return stat, true
+		}
+	}
+	return ArtifactStat{}, false
+}
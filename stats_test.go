@@ -0,0 +1,38 @@
+package profiler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatArtifacts(t *testing.T) {
+	dir := t.TempDir()
+	trace := filepath.Join(dir, TraceFileName)
+	assert.NoError(t, os.WriteFile(trace, []byte("go 1.23 trace"), 0644))
+	stats := statArtifacts(OSFS{}, []string{trace, filepath.Join(dir, "missing.pprof")})
+	assert.Equal(t, []ArtifactStat{{Path: trace, Size: 13, Samples: -1}}, stats)
+	assert.Equal(t, "13B", stats[0].String())
+	assert.Equal(t, "1.5KiB, 3 samples", ArtifactStat{Size: 1536, Samples: 3}.String())
+}
+
+func TestReportDescribesArtifacts(t *testing.T) {
+	var report Report
+	p := Start(
+		WithMode(GoroutineMode),
+		WithProfileFileLocation(t.TempDir()),
+		WithCallback(func(p *Profiler) { report = p.Report() }),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	p.Stop()
+	assert.Positive(t, report.Duration)
+	if assert.Len(t, report.ArtifactStats, 1) {
+		stat := report.ArtifactStats[0]
+		assert.Equal(t, p.ArtifactPaths()[0], stat.Path)
+		assert.Positive(t, stat.Size)
+		assert.Positive(t, stat.Samples)
+	}
+}
@@ -1,9 +1,13 @@
 package profiler
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
+	"time"
 
 	"github.com/felixge/fgprof"
 )
@@ -12,6 +16,25 @@ import (
 // that controls pre/post profiling setup and teardown.
 type StrategyFunc func(p *Profiler) (FinalizerFunc, error)
 
+// StrategyMiddleware wraps a StrategyFunc, analogous to http middleware,
+// allowing concerns such as timing or setup and teardown of the process
+// around a capture to be composed with any strategy rather than baked into
+// each of them.  Middleware may act before the strategy starts and, by
+// wrapping the returned FinalizerFunc, during teardown.  It does not see
+// the bytes of artifacts, which are transformed by the writer of each
+// artifact instead, see WithCompression and WithPostProcessor, and
+// uploaded once the session has stopped, see WithUpload.
+type StrategyMiddleware func(next StrategyFunc) StrategyFunc
+
+// chainStrategy wraps strategy with middleware, the first middleware
+// being the outermost.
+func chainStrategy(strategy StrategyFunc, middleware []StrategyMiddleware) StrategyFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		strategy = middleware[i](strategy)
+	}
+	return strategy
+}
+
 var StrategyMap = map[Mode]StrategyFunc{
 	CPUMode:          cpuStrategyFn,
 	MemoryHeapMode:   heapStrategyFn,
@@ -22,6 +45,8 @@ var StrategyMap = map[Mode]StrategyFunc{
 	ThreadCreateMode: threadCreateStrategyFn,
 	TraceMode:        traceStrategyFn,
 	ClockMode:        clockStrategyFn,
+	MemoryMode:       memoryStrategyFn,
+	SchedLatencyMode: schedLatencyStrategyFn,
 }
 
 // cpuStrategyFn handles configuring the cpu profiler and
@@ -29,95 +54,199 @@ var StrategyMap = map[Mode]StrategyFunc{
 // the output of using this strategy is a `cpu.pprof`
 // file written to disk.
 func cpuStrategyFn(p *Profiler) (FinalizerFunc, error) {
-	p.SetProfileFile(CPUFileName)
-	if err := pprof.StartCPUProfile(p.profileFile); err != nil {
+	if err := p.openProfileFile(CPUMode.fileName()); err != nil {
 		return nil, err
 	}
-	return func() (err error) {
-		defer func() { err = p.profileFile.Close() }()
+	if err := p.startCPUProfile(p.profileFile); err != nil {
+		return nil, errors.Join(err, p.profileFile.Close())
+	}
+	before := observe()
+	p.setRollover(func(phase string) error {
+		// The artifact of the phase is created first, so that the profile
+		// continues uninterrupted if it cannot be.
+		previous := p.phase
+		p.phase = phase
+		w, err := p.createArtifact(phaseFileName(CPUMode.fileName(), phase))
+		if err != nil {
+			p.phase = previous
+			return err
+		}
+		pprof.StopCPUProfile()
+		closeErr := p.profileFile.Close()
+		p.recordPhase(previous, p.profilePath, before)
+		p.mu.Lock()
+		p.profileFile, p.profilePath = w, p.artifacts[len(p.artifacts)-1]
+		p.mu.Unlock()
+		before = observe()
+		if err := p.startCPUProfile(w); err != nil {
+			return errors.Join(closeErr, err)
+		}
+		return closeErr
+	})
+	return func() error {
+		p.setRollover(nil)
 		pprof.StopCPUProfile()
-		return nil
+		// Only the CPU used since the latest phase began is expected to
+		// be sampled in the profile file.
+		cpu := time.Duration((observe().userCPU - before.userCPU) * float64(time.Second))
+		if p.phase != "" {
+			p.recordPhase(p.phase, p.profilePath, before)
+		}
+		if err := p.profileFile.Close(); err != nil {
+			return err
+		}
+		return checkCPUSamples(p.fs, p.profilePath, cpu)
 	}, nil
 }
 
 func heapStrategyFn(p *Profiler) (FinalizerFunc, error) {
-	rate := runtime.MemProfileRate
-	p.SetProfileFile(MemoryFileName)
-	runtime.MemProfileRate = p.memoryProfileRate
-	return func() (err error) {
-		defer func() { runtime.MemProfileRate = rate }()
-		defer func() { err = p.profileFile.Close() }()
-		_ = pprof.Lookup(heapProfileName).WriteTo(p.profileFile, 0)
-		runtime.GC()
-		return nil
+	if err := p.openProfileFile(MemoryHeapMode.fileName()); err != nil {
+		return nil, err
+	}
+	restore := p.applyMemProfileRate()
+	return func() error {
+		defer restore()
+		defer runtime.GC()
+		return closeLookup(heapProfileName, p.profileFile)
 	}, nil
 }
 
 func allocStrategyFn(p *Profiler) (FinalizerFunc, error) {
-	rate := runtime.MemProfileRate
-	p.SetProfileFile(MemoryFileName)
-	runtime.MemProfileRate = p.memoryProfileRate
-	return func() (err error) {
-		defer func() { runtime.MemProfileRate = rate }()
-		defer func() { err = p.profileFile.Close() }()
-		_ = pprof.Lookup(allocProfileName).WriteTo(p.profileFile, 0)
+	if err := p.openProfileFile(MemoryAllocMode.fileName()); err != nil {
+		return nil, err
+	}
+	restore := p.applyMemProfileRate()
+	return func() error {
+		defer restore()
+		defer runtime.GC()
+		return closeLookup(allocProfileName, p.profileFile)
+	}, nil
+}
+
+// memoryStrategyFn writes both the heap (in use) and allocs (allocated
+// since program start) views of the memory profile on teardown into
+// separate `heap.pprof` and `allocs.pprof` files.
+func memoryStrategyFn(p *Profiler) (FinalizerFunc, error) {
+	heap, err := p.createArtifact(HeapFileName)
+	if err != nil {
+		return nil, err
+	}
+	allocs, err := p.createArtifact(AllocsFileName)
+	if err != nil {
+		return nil, errors.Join(err, heap.Close())
+	}
+	restore := p.applyMemProfileRate()
+	return func() error {
+		defer restore()
+		// The heap profile is only as up to date as the most recent
+		// garbage collection.
 		runtime.GC()
-		return nil
+		var heapErr, allocsErr error
+		p.finalizeEach([]func(){
+			func() { heapErr = closeLookup(heapProfileName, heap) },
+			func() { allocsErr = closeLookup(allocProfileName, allocs) },
+		})
+		return errors.Join(heapErr, allocsErr)
 	}, nil
 }
 
+// applyMemProfileRate modifies the global runtime.MemProfileRate only
+// when the user has explicitly opted in with WithMemoryProfilingRate.
+// The returned function restores the previous rate when the scope is
+// limited to the session.
+func (p *Profiler) applyMemProfileRate() func() {
+	previous := runtime.MemProfileRate
+	if p.memoryProfileRate == 0 || p.memoryProfileRate == previous {
+		return func() {}
+	}
+	// The rate is consulted at allocation time, allocations which occurred
+	// prior to this point were sampled at the previous rate.
+	p.report("[warning] runtime.MemProfileRate changed from %d to %d, allocations made prior to profiling were sampled at the previous rate", previous, p.memoryProfileRate)
+	runtime.MemProfileRate = p.memoryProfileRate
+	if p.memoryRateScope == MemProfileRateProcess {
+		return func() {}
+	}
+	return func() { runtime.MemProfileRate = previous }
+}
+
 func mutexStrategyFn(p *Profiler) (FinalizerFunc, error) {
-	p.SetProfileFile(MutexFileName)
-	_ = pprof.Lookup("mutex").WriteTo(p.profileFile, 0)
+	if err := p.openProfileFile(MutexMode.fileName()); err != nil {
+		return nil, err
+	}
+	if err := pprof.Lookup("mutex").WriteTo(p.profileFile, 0); err != nil {
+		return nil, errors.Join(err, p.profileFile.Close())
+	}
 	return func() error {
 		return p.profileFile.Close()
 	}, nil
 }
 
 func blockStrategyFn(p *Profiler) (FinalizerFunc, error) {
-	p.SetProfileFile(BlockFileName)
-	// for now, we do not allow customising the runtime.SetBlockProfileRate
-	// if it is useful in future, change is welcome here.
+	if err := p.openProfileFile(BlockMode.fileName()); err != nil {
+		return nil, err
+	}
+	// The block profile rate is set for the capture by WithSamplingRates.
 	return func() error {
 		defer runtime.SetBlockProfileRate(0)
-		_ = pprof.Lookup("block").WriteTo(p.profileFile, 0)
-		return p.profileFile.Close()
+		return closeLookup("block", p.profileFile)
 	}, nil
 }
 
 func goroutineStrategyFn(p *Profiler) (FinalizerFunc, error) {
-	p.SetProfileFile(GoroutineFileName)
-	_ = pprof.Lookup("goroutine").WriteTo(p.profileFile, 0)
+	if err := p.openProfileFile(GoroutineMode.fileName()); err != nil {
+		return nil, err
+	}
+	if err := pprof.Lookup("goroutine").WriteTo(p.profileFile, 0); err != nil {
+		return nil, errors.Join(err, p.profileFile.Close())
+	}
+	if p.deadlockDetection {
+		if err := p.writeGoroutineDump(); err != nil {
+			return nil, errors.Join(err, p.profileFile.Close())
+		}
+	}
 	return func() error {
 		return p.profileFile.Close()
 	}, nil
 }
 
 func threadCreateStrategyFn(p *Profiler) (FinalizerFunc, error) {
-	p.SetProfileFile(ThreadCreateFileName)
-	return func() (err error) {
-		defer func() { err = p.profileFile.Close() }()
-		_ = pprof.Lookup("threadcreate").WriteTo(p.profileFile, 0)
-		return nil
+	if err := p.openProfileFile(ThreadCreateMode.fileName()); err != nil {
+		return nil, err
+	}
+	return func() error {
+		return closeLookup("threadcreate", p.profileFile)
 	}, nil
 }
 
 func traceStrategyFn(p *Profiler) (FinalizerFunc, error) {
-	p.SetProfileFile(TraceFileName)
-	if err := trace.Start(p.profileFile); err != nil {
+	if err := p.openProfileFile(TraceMode.fileName()); err != nil {
 		return nil, err
 	}
+	if err := trace.Start(p.profileFile); err != nil {
+		return nil, errors.Join(err, p.profileFile.Close())
+	}
 	return func() error {
 		trace.Stop()
-		return nil
+		return p.profileFile.Close()
 	}, nil
 }
 
 func clockStrategyFn(p *Profiler) (FinalizerFunc, error) {
-	p.SetProfileFile(ClockFileName)
+	if err := p.openProfileFile(ClockMode.fileName()); err != nil {
+		return nil, err
+	}
 	teardown := fgprof.Start(p.profileFile, fgprof.FormatPprof)
-	return func() (err error) {
-		defer func() { err = p.profileFile.Close() }()
-		return teardown()
+	return func() error {
+		return errors.Join(teardown(), p.profileFile.Close())
 	}, nil
 }
+
+// closeLookup writes the named runtime profile to w before closing it,
+// a failure to write (full disk etc) is returned rather than silently
+// producing an empty profile.
+func closeLookup(name string, w io.WriteCloser) error {
+	if err := pprof.Lookup(name).WriteTo(w, 0); err != nil {
+		return errors.Join(fmt.Errorf("failed to write %s profile: %w", name, err), w.Close())
+	}
+	return w.Close()
+}
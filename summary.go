@@ -0,0 +1,126 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// SummaryFileName is the markdown summary written by WithMarkdownSummary.
+const SummaryFileName = "summary.md"
+
+// summaryTop is the number of functions in each table of the summary.
+const summaryTop = 10
+
+// markdownSummary writes `summary.md` into the output folder when
+// WithMarkdownSummary is provided.
+func (p *Profiler) markdownSummary() {
+	if !p.summary {
+		return
+	}
+	path := filepath.Join(p.OutputDir(), SummaryFileName)
+	if err := writeFile(p.fs, path, []byte(p.renderSummary())); err != nil {
+		p.recordError(fmt.Errorf("failed to write summary: %w", err))
+		return
+	}
+	p.addArtifact(path)
+}
+
+// renderSummary renders the session as markdown, suitable for pasting
+// into an issue or pull request.
+func (p *Profiler) renderSummary() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "## Profiling summary: %s\n\n", p.profileMode)
+	if !p.startedAt.IsZero() {
+		fmt.Fprintf(&b, "Captured for %s from %s.\n\n", time.Since(p.startedAt).Round(time.Millisecond), p.startedAt.Format(time.RFC3339))
+	}
+	// The environment is unknown when reprocessing past artifacts.
+	if env := p.environment; env.GoVersion != "" {
+		b.WriteString("| Go | Platform | GOMAXPROCS | CPUs | CPU quota | GOGC | GOMEMLIMIT |\n| --- | --- | ---: | ---: | ---: | ---: | ---: |\n")
+		quota, gogc, limit := "none", "off", "none"
+		if env.CPUQuota > 0 {
+			quota = fmt.Sprintf("%.2f", env.CPUQuota)
+		}
+		if env.GOGC >= 0 {
+			gogc = fmt.Sprint(env.GOGC)
+		}
+		if env.GOMemLimit != math.MaxInt64 {
+			limit = formatBytes(env.GOMemLimit)
+		}
+		fmt.Fprintf(&b, "| %s | %s/%s | %d | %d | %s | %s | %s |\n", env.GoVersion, env.GOOS, env.GOARCH, env.GOMAXPROCS, env.NumCPU, quota, gogc, limit)
+		if env.GODEBUG != "" {
+			fmt.Fprintf(&b, "\nGODEBUG=`%s`\n", env.GODEBUG)
+		}
+		for _, warning := range env.Warnings(p.profileMode) {
+			fmt.Fprintf(&b, "\n> [!WARNING]\n> %s\n", warning)
+		}
+	}
+	if len(p.phases) > 0 {
+		b.WriteString("\n### Phases\n\n| Phase | Duration | CPU | Profile |\n| --- | ---: | ---: | --- |\n")
+		for _, stat := range p.phases {
+			fmt.Fprintf(&b, "| %s | %s | %s | `%s` |\n", stat.Name, stat.Duration.Round(time.Millisecond), stat.CPU.Round(time.Millisecond), filepath.Base(stat.Artifact))
+		}
+	}
+	var baseline *profile.Profile
+	if p.summaryBaseline != "" {
+		var err error
+		if baseline, err = ReadProfile(p.summaryBaseline); err != nil {
+			fmt.Fprintf(&b, "\nThe baseline `%s` could not be read: %s.\n", p.summaryBaseline, err)
+		}
+	}
+	for _, path := range p.ArtifactPaths() {
+		prof, err := readProfile(p.fs, path)
+		if err != nil {
+			// Execution traces and other artifacts are not profiles.
+			continue
+		}
+		if err := writeSummaryProfile(&b, filepath.Base(path), prof, baseline); err != nil {
+			fmt.Fprintf(&b, "\n### `%s`\n\nThe profile could not be summarised: %s.\n", filepath.Base(path), err)
+		}
+	}
+	return b.String()
+}
+
+// writeSummaryProfile writes the top functions of prof, compared with
+// baseline if it is not nil.
+func writeSummaryProfile(b *strings.Builder, name string, prof *profile.Profile, baseline *profile.Profile) error {
+	index := defaultSampleIndex(prof)
+	if index < 0 {
+		return errors.New("profile has no sample types")
+	}
+	sampleType := prof.SampleType[index]
+	format := formatSampleValue(sampleType.Unit)
+	top, err := TopFunctions(prof, sampleType.Type, summaryTop)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(b, "\n### `%s` top functions by %s\n\n", name, sampleType.Type)
+	if baseline == nil {
+		writeShareTable(b, top, format)
+		return nil
+	}
+	before, err := TopFunctions(baseline, sampleType.Type, math.MaxInt)
+	if err != nil {
+		fmt.Fprintf(b, "The baseline has no %s samples to compare with.\n\n", sampleType.Type)
+		writeShareTable(b, top, format)
+		return nil
+	}
+	flat := make(map[string]int64, len(before))
+	for _, s := range before {
+		flat[s.Name] = s.Flat
+	}
+	b.WriteString("| Function | Flat | Flat % | Baseline | Delta |\n| --- | ---: | ---: | ---: | ---: |\n")
+	for _, s := range top {
+		delta := "new"
+		if previous, ok := flat[s.Name]; ok {
+			delta = fmt.Sprintf("%+.1f%%", float64(s.Flat-previous)/float64(previous)*100)
+		}
+		fmt.Fprintf(b, "| `%s` | %s | %.1f%% | %s | %s |\n", s.Name, format(s.Flat), s.Share*100, format(flat[s.Name]), delta)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package profiler
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithMarkdownSummary(t *testing.T) {
+	dir := t.TempDir()
+	p, err := Capture(context.Background(), time.Millisecond, WithMode(GoroutineMode), WithMarkdownSummary(""), WithProfileFileLocation(dir), WithQuietOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, SummaryFileName)
+	assert.Contains(t, p.ArtifactPaths(), path)
+	summary, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Contains(t, string(summary), "## Profiling summary: goroutine")
+	assert.Contains(t, string(summary), "| "+p.Report().Environment.GoVersion+" |")
+	assert.Contains(t, string(summary), "### `goroutine.pprof` top functions by goroutine")
+}
+
+func TestWithMarkdownSummaryComparesBaseline(t *testing.T) {
+	baseline, err := Capture(context.Background(), time.Millisecond, WithMode(GoroutineMode), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	_, err = Capture(context.Background(), time.Millisecond, WithMode(GoroutineMode), WithMarkdownSummary(baseline.ArtifactPaths()[0]), WithProfileFileLocation(dir), WithQuietOutput())
+	if err != nil {
+		t.Fatal(err)
+	}
+	summary, err := os.ReadFile(filepath.Join(dir, SummaryFileName))
+	assert.NoError(t, err)
+	assert.Contains(t, string(summary), "| Function | Flat | Flat % | Baseline | Delta |")
+}
+
+func TestWriteSummaryProfileDeltas(t *testing.T) {
+	fn := func(id uint64, name string) *profile.Location {
+		return &profile.Location{ID: id, Line: []profile.Line{{Function: &profile.Function{ID: id, Name: name}}}}
+	}
+	sampleTypes := []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}}
+	work, cache := fn(1, "main.work"), fn(2, "main.cache")
+	baseline := &profile.Profile{SampleType: sampleTypes, Sample: []*profile.Sample{{Location: []*profile.Location{work}, Value: []int64{1024}}}}
+	current := &profile.Profile{SampleType: sampleTypes, Sample: []*profile.Sample{
+		{Location: []*profile.Location{work}, Value: []int64{1536}},
+		{Location: []*profile.Location{cache}, Value: []int64{512}},
+	}}
+	var b strings.Builder
+	assert.NoError(t, writeSummaryProfile(&b, "heap.pprof", current, baseline))
+	assert.Contains(t, b.String(), "| `main.work` | 1.5KiB | 75.0% | 1.0KiB | +50.0% |")
+	assert.Contains(t, b.String(), "| `main.cache` | 512B | 25.0% | 0B | new |")
+}
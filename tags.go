@@ -0,0 +1,64 @@
+package profiler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/google/pprof/profile"
+)
+
+// TagHeaderPrefix prefixes the header carrying each session tag on the
+// requests of an HTTPSink.
+const TagHeaderPrefix = "X-Profiler-Tag-"
+
+// tagsKey is the context key of the session tags.
+type tagsKey struct{}
+
+// withTags returns ctx carrying tags for sinks to index artifacts by.
+func withTags(ctx context.Context, tags map[string]string) context.Context {
+	if len(tags) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, tagsKey{}, tags)
+}
+
+// ContextTags returns the session tags, see WithTags, carried by the
+// context passed to Sink.Create so that custom sinks can include them in
+// their upload payloads.  The returned map must not be modified.
+func ContextTags(ctx context.Context) map[string]string {
+	tags, _ := ctx.Value(tagsKey{}).(map[string]string)
+	return tags
+}
+
+// copyTags returns a copy of tags, nil if there are none, so that the
+// tags of a session cannot be modified through a Report or Event.
+func copyTags(tags map[string]string) map[string]string {
+	if len(tags) == 0 {
+		return nil
+	}
+	copied := make(map[string]string, len(tags))
+	for key, value := range tags {
+		copied[key] = value
+	}
+	return copied
+}
+
+// sortedTags returns the tags formatted as key=value, sorted by key.
+func sortedTags(tags map[string]string) []string {
+	formatted := make([]string, 0, len(tags))
+	for key, value := range tags {
+		formatted = append(formatted, fmt.Sprintf("%s=%s", key, value))
+	}
+	sort.Strings(formatted)
+	return formatted
+}
+
+// tagProfile is a PostProcessor recording the session tags as comments
+// of the profile, which `go tool pprof -comments` displays.
+func (p *Profiler) tagProfile(prof *profile.Profile) (*profile.Profile, error) {
+	for _, tag := range sortedTags(p.tags) {
+		prof.Comments = append(prof.Comments, "tag "+tag)
+	}
+	return prof, nil
+}
@@ -0,0 +1,50 @@
+package profiler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTagsAreAttachedToArtifactsAndUploads(t *testing.T) {
+	var mu sync.Mutex
+	var headers []http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		headers = append(headers, r.Header.Clone())
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	tags := map[string]string{"service": "checkout", "version": "1.2.3"}
+	p, err := Capture(context.Background(), time.Millisecond, WithHeapProfiler(), WithTags(tags), WithHTTPUpload(server.URL), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.Equal(t, tags, p.Report().Tags)
+	p.Report().Tags["service"] = "modified"
+	assert.Equal(t, "checkout", p.Report().Tags["service"], "the report holds a copy of the tags")
+	var event Event
+	for event = range p.Events() {
+	}
+	assert.Equal(t, EventStopped, event.Type)
+	assert.Equal(t, tags, event.Tags)
+	assert.Equal(t, tags, event.Metadata().Tags)
+
+	prof, err := ReadProfile(p.ArtifactPaths()[0])
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tag service=checkout", "tag version=1.2.3"}, prof.Comments)
+
+	assert.Len(t, headers, 1)
+	assert.Equal(t, "checkout", headers[0].Get(TagHeaderPrefix+"service"))
+	assert.Equal(t, "1.2.3", headers[0].Get(TagHeaderPrefix+"version"))
+}
+
+func TestContextTags(t *testing.T) {
+	assert.Nil(t, ContextTags(context.Background()))
+	tags := map[string]string{"env": "prod"}
+	assert.Equal(t, tags, ContextTags(withTags(context.Background(), tags)))
+}
@@ -0,0 +1,79 @@
+package profiler
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+// TaskLabel is the pprof label key carried by the goroutine executing a
+// task of a TaskRunner, its value is the type of the task.
+const TaskLabel = "task"
+
+// TaskRunner instruments the tasks of a worker pool or job processor so
+// that the profiles of the process break down by task type, such as
+// "send_email" or "resize_image".  Each task runs with TaskLabel set to
+// its type, WithLabelBreakdown(TaskLabel) tabulates the share of each.
+// It is safe for concurrent use by every worker.
+type TaskRunner struct {
+	regions bool
+}
+
+// TaskOption configures a TaskRunner.
+type TaskOption func(*TaskRunner)
+
+// WithTaskRegions additionally records each task as a trace task named
+// by its type while an execution trace is running, so that `go tool
+// trace` reports the latency distribution of each type and the time of
+// a single task can be followed across the goroutines it starts.
+func WithTaskRegions() TaskOption {
+	return func(r *TaskRunner) {
+		r.regions = true
+	}
+}
+
+// NewTaskRunner returns a TaskRunner configured by options.
+func NewTaskRunner(options ...TaskOption) *TaskRunner {
+	r := &TaskRunner{}
+	for _, option := range options {
+		option(r)
+	}
+	return r
+}
+
+// Run runs fn as a task of taskType, returning its error.  The labels of
+// ctx, such as those of p.LabeledGo for the pool, are retained.
+func (r *TaskRunner) Run(ctx context.Context, taskType string, fn func(ctx context.Context) error) (err error) {
+	pprof.Do(ctx, pprof.Labels(TaskLabel, taskType), func(ctx context.Context) {
+		if !r.regions || !trace.IsEnabled() {
+			err = fn(ctx)
+			return
+		}
+		ctx, task := trace.NewTask(ctx, taskType)
+		defer task.End()
+		trace.WithRegion(ctx, taskType, func() {
+			err = fn(ctx)
+		})
+	})
+	return err
+}
+
+// Wrap returns fn as a task of taskType, for pools accepting
+// func(context.Context) error such as errgroup.
+func (r *TaskRunner) Wrap(taskType string, fn func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return r.Run(ctx, taskType, fn)
+	}
+}
+
+// Func returns fn as a task of taskType, for pools accepting func() such
+// as ants.  Having no context, the task carries TaskLabel alone and not
+// the labels of the goroutine executing it.
+func (r *TaskRunner) Func(taskType string, fn func()) func() {
+	return func() {
+		_ = r.Run(context.Background(), taskType, func(context.Context) error {
+			fn()
+			return nil
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"runtime/pprof"
+	"runtime/trace"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTaskRunnerLabelsTasks(t *testing.T) {
+	r := NewTaskRunner()
+	ctx := pprof.WithLabels(context.Background(), pprof.Labels("pool", "mailer"))
+	boom := errors.New("boom")
+	err := r.Run(ctx, "send_email", func(ctx context.Context) error {
+		task, _ := pprof.Label(ctx, TaskLabel)
+		pool, _ := pprof.Label(ctx, "pool")
+		assert.Equal(t, "send_email", task)
+		assert.Equal(t, "mailer", pool)
+		return boom
+	})
+	assert.ErrorIs(t, err, boom)
+}
+
+func TestTaskRunnerGoroutineBreakdown(t *testing.T) {
+	r := NewTaskRunner()
+	running, release := make(chan struct{}), make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		r.Func("resize_image", func() {
+			close(running)
+			<-release
+		})()
+	}()
+	<-running
+	var b bytes.Buffer
+	require.NoError(t, pprof.Lookup("goroutine").WriteTo(&b, 0))
+	close(release)
+	<-done
+
+	shares, err := BreakdownByLabel(&b, TaskLabel)
+	require.NoError(t, err)
+	var values []string
+	for _, share := range shares {
+		values = append(values, share.Value)
+	}
+	assert.Contains(t, values, "resize_image")
+}
+
+func TestTaskRunnerRegions(t *testing.T) {
+	r := NewTaskRunner(WithTaskRegions())
+	var b bytes.Buffer
+	require.NoError(t, trace.Start(&b))
+	err := r.Wrap("rebuild_index", func(context.Context) error { return nil })(context.Background())
+	trace.Stop()
+	assert.NoError(t, err)
+	assert.Contains(t, b.String(), "rebuild_index")
+
+	// Without a running trace the task simply runs.
+	ran := false
+	assert.NoError(t, r.Run(context.Background(), "rebuild_index", func(context.Context) error { ran = true; return nil }))
+	assert.True(t, ran)
+}
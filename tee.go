@@ -0,0 +1,79 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// teeWriter writes an artifact to its local file and simultaneously
+// streams it to each tee sink.  A failing sink is abandoned without
+// affecting the local file or the other sinks.
+type teeWriter struct {
+	p      *Profiler
+	local  io.WriteCloser
+	name   string
+	remote []io.WriteCloser
+}
+
+// tee wraps the local writer of the named artifact so that it is also
+// streamed to every sink configured with WithTee.
+func (p *Profiler) tee(local io.WriteCloser, name string) io.WriteCloser {
+	if len(p.tees) == 0 {
+		return local
+	}
+	t := &teeWriter{p: p, local: local, name: name}
+	for _, sink := range p.tees {
+		w, err := sink.Create(p.sinkContext(context.Background()), name)
+		if err != nil {
+			t.fail(err)
+			continue
+		}
+		t.remote = append(t.remote, w)
+	}
+	return t
+}
+
+// Write writes b to the local file, and then every healthy sink.
+func (t *teeWriter) Write(b []byte) (int, error) {
+	n, err := t.local.Write(b)
+	if err != nil {
+		return n, err
+	}
+	for i, w := range t.remote {
+		if w == nil {
+			continue
+		}
+		if _, err := w.Write(b); err != nil {
+			t.fail(err)
+			_ = w.Close()
+			t.remote[i] = nil
+		}
+	}
+	return n, nil
+}
+
+// Close closes the local file before the sinks, so that the local copy
+// is complete regardless of them.  Sink failures are recorded in the
+// report rather than returned.
+func (t *teeWriter) Close() error {
+	err := t.local.Close()
+	for _, w := range t.remote {
+		if w == nil {
+			continue
+		}
+		if closeErr := w.Close(); closeErr != nil {
+			t.fail(closeErr)
+		}
+	}
+	return err
+}
+
+// fail records that streaming the artifact to a sink failed.
+func (t *teeWriter) fail(err error) {
+	err = fmt.Errorf("failed to stream %s: %w", t.name, err)
+	t.p.report("[warning] %s, the local copy is retained", err)
+	t.p.recordError(err)
+	t.p.emit(EventUploadFailed, []string{t.name}, errors.Unwrap(err))
+}
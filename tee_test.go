@@ -0,0 +1,42 @@
+package profiler
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingWriterSink returns writers which fail to write.
+type failingWriterSink struct{}
+
+func (failingWriterSink) Create(context.Context, string) (io.WriteCloser, error) {
+	return failingWriter{}, nil
+}
+
+func TestTeeStreamsArtifacts(t *testing.T) {
+	sink := memorySink{}
+	p, err := Capture(context.Background(), 10*time.Millisecond, WithTracing(), WithTee(sink), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.NoError(t, err)
+	local, err := os.ReadFile(p.ArtifactPaths()[0])
+	assert.NoError(t, err)
+	assert.NotEmpty(t, local)
+	assert.Equal(t, local, sink[TraceFileName].Bytes())
+}
+
+func TestTeeFailureRetainsLocalCopy(t *testing.T) {
+	healthy := memorySink{}
+	p, err := Capture(context.Background(), 10*time.Millisecond, WithTracing(), WithTee(failingSink{}, failingWriterSink{}, healthy), WithProfileFileLocation(t.TempDir()), WithErrorHandler(func(error) {}), WithQuietOutput())
+	assert.NoError(t, err)
+	local, err := os.ReadFile(p.ArtifactPaths()[0])
+	assert.NoError(t, err)
+	assert.NotEmpty(t, local)
+	assert.Equal(t, local, healthy[TraceFileName].Bytes())
+	errs := p.Report().Errors
+	assert.Len(t, errs, 2)
+	assert.ErrorContains(t, errs[0], "unreachable")
+	assert.ErrorContains(t, errs[1], "disk full")
+}
@@ -0,0 +1,108 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// pendingCapture is a capture requested with RequestCapture, shared by
+// every request coalesced into it.
+type pendingCapture struct {
+	mode     Mode
+	done     chan struct{}
+	profiler *Profiler
+	err      error
+}
+
+// Ticket is a claim on the result of a capture requested with
+// RequestCapture.
+type Ticket struct {
+	capture *pendingCapture
+	// Coalesced is true when the request joined a capture which had
+	// already been requested rather than beginning a new one.
+	Coalesced bool
+}
+
+// Mode returns the mode of the capture.
+func (t Ticket) Mode() Mode {
+	return t.capture.mode
+}
+
+// Done is closed once the capture has stopped.
+func (t Ticket) Done() <-chan struct{} {
+	return t.capture.done
+}
+
+// Wait blocks until the capture has stopped, returning the stopped
+// *Profiler and the error of the capture, or until ctx is done.  Giving
+// up on a ticket does not cancel the capture, other requesters may still
+// be waiting on it.
+func (t Ticket) Wait(ctx context.Context) (*Profiler, error) {
+	select {
+	case <-t.capture.done:
+		return t.capture.profiler, t.capture.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// RequestCapture asks for spec to be captured in the background with the
+// options p was created with, it is safe to call from many goroutines,
+// for example from error handlers.  Requests for a mode which arrive while
+// a capture of that mode is pending are coalesced into it, so a burst of
+// requests produces a single capture whose result every requester can
+// wait on with its Ticket.  The capture is subject to the same rules as
+// Capture, a request for a different mode fails with ErrAlreadyStarted
+// while another capture is active unless WithExclusiveQueueing is provided.
+func (p *Profiler) RequestCapture(spec CaptureSpec) (Ticket, error) {
+	if spec.Duration <= 0 {
+		return Ticket{}, errors.New("capture duration must be positive")
+	}
+	if _, ok := StrategyMap[spec.Mode]; !ok {
+		return Ticket{}, fmt.Errorf("unknown profiler mode %s", spec.Mode)
+	}
+	p.requestMu.Lock()
+	defer p.requestMu.Unlock()
+	if pending, ok := p.requests[spec.Mode]; ok {
+		return Ticket{capture: pending, Coalesced: true}, nil
+	}
+	if p.requests == nil {
+		p.requests = make(map[Mode]*pendingCapture)
+	}
+	pending := &pendingCapture{mode: spec.Mode, done: make(chan struct{})}
+	p.requests[spec.Mode] = pending
+	p.goroutines.start(internal(func() error {
+		p.fulfil(pending, spec)
+		return nil
+	}), nil)
+	return Ticket{capture: pending}, nil
+}
+
+// fulfil performs the pending capture, releasing its requesters.
+func (p *Profiler) fulfil(pending *pendingCapture, spec CaptureSpec) {
+	defer close(pending.done)
+	if spec.Delay > 0 {
+		time.Sleep(spec.Delay)
+	}
+	options := append([]ProfileOption{}, p.options...)
+	options = append(options, WithMode(spec.Mode))
+	p.requestMu.Lock()
+	if p.outputDir != "" {
+		options = append(options, WithProfileFileLocation(p.outputDir))
+	}
+	p.requestMu.Unlock()
+	if spec.Output != "" {
+		options = append(options, WithProfileFileLocation(spec.Output))
+	}
+	if spec.Rates != (SamplingRates{}) {
+		options = append(options, WithSamplingRates(spec.Rates))
+	}
+	options = append(options, spec.Options...)
+	pending.profiler, pending.err = Capture(context.Background(), spec.Duration, options...)
+	// Requests arriving from here on begin a new capture.
+	p.requestMu.Lock()
+	delete(p.requests, spec.Mode)
+	p.requestMu.Unlock()
+}
@@ -0,0 +1,70 @@
+package profiler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestCaptureCoalescesConcurrentRequests(t *testing.T) {
+	p := New(WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	spec := CaptureSpec{Mode: GoroutineMode, Duration: 50 * time.Millisecond}
+
+	var wg sync.WaitGroup
+	tickets := make([]Ticket, 10)
+	for i := range tickets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ticket, err := p.RequestCapture(spec)
+			assert.NoError(t, err)
+			tickets[i] = ticket
+		}(i)
+	}
+	wg.Wait()
+
+	var coalesced int
+	var first *Profiler
+	for _, ticket := range tickets {
+		if ticket.Coalesced {
+			coalesced++
+		}
+		captured, err := ticket.Wait(context.Background())
+		assert.NoError(t, err)
+		if first == nil {
+			first = captured
+		}
+		assert.Same(t, first, captured)
+		assert.Equal(t, GoroutineMode, ticket.Mode())
+	}
+	assert.Equal(t, len(tickets)-1, coalesced)
+	assert.Len(t, first.ArtifactPaths(), 1)
+
+	// Once complete, a further request begins a new capture.
+	ticket, err := p.RequestCapture(spec)
+	assert.NoError(t, err)
+	assert.False(t, ticket.Coalesced)
+	<-ticket.Done()
+}
+
+func TestRequestCaptureRejectsInvalidSpecs(t *testing.T) {
+	p := New(WithQuietOutput())
+	_, err := p.RequestCapture(CaptureSpec{Mode: GoroutineMode})
+	assert.ErrorContains(t, err, "duration must be positive")
+	_, err = p.RequestCapture(CaptureSpec{Mode: Mode(-1), Duration: time.Second})
+	assert.ErrorContains(t, err, "unknown profiler mode")
+}
+
+func TestTicketWaitHonoursContext(t *testing.T) {
+	p := New(WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	ticket, err := p.RequestCapture(CaptureSpec{Mode: GoroutineMode, Duration: time.Second})
+	assert.NoError(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = ticket.Wait(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	<-ticket.Done()
+}
@@ -0,0 +1,111 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// ErrFinalizeTimeout is recorded when the finalizer of a strategy does
+// not complete within the timeout provided by WithFinalizeTimeout.
+var ErrFinalizeTimeout = errors.New("finalizer timed out")
+
+// completedArtifact marks an artifact as complete once it is closed.
+type completedArtifact struct {
+	io.WriteCloser
+	completed func()
+}
+
+// Close closes the artifact, marking it as complete if it closed
+// successfully.
+func (c *completedArtifact) Close() error {
+	if err := c.WriteCloser.Close(); err != nil {
+		return err
+	}
+	c.completed()
+	return nil
+}
+
+// markCompleted records that the artifact at path has been closed.
+func (p *Profiler) markCompleted(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.completed == nil {
+		p.completed = make(map[string]bool)
+	}
+	p.completed[path] = true
+}
+
+// finalize invokes the finalizer of the strategy.  When WithFinalizeTimeout
+// is provided a finalizer which hangs, such as on a stalled disk, is
+// abandoned after the timeout, the artifacts it completed are salvaged and
+// the remainder are reported as partial so that teardown can continue.
+// The session is released once the finalizer returns, an abandoned
+// finalizer holds it until it eventually does, so that the next session
+// does not capture alongside it.
+func (p *Profiler) finalize() error {
+	if p.finalizeTimeout <= 0 {
+		defer session.release(p)
+		return p.runFinalizer()
+	}
+	done := make(chan error, 1)
+	goInternal(func() {
+		defer session.release(p)
+		done <- p.runFinalizer()
+	})
+	timer := time.NewTimer(p.finalizeTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+	}
+	for _, path := range p.salvage() {
+		p.report("[warning] %s was not finalized within %s and is partial", path, p.finalizeTimeout)
+	}
+	return fmt.Errorf("%w after %s", ErrFinalizeTimeout, p.finalizeTimeout)
+}
+
+// runFinalizer invokes the finalizer of the strategy, closing the profile
+// file if it panics so that the file is not left open and unflushed.
+func (p *Profiler) runFinalizer() error {
+	err := guard("finalizer", p.finalizer)
+	var panicked *PanicError
+	if errors.As(err, &panicked) {
+		p.mu.Lock()
+		f := p.profileFile
+		p.mu.Unlock()
+		if f != nil {
+			// The finalizer may have closed it before panicking.
+			_ = f.Close()
+		}
+	}
+	return err
+}
+
+// salvage retains the completed artifacts, moving those which were not
+// completed to the partial artifacts, which are returned.
+func (p *Profiler) salvage() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var complete, partial []string
+	for _, path := range p.artifacts {
+		if p.completed[path] {
+			complete = append(complete, path)
+		} else {
+			partial = append(partial, path)
+		}
+	}
+	p.artifacts = complete
+	p.partial = append(p.partial, partial...)
+	return partial
+}
+
+// PartialArtifacts returns the artifacts abandoned incomplete when their
+// finalizer timed out, see WithFinalizeTimeout.
+func (p *Profiler) PartialArtifacts() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.partial...)
+}
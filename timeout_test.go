@@ -0,0 +1,94 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFinalizeTimeoutSalvagesCompletedArtifacts(t *testing.T) {
+	release := make(chan struct{})
+	// The allocs view of the memory profile stalls as it is written.
+	stall := func(prof *profile.Profile) (*profile.Profile, error) {
+		if prof.DefaultSampleType == "alloc_space" {
+			<-release
+		}
+		return prof, nil
+	}
+	var handled []error
+	dir := t.TempDir()
+	p := Start(
+		WithMemoryProfiler(),
+		WithProfileFileLocation(dir),
+		WithPostProcessor(stall),
+		WithFinalizeTimeout(100*time.Millisecond),
+		WithErrorHandler(func(err error) { handled = append(handled, err) }),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	p.Stop()
+	abs, err := filepath.Abs(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(abs, HeapFileName)}, p.ArtifactPaths())
+	assert.Equal(t, []string{filepath.Join(abs, AllocsFileName)}, p.PartialArtifacts())
+	assert.Equal(t, p.PartialArtifacts(), p.Report().Partial)
+	if assert.Len(t, handled, 1) {
+		assert.True(t, errors.Is(handled[0], ErrFinalizeTimeout))
+	}
+	close(release)
+	assert.Eventually(t, func() bool { return !session.owns(p) }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestFinalizeWithinTimeout(t *testing.T) {
+	p := Start(
+		WithHeapProfiler(),
+		WithProfileFileLocation(t.TempDir()),
+		WithFinalizeTimeout(time.Minute),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	p.Stop()
+	assert.Len(t, p.ArtifactPaths(), 1)
+	assert.Empty(t, p.PartialArtifacts())
+}
+
+func TestAbandonedFinalizerHoldsTheSession(t *testing.T) {
+	release := make(chan struct{})
+	stall := func(prof *profile.Profile) (*profile.Profile, error) {
+		<-release
+		return prof, nil
+	}
+	p := Start(
+		WithHeapProfiler(),
+		WithProfileFileLocation(t.TempDir()),
+		WithPostProcessor(stall),
+		WithFinalizeTimeout(50*time.Millisecond),
+		WithErrorHandler(func(error) {}),
+		WithoutSignalHandling(),
+		WithQuietOutput(),
+	)
+	p.Stop()
+	_, err := Capture(context.Background(), time.Millisecond, WithHeapProfiler(), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.ErrorIs(t, err, ErrAlreadyStarted)
+
+	close(release)
+	assert.Eventually(t, func() bool { return !session.owns(p) }, 5*time.Second, 10*time.Millisecond)
+	_, err = Capture(context.Background(), time.Millisecond, WithHeapProfiler(), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.NoError(t, err)
+}
+
+type failingCloser struct{ nopCloser }
+
+func (failingCloser) Close() error { return errors.New("disk full") }
+
+func TestFailedCloseIsNotCompleted(t *testing.T) {
+	var completed bool
+	c := &completedArtifact{WriteCloser: failingCloser{}, completed: func() { completed = true }}
+	assert.Error(t, c.Close())
+	assert.False(t, completed)
+}
@@ -0,0 +1,173 @@
+package profiler
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testPKI is a certificate authority issuing a server certificate for
+// 127.0.0.1 and a client certificate for "alice", written as PEM files.
+type testPKI struct {
+	ca, serverCert, serverKey, clientCert, clientKey string
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	dir := t.TempDir()
+	write := func(name string, block *pem.Block) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(block), 0600))
+		return path
+	}
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "profiler test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+	issue := func(name string, serial int64, usage x509.ExtKeyUsage) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		require.NoError(t, err)
+		return write(name+".pem", &pem.Block{Type: "CERTIFICATE", Bytes: der}), write(name+"-key.pem", &pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	}
+	pki := testPKI{ca: write("ca.pem", &pem.Block{Type: "CERTIFICATE", Bytes: caDER})}
+	pki.serverCert, pki.serverKey = issue("server", 2, x509.ExtKeyUsageServerAuth)
+	pki.clientCert, pki.clientKey = issue("alice", 3, x509.ExtKeyUsageClientAuth)
+	return pki
+}
+
+func TestAgentMutualTLS(t *testing.T) {
+	t.Setenv("GOPS_CONFIG_DIR", t.TempDir())
+	pki := newTestPKI(t)
+	server, err := ServerTLSConfig(pki.serverCert, pki.serverKey, pki.ca)
+	require.NoError(t, err)
+	var mu sync.Mutex
+	var requesters []string
+	audit := func(_ context.Context, entry AuditEntry) error {
+		mu.Lock()
+		defer mu.Unlock()
+		requesters = append(requesters, entry.Requester)
+		return nil
+	}
+	agent, err := StartAgent("127.0.0.1:0", WithAgentTLS(server), WithAuditHandler(audit), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	require.NoError(t, err)
+	defer agent.Close()
+	addr := agent.Addr().String()
+
+	client, err := ClientTLSConfig(pki.clientCert, pki.clientKey, pki.ca)
+	require.NoError(t, err)
+	require.NoError(t, AgentCaptureTLS(context.Background(), addr, MemoryHeapMode, io.Discard, client))
+	// The request is audited as it is received and once it is served.
+	require.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(requesters) == 2
+	}, 5*time.Second, 5*time.Millisecond)
+	mu.Lock()
+	for _, requester := range requesters {
+		assert.True(t, strings.HasPrefix(requester, "alice@127.0.0.1:"), requester)
+	}
+	mu.Unlock()
+
+	anonymous, err := ClientTLSConfig("", "", pki.ca)
+	require.NoError(t, err)
+	assert.Error(t, AgentCaptureTLS(context.Background(), addr, MemoryHeapMode, io.Discard, anonymous), "client certificates are required")
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	assert.Error(t, AgentCapture(ctx, addr, MemoryHeapMode, io.Discard), "plaintext is refused")
+}
+
+func TestHTTPSinkMutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+	var uploaded []string
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uploaded = append(uploaded, r.TLS.PeerCertificates[0].Subject.CommonName+" "+r.URL.Path)
+	}))
+	var err error
+	server.TLS, err = ServerTLSConfig(pki.serverCert, pki.serverKey, pki.ca)
+	require.NoError(t, err)
+	server.StartTLS()
+	defer server.Close()
+
+	client, err := ClientTLSConfig(pki.clientCert, pki.clientKey, pki.ca)
+	require.NoError(t, err)
+	sink := NewHTTPSink(server.URL, WithHTTPTLS(client))
+	w, err := sink.Create(context.Background(), "cpu.pprof")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("profile"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	assert.Equal(t, []string{"alice /cpu.pprof"}, uploaded)
+
+	anonymous, err := ClientTLSConfig("", "", pki.ca)
+	require.NoError(t, err)
+	w, err = NewHTTPSink(server.URL, WithHTTPTLS(anonymous), WithHTTPRetries(0, 0)).Create(context.Background(), "cpu.pprof")
+	require.NoError(t, err)
+	assert.Error(t, w.Close())
+}
+
+// roundTripperFunc is an http.RoundTripper which is not an *http.Transport.
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestHTTPSinkTLSRequiresTransport(t *testing.T) {
+	client := &http.Client{Transport: roundTripperFunc(http.DefaultTransport.RoundTrip)}
+	_, err := NewHTTPSink("https://localhost", WithHTTPClient(client), WithHTTPTLS(&tls.Config{})).Create(context.Background(), "cpu.pprof")
+	assert.ErrorContains(t, err, "an *http.Transport is required")
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	pki := newTestPKI(t)
+	_, err := ServerTLSConfig("missing.pem", "missing-key.pem", "")
+	assert.ErrorContains(t, err, "failed to load tls certificate")
+	_, err = ServerTLSConfig(pki.serverCert, pki.serverKey, pki.serverKey)
+	assert.ErrorContains(t, err, "no certificates found")
+	_, err = ClientTLSConfig(pki.clientCert, "", "")
+	assert.ErrorContains(t, err, "failed to load tls certificate")
+
+	config, err := ServerTLSConfig(pki.serverCert, pki.serverKey, "")
+	require.NoError(t, err)
+	assert.Equal(t, tls.NoClientCert, config.ClientAuth)
+}
@@ -0,0 +1,176 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/google/pprof/profile"
+)
+
+// FunctionShare is the share of a profile attributed to a function.
+type FunctionShare struct {
+	// Name is the name of the function.
+	Name string
+	// Flat is the sum of the samples in which the function was the leaf.
+	Flat int64
+	// Cum is the sum of the samples in which the function was on the
+	// stack.
+	Cum int64
+	// Share is the fraction (0 to 1) of the profile total that is flat.
+	Share float64
+	// CumShare is the fraction (0 to 1) of the profile total that is
+	// cumulative.
+	CumShare float64
+}
+
+// TopFunctions returns the n functions of prof with the largest flat
+// value of sampleType, such as "cpu" or "alloc_space", largest first.
+// Functions without a flat value are omitted.
+func TopFunctions(prof *profile.Profile, sampleType string, n int) ([]FunctionShare, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("the number of functions must not be negative, got %d", n)
+	}
+	shares, err := functionShares(prof, sampleType)
+	if err != nil {
+		return nil, err
+	}
+	top := shares[:0]
+	for _, s := range shares {
+		if s.Flat != 0 {
+			top = append(top, s)
+		}
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Flat != top[j].Flat {
+			return top[i].Flat > top[j].Flat
+		}
+		if top[i].Cum != top[j].Cum {
+			return top[i].Cum > top[j].Cum
+		}
+		return top[i].Name < top[j].Name
+	})
+	return top[:min(n, len(top))], nil
+}
+
+// TopCumulativeFunctions returns the n functions of prof with the largest
+// cumulative value of sampleType, largest first, showing the callers
+// responsible for the work beneath them.
+func TopCumulativeFunctions(prof *profile.Profile, sampleType string, n int) ([]FunctionShare, error) {
+	if n < 0 {
+		return nil, fmt.Errorf("the number of functions must not be negative, got %d", n)
+	}
+	top, err := functionShares(prof, sampleType)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Cum != top[j].Cum {
+			return top[i].Cum > top[j].Cum
+		}
+		if top[i].Flat != top[j].Flat {
+			return top[i].Flat > top[j].Flat
+		}
+		return top[i].Name < top[j].Name
+	})
+	return top[:min(n, len(top))], nil
+}
+
+// functionShares attributes the values of sampleType in prof to every
+// function on the stack of each sample, in no particular order.
+func functionShares(prof *profile.Profile, sampleType string) ([]FunctionShare, error) {
+	index := -1
+	for i, st := range prof.SampleType {
+		if st.Type == sampleType {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("profile has no %s samples", sampleType)
+	}
+	shares := make(map[string]*FunctionShare)
+	share := func(name string) *FunctionShare {
+		if _, ok := shares[name]; !ok {
+			shares[name] = &FunctionShare{Name: name}
+		}
+		return shares[name]
+	}
+	var total int64
+	for _, sample := range prof.Sample {
+		value := sample.Value[index]
+		total += value
+		seen := make(map[string]bool)
+		for i, name := range sampleFunctions(sample) {
+			if i == 0 {
+				share(name).Flat += value
+			}
+			// Recursive functions are only counted once per sample.
+			if !seen[name] {
+				share(name).Cum += value
+				seen[name] = true
+			}
+		}
+	}
+	all := make([]FunctionShare, 0, len(shares))
+	for _, s := range shares {
+		if total != 0 {
+			s.Share = float64(s.Flat) / float64(total)
+			s.CumShare = float64(s.Cum) / float64(total)
+		}
+		all = append(all, *s)
+	}
+	return all, nil
+}
+
+// WriteTop writes the n top functions of prof by the values of sampleType,
+// the default sample type if empty, as a text table in the style of
+// `go tool pprof -top`.  Functions are ordered by their flat value, or
+// by their cumulative value when cumulative is true.
+func WriteTop(w io.Writer, prof *profile.Profile, sampleType string, n int, cumulative bool) error {
+	index := defaultSampleIndex(prof)
+	if index < 0 {
+		return errors.New("profile has no sample types")
+	}
+	if sampleType == "" {
+		sampleType = prof.SampleType[index].Type
+	}
+	var unit string
+	for _, st := range prof.SampleType {
+		if st.Type == sampleType {
+			unit = st.Unit
+		}
+	}
+	topFunctions := TopFunctions
+	if cumulative {
+		topFunctions = TopCumulativeFunctions
+	}
+	top, err := topFunctions(prof, sampleType, n)
+	if err != nil {
+		return err
+	}
+	format := formatSampleValue(unit)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "flat\tflat%%\tsum%%\tcum\tcum%%\t\n")
+	var sum float64
+	for _, s := range top {
+		sum += s.Share
+		fmt.Fprintf(tw, "%s\t%.2f%%\t%.2f%%\t%s\t%.2f%%\t  %s\n", format(s.Flat), s.Share*100, sum*100, format(s.Cum), s.CumShare*100, s.Name)
+	}
+	return tw.Flush()
+}
+
+// sampleFunctions returns the function names of the stack of sample,
+// leaf first, inlined functions included.
+func sampleFunctions(sample *profile.Sample) []string {
+	var names []string
+	for _, location := range sample.Location {
+		for _, line := range location.Line {
+			if line.Function != nil {
+				names = append(names, line.Function.Name)
+			}
+		}
+	}
+	return names
+}
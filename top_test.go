@@ -0,0 +1,27 @@
+package profiler
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteTop(t *testing.T) {
+	var b strings.Builder
+	assert.NoError(t, WriteTop(&b, exportProfile(), "", 2, false))
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Regexp(t, `flat\s+flat%\s+sum%\s+cum\s+cum%`, lines[0])
+	assert.Regexp(t, `400ns\s+80.00%\s+80.00%\s+400ns\s+80.00%\s+main.work$`, lines[1])
+	assert.Regexp(t, `100ns\s+20.00%\s+100.00%\s+100ns\s+20.00%\s+main.idle$`, lines[2])
+
+	b.Reset()
+	assert.NoError(t, WriteTop(&b, exportProfile(), "samples", 1, true))
+	assert.Regexp(t, `0\s+0.00%\s+0.00%\s+5\s+100.00%\s+main.main`, b.String())
+
+	assert.Error(t, WriteTop(&b, exportProfile(), "alloc_space", 1, false))
+	assert.ErrorContains(t, WriteTop(&b, exportProfile(), "", -1, false), "must not be negative")
+	_, err := TopCumulativeFunctions(exportProfile(), "samples", -1)
+	assert.ErrorContains(t, err, "must not be negative")
+}
@@ -0,0 +1,149 @@
+package profiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Condition reports whether a capture should be triggered, along with a
+// description of why, it is polled by a Trigger.
+type Condition func() (bool, string)
+
+// Trigger captures a profile each time its Condition is met, so that
+// profiles are taken at exactly the moments they matter.
+type Trigger struct {
+	// Condition is polled every Interval.
+	Condition Condition
+	// Interval is how often the condition is polled, one second if zero.
+	Interval time.Duration
+	// Duration is how long each capture runs for, one second if zero.
+	Duration time.Duration
+	// Options configure each capture, such as its mode and location.
+	Options []ProfileOption
+	// Rates override the sampling rates of the runtime profilers for each
+	// capture, see WithSamplingRates.
+	Rates SamplingRates
+	// Cooldown is the minimum time between the start of captures, the
+	// condition being met again sooner is suppressed.
+	Cooldown time.Duration
+	// MaxPerHour caps the captures started in any rolling hour, no cap
+	// if zero.
+	MaxPerHour int
+}
+
+// debouncer coalesces the firings of a Trigger during a sustained
+// incident, so that profiling cannot amplify an ongoing outage.
+type debouncer struct {
+	cooldown   time.Duration
+	maxPerHour int
+	captures   []time.Time
+	suppressed int
+}
+
+// allow reports whether a firing at now may capture, otherwise it is
+// counted as suppressed and the reason is returned.
+func (d *debouncer) allow(now time.Time) (bool, string) {
+	for len(d.captures) > 0 && now.Sub(d.captures[0]) >= time.Hour {
+		d.captures = d.captures[1:]
+	}
+	if n := len(d.captures); n > 0 && d.cooldown > 0 && now.Sub(d.captures[n-1]) < d.cooldown {
+		d.suppressed++
+		return false, fmt.Sprintf("within the %s cooldown", d.cooldown)
+	}
+	if d.maxPerHour > 0 && len(d.captures) >= d.maxPerHour {
+		d.suppressed++
+		return false, fmt.Sprintf("the limit of %d captures per hour is reached", d.maxPerHour)
+	}
+	d.captures = append(d.captures, now)
+	return true, ""
+}
+
+// Watch polls the condition until ctx is done, capturing whenever it is
+// met.  It blocks, returning ctx.Err(), and is typically run in its own
+// goroutine.  Captures which fail, such as while another session is
+// active, are reported and do not stop the trigger.  Firings within the
+// Cooldown or beyond MaxPerHour are suppressed and logged.
+//
+// A Trigger without a Condition whose Options include
+// WithHeapTriggerPercent captures a heap profile each time the memory in
+// use crosses that percentage of the container memory limit.
+func (t Trigger) Watch(ctx context.Context) error {
+	reporter := New(t.Options...)
+	if reporter.heapTrigger {
+		percent := reporter.heapTriggerPercent
+		if !(percent > 0 && percent <= 100) {
+			return fmt.Errorf("heap trigger percent must be above 0 and at most 100, got %v", percent)
+		}
+		// The captures themselves are not heap triggers.
+		t.Options = append(append([]ProfileOption{}, t.Options...), withoutHeapTrigger())
+		if t.Condition == nil {
+			t.Condition = ContainerMemoryCondition(percent)
+			t.Options = append([]ProfileOption{WithHeapProfiler()}, t.Options...)
+		}
+	}
+	if t.Condition == nil {
+		return errors.New("trigger requires a condition")
+	}
+	// The goroutine watching is internal to the profiler for as long as
+	// it watches.
+	return internal(func() error { return t.watch(ctx, reporter) })()
+}
+
+// withoutHeapTrigger clears WithHeapTriggerPercent from the captures of
+// the Trigger it configures.
+func withoutHeapTrigger() ProfileOption {
+	return func(p *Profiler) {
+		p.heapTrigger = false
+	}
+}
+
+// watch polls the condition until ctx is done, reporting to reporter.
+func (t Trigger) watch(ctx context.Context, reporter *Profiler) error {
+	interval, duration := t.Interval, t.Duration
+	if interval <= 0 {
+		interval = time.Second
+	}
+	if duration <= 0 {
+		duration = time.Second
+	}
+	options := t.Options
+	if t.Rates != (SamplingRates{}) {
+		options = append(append([]ProfileOption{}, options...), WithSamplingRates(t.Rates))
+	}
+	debounce := &debouncer{cooldown: t.Cooldown, maxPerHour: t.MaxPerHour}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		met, reason := t.Condition()
+		if !met {
+			continue
+		}
+		if ok, why := debounce.allow(time.Now()); !ok {
+			// Only the first of a run of suppressed firings is logged,
+			// the remainder are counted on the next capture.
+			if debounce.suppressed == 1 {
+				reporter.report("triggered capture suppressed, %s: %s", why, reason)
+			}
+			continue
+		}
+		if debounce.suppressed > 0 {
+			reporter.report("capture triggered: %s (%d firings suppressed since the last capture)", reason, debounce.suppressed)
+			debounce.suppressed = 0
+		} else {
+			reporter.report("capture triggered: %s", reason)
+		}
+		if _, err := Capture(ctx, duration, options...); err != nil && ctx.Err() == nil {
+			reporter.report("[warning] triggered capture failed: %s", err)
+			if reporter.errorHandler != nil {
+				reporter.errorHandler(err)
+			}
+		}
+	}
+}
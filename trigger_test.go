@@ -0,0 +1,74 @@
+package profiler
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTriggerCapturesWhenConditionIsMet(t *testing.T) {
+	var polls atomic.Int32
+	captures := make(chan []string, 10)
+	trigger := Trigger{
+		Condition: func() (bool, string) { return polls.Add(1) == 2, "second poll" },
+		Interval:  5 * time.Millisecond,
+		Duration:  time.Millisecond,
+		Options: []ProfileOption{WithHeapProfiler(), WithProfileFileLocation(t.TempDir()), WithQuietOutput(), WithCallback(func(p *Profiler) {
+			captures <- p.ArtifactPaths()
+		})},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- trigger.Watch(ctx) }()
+	assert.Len(t, <-captures, 1)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+	assert.Empty(t, captures)
+}
+
+func TestTriggerRequiresCondition(t *testing.T) {
+	assert.Error(t, Trigger{}.Watch(context.Background()))
+}
+
+func TestDebouncerCooldownAndHourlyCap(t *testing.T) {
+	d := &debouncer{cooldown: time.Minute, maxPerHour: 2}
+	epoch := time.Now()
+	ok, _ := d.allow(epoch)
+	assert.True(t, ok)
+	ok, why := d.allow(epoch.Add(30 * time.Second))
+	assert.False(t, ok)
+	assert.Contains(t, why, "cooldown")
+	ok, _ = d.allow(epoch.Add(2 * time.Minute))
+	assert.True(t, ok)
+	ok, why = d.allow(epoch.Add(10 * time.Minute))
+	assert.False(t, ok)
+	assert.Contains(t, why, "2 captures per hour")
+	assert.Equal(t, 2, d.suppressed)
+	// The first capture falls out of the rolling hour.
+	ok, _ = d.allow(epoch.Add(time.Hour))
+	assert.True(t, ok)
+}
+
+func TestTriggerCooldownSuppressesFirings(t *testing.T) {
+	var polls atomic.Int32
+	var captures atomic.Int32
+	trigger := Trigger{
+		Condition: func() (bool, string) { polls.Add(1); return true, "always" },
+		Interval:  2 * time.Millisecond,
+		Duration:  time.Millisecond,
+		Cooldown:  time.Hour,
+		Options: []ProfileOption{WithHeapProfiler(), WithProfileFileLocation(t.TempDir()), WithQuietOutput(), WithCallback(func(p *Profiler) {
+			captures.Add(1)
+		})},
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- trigger.Watch(ctx) }()
+	assert.Eventually(t, func() bool { return polls.Load() > 10 }, 5*time.Second, time.Millisecond)
+	cancel()
+	<-done
+	assert.Equal(t, int32(1), captures.Load())
+}
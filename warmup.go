@@ -0,0 +1,52 @@
+package profiler
+
+import "time"
+
+// deferredStart is the outcome of a strategy started after a delay.
+type deferredStart struct {
+	finalizer FinalizerFunc
+	err       error
+}
+
+// deferStrategy starts next once d has elapsed, without blocking the
+// caller.  The returned finalizer finalizes next, if the session is
+// stopped before d elapses nothing is captured and a warning naming the
+// period is reported.
+func deferStrategy(p *Profiler, d time.Duration, period string, next func() (FinalizerFunc, error)) FinalizerFunc {
+	stop := make(chan struct{})
+	result := make(chan deferredStart, 1)
+	goInternal(func() {
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-stop:
+			result <- deferredStart{}
+			return
+		}
+		finalizer, err := next()
+		result <- deferredStart{finalizer: finalizer, err: err}
+	})
+	return func() error {
+		close(stop)
+		r := <-result
+		if r.err != nil {
+			return r.err
+		}
+		if r.finalizer == nil {
+			p.report("[warning] profiling was stopped during the %s %s period, nothing was captured", d, period)
+			return nil
+		}
+		return r.finalizer()
+	}
+}
+
+// warmupStrategy delays capture by the warmup period of the profiler.
+func warmupStrategy(capture StrategyFunc) StrategyFunc {
+	return func(p *Profiler) (FinalizerFunc, error) {
+		p.report("profiling will begin after a warmup of %s", p.warmup)
+		return deferStrategy(p, p.warmup, "warmup", func() (FinalizerFunc, error) {
+			return capture(p)
+		}), nil
+	}
+}
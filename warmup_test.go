@@ -0,0 +1,26 @@
+package profiler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarmupDelaysCapture(t *testing.T) {
+	var began time.Time
+	started := time.Now()
+	p, err := Capture(context.Background(), 100*time.Millisecond, WithHeapProfiler(), WithWarmup(30*time.Millisecond), WithBeforeCapture(func(Mode) { began = time.Now() }), WithProfileFileLocation(t.TempDir()), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.GreaterOrEqual(t, began.Sub(started), 30*time.Millisecond)
+	assert.Len(t, p.ArtifactPaths(), 1)
+	assert.Equal(t, 30*time.Millisecond, p.Report().Warmup)
+}
+
+func TestStopDuringWarmupCapturesNothing(t *testing.T) {
+	p, err := start(WithCPUProfiler(), WithWarmup(time.Hour), WithProfileFileLocation(t.TempDir()), WithoutSignalHandling(), WithQuietOutput())
+	assert.NoError(t, err)
+	assert.NoError(t, p.stop(false))
+	assert.Empty(t, p.ArtifactPaths())
+}
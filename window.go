@@ -0,0 +1,69 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// MergeOverlapping merges every profile named name (such as CPUFileName)
+// found beneath dir, typically the output of continuous profiling, whose
+// capture overlaps the wall clock window from to to and writes the merged
+// profile to w.  This allows incident response to zoom in on an anomaly,
+// "give me the captures covering 14:05 to 14:07".  Selection is of whole
+// profiles by the start time and duration recorded within them, samples
+// are not filtered as pprof samples carry no timestamps of their own, so a
+// capture partially within the window is included in full and the window
+// is only as precise as the captures are short.  Compressed profiles with
+// a further extension (name.gz) are included.  Files which cannot be read,
+// such as those compressed with zstd, are skipped rather than failing the
+// merge, the merge of the remainder is still written to w and the returned
+// error reports every file skipped.
+func MergeOverlapping(w io.Writer, dir string, name string, from time.Time, to time.Time) error {
+	if !from.Before(to) {
+		return errors.New("the window must end after it begins")
+	}
+	var profiles []*profile.Profile
+	var skipped []error
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		base := filepath.Base(path)
+		if d.IsDir() || (base != name && strings.TrimSuffix(base, filepath.Ext(base)) != name) {
+			return nil
+		}
+		prof, err := ReadProfile(path)
+		if err != nil {
+			skipped = append(skipped, fmt.Errorf("skipped %s: %w", path, err))
+			return nil
+		}
+		started := time.Unix(0, prof.TimeNanos)
+		stopped := started.Add(time.Duration(prof.DurationNanos))
+		if started.Before(to) && stopped.After(from) {
+			profiles = append(profiles, prof)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(profiles) == 0 {
+		err := fmt.Errorf("no %s profiles in %s overlap %s to %s", name, dir, from.Format(time.RFC3339), to.Format(time.RFC3339))
+		return errors.Join(append([]error{err}, skipped...)...)
+	}
+	merged, err := profile.Merge(profiles)
+	if err != nil {
+		return err
+	}
+	if err := merged.Write(w); err != nil {
+		return err
+	}
+	return errors.Join(skipped...)
+}
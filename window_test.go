@@ -0,0 +1,76 @@
+package profiler
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+)
+
+func writeChunk(t *testing.T, dir string, started time.Time, value int64) {
+	t.Helper()
+	fn := &profile.Function{ID: 1, Name: "work"}
+	location := &profile.Location{ID: 1, Line: []profile.Line{{Function: fn}}}
+	prof := &profile.Profile{
+		SampleType:    []*profile.ValueType{{Type: "cpu", Unit: "nanoseconds"}},
+		Sample:        []*profile.Sample{{Location: []*profile.Location{location}, Value: []int64{value}}},
+		Location:      []*profile.Location{location},
+		Function:      []*profile.Function{fn},
+		TimeNanos:     started.UnixNano(),
+		DurationNanos: time.Minute.Nanoseconds(),
+	}
+	folder := filepath.Join(dir, started.Format(cycleTimeFormat))
+	assert.NoError(t, os.MkdirAll(folder, 0o755))
+	f, err := os.Create(filepath.Join(folder, CPUFileName))
+	assert.NoError(t, err)
+	defer f.Close()
+	assert.NoError(t, prof.Write(f))
+}
+
+func TestMergeOverlapping(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		writeChunk(t, dir, base.Add(time.Duration(i)*time.Minute), int64(1)<<i)
+	}
+	var b bytes.Buffer
+	assert.NoError(t, MergeOverlapping(&b, dir, CPUFileName, base.Add(5*time.Minute), base.Add(7*time.Minute)))
+	merged, err := profile.Parse(&b)
+	assert.NoError(t, err)
+	assert.Len(t, merged.Sample, 1)
+	assert.Equal(t, int64(1<<5+1<<6), merged.Sample[0].Value[0])
+}
+
+func TestMergeOverlappingWithoutProfiles(t *testing.T) {
+	dir := t.TempDir()
+	writeChunk(t, dir, time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC), 1)
+	err := MergeOverlapping(&bytes.Buffer{}, dir, CPUFileName, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC), time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC))
+	assert.ErrorContains(t, err, "no cpu.pprof profiles")
+	assert.Error(t, MergeOverlapping(&bytes.Buffer{}, dir, CPUFileName, time.Now(), time.Now().Add(-time.Second)))
+}
+
+func TestMergeOverlappingSkipsUnreadableFiles(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 14, 0, 0, 0, time.UTC)
+	writeChunk(t, dir, base, 1)
+	writeChunk(t, dir, base.Add(time.Minute), 2)
+	corrupt := filepath.Join(dir, base.Format(cycleTimeFormat), CPUFileName+".zst")
+	assert.NoError(t, os.WriteFile(corrupt, []byte{0x28, 0xb5, 0x2f, 0xfd}, 0o644))
+
+	var b bytes.Buffer
+	err := MergeOverlapping(&b, dir, CPUFileName, base, base.Add(2*time.Minute))
+	assert.ErrorContains(t, err, "skipped "+corrupt)
+	merged, parseErr := profile.Parse(&b)
+	assert.NoError(t, parseErr, "the readable profiles are still merged")
+	assert.Equal(t, int64(3), merged.Sample[0].Value[0])
+
+	assert.NoError(t, os.RemoveAll(filepath.Join(dir, base.Add(time.Minute).Format(cycleTimeFormat))))
+	assert.NoError(t, os.Remove(filepath.Join(dir, base.Format(cycleTimeFormat), CPUFileName)))
+	err = MergeOverlapping(&bytes.Buffer{}, dir, CPUFileName, base, base.Add(2*time.Minute))
+	assert.ErrorContains(t, err, "no cpu.pprof profiles")
+	assert.ErrorContains(t, err, "skipped "+corrupt)
+}
@@ -0,0 +1,35 @@
+// Package wire provides a wire provider set for a running
+// profiler.Service.  It is a separate module so that the profiler itself
+// does not depend on github.com/google/wire.
+package wire
+
+import (
+	"context"
+
+	"github.com/google/wire"
+	"github.com/symonk/profiler"
+)
+
+// ProviderSet provides a started *profiler.Service from the
+// profiler.Config and context.Context of the injector, the cleanup
+// function returned by the injector stops it:
+//
+//	func initialize(ctx context.Context, config profiler.Config) (*App, func(), error) {
+//		wire.Build(profilerwire.ProviderSet, NewApp)
+//		return nil, nil, nil
+//	}
+var ProviderSet = wire.NewSet(NewService)
+
+// NewService starts a Service configured by config, ctx bounds only the
+// start up, see profiler.Service.Start.  The returned cleanup stops it.
+func NewService(ctx context.Context, config profiler.Config) (*profiler.Service, func(), error) {
+	options, err := config.Options()
+	if err != nil {
+		return nil, nil, err
+	}
+	svc := profiler.NewService(options...)
+	if err := svc.Start(ctx); err != nil {
+		return nil, nil, err
+	}
+	return svc, func() { _ = svc.Stop(context.Background()) }, nil
+}
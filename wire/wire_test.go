@@ -0,0 +1,23 @@
+package wire
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/symonk/profiler"
+)
+
+func TestNewService(t *testing.T) {
+	svc, cleanup, err := NewService(context.Background(), profiler.Config{Mode: "heap", OutputDir: t.TempDir(), Quiet: true})
+	require.NoError(t, err)
+	require.NotNil(t, svc.Profiler())
+	cleanup()
+	assert.Len(t, svc.Profiler().ArtifactPaths(), 1)
+}
+
+func TestNewServiceInvalidConfig(t *testing.T) {
+	_, _, err := NewService(context.Background(), profiler.Config{Mode: "bogus"})
+	assert.ErrorContains(t, err, `unknown profiler mode "bogus"`)
+}
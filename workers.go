@@ -0,0 +1,154 @@
+package profiler
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/google/pprof/profile"
+)
+
+// WorkerEnv is the environment variable which, when set along with
+// OutputDirEnv, writes the artifacts of the process into a folder named
+// after its PID beneath the output folder, see Workers.
+const WorkerEnv = "PROFILER_WORKER"
+
+// Folders of a session written by Workers.
+const (
+	// WorkersFolder is the folder beneath the session output folder the
+	// artifacts of workers are collected into, each in a pid-<pid> folder.
+	WorkersFolder = "workers"
+	// AggregateFolder is the folder beneath the session output folder the
+	// merged profiles of the session and its workers are written to.
+	AggregateFolder = "aggregate"
+)
+
+// workerFolder returns the folder of the process beneath dir.
+func workerFolder(dir string, pid int) string {
+	return filepath.Join(dir, fmt.Sprintf("pid-%d", pid))
+}
+
+// Workers coordinates the profiling of worker subprocesses, including
+// exec based plugins, with a session.  Each worker configured by Command
+// which imports this package writes its artifacts to
+// <output>/workers/pid-<pid>, where they can be merged with the profiles of
+// the session by Aggregate.
+//
+//	workers := p.Workers()
+//	cmd := exec.Command("./worker")
+//	workers.Command(cmd)
+type Workers struct {
+	dir string
+}
+
+// Workers returns the coordinator of the workers of the session.
+func (p *Profiler) Workers() *Workers {
+	return &Workers{dir: p.OutputDir()}
+}
+
+// Dir returns the folder the artifacts of workers are collected into.
+func (w *Workers) Dir() string {
+	return filepath.Join(w.dir, WorkersFolder)
+}
+
+// Command configures cmd, before it is started, to write the artifacts of
+// its sessions into a folder named after its PID.  The profiling of the
+// worker is configured as usual, an explicit WithProfileFileLocation
+// takes precedence.
+func (w *Workers) Command(cmd *exec.Cmd) {
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	// Later values take precedence over those inherited.
+	cmd.Env = append(env, OutputDirEnv+"="+w.Dir(), WorkerEnv+"=1")
+}
+
+// Aggregate merges the pprof profiles of the session and every worker
+// which share a name, such as cpu.pprof, into <output>/aggregate, once the
+// session and workers have stopped.  The paths of the merged profiles are
+// returned, profiles of a name which cannot be merged, such as profiles
+// with differing sampling rates, are reported in the error and the rest
+// are still merged.  Traces and other artifacts are not merged.
+func (w *Workers) Aggregate() ([]string, error) {
+	byName := make(map[string][]string)
+	collect := func(dir string) error {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			// Compressed profiles, such as cpu.pprof.gz, merge with the
+			// uncompressed profiles of the same name.
+			name, _, ok := strings.Cut(entry.Name(), ".pprof")
+			if !entry.IsDir() && ok {
+				byName[name+".pprof"] = append(byName[name+".pprof"], filepath.Join(dir, entry.Name()))
+			}
+		}
+		return nil
+	}
+	if err := collect(w.dir); err != nil {
+		return nil, err
+	}
+	workers, err := os.ReadDir(w.Dir())
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	for _, worker := range workers {
+		if worker.IsDir() && strings.HasPrefix(worker.Name(), "pid-") {
+			if err := collect(filepath.Join(w.Dir(), worker.Name())); err != nil {
+				return nil, err
+			}
+		}
+	}
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var merged []string
+	var errs []error
+	for _, name := range names {
+		path, err := w.merge(name, byName[name])
+		if err != nil {
+			errs = append(errs, fmt.Errorf("unable to aggregate %s: %w", name, err))
+			continue
+		}
+		merged = append(merged, path)
+	}
+	return merged, errors.Join(errs...)
+}
+
+// merge merges the profiles at paths into the aggregate folder.
+func (w *Workers) merge(name string, paths []string) (string, error) {
+	profiles := make([]*profile.Profile, 0, len(paths))
+	for _, path := range paths {
+		prof, err := ReadProfile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		profiles = append(profiles, prof)
+	}
+	prof, err := profile.Merge(profiles)
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(w.dir, AggregateFolder)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		return "", err
+	}
+	if err := prof.Write(f); err != nil {
+		return "", errors.Join(err, f.Close())
+	}
+	return path, f.Close()
+}
@@ -0,0 +1,102 @@
+package profiler
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/pprof/profile"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// workerHelperEnv runs TestWorkerHelperProcess as a worker.
+const workerHelperEnv = "PROFILER_TEST_WORKER"
+
+// TestWorkerHelperProcess is not a test, it is the worker subprocess of
+// TestWorkersCollectArtifactsOfChildren.
+func TestWorkerHelperProcess(t *testing.T) {
+	if os.Getenv(workerHelperEnv) == "" {
+		t.Skip("only run as a worker subprocess")
+	}
+	_, err := Capture(context.Background(), time.Millisecond, WithHeapProfiler(), WithQuietOutput())
+	require.NoError(t, err)
+}
+
+func TestWorkersCollectArtifactsOfChildren(t *testing.T) {
+	workers := New(WithProfileFileLocation(t.TempDir())).Workers()
+	var pids []int
+	for range 2 {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestWorkerHelperProcess$")
+		cmd.Env = append(os.Environ(), workerHelperEnv+"=1")
+		workers.Command(cmd)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+		pids = append(pids, cmd.ProcessState.Pid())
+	}
+	for _, pid := range pids {
+		assert.FileExists(t, filepath.Join(workers.Dir(), "pid-"+strconv.Itoa(pid), MemoryFileName))
+	}
+	merged, err := workers.Aggregate()
+	require.NoError(t, err)
+	assert.Equal(t, []string{filepath.Join(filepath.Dir(workers.Dir()), AggregateFolder, MemoryFileName)}, merged)
+}
+
+func TestNewWritesWorkerArtifactsPerPID(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv(OutputDirEnv, dir)
+	assert.Equal(t, dir, New().OutputDir())
+	t.Setenv(WorkerEnv, "1")
+	assert.Equal(t, filepath.Join(dir, "pid-"+strconv.Itoa(os.Getpid())), New().OutputDir())
+	assert.Equal(t, "elsewhere", New(WithProfileFileLocation("elsewhere")).OutputDir())
+}
+
+func TestWorkersCommandOverridesInheritedEnv(t *testing.T) {
+	workers := &Workers{dir: "session"}
+	cmd := exec.Command("worker")
+	cmd.Env = []string{OutputDirEnv + "=inherited"}
+	workers.Command(cmd)
+	assert.Equal(t, []string{OutputDirEnv + "=inherited", OutputDirEnv + "=" + filepath.Join("session", WorkersFolder), WorkerEnv + "=1"}, cmd.Env)
+}
+
+func TestWorkersAggregate(t *testing.T) {
+	dir := t.TempDir()
+	workers := &Workers{dir: dir}
+	for _, folder := range []string{"pid-1", "pid-2"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(workers.Dir(), folder), 0755))
+	}
+	labelledProfile(t, filepath.Join(dir, CPUFileName))
+	labelledProfile(t, filepath.Join(workers.Dir(), "pid-1", CPUFileName))
+	// Compressed profiles merge with those of the same name.
+	labelledProfile(t, filepath.Join(workers.Dir(), "pid-2", CPUFileName+".gz"))
+	// Profiles of differing types cannot be merged.
+	labelledProfile(t, filepath.Join(workers.Dir(), "pid-1", "block.pprof"))
+	heap := &profile.Profile{SampleType: []*profile.ValueType{{Type: "inuse_space", Unit: "bytes"}}}
+	var b bytes.Buffer
+	require.NoError(t, heap.Write(&b))
+	require.NoError(t, os.WriteFile(filepath.Join(workers.Dir(), "pid-2", "block.pprof"), b.Bytes(), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(workers.Dir(), "pid-2", TraceFileName), []byte("trace"), 0644))
+
+	merged, err := workers.Aggregate()
+	assert.ErrorContains(t, err, "unable to aggregate block.pprof")
+	require.Equal(t, []string{filepath.Join(dir, AggregateFolder, CPUFileName)}, merged)
+	prof, err := ReadProfile(merged[0])
+	require.NoError(t, err)
+	var total int64
+	for _, sample := range prof.Sample {
+		total += sample.Value[1]
+	}
+	// Each of the three profiles has 100 nanoseconds of cpu.
+	assert.Equal(t, int64(300), total)
+}
+
+func TestWorkersAggregateWithoutWorkers(t *testing.T) {
+	merged, err := (&Workers{dir: t.TempDir()}).Aggregate()
+	assert.NoError(t, err)
+	assert.Empty(t, merged)
+}
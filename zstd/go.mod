@@ -0,0 +1,15 @@
+module github.com/symonk/profiler/zstd
+
+go 1.22
+
+require (
+	github.com/klauspost/compress v1.17.11
+	github.com/symonk/profiler v0.0.0
+)
+
+require (
+	github.com/felixge/fgprof v0.9.5 // indirect
+	github.com/google/pprof v0.0.0-20241023014458-598669927662 // indirect
+)
+
+replace github.com/symonk/profiler => ../
@@ -0,0 +1,20 @@
+// Package zstd provides zstd compression for profiler artifacts.  It is
+// a separate module so that the profiler itself does not depend on
+// github.com/klauspost/compress.
+package zstd
+
+import (
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/symonk/profiler"
+)
+
+// Compression compresses artifacts with zstd, for use with the
+// profiler.WithCompression option and profiler.CompressedSink.
+var Compression = profiler.Compression{
+	Extension: ".zst",
+	NewWriter: func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w)
+	},
+}